@@ -0,0 +1,59 @@
+package bitempura
+
+import "time"
+
+// AsOfValidLocalTime allows reader to read as of a civil date and clock time in loc, such as 17:00 in New York.
+// Business valid times are usually expressed in local calendars. Civil times that do not exist or are ambiguous because
+// of daylight saving time transitions are resolved as by time.Date.
+func AsOfValidLocalTime(year int, month time.Month, day, hour, min, sec int, loc *time.Location) ReadOpt {
+	return AsOfValidTime(time.Date(year, month, day, hour, min, sec, 0, loc))
+}
+
+// AsOfValidEndOfDay allows reader to read as of the end of a civil date in loc, the last instant before the next day
+// starts there.
+func AsOfValidEndOfDay(year int, month time.Month, day int, loc *time.Location) ReadOpt {
+	return AsOfValidTime(endOfDay(year, month, day, loc))
+}
+
+// AsOfTransactionLocalTime allows reader to read as of a civil date and clock time in loc. See AsOfValidLocalTime.
+func AsOfTransactionLocalTime(year int, month time.Month, day, hour, min, sec int, loc *time.Location) ReadOpt {
+	return AsOfTransactionTime(time.Date(year, month, day, hour, min, sec, 0, loc))
+}
+
+// AsOfTransactionEndOfDay allows reader to read as of the end of a civil date in loc, the last instant before the next
+// day starts there.
+func AsOfTransactionEndOfDay(year int, month time.Month, day int, loc *time.Location) ReadOpt {
+	return AsOfTransactionTime(endOfDay(year, month, day, loc))
+}
+
+func endOfDay(year int, month time.Month, day int, loc *time.Location) time.Time {
+	return time.Date(year, month, day+1, 0, 0, 0, 0, loc).Add(-time.Nanosecond)
+}
+
+// AsOfValidAgo allows reader to read as of a valid time d before now, resolved against the DB's clock. It suits
+// monitoring jobs that always look a fixed window back.
+func AsOfValidAgo(d time.Duration) ReadOpt {
+	return func(os *ReadOptions) {
+		os.ValidTime, os.ValidTimeAgo, os.ValidTimeWindow = nil, &d, nil
+	}
+}
+
+// AsOfTransactionAgo allows reader to read as of a transaction time d before now, resolved against the DB's clock.
+func AsOfTransactionAgo(d time.Duration) ReadOpt {
+	return func(os *ReadOptions) {
+		os.TxTime, os.TxTimeAgo = nil, &d
+	}
+}
+
+// ResolveAgo converts relative times set by AsOfValidAgo and AsOfTransactionAgo to times before now. DBs call it with
+// their clock's time before reading ValidTime and TxTime.
+func (os *ReadOptions) ResolveAgo(now time.Time) {
+	if os.ValidTimeAgo != nil {
+		t := now.Add(-*os.ValidTimeAgo)
+		os.ValidTime, os.ValidTimeAgo = &t, nil
+	}
+	if os.TxTimeAgo != nil {
+		t := now.Add(-*os.TxTimeAgo)
+		os.TxTime, os.TxTimeAgo = &t, nil
+	}
+}
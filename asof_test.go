@@ -0,0 +1,105 @@
+package bitempura_test
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // for LoadLocation
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/elh/bitempura/dbtest/tt"
+	"github.com/elh/bitempura/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsOfLocal(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	require.Nil(t, err)
+
+	testCases := []struct {
+		desc        string
+		opt         ReadOpt
+		expectValid *time.Time
+		expectTx    *time.Time
+	}{
+		{
+			desc:        "valid local time",
+			opt:         AsOfValidLocalTime(2022, time.January, 3, 17, 0, 0, ny),
+			expectValid: timePtr(time.Date(2022, time.January, 3, 22, 0, 0, 0, time.UTC)),
+		},
+		{
+			desc:        "valid end of day",
+			opt:         AsOfValidEndOfDay(2022, time.January, 3, ny),
+			expectValid: timePtr(time.Date(2022, time.January, 4, 4, 59, 59, 999999999, time.UTC)),
+		},
+		{
+			desc:        "valid end of day before daylight saving time starts",
+			opt:         AsOfValidEndOfDay(2022, time.March, 12, ny),
+			expectValid: timePtr(time.Date(2022, time.March, 13, 4, 59, 59, 999999999, time.UTC)),
+		},
+		{
+			desc:        "valid end of day when daylight saving time starts",
+			opt:         AsOfValidEndOfDay(2022, time.March, 13, ny),
+			expectValid: timePtr(time.Date(2022, time.March, 14, 3, 59, 59, 999999999, time.UTC)),
+		},
+		{
+			desc:     "transaction local time",
+			opt:      AsOfTransactionLocalTime(2022, time.July, 1, 9, 30, 0, ny),
+			expectTx: timePtr(time.Date(2022, time.July, 1, 13, 30, 0, 0, time.UTC)),
+		},
+		{
+			desc:     "transaction end of day",
+			opt:      AsOfTransactionEndOfDay(2022, time.December, 31, time.UTC),
+			expectTx: timePtr(time.Date(2022, time.December, 31, 23, 59, 59, 999999999, time.UTC)),
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			options := ApplyReadOpts([]ReadOpt{tC.opt})
+			assertInstant(t, tC.expectValid, options.ValidTime)
+			assertInstant(t, tC.expectTx, options.TxTime)
+		})
+	}
+}
+
+func TestAsOfAgo(t *testing.T) {
+	c := clock.New(tt.Day(1))
+	db, err := memory.NewDB(memory.WithClock(c))
+	require.Nil(t, err)
+	require.Nil(t, db.Set("A", "Old"))
+	require.Nil(t, c.SetNow(tt.Day(2)))
+	require.Nil(t, db.Set("A", "New"))
+	require.Nil(t, c.SetNow(tt.Day(3)))
+
+	kv, err := db.Get("A", AsOfValidAgo(48*time.Hour))
+	require.Nil(t, err)
+	assert.Equal(t, "Old", kv.Value)
+	kv, err = db.Get("A", AsOfValidAgo(48*time.Hour), AsOfTransactionAgo(12*time.Hour))
+	require.Nil(t, err)
+	assert.Equal(t, "Old", kv.Value)
+	kv, err = db.Get("A", AsOfTransactionAgo(36*time.Hour))
+	require.Nil(t, err)
+	assert.Equal(t, "Old", kv.Value)
+	_, err = db.Get("A", AsOfValidAgo(72*time.Hour))
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// the last option applied wins
+	kv, err = db.Get("A", AsOfValidAgo(48*time.Hour), AsOfValidTime(tt.Day(2)))
+	require.Nil(t, err)
+	assert.Equal(t, "New", kv.Value)
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func assertInstant(t *testing.T, expected, actual *time.Time) {
+	t.Helper()
+	if expected == nil {
+		assert.Nil(t, actual)
+		return
+	}
+	require.NotNil(t, actual)
+	assert.True(t, expected.Equal(*actual), "expected %v, got %v", expected, actual)
+}
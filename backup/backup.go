@@ -0,0 +1,213 @@
+package backup
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	bt "github.com/elh/bitempura"
+)
+
+// historiesChunkSize is the number of keys whose histories Backup reads at a time, so it holds the versions of at most
+// that many keys in memory.
+const historiesChunkSize = 256
+
+// Backup writes every version of every key in db to w. Keys are enumerated with bt.KeyLister unless provided with
+// WithKeys. The returned Header's UntilTxTime can be used to resume with an incremental backup via Since.
+//
+// Histories are streamed to w a chunk of keys at a time. Since the header is written first, a first pass reads the
+// histories to find UntilTxTime. Versions written between the passes may be included in the backup with transaction
+// times after UntilTxTime; they are included again by the next incremental backup, and Merge deduplicates them.
+func Backup(w io.Writer, db bt.DB, opts ...Opt) (*Header, error) {
+	options := &backupOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	keys := options.keys
+	if keys == nil {
+		kl, ok := db.(bt.KeyLister)
+		if !ok {
+			return nil, errors.New("db does not implement bt.KeyLister. keys must be provided with WithKeys")
+		}
+		var err error
+		if keys, err = kl.Keys(); err != nil {
+			return nil, err
+		}
+	}
+
+	// find the high-water transaction time before writing the header
+	var until *time.Time
+	err := forEachChanged(db, keys, options.since, func(v *bt.VersionedKV) error {
+		until = maxTime(until, &v.TxTimeStart)
+		until = maxTime(until, v.TxTimeEnd)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	header := Header{
+		CreatedAt:   time.Now(),
+		SinceTxTime: options.since,
+		UntilTxTime: until,
+	}
+	bw, err := NewWriter(w, header, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := forEachChanged(db, keys, options.since, bw.Write); err != nil {
+		return nil, err
+	}
+	header.FormatVersion = FormatVersion
+	header.Compression = options.compression
+	header.Encrypted = options.encryptor != nil
+	return &header, nil
+}
+
+// forEachChanged calls fn with the versions of keys that changed since, reading histories a chunk of keys at a time.
+func forEachChanged(db bt.DB, keys []string, since *time.Time, fn func(*bt.VersionedKV) error) error {
+	for start := 0; start < len(keys); start += historiesChunkSize {
+		chunk := keys[start:]
+		if len(chunk) > historiesChunkSize {
+			chunk = chunk[:historiesChunkSize]
+		}
+		histories, err := bt.Histories(db, chunk)
+		if err != nil {
+			return err
+		}
+		for _, key := range chunk {
+			for _, v := range histories[key] {
+				if !changedSince(v, since) {
+					continue
+				}
+				if err := fn(v); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Restore reads the versioned key-values of a backup, calling fn with each in the order they were written. If fn
+// returns an error, Restore stops and returns it. Versions can be imported into a DB as they are read, e.g. with
+// bt.Importer. WithEncryptor is required to restore encrypted backups.
+func Restore(r io.Reader, fn func(*bt.VersionedKV) error, opts ...Opt) (*Header, error) {
+	br, err := NewReader(r, opts...)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		kv, err := br.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if err := fn(kv); err != nil {
+			return nil, err
+		}
+	}
+	header := br.Header()
+	return &header, nil
+}
+
+// RestoreAll reads all versioned key-values of a backup into memory. Versions can be seeded into a DB, e.g. with
+// memory.WithVersionedKVs. Incremental backups can be applied on top of a full backup with Merge. Use Restore for
+// backups too large to hold in memory.
+func RestoreAll(r io.Reader, opts ...Opt) (*Header, []*bt.VersionedKV, error) {
+	var kvs []*bt.VersionedKV
+	header, err := Restore(r, func(kv *bt.VersionedKV) error {
+		kvs = append(kvs, kv)
+		return nil
+	}, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return header, kvs, nil
+}
+
+// Merge applies incremental versions on top of base versions. Versions are identified by key, transaction time start,
+// and valid time start; incremental versions replace matching base versions (e.g. when they were later closed).
+func Merge(base, incremental []*bt.VersionedKV) []*bt.VersionedKV {
+	type id struct {
+		key            string
+		txTimeStart    time.Time
+		validTimeStart time.Time
+	}
+	idOf := func(v *bt.VersionedKV) id {
+		return id{v.Key, v.TxTimeStart.UTC(), v.ValidTimeStart.UTC()}
+	}
+
+	out := make([]*bt.VersionedKV, 0, len(base)+len(incremental))
+	idx := map[id]int{}
+	for _, kvs := range [][]*bt.VersionedKV{base, incremental} {
+		for _, kv := range kvs {
+			if i, ok := idx[idOf(kv)]; ok {
+				out[i] = kv
+				continue
+			}
+			idx[idOf(kv)] = len(out)
+			out = append(out, kv)
+		}
+	}
+	return out
+}
+
+// changedSince returns true if the version was created or closed at or after since. All versions are included if
+// since is nil.
+func changedSince(v *bt.VersionedKV, since *time.Time) bool {
+	if since == nil {
+		return true
+	}
+	return !v.TxTimeStart.Before(*since) || (v.TxTimeEnd != nil && !v.TxTimeEnd.Before(*since))
+}
+
+func maxTime(a, b *time.Time) *time.Time {
+	if b == nil || (a != nil && !b.After(*a)) {
+		return a
+	}
+	t := *b
+	return &t
+}
+
+// backupOptions is a struct for processing Opt's to be used by Backup
+type backupOptions struct {
+	keys        []string
+	since       *time.Time
+	encryptor   bt.Encryptor
+	compression Compression
+}
+
+// Opt is an option for Backup and Restore
+type Opt func(*backupOptions)
+
+// WithKeys configures the keys to back up. This is required for DBs that do not implement bt.KeyLister.
+func WithKeys(keys []string) Opt {
+	return func(os *backupOptions) {
+		os.keys = keys
+	}
+}
+
+// Since configures an incremental backup of versions created or closed at or after transaction time t.
+func Since(t time.Time) Opt {
+	return func(os *backupOptions) {
+		os.since = &t
+	}
+}
+
+// WithEncryptor configures encryption of values in backups, e.g. with bt.NewAESGCMEncryptor. Audit histories often
+// contain PII. Backups written with an Encryptor must be restored with one that can decrypt them.
+func WithEncryptor(e bt.Encryptor) Opt {
+	return func(os *backupOptions) {
+		os.encryptor = e
+	}
+}
+
+// WithCompression configures compression of values in backups.
+func WithCompression(c Compression) Opt {
+	return func(os *backupOptions) {
+		os.compression = c
+	}
+}
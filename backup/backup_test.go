@@ -0,0 +1,251 @@
+package backup_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/backup"
+	"github.com/elh/bitempura/clock"
+	"github.com/elh/bitempura/dbtest"
+	"github.com/elh/bitempura/dbtest/tt"
+	"github.com/elh/bitempura/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	t1 = tt.Day(1)
+	t2 = tt.Day(2)
+	t3 = tt.Day(3)
+	t4 = tt.Day(4)
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	clock := &clock.Clock{}
+	db, err := memory.NewDB(memory.WithClock(clock))
+	require.Nil(t, err)
+
+	require.Nil(t, clock.SetNow(t1))
+	require.Nil(t, db.Set("A", "Old"))
+	require.Nil(t, db.Set("B", "Old"))
+	require.Nil(t, clock.SetNow(t2))
+	require.Nil(t, db.Set("A", "New"))
+
+	var full bytes.Buffer
+	header, err := backup.Backup(&full, db)
+	require.Nil(t, err)
+	assert.Nil(t, header.SinceTxTime)
+	assert.Equal(t, t2, *header.UntilTxTime)
+
+	require.Nil(t, clock.SetNow(t3))
+	require.Nil(t, db.Delete("B"))
+	require.Nil(t, clock.SetNow(t4))
+	require.Nil(t, db.Set("C", "Old"))
+
+	var incremental bytes.Buffer
+	incHeader, err := backup.Backup(&incremental, db, backup.Since(*header.UntilTxTime))
+	require.Nil(t, err)
+	assert.Equal(t, t4, *incHeader.UntilTxTime)
+
+	_, fullKVs, err := backup.RestoreAll(&full)
+	require.Nil(t, err)
+	_, incKVs, err := backup.RestoreAll(&incremental)
+	require.Nil(t, err)
+	assert.Len(t, fullKVs, 4)
+	assert.Len(t, incKVs, 6, "incremental backup includes versions created or closed since t2")
+
+	restored, err := memory.NewDB(memory.WithVersionedKVs(backup.Merge(fullKVs, incKVs)))
+	require.Nil(t, err)
+	for _, key := range []string{"A", "B", "C"} {
+		expected, err := db.History(key)
+		require.Nil(t, err)
+		actual, err := restored.History(key)
+		require.Nil(t, err)
+		assert.ElementsMatch(t, summarize(expected), summarize(actual))
+	}
+}
+
+func TestBackup_Keys(t *testing.T) {
+	db, err := memory.NewDB()
+	require.Nil(t, err)
+	require.Nil(t, db.Set("A", "Old"))
+	require.Nil(t, db.Set("B", "Old"))
+
+	var buf bytes.Buffer
+	_, err = backup.Backup(&buf, struct{ bt.DB }{db})
+	require.NotNil(t, err, "keys are required when DB does not implement bt.KeyLister")
+
+	_, err = backup.Backup(&buf, struct{ bt.DB }{db}, backup.WithKeys([]string{"B"}))
+	require.Nil(t, err)
+	_, kvs, err := backup.RestoreAll(&buf)
+	require.Nil(t, err)
+	require.Len(t, kvs, 1)
+	assert.Equal(t, "B", kvs[0].Key)
+}
+
+func TestBackup_Encrypted(t *testing.T) {
+	db, err := memory.NewDB()
+	require.Nil(t, err)
+	require.Nil(t, db.Set("users/1", map[string]interface{}{"name": "Alice"}))
+	require.Nil(t, db.Set("users/1", map[string]interface{}{"name": "Alicia"}))
+
+	key := bytes.Repeat([]byte{1}, 32)
+	encryptor := bt.NewAESGCMEncryptor(func(string) ([]byte, error) { return key, nil })
+	var buf bytes.Buffer
+	header, err := backup.Backup(&buf, db, backup.WithEncryptor(encryptor))
+	require.Nil(t, err)
+	assert.True(t, header.Encrypted)
+	assert.NotContains(t, buf.String(), "Alice")
+	assert.Contains(t, buf.String(), "users/1")
+	b := buf.Bytes()
+
+	_, _, err = backup.RestoreAll(bytes.NewReader(b))
+	require.NotNil(t, err, "an Encryptor is required")
+	wrongKey := bt.NewAESGCMEncryptor(func(string) ([]byte, error) { return bytes.Repeat([]byte{2}, 32), nil })
+	_, _, err = backup.RestoreAll(bytes.NewReader(b), backup.WithEncryptor(wrongKey))
+	require.NotNil(t, err)
+
+	header, kvs, err := backup.RestoreAll(bytes.NewReader(b), backup.WithEncryptor(encryptor))
+	require.Nil(t, err)
+	assert.True(t, header.Encrypted)
+	expected, err := db.History("users/1")
+	require.Nil(t, err)
+	assert.ElementsMatch(t, summarize(expected), summarize(kvs))
+}
+
+func TestBackup_Compressed(t *testing.T) {
+	db, err := memory.NewDB()
+	require.Nil(t, err)
+	doc := strings.Repeat("near-identical large document ", 100)
+	for i := 0; i < 5; i++ {
+		require.Nil(t, db.Set("A", fmt.Sprintf("%v %v", doc, i)))
+	}
+	expected, err := db.History("A")
+	require.Nil(t, err)
+
+	var uncompressed bytes.Buffer
+	_, err = backup.Backup(&uncompressed, db)
+	require.Nil(t, err)
+
+	encryptor := bt.NewAESGCMEncryptor(func(string) ([]byte, error) { return bytes.Repeat([]byte{1}, 16), nil })
+	for _, c := range []backup.Compression{backup.CompressionSnappy, backup.CompressionZstd} {
+		for _, encrypted := range []bool{false, true} {
+			opts := []backup.Opt{backup.WithCompression(c)}
+			if encrypted {
+				opts = append(opts, backup.WithEncryptor(encryptor))
+			}
+			var buf bytes.Buffer
+			header, err := backup.Backup(&buf, db, opts...)
+			require.Nil(t, err)
+			assert.Equal(t, c, header.Compression)
+			assert.Less(t, buf.Len(), uncompressed.Len()/2, "%v, encrypted: %v", c, encrypted)
+
+			header, kvs, err := backup.RestoreAll(&buf, opts[1:]...)
+			require.Nil(t, err)
+			assert.Equal(t, c, header.Compression)
+			assert.ElementsMatch(t, summarize(expected), summarize(kvs))
+		}
+	}
+
+	var buf bytes.Buffer
+	_, err = backup.Backup(&buf, db, backup.WithCompression("lzma"))
+	require.NotNil(t, err)
+}
+
+func TestBackup_Streams(t *testing.T) {
+	db, err := memory.NewDB()
+	require.Nil(t, err)
+	// more keys than are read at a time
+	for i := 0; i < 600; i++ {
+		require.Nil(t, db.Set(fmt.Sprintf("%03d", i), i))
+	}
+	var buf bytes.Buffer
+	header, err := backup.Backup(&buf, db)
+	require.Nil(t, err)
+	b := buf.Bytes()
+
+	// versions are yielded as they are read, so a truncated backup yields the versions before the truncation
+	var keys []string
+	_, err = backup.Restore(bytes.NewReader(b[:len(b)-1]), func(kv *bt.VersionedKV) error {
+		keys = append(keys, kv.Key)
+		return nil
+	})
+	require.NotNil(t, err)
+	require.Len(t, keys, 599)
+	assert.Equal(t, "000", keys[0])
+
+	// errors of fn stop the restore
+	errStop := errors.New("stop")
+	n := 0
+	_, err = backup.Restore(bytes.NewReader(b), func(kv *bt.VersionedKV) error {
+		n++
+		if n == 10 {
+			return errStop
+		}
+		return nil
+	})
+	require.ErrorIs(t, err, errStop)
+	assert.Equal(t, 10, n)
+
+	restoredHeader, kvs, err := backup.RestoreAll(bytes.NewReader(b))
+	require.Nil(t, err)
+	assert.Len(t, kvs, 600)
+	assert.Equal(t, header.UntilTxTime, restoredHeader.UntilTxTime)
+}
+
+func TestRestore_Invalid(t *testing.T) {
+	_, _, err := backup.RestoreAll(bytes.NewBufferString("not a backup"))
+	require.NotNil(t, err)
+}
+
+// summarize versions for comparison independent of pointers and time representation
+func summarize(kvs []*bt.VersionedKV) []string {
+	var out []string
+	for _, kv := range kvs {
+		s := fmt.Sprintf("%v %v %v", kv.Value, kv.TxTimeStart.UTC(), kv.ValidTimeStart.UTC())
+		if kv.TxTimeEnd != nil {
+			s += fmt.Sprintf(" tx_end=%v", kv.TxTimeEnd.UTC())
+		}
+		if kv.ValidTimeEnd != nil {
+			s += fmt.Sprintf(" valid_end=%v", kv.ValidTimeEnd.UTC())
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func TestMigration(t *testing.T) {
+	seeded := dbtest.Backend{
+		Capabilities: []dbtest.Capability{dbtest.CapabilitySeed},
+		NewDB: func(kvs []*bt.VersionedKV, _ bt.Clock) (bt.DB, func(), error) {
+			db, err := memory.NewDB(memory.WithVersionedKVs(kvs))
+			return db, func() {}, err
+		},
+	}
+	replayed := dbtest.Backend{
+		Capabilities: []dbtest.Capability{dbtest.CapabilityWrite, dbtest.CapabilityClock},
+		NewDB: func(_ []*bt.VersionedKV, clock bt.Clock) (bt.DB, func(), error) {
+			db, err := memory.NewDB(memory.WithClock(clock))
+			return db, func() {}, err
+		},
+	}
+	export := func(db bt.DB, keys []string) ([]*bt.VersionedKV, error) {
+		var buf bytes.Buffer
+		if _, err := backup.Backup(&buf, db, backup.WithKeys(keys)); err != nil {
+			return nil, err
+		}
+		_, kvs, err := backup.RestoreAll(&buf)
+		return kvs, err
+	}
+
+	t.Run("seeded", func(t *testing.T) {
+		dbtest.TestMigration(t, seeded, seeded, export)
+	})
+	t.Run("replayed", func(t *testing.T) {
+		dbtest.TestMigration(t, seeded, replayed, export)
+	})
+}
@@ -0,0 +1,81 @@
+package backup
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is an algorithm for compressing values in backups and the file snapshots of cmd/bitempura, which are
+// saved in the backup format. Correction heavy histories store many near-identical values, so large values compress
+// well. sql.TableDB does not compress values, since they are stored as the SQL-queryable columns of an application
+// table.
+type Compression string
+
+// Compression algorithms.
+const (
+	CompressionNone   Compression = ""
+	CompressionSnappy Compression = "snappy" // fast, with a moderate ratio
+	CompressionZstd   Compression = "zstd"   // slower, with a better ratio
+)
+
+// zstd encoders and decoders are safe for concurrent use of EncodeAll and DecodeAll and are expensive to create.
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+func initZstd() error {
+	zstdOnce.Do(func() {
+		if zstdEncoder, zstdErr = zstd.NewWriter(nil); zstdErr != nil {
+			return
+		}
+		zstdDecoder, zstdErr = zstd.NewReader(nil)
+	})
+	return zstdErr
+}
+
+func (c Compression) validate() error {
+	switch c {
+	case CompressionNone, CompressionSnappy, CompressionZstd:
+		return nil
+	default:
+		return fmt.Errorf("unsupported compression: %v", c)
+	}
+}
+
+func (c Compression) compress(b []byte) ([]byte, error) {
+	switch c {
+	case CompressionNone:
+		return b, nil
+	case CompressionSnappy:
+		return snappy.Encode(nil, b), nil
+	case CompressionZstd:
+		if err := initZstd(); err != nil {
+			return nil, err
+		}
+		return zstdEncoder.EncodeAll(b, nil), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression: %v", c)
+	}
+}
+
+func (c Compression) decompress(b []byte) ([]byte, error) {
+	switch c {
+	case CompressionNone:
+		return b, nil
+	case CompressionSnappy:
+		return snappy.Decode(nil, b)
+	case CompressionZstd:
+		if err := initZstd(); err != nil {
+			return nil, err
+		}
+		return zstdDecoder.DecodeAll(b, nil)
+	default:
+		return nil, fmt.Errorf("unsupported compression: %v", c)
+	}
+}
@@ -0,0 +1,6 @@
+// Package backup defines a streaming backup format for bitempura DBs and helpers to back up and restore any backend.
+//
+// Format: the magic bytes "BTBK", then a length-prefixed JSON Header, then length-prefixed JSON versioned key-values.
+// Lengths are big-endian uint32s. The Header's FormatVersion describes the encoding of everything after it. Values of
+// compressed or encrypted backups are their JSON encoding, compressed and then encrypted, as base64 JSON strings.
+package backup
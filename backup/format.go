@@ -0,0 +1,203 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	bt "github.com/elh/bitempura"
+)
+
+// FormatVersion is the current format version written by Writer.
+const FormatVersion = 1
+
+var magic = []byte("BTBK")
+
+// maxRecordSize guards against allocating huge buffers for corrupt input.
+const maxRecordSize = 64 << 20
+
+// IsBackup returns whether b starts with the magic bytes of the backup format.
+func IsBackup(b []byte) bool {
+	return bytes.HasPrefix(b, magic)
+}
+
+// Header describes a backup.
+type Header struct {
+	FormatVersion int
+	CreatedAt     time.Time
+	// SinceTxTime is set for incremental backups. Only versions created or closed at or after it are included.
+	SinceTxTime *time.Time
+	// UntilTxTime is the highest transaction time (start or end) of any version in the backup. Pass it as the since time
+	// of the next incremental backup to resume.
+	UntilTxTime *time.Time
+	// Compression of values, if set. Each version's value is its compressed JSON encoding.
+	Compression Compression
+	// Encrypted is set if values are encrypted. Each version's value is the ciphertext of its JSON encoding, compressed
+	// first if Compression is set. Keys and times are not encrypted.
+	Encrypted bool
+}
+
+// encodedRecord is the record of a versioned key-value in a compressed or encrypted backup. Value shadows the embedded
+// Value.
+type encodedRecord struct {
+	bt.VersionedKV
+	Value []byte
+}
+
+// NewWriter writes the header and returns a Writer for versioned key-values. Values are compressed if WithCompression is
+// set and encrypted if WithEncryptor is set.
+func NewWriter(w io.Writer, header Header, opts ...Opt) (*Writer, error) {
+	options := &backupOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	header.FormatVersion = FormatVersion
+	header.Compression = options.compression
+	header.Encrypted = options.encryptor != nil
+	if err := options.compression.validate(); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(magic); err != nil {
+		return nil, err
+	}
+	bw := &Writer{w: w, compression: options.compression, encryptor: options.encryptor}
+	if err := bw.writeRecord(header); err != nil {
+		return nil, err
+	}
+	return bw, nil
+}
+
+// Writer streams versioned key-values in the backup format.
+type Writer struct {
+	w           io.Writer
+	compression Compression
+	encryptor   bt.Encryptor
+}
+
+// Write writes a single versioned key-value.
+func (w *Writer) Write(kv *bt.VersionedKV) error {
+	if w.compression == CompressionNone && w.encryptor == nil {
+		return w.writeRecord(kv)
+	}
+	b, err := json.Marshal(kv.Value)
+	if err != nil {
+		return err
+	}
+	if b, err = w.compression.compress(b); err != nil {
+		return err
+	}
+	if w.encryptor != nil {
+		if b, err = w.encryptor.Encrypt(kv.Key, b); err != nil {
+			return fmt.Errorf("failed to encrypt key=%v: %w", kv.Key, err)
+		}
+	}
+	return w.writeRecord(&encodedRecord{VersionedKV: *kv, Value: b})
+}
+
+func (w *Writer) writeRecord(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(b)))
+	if _, err := w.w.Write(size[:]); err != nil {
+		return err
+	}
+	_, err = w.w.Write(b)
+	return err
+}
+
+// NewReader reads the header and returns a Reader for versioned key-values. WithEncryptor is required to read encrypted
+// backups.
+func NewReader(r io.Reader, opts ...Opt) (*Reader, error) {
+	options := &backupOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	br := &Reader{r: bufio.NewReader(r), encryptor: options.encryptor}
+	m := make([]byte, len(magic))
+	if _, err := io.ReadFull(br.r, m); err != nil {
+		return nil, fmt.Errorf("failed to read magic bytes: %v", err)
+	}
+	if string(m) != string(magic) {
+		return nil, errors.New("not a bitempura backup")
+	}
+	if err := br.readRecord(&br.header); err != nil {
+		return nil, fmt.Errorf("failed to read header: %v", err)
+	}
+	if br.header.FormatVersion != FormatVersion {
+		return nil, fmt.Errorf("unsupported format version: %v", br.header.FormatVersion)
+	}
+	if br.header.Encrypted && br.encryptor == nil {
+		return nil, errors.New("backup is encrypted. an Encryptor is required")
+	}
+	if err := br.header.Compression.validate(); err != nil {
+		return nil, err
+	}
+	return br, nil
+}
+
+// Reader streams versioned key-values from the backup format.
+type Reader struct {
+	r         *bufio.Reader
+	header    Header
+	encryptor bt.Encryptor
+}
+
+// Header returns the backup's header.
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// Next returns the next versioned key-value. It returns io.EOF when there are no more.
+func (r *Reader) Next() (*bt.VersionedKV, error) {
+	if r.header.Compression == CompressionNone && !r.header.Encrypted {
+		var kv bt.VersionedKV
+		if err := r.readRecord(&kv); err != nil {
+			return nil, err
+		}
+		return &kv, nil
+	}
+	var rec encodedRecord
+	if err := r.readRecord(&rec); err != nil {
+		return nil, err
+	}
+	b := rec.Value
+	if r.header.Encrypted {
+		var err error
+		if b, err = r.encryptor.Decrypt(rec.Key, b); err != nil {
+			return nil, fmt.Errorf("failed to decrypt key=%v: %w", rec.Key, err)
+		}
+	}
+	b, err := r.header.Compression.decompress(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress key=%v: %w", rec.Key, err)
+	}
+	kv := rec.VersionedKV
+	if err := json.Unmarshal(b, &kv.Value); err != nil {
+		return nil, err
+	}
+	return &kv, nil
+}
+
+func (r *Reader) readRecord(v interface{}) error {
+	var size [4]byte
+	if _, err := io.ReadFull(r.r, size[:]); err != nil {
+		return err // io.EOF only if cleanly at a record boundary
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > maxRecordSize {
+		return fmt.Errorf("record size %v exceeds maximum", n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,50 @@
+package bitempura
+
+import "errors"
+
+// BatchWrite is a Set or Delete in a WriteBatch.
+type BatchWrite struct {
+	Key    string
+	Value  Value // nil for Delete
+	Delete bool
+	Opts   []WriteOpt
+}
+
+// WriteBatch is a sequence of Sets and Deletes of different keys that are applied atomically at a single transaction
+// time. A batch may write each key at most once, since a later write to a key would close the versions of an earlier
+// one at the transaction time they started. See ApplyBatch.
+type WriteBatch struct {
+	Writes []BatchWrite
+}
+
+// Set adds a Set of value to key (with optional start and end valid time) to the batch.
+func (b *WriteBatch) Set(key string, value Value, opts ...WriteOpt) {
+	b.Writes = append(b.Writes, BatchWrite{Key: key, Value: value, Opts: opts})
+}
+
+// Delete adds a Delete of key (with optional start and end valid time) to the batch.
+func (b *WriteBatch) Delete(key string, opts ...WriteOpt) {
+	b.Writes = append(b.Writes, BatchWrite{Key: key, Delete: true, Opts: opts})
+}
+
+// Len returns the number of writes in the batch.
+func (b *WriteBatch) Len() int {
+	return len(b.Writes)
+}
+
+// BatchWriter is implemented by DBs that can apply a WriteBatch atomically.
+type BatchWriter interface {
+	// WriteBatch applies the writes of b in order with a single transaction time. It fails without applying any of
+	// them if one fails. It fails with an error wrapping ErrInvalidWrite if b writes a key more than once.
+	WriteBatch(b *WriteBatch) error
+}
+
+// ApplyBatch applies the writes of b to db atomically with a single transaction time. db must be a BatchWriter since
+// applying the writes one by one would be neither.
+func ApplyBatch(db DB, b *WriteBatch) error {
+	bw, ok := db.(BatchWriter)
+	if !ok {
+		return errors.New("DB does not support write batches")
+	}
+	return bw.WriteBatch(b)
+}
@@ -0,0 +1,27 @@
+package bitempura
+
+import (
+	"math"
+	"time"
+)
+
+// BeginningOfTime is the valid time start of facts that have been valid since forever, such as facts whose historical
+// onset is unknown. Write them WithValidTime(BeginningOfTime) instead of picking an arbitrary early date. Reads as of any
+// valid time before BeginningOfTime are read as of BeginningOfTime, so such facts are found at every valid time.
+//
+// BeginningOfTime is the earliest time representable as unix nanoseconds (1677-09-21T00:12:43.145224192Z). It is only
+// supported as a valid time start.
+var BeginningOfTime = time.Unix(0, math.MinInt64).UTC()
+
+// ClampValidTime returns BeginningOfTime if valid time t is before it and t otherwise. DBs call it on read valid times.
+func ClampValidTime(t time.Time) time.Time {
+	if t.Before(BeginningOfTime) {
+		return BeginningOfTime
+	}
+	return t
+}
+
+// ValidSinceBeginning returns whether the version has been valid since BeginningOfTime.
+func (d *VersionedKV) ValidSinceBeginning() bool {
+	return d.ValidTimeStart.Equal(BeginningOfTime)
+}
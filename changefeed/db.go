@@ -0,0 +1,113 @@
+package changefeed
+
+import (
+	"sync"
+	"time"
+
+	bt "github.com/elh/bitempura"
+)
+
+var _ bt.DB = (*DB)(nil)
+
+// Op is the type of write that produced an Event.
+type Op string
+
+// Ops
+const (
+	OpSet    Op = "set"
+	OpDelete Op = "delete"
+)
+
+// Event describes the versions created and closed by a single write.
+type Event struct {
+	Key     string
+	Op      Op
+	TxTime  time.Time         // transaction time of the write
+	Created []*bt.VersionedKV // versions created by the write, including overhangs re-asserting old values
+	Closed  []*bt.VersionedKV // versions whose transaction time was ended by the write
+}
+
+// NewDB wraps a DB so every successful write through it emits an Event to subscribers. Writes made to the underlying
+// DB directly are not observed.
+func NewDB(db bt.DB) *DB {
+	return &DB{DB: db, subscribers: map[int]func(Event){}}
+}
+
+// DB is a DB that emits change events. Reads are passed through to the underlying DB.
+type DB struct {
+	bt.DB
+	writeM      sync.Mutex // serialize writes so before and after histories are attributable to a single write
+	subM        sync.RWMutex
+	subscribers map[int]func(Event)
+	nextID      int
+}
+
+// Subscribe registers fn to be called with every Event. Subscribers are called synchronously and in order after the
+// write completes, so they should be fast or hand events off. The returned function cancels the subscription.
+func (db *DB) Subscribe(fn func(Event)) (cancel func()) {
+	db.subM.Lock()
+	defer db.subM.Unlock()
+	id := db.nextID
+	db.nextID++
+	db.subscribers[id] = fn
+	return func() {
+		db.subM.Lock()
+		defer db.subM.Unlock()
+		delete(db.subscribers, id)
+	}
+}
+
+// Set stores value (with optional start and end valid time).
+func (db *DB) Set(key string, value bt.Value, opts ...bt.WriteOpt) error {
+	return db.write(key, OpSet, func() (*bt.WriteResult, error) { return bt.SetWithResult(db.DB, key, value, opts...) })
+}
+
+// Delete removes value (with optional start and end valid time).
+func (db *DB) Delete(key string, opts ...bt.WriteOpt) error {
+	return db.write(key, OpDelete, func() (*bt.WriteResult, error) { return bt.DeleteWithResult(db.DB, key, opts...) })
+}
+
+// write applies fn and emits the Event of its result. If the underlying DB is not a bt.ResultWriter, the result is found
+// by comparing the key's history before and after the write.
+func (db *DB) write(key string, op Op, fn func() (*bt.WriteResult, error)) error {
+	db.writeM.Lock()
+	defer db.writeM.Unlock()
+
+	result, err := fn()
+	if err != nil {
+		return err
+	}
+	if result.TxTime.IsZero() {
+		return nil
+	}
+	e := eventOf(key, op, result)
+	db.subM.RLock()
+	defer db.subM.RUnlock()
+	for id := 0; id < db.nextID; id++ { // in subscription order
+		if fn, ok := db.subscribers[id]; ok {
+			fn(e)
+		}
+	}
+	return nil
+}
+
+// eventOf returns the Event for a write's result. Event versions are copies so they are safe to hand off while the
+// underlying DB mutates its versions.
+func eventOf(key string, op Op, result *bt.WriteResult) Event {
+	e := Event{Key: key, Op: op, TxTime: result.TxTime}
+	if result.Created != nil {
+		e.Created = append(e.Created, copyOf(result.Created))
+	}
+	for _, v := range result.Overhangs {
+		e.Created = append(e.Created, copyOf(v))
+	}
+	for _, v := range result.Closed {
+		e.Closed = append(e.Closed, copyOf(v))
+	}
+	return e
+}
+
+func copyOf(v *bt.VersionedKV) *bt.VersionedKV {
+	cp := *v
+	return &cp
+}
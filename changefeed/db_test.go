@@ -0,0 +1,121 @@
+package changefeed_test
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/changefeed"
+	"github.com/elh/bitempura/clock"
+	"github.com/elh/bitempura/dbtest/tt"
+	"github.com/elh/bitempura/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	t1 = tt.Day(1)
+	t2 = tt.Day(2)
+	t3 = tt.Day(3)
+)
+
+func TestDB(t *testing.T) {
+	clock := &clock.Clock{}
+	mdb, err := memory.NewDB(memory.WithClock(clock))
+	require.Nil(t, err)
+	db := changefeed.NewDB(mdb)
+
+	var events []changefeed.Event
+	cancel := db.Subscribe(func(e changefeed.Event) {
+		events = append(events, e)
+	})
+
+	require.Nil(t, clock.SetNow(t1))
+	require.Nil(t, db.Set("A", "Old"))
+	require.Nil(t, clock.SetNow(t3))
+	require.Nil(t, db.Set("A", "New", bt.WithValidTime(t2)))
+	require.NotNil(t, db.Set("", "New"))
+	require.Nil(t, db.Delete("B")) // no-op
+
+	require.Len(t, events, 2)
+	assert.Equal(t, changefeed.OpSet, events[0].Op)
+	assert.Equal(t, t1, events[0].TxTime)
+	assert.Len(t, events[0].Created, 1)
+	assert.Len(t, events[0].Closed, 0)
+	assert.Equal(t, t3, events[1].TxTime)
+	assert.Len(t, events[1].Created, 2) // new value and overhang re-asserting old value
+	require.Len(t, events[1].Closed, 1)
+	assert.Equal(t, "Old", events[1].Closed[0].Value)
+
+	cancel()
+	require.Nil(t, db.Delete("A"))
+	assert.Len(t, events, 2)
+}
+
+func TestDBSameTxTime(t *testing.T) {
+	for _, tC := range []struct {
+		desc string
+		wrap func(db *memory.DB) bt.DB
+	}{
+		{desc: "ResultWriter", wrap: func(db *memory.DB) bt.DB { return db }},
+		{desc: "history fallback", wrap: func(db *memory.DB) bt.DB { return struct{ bt.DB }{db} }},
+	} {
+		t.Run(tC.desc, func(t *testing.T) {
+			mdb, err := memory.NewDB(memory.WithClock(clock.New(t1)))
+			require.Nil(t, err)
+			db := changefeed.NewDB(tC.wrap(mdb))
+			var events []changefeed.Event
+			db.Subscribe(func(e changefeed.Event) {
+				events = append(events, e)
+			})
+
+			require.Nil(t, db.Set("A", 1))
+			require.Nil(t, db.Set("A", 2))
+			require.Len(t, events, 2)
+			require.Len(t, events[1].Created, 1)
+			assert.Equal(t, 2, events[1].Created[0].Value)
+			require.Len(t, events[1].Closed, 1)
+			assert.Equal(t, 1, events[1].Closed[0].Value)
+		})
+	}
+}
+
+func TestPublisher(t *testing.T) {
+	clock := &clock.Clock{}
+	mdb, err := memory.NewDB(memory.WithClock(clock))
+	require.Nil(t, err)
+	db := changefeed.NewDB(mdb)
+
+	var m sync.Mutex
+	var topics, keys []string
+	var errCount int
+	p := changefeed.NewPublisher(db, changefeed.PublisherFunc(func(topic string, key, value []byte) error {
+		m.Lock()
+		defer m.Unlock()
+		var e changefeed.Event
+		if err := json.Unmarshal(value, &e); err != nil {
+			return err
+		}
+		if e.Op == changefeed.OpDelete {
+			return errors.New("publish failed")
+		}
+		topics = append(topics, topic)
+		keys = append(keys, string(key))
+		return nil
+	}), changefeed.WithTopic("changes"), changefeed.WithOnError(func(changefeed.Event, error) {
+		errCount++
+	}))
+
+	require.Nil(t, clock.SetNow(t1))
+	require.Nil(t, db.Set("A", "Old"))
+	require.Nil(t, db.Set("B", "Old"))
+	require.Nil(t, db.Delete("A"))
+	p.Close()
+	require.Nil(t, db.Set("C", "Old")) // not published after Close
+
+	assert.Equal(t, []string{"changes", "changes"}, topics)
+	assert.Equal(t, []string{"A", "B"}, keys)
+	assert.Equal(t, 1, errCount)
+}
@@ -0,0 +1,3 @@
+// Package changefeed provides a DB decorator that emits change events for every successful write, and sinks that
+// forward change events to downstream systems such as message buses.
+package changefeed
@@ -0,0 +1,119 @@
+package changefeed
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// MessagePublisher publishes a message to a topic. Kafka producers and NATS connections can be adapted with a
+// PublisherFunc, e.g. for NATS:
+//
+//	changefeed.PublisherFunc(func(topic string, key, value []byte) error { return nc.Publish(topic, value) })
+type MessagePublisher interface {
+	Publish(topic string, key, value []byte) error
+}
+
+// PublisherFunc is an adapter to allow the use of ordinary functions as MessagePublishers.
+type PublisherFunc func(topic string, key, value []byte) error
+
+// Publish calls f(topic, key, value).
+func (f PublisherFunc) Publish(topic string, key, value []byte) error {
+	return f(topic, key, value)
+}
+
+// NewPublisher constructs a Publisher that consumes Events from db and publishes them as JSON to mp. Events are
+// published asynchronously and in order. The Publisher must be closed to flush pending Events.
+func NewPublisher(db *DB, mp MessagePublisher, opts ...PublisherOpt) *Publisher {
+	options := &publisherOptions{
+		topicFn:    func(Event) string { return "bitempura" },
+		bufferSize: 1024,
+		onError:    func(Event, error) {},
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	p := &Publisher{
+		mp:      mp,
+		topicFn: options.topicFn,
+		onError: options.onError,
+		events:  make(chan Event, options.bufferSize),
+		done:    make(chan struct{}),
+	}
+	go p.run()
+	p.cancel = db.Subscribe(func(e Event) { p.events <- e })
+	return p
+}
+
+// Publisher forwards Events to a MessagePublisher such as a Kafka or NATS client. Message keys are the DB key so
+// partitioned topics preserve per-key ordering.
+type Publisher struct {
+	mp      MessagePublisher
+	topicFn func(Event) string
+	onError func(Event, error)
+	events  chan Event
+	done    chan struct{}
+	cancel  func()
+	once    sync.Once
+}
+
+// publisherOptions is a struct for processing PublisherOpt's to be used by Publisher
+type publisherOptions struct {
+	topicFn    func(Event) string
+	bufferSize int
+	onError    func(Event, error)
+}
+
+// PublisherOpt is an option for constructing Publishers
+type PublisherOpt func(*publisherOptions)
+
+// WithTopic configures a fixed topic. The default topic is "bitempura".
+func WithTopic(topic string) PublisherOpt {
+	return func(os *publisherOptions) {
+		os.topicFn = func(Event) string { return topic }
+	}
+}
+
+// WithTopicFn configures the topic per Event, e.g. by key prefix.
+func WithTopicFn(fn func(Event) string) PublisherOpt {
+	return func(os *publisherOptions) {
+		os.topicFn = fn
+	}
+}
+
+// WithBufferSize configures how many Events may be pending before writes to the DB block.
+func WithBufferSize(n int) PublisherOpt {
+	return func(os *publisherOptions) {
+		os.bufferSize = n
+	}
+}
+
+// WithOnError configures a callback for Events that failed to publish.
+func WithOnError(fn func(Event, error)) PublisherOpt {
+	return func(os *publisherOptions) {
+		os.onError = fn
+	}
+}
+
+// Close stops consuming Events and blocks until all pending Events are published.
+func (p *Publisher) Close() {
+	p.once.Do(func() {
+		p.cancel()
+		close(p.events)
+		<-p.done
+	})
+}
+
+func (p *Publisher) run() {
+	defer close(p.done)
+	for e := range p.events {
+		value, err := json.Marshal(e)
+		if err != nil {
+			p.onError(e, err)
+			continue
+		}
+		if err := p.mp.Publish(p.topicFn(e), []byte(e.Key), value); err != nil {
+			p.onError(e, err)
+		}
+	}
+}
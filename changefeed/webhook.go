@@ -0,0 +1,125 @@
+package changefeed
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var _ MessagePublisher = (*WebhookPublisher)(nil)
+
+// Webhook is a URL that change events are POSTed to. If KeyPrefixes is non-empty, only events for keys with one of the
+// prefixes are sent.
+type Webhook struct {
+	URL         string
+	KeyPrefixes []string
+}
+
+func (w Webhook) matches(key string) bool {
+	if len(w.KeyPrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range w.KeyPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewWebhookPublisher constructs a MessagePublisher that POSTs change events to webhooks. Use it with NewPublisher for
+// lightweight integrations that don't run a message bus:
+//
+//	p := changefeed.NewPublisher(db, changefeed.NewWebhookPublisher(hooks))
+func NewWebhookPublisher(hooks []Webhook, opts ...WebhookOpt) *WebhookPublisher {
+	options := &webhookOptions{
+		client:      http.DefaultClient,
+		maxAttempts: 3,
+		backoff:     100 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return &WebhookPublisher{
+		hooks:       hooks,
+		client:      options.client,
+		maxAttempts: options.maxAttempts,
+		backoff:     options.backoff,
+	}
+}
+
+// WebhookPublisher POSTs JSON change events to webhooks, retrying failed requests with exponential backoff.
+type WebhookPublisher struct {
+	hooks       []Webhook
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+}
+
+// webhookOptions is a struct for processing WebhookOpt's to be used by WebhookPublisher
+type webhookOptions struct {
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+}
+
+// WebhookOpt is an option for constructing WebhookPublishers
+type WebhookOpt func(*webhookOptions)
+
+// WithHTTPClient configures the HTTP client. The default is http.DefaultClient.
+func WithHTTPClient(client *http.Client) WebhookOpt {
+	return func(os *webhookOptions) {
+		os.client = client
+	}
+}
+
+// WithRetries configures the maximum number of attempts per webhook and the initial backoff between attempts, which
+// doubles after each failure. The default is 3 attempts with 100ms initial backoff.
+func WithRetries(maxAttempts int, backoff time.Duration) WebhookOpt {
+	return func(os *webhookOptions) {
+		os.maxAttempts = maxAttempts
+		os.backoff = backoff
+	}
+}
+
+// Publish POSTs value to every webhook matching key. topic is ignored. An error is returned if any webhook fails all
+// attempts.
+func (p *WebhookPublisher) Publish(topic string, key, value []byte) error {
+	var failed []string
+	for _, hook := range p.hooks {
+		if !hook.matches(string(key)) {
+			continue
+		}
+		if err := p.post(hook.URL, value); err != nil {
+			failed = append(failed, fmt.Sprintf("%v: %v", hook.URL, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to post to webhooks: %v", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+func (p *WebhookPublisher) post(url string, body []byte) error {
+	var err error
+	backoff := p.backoff
+	for attempt := 0; attempt < p.maxAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		var resp *http.Response
+		resp, err = p.client.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			continue
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		err = fmt.Errorf("status %v", resp.StatusCode)
+	}
+	return err
+}
@@ -0,0 +1,53 @@
+package changefeed_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elh/bitempura/changefeed"
+	"github.com/elh/bitempura/clock"
+	"github.com/elh/bitempura/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookPublisher(t *testing.T) {
+	var m sync.Mutex
+	var keys []string
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+		calls++
+		if calls == 1 { // fail first attempt to exercise retries
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var e changefeed.Event
+		require.Nil(t, json.NewDecoder(r.Body).Decode(&e))
+		keys = append(keys, e.Key)
+	}))
+	defer server.Close()
+
+	clock := &clock.Clock{}
+	mdb, err := memory.NewDB(memory.WithClock(clock))
+	require.Nil(t, err)
+	db := changefeed.NewDB(mdb)
+	p := changefeed.NewPublisher(db, changefeed.NewWebhookPublisher(
+		[]changefeed.Webhook{{URL: server.URL, KeyPrefixes: []string{"Alice/"}}},
+		changefeed.WithRetries(2, time.Millisecond),
+	))
+
+	require.Nil(t, clock.SetNow(t1))
+	require.Nil(t, db.Set("Alice/balance", 100))
+	require.Nil(t, db.Set("Bob/balance", 100))
+	require.Nil(t, db.Set("Alice/positions", 1))
+	p.Close()
+
+	assert.Equal(t, []string{"Alice/balance", "Alice/positions"}, keys)
+	assert.Equal(t, 3, calls)
+}
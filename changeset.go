@@ -0,0 +1,156 @@
+package bitempura
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ChangeKind classifies a FieldChange.
+type ChangeKind string
+
+// Change kinds
+const (
+	ChangeAdded    ChangeKind = "added"
+	ChangeRemoved  ChangeKind = "removed"
+	ChangeModified ChangeKind = "modified"
+)
+
+// FieldChange is a change to a field of a Value. Path is the dot separated path of map keys and struct field names to
+// the field, or empty if the whole value changed.
+type FieldChange struct {
+	Path string
+	Kind ChangeKind
+	Old  Value `json:",omitempty"`
+	New  Value `json:",omitempty"`
+}
+
+func (c FieldChange) String() string {
+	path := c.Path
+	if path == "" {
+		path = "."
+	}
+	switch c.Kind {
+	case ChangeAdded:
+		return fmt.Sprintf("+ %v: %v", path, c.New)
+	case ChangeRemoved:
+		return fmt.Sprintf("- %v: %v", path, c.Old)
+	default:
+		return fmt.Sprintf("~ %v: %v -> %v", path, c.Old, c.New)
+	}
+}
+
+// ChangeSet is the field-level changes between two Values, ordered by path.
+type ChangeSet []FieldChange
+
+// String renders the change set with one change per line.
+func (cs ChangeSet) String() string {
+	lines := make([]string, len(cs))
+	for i, c := range cs {
+		lines[i] = c.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// DiffVersions returns the field-level changes from the value of old to the value of new. A nil version has no fields,
+// so all fields of the other are added or removed.
+func DiffVersions(old, new *VersionedKV) ChangeSet {
+	var oldV, newV reflect.Value
+	if old != nil {
+		oldV = fieldsOf(old.Value)
+	}
+	if new != nil {
+		newV = fieldsOf(new.Value)
+	}
+	var cs ChangeSet
+	diffFields(&cs, "", oldV, newV)
+	return cs
+}
+
+// DiffValues returns the field-level changes from old to new. Maps with string keys and structs are compared field by
+// field, recursively. Exported struct fields are compared by name. Other values, including slices, are compared whole
+// with reflect.DeepEqual.
+func DiffValues(old, new Value) ChangeSet {
+	var cs ChangeSet
+	diffFields(&cs, "", fieldsOf(old), fieldsOf(new))
+	return cs
+}
+
+// fieldsOf returns v with pointers and interfaces dereferenced. The result is invalid if v is nil.
+func fieldsOf(v Value) reflect.Value {
+	return deref(reflect.ValueOf(v))
+}
+
+func deref(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func diffFields(cs *ChangeSet, path string, old, new reflect.Value) {
+	switch {
+	case !old.IsValid() && !new.IsValid():
+		return
+	case !old.IsValid() && !hasFields(new):
+		*cs = append(*cs, FieldChange{Path: path, Kind: ChangeAdded, New: new.Interface()})
+		return
+	case !new.IsValid() && !hasFields(old):
+		*cs = append(*cs, FieldChange{Path: path, Kind: ChangeRemoved, Old: old.Interface()})
+		return
+	case old.IsValid() && new.IsValid() && (!hasFields(old) || !hasFields(new) || old.Type() != new.Type()):
+		if !reflect.DeepEqual(old.Interface(), new.Interface()) {
+			*cs = append(*cs, FieldChange{Path: path, Kind: ChangeModified, Old: old.Interface(), New: new.Interface()})
+		}
+		return
+	}
+
+	oldFields, newFields := fields(old), fields(new)
+	names := make([]string, 0, len(oldFields)+len(newFields))
+	for name := range oldFields {
+		names = append(names, name)
+	}
+	for name := range newFields {
+		if _, ok := oldFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := name
+		if path != "" {
+			p = path + "." + name
+		}
+		diffFields(cs, p, oldFields[name], newFields[name])
+	}
+}
+
+// hasFields returns whether v is compared field by field.
+func hasFields(v reflect.Value) bool {
+	return v.Kind() == reflect.Struct || (v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String)
+}
+
+// fields returns the fields of a value with fields by name, dereferenced. Invalid values have no fields.
+func fields(v reflect.Value) map[string]reflect.Value {
+	out := map[string]reflect.Value{}
+	if !v.IsValid() {
+		return out
+	}
+	if v.Kind() == reflect.Map {
+		iter := v.MapRange()
+		for iter.Next() {
+			out[iter.Key().String()] = deref(iter.Value())
+		}
+		return out
+	}
+	for i := 0; i < v.NumField(); i++ {
+		if f := v.Type().Field(i); f.PkgPath == "" {
+			out[f.Name] = deref(v.Field(i))
+		}
+	}
+	return out
+}
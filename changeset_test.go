@@ -0,0 +1,86 @@
+package bitempura_test
+
+import (
+	"testing"
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/dbtest/tt"
+	"github.com/stretchr/testify/assert"
+)
+
+type account struct {
+	Owner   string
+	Balance int
+	Limits  *limits
+	private string
+}
+
+type limits struct {
+	Daily int
+}
+
+func TestDiffValues(t *testing.T) {
+	testCases := []struct {
+		desc     string
+		old, new Value
+		expected ChangeSet
+	}{
+		{
+			desc: "equal",
+			old:  map[string]interface{}{"a": 1.0},
+			new:  map[string]interface{}{"a": 1.0},
+		},
+		{
+			desc: "maps",
+			old:  map[string]interface{}{"a": 1.0, "b": "x", "nested": map[string]interface{}{"c": true, "d": []int{1}}},
+			new:  map[string]interface{}{"a": 2.0, "z": "y", "nested": map[string]interface{}{"c": true, "d": []int{1, 2}}},
+			expected: ChangeSet{
+				{Path: "a", Kind: ChangeModified, Old: 1.0, New: 2.0},
+				{Path: "b", Kind: ChangeRemoved, Old: "x"},
+				{Path: "nested.d", Kind: ChangeModified, Old: []int{1}, New: []int{1, 2}},
+				{Path: "z", Kind: ChangeAdded, New: "y"},
+			},
+		},
+		{
+			desc: "structs",
+			old:  account{Owner: "Alice", Balance: 100, private: "x"},
+			new:  &account{Owner: "Alice", Balance: 90, Limits: &limits{Daily: 10}, private: "y"},
+			expected: ChangeSet{
+				{Path: "Balance", Kind: ChangeModified, Old: 100, New: 90},
+				{Path: "Limits.Daily", Kind: ChangeAdded, New: 10},
+			},
+		},
+		{
+			desc:     "scalars",
+			old:      "Old",
+			new:      "New",
+			expected: ChangeSet{{Kind: ChangeModified, Old: "Old", New: "New"}},
+		},
+		{
+			desc:     "different types",
+			old:      map[string]int{"a": 1},
+			new:      "New",
+			expected: ChangeSet{{Kind: ChangeModified, Old: map[string]int{"a": 1}, New: "New"}},
+		},
+		{
+			desc:     "nil",
+			old:      nil,
+			new:      map[string]int{"a": 1},
+			expected: ChangeSet{{Path: "a", Kind: ChangeAdded, New: 1}},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, DiffValues(tC.old, tC.new))
+		})
+	}
+}
+
+func TestDiffVersions(t *testing.T) {
+	old := &VersionedKV{Key: "A", Value: map[string]int{"a": 1, "b": 2}, TxTimeStart: tt.Day(1), ValidTimeStart: tt.Day(1)}
+	new := &VersionedKV{Key: "A", Value: map[string]int{"a": 1, "b": 3, "c": 4}, TxTimeStart: tt.Day(2), ValidTimeStart: tt.Day(1)}
+	cs := DiffVersions(old, new)
+	assert.Equal(t, "~ b: 2 -> 3\n+ c: 4", cs.String())
+	assert.Equal(t, "- a: 1\n- b: 2", DiffVersions(old, nil).String())
+	assert.Equal(t, "~ .: Old -> New", DiffValues("Old", "New").String())
+}
@@ -0,0 +1,93 @@
+package bitempura
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ViolationKind classifies a Violation found by Check.
+type ViolationKind string
+
+// Violation kinds reported by Check.
+const (
+	// ViolationWrongKey is a version returned in a key's history that has a different key.
+	ViolationWrongKey ViolationKind = "wrong key"
+	// ViolationZeroTime is a version with a zero transaction or valid time start or end.
+	ViolationZeroTime ViolationKind = "zero time"
+	// ViolationEndBeforeStart is a version with a transaction or valid time end before its start.
+	ViolationEndBeforeStart ViolationKind = "end before start"
+	// ViolationOverlap is a pair of versions that overlap both transaction time and valid time.
+	ViolationOverlap ViolationKind = "overlap"
+	// ViolationDuplicateOpen is a pair of current versions (nil TxTimeEnd) with the same valid time start.
+	ViolationDuplicateOpen ViolationKind = "duplicate open version"
+)
+
+// Violation is a corruption of a key's history found by Check.
+type Violation struct {
+	Key      string
+	Kind     ViolationKind
+	Versions []*VersionedKV
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("key=%v: %v (%v version(s))", v.Key, v.Kind, len(v.Versions))
+}
+
+// Check scans the full history of keys and reports every violation of the structural invariants of a DB. If no keys
+// are provided, the DB must be a KeyLister and all of its keys are checked.
+//
+// Empty transaction time ranges (TxTimeEnd equal to TxTimeStart) are allowed for versions replaced at the same
+// transaction time they were written.
+func Check(db DB, keys ...string) ([]*Violation, error) {
+	if len(keys) == 0 {
+		kl, ok := db.(KeyLister)
+		if !ok {
+			return nil, errors.New("keys are required if DB is not a KeyLister")
+		}
+		var err error
+		if keys, err = kl.Keys(); err != nil {
+			return nil, fmt.Errorf("failed to list keys: %w", err)
+		}
+	}
+
+	histories, err := Histories(db, keys)
+	if err != nil {
+		return nil, err
+	}
+	var violations []*Violation
+	for _, key := range keys {
+		if vs, ok := histories[key]; ok {
+			violations = append(violations, CheckHistory(key, vs)...)
+		}
+	}
+	return violations, nil
+}
+
+// CheckHistory reports every violation of the structural invariants in a single key's history.
+func CheckHistory(key string, vs []*VersionedKV) []*Violation {
+	var violations []*Violation
+	add := func(kind ViolationKind, versions ...*VersionedKV) {
+		violations = append(violations, &Violation{Key: key, Kind: kind, Versions: versions})
+	}
+	for i, v := range vs {
+		if v.Key != key {
+			add(ViolationWrongKey, v)
+		}
+		if v.TxTimeStart.IsZero() || v.ValidTimeStart.IsZero() ||
+			(v.TxTimeEnd != nil && v.TxTimeEnd.IsZero()) || (v.ValidTimeEnd != nil && v.ValidTimeEnd.IsZero()) {
+			add(ViolationZeroTime, v)
+		}
+		if (v.TxTimeEnd != nil && v.TxTimeEnd.Before(v.TxTimeStart)) ||
+			(v.ValidTimeEnd != nil && !v.ValidTimeStart.Before(*v.ValidTimeEnd)) {
+			add(ViolationEndBeforeStart, v)
+		}
+		for _, w := range vs[i+1:] {
+			if v.TxTimeEnd == nil && w.TxTimeEnd == nil && v.ValidTimeStart.Equal(w.ValidTimeStart) {
+				add(ViolationDuplicateOpen, v, w)
+			} else if v.Overlaps(w) {
+				add(ViolationOverlap, v, w)
+			}
+		}
+	}
+	return violations
+}
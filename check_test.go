@@ -0,0 +1,73 @@
+package bitempura_test
+
+import (
+	"testing"
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/dbtest/tt"
+	"github.com/elh/bitempura/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// historyDB is a DB that serves fixed, possibly corrupt, histories.
+type historyDB struct {
+	DB
+	histories map[string][]*VersionedKV
+}
+
+func (db *historyDB) History(key string, opts ...ReadOpt) ([]*VersionedKV, error) {
+	vs, ok := db.histories[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return vs, nil
+}
+
+func TestCheck(t *testing.T) {
+	t.Run("valid DB", func(t *testing.T) {
+		db, err := memory.NewDB(memory.WithVersionedKVs([]*VersionedKV{
+			{Key: "A", Value: "Old", TxTimeStart: tt.Day(1), TxTimeEnd: tt.DayPtr(2), ValidTimeStart: tt.Day(1)},
+			{Key: "A", Value: "Old", TxTimeStart: tt.Day(2), ValidTimeStart: tt.Day(1), ValidTimeEnd: tt.DayPtr(2)},
+			{Key: "A", Value: "New", TxTimeStart: tt.Day(2), ValidTimeStart: tt.Day(2)},
+			{Key: "B", Value: "Old", TxTimeStart: tt.Day(1), ValidTimeStart: tt.Day(1)},
+		}))
+		require.Nil(t, err)
+		violations, err := Check(db)
+		require.Nil(t, err)
+		assert.Empty(t, violations)
+	})
+	t.Run("keys are required if DB is not a KeyLister", func(t *testing.T) {
+		db := &historyDB{}
+		_, err := Check(db)
+		assert.NotNil(t, err)
+		violations, err := Check(db, "A")
+		require.Nil(t, err)
+		assert.Empty(t, violations)
+	})
+	t.Run("reports violations", func(t *testing.T) {
+		good := &VersionedKV{Key: "A", TxTimeStart: tt.Day(1), ValidTimeStart: tt.Day(1), ValidTimeEnd: tt.DayPtr(3)}
+		overlapping := &VersionedKV{Key: "A", TxTimeStart: tt.Day(2), ValidTimeStart: tt.Day(2), ValidTimeEnd: tt.DayPtr(4)}
+		duplicateOpen := &VersionedKV{Key: "A", TxTimeStart: tt.Day(5), ValidTimeStart: tt.Day(1), ValidTimeEnd: tt.DayPtr(2)}
+		sameTx := &VersionedKV{Key: "B", TxTimeStart: tt.Day(1), TxTimeEnd: tt.DayPtr(1), ValidTimeStart: tt.Day(1)}
+		zero := &VersionedKV{Key: "B", TxTimeStart: tt.Day(1)}
+		backwards := &VersionedKV{Key: "C", TxTimeStart: tt.Day(2), TxTimeEnd: tt.DayPtr(1), ValidTimeStart: tt.Day(1)}
+		wrongKey := &VersionedKV{Key: "D", TxTimeStart: tt.Day(1), ValidTimeStart: tt.Day(1)}
+		db := &historyDB{histories: map[string][]*VersionedKV{
+			"A": {good, overlapping, duplicateOpen},
+			"B": {sameTx, zero},
+			"C": {backwards, wrongKey},
+		}}
+
+		violations, err := Check(db, "A", "B", "C", "Z")
+		require.Nil(t, err)
+		expected := []*Violation{
+			{Key: "A", Kind: ViolationOverlap, Versions: []*VersionedKV{good, overlapping}},
+			{Key: "A", Kind: ViolationDuplicateOpen, Versions: []*VersionedKV{good, duplicateOpen}},
+			{Key: "B", Kind: ViolationZeroTime, Versions: []*VersionedKV{zero}},
+			{Key: "C", Kind: ViolationEndBeforeStart, Versions: []*VersionedKV{backwards}},
+			{Key: "C", Kind: ViolationWrongKey, Versions: []*VersionedKV{wrongKey}},
+		}
+		assert.Equal(t, expected, violations)
+	})
+}
@@ -0,0 +1,71 @@
+package clock
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var _ Settable = (*Chaos)(nil)
+
+// chaosZones are the locations Chaos returns times in. EST and EDT share a wall clock hour around a daylight saving
+// time transition, so consecutive times can have decreasing wall clock readings while still increasing as instants.
+var chaosZones = []*time.Location{
+	time.UTC,
+	time.FixedZone("EST", -5*60*60),
+	time.FixedZone("EDT", -4*60*60),
+	time.FixedZone("IST", 5*60*60+30*60),
+	time.FixedZone("LINT", 14*60*60),
+}
+
+// chaosSteps are the increments Chaos advances by. Equal timestamps and sub-microsecond increments are common so they
+// are over-represented.
+var chaosSteps = []time.Duration{
+	0,
+	0,
+	time.Nanosecond,
+	time.Nanosecond,
+	999 * time.Nanosecond,
+	time.Microsecond,
+	time.Millisecond,
+	time.Second,
+	59 * time.Minute,
+	time.Hour,
+}
+
+// Chaos is a seeded clock that produces times that are valid but break common assumptions about transaction times.
+// Every call to Now advances by a random step that may be zero (repeating the last time) or as small as a nanosecond,
+// and returns the time in a random location, including fixed zones that simulate daylight saving time transitions.
+// Times never decrease as instants. Chaos is intended to flush out DBs that assume strictly increasing, UTC, or
+// microsecond precision transaction times.
+type Chaos struct {
+	m   sync.Mutex
+	r   *rand.Rand
+	now time.Time
+}
+
+// NewChaos constructs a chaos clock starting at now. The same seed always produces the same sequence of times.
+func NewChaos(seed int64, now time.Time) *Chaos {
+	return &Chaos{r: rand.New(rand.NewSource(seed)), now: now}
+}
+
+// Now returns the current time of the clock in a random location and then advances the clock by a random step.
+func (c *Chaos) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+	now := c.now.In(chaosZones[c.r.Intn(len(chaosZones))])
+	c.now = c.now.Add(chaosSteps[c.r.Intn(len(chaosSteps))])
+	return now
+}
+
+// SetNow sets "now". Times being set must be monotonically increasing.
+func (c *Chaos) SetNow(t time.Time) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.now.After(t) {
+		return errors.New("clock: times must be monotonically increasing")
+	}
+	c.now = t
+	return nil
+}
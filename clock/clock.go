@@ -0,0 +1,84 @@
+// Package clock provides a controllable clock for tests of bitempura DBs and of applications using them. DBs use the
+// clock for transaction times, so tests can pin, step, and auto-advance "now".
+package clock
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	bt "github.com/elh/bitempura"
+)
+
+var _ bt.Clock = (*Clock)(nil)
+var _ Settable = (*Clock)(nil)
+
+// Settable is a clock whose "now" can be set, such as Clock.
+type Settable interface {
+	bt.Clock
+	SetNow(t time.Time) error
+}
+
+// Clock is a manually controlled clock. It is frozen by default, always returning the last time set. In auto-advance
+// mode, every call to Now advances the clock after returning. Times must be monotonically increasing as a safeguard for
+// correct tests. The zero value is a frozen clock at the zero time.
+type Clock struct {
+	m    sync.Mutex
+	now  time.Time
+	step time.Duration // if > 0, auto-advance by step after every call to Now
+}
+
+// New constructs a frozen clock at now.
+func New(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the current time of the clock. In auto-advance mode, the clock is then advanced by the step.
+func (c *Clock) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+	now := c.now
+	c.now = c.now.Add(c.step)
+	return now
+}
+
+// SetNow sets "now". Times being set must be monotonically increasing.
+func (c *Clock) SetNow(t time.Time) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.now.After(t) {
+		return errors.New("clock: times must be monotonically increasing")
+	}
+	c.now = t
+	return nil
+}
+
+// Advance moves "now" forward by d. d must not be negative.
+func (c *Clock) Advance(d time.Duration) error {
+	if d < 0 {
+		return errors.New("clock: times must be monotonically increasing")
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.now = c.now.Add(d)
+	return nil
+}
+
+// Freeze stops auto-advancing. Now returns the same time until the clock is set or advanced.
+func (c *Clock) Freeze() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.step = 0
+}
+
+// AutoAdvance makes every call to Now advance the clock by step after returning, so every call returns a distinct,
+// increasing time. step must be positive.
+func (c *Clock) AutoAdvance(step time.Duration) error {
+	if step <= 0 {
+		return errors.New("clock: step must be positive")
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.step = step
+	return nil
+}
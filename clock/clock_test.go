@@ -0,0 +1,73 @@
+package clock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elh/bitempura/clock"
+	"github.com/elh/bitempura/dbtest/tt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	t1 = tt.Day(1)
+	t2 = tt.Day(2)
+)
+
+func TestClock(t *testing.T) {
+	var zero clock.Clock
+	assert.True(t, zero.Now().IsZero())
+
+	c := clock.New(t1)
+	assert.Equal(t, t1, c.Now())
+	assert.Equal(t, t1, c.Now())
+
+	require.Nil(t, c.SetNow(t2))
+	assert.Equal(t, t2, c.Now())
+	assert.NotNil(t, c.SetNow(t1))
+
+	require.Nil(t, c.Advance(time.Hour))
+	assert.Equal(t, t2.Add(time.Hour), c.Now())
+	assert.NotNil(t, c.Advance(-time.Hour))
+
+	require.Nil(t, c.AutoAdvance(time.Minute))
+	assert.Equal(t, t2.Add(time.Hour), c.Now())
+	assert.Equal(t, t2.Add(time.Hour+time.Minute), c.Now())
+	assert.NotNil(t, c.AutoAdvance(0))
+
+	c.Freeze()
+	assert.Equal(t, t2.Add(time.Hour+2*time.Minute), c.Now())
+	assert.Equal(t, t2.Add(time.Hour+2*time.Minute), c.Now())
+}
+
+func TestChaos(t *testing.T) {
+	c := clock.NewChaos(1, t1)
+	var prev time.Time
+	var equal, subMicro, zones int
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		now := c.Now()
+		require.False(t, now.Before(prev), "times must not decrease")
+		if i > 0 && now.Equal(prev) {
+			equal++
+		}
+		if d := now.Sub(prev); i > 0 && d > 0 && d < time.Microsecond {
+			subMicro++
+		}
+		if name, _ := now.Zone(); !seen[name] {
+			seen[name] = true
+			zones++
+		}
+		prev = now
+	}
+	assert.Greater(t, equal, 0)
+	assert.Greater(t, subMicro, 0)
+	assert.Greater(t, zones, 1)
+
+	assert.Equal(t, clock.NewChaos(1, t1).Now(), clock.NewChaos(1, t1).Now(), "sequence is reproducible")
+	require.NotNil(t, c.SetNow(t1))
+	later := t1.AddDate(1, 0, 0)
+	require.Nil(t, c.SetNow(later))
+	assert.True(t, c.Now().Equal(later))
+}
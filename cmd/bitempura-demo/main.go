@@ -0,0 +1,298 @@
+// Command bitempura-demo generates a runnable example program from a recorded scenario so documented scenarios can
+// be regenerated instead of maintained by hand.
+//
+// Usage:
+//
+//	bitempura-demo [-o main.go] <scenario.json>
+//
+// The scenario is either a dbtest.OpLog, as recorded by dbtest.Recorder, or a fixture of versioned key-values. An op
+// log is replayed call by call against a memory DB with a controlled clock, printing the result of each call. A fixture
+// seeds a memory DB and prints the history of each key. The generated program only uses the public API.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/dbtest"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("bitempura-demo", flag.ContinueOnError)
+	out := fs.String("o", "", "output file. defaults to stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: bitempura-demo [-o main.go] <scenario.json>")
+	}
+	b, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	src, err := generate(b)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(*out, src, 0644)
+}
+
+// generate returns the formatted source of a program for a scenario.
+func generate(scenario []byte) ([]byte, error) {
+	// op log entries always have an op. fixtures never do
+	var probe []map[string]interface{}
+	if err := json.Unmarshal(scenario, &probe); err != nil {
+		return nil, fmt.Errorf("failed to parse scenario: %v", err)
+	}
+	var buf bytes.Buffer
+	if len(probe) > 0 && probe[0]["op"] != nil {
+		l, err := dbtest.ReadOpLog(bytes.NewReader(scenario))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse op log: %v", err)
+		}
+		if err := writeOpLogProgram(&buf, l); err != nil {
+			return nil, err
+		}
+	} else {
+		var kvs []*bt.VersionedKV
+		if err := json.Unmarshal(scenario, &kvs); err != nil {
+			return nil, fmt.Errorf("failed to parse fixture: %v", err)
+		}
+		if err := writeFixtureProgram(&buf, kvs); err != nil {
+			return nil, err
+		}
+	}
+	return format.Source(buf.Bytes())
+}
+
+// writeHeader writes the package clause and imports. The clock package is only used by op log programs.
+func writeHeader(w io.Writer, withClock bool) {
+	fmt.Fprint(w, "// Code generated by bitempura-demo. DO NOT EDIT.\n\npackage main\n\n")
+	fmt.Fprint(w, "import (\n\"encoding/json\"\n\"fmt\"\n\"time\"\n\n")
+	fmt.Fprint(w, "bt \"github.com/elh/bitempura\"\n")
+	if withClock {
+		fmt.Fprint(w, "\"github.com/elh/bitempura/clock\"\n")
+	}
+	fmt.Fprint(w, "\"github.com/elh/bitempura/memory\"\n)\n\n")
+}
+
+const helpers = `
+func mustParse(s string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func check(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+func printWrite(call string, err error) {
+	if err != nil {
+		fmt.Printf("%v: error: %v\n", call, err)
+		return
+	}
+	fmt.Printf("%v: ok\n", call)
+}
+
+func printResult(call string, v interface{}, err error) {
+	if err != nil {
+		fmt.Printf("%v: error: %v\n", call, err)
+		return
+	}
+	b, err := json.MarshalIndent(v, "", "  ")
+	check(err)
+	fmt.Printf("%v:\n%v\n", call, string(b))
+}
+`
+
+func writeOpLogProgram(w io.Writer, l dbtest.OpLog) error {
+	writeHeader(w, true)
+	fmt.Fprintln(w, "func main() {")
+	fmt.Fprintln(w, "clock := &clock.Clock{}")
+	fmt.Fprintln(w, "db, err := memory.NewDB(memory.WithClock(clock))")
+	fmt.Fprintln(w, "check(err)")
+	var now *time.Time
+	for _, o := range l {
+		if now == nil || !now.Equal(o.Now) {
+			fmt.Fprintf(w, "\ncheck(clock.SetNow(%v))\n", timeLit(o.Now))
+			n := o.Now
+			now = &n
+		}
+		call, err := callLit(o)
+		if err != nil {
+			return err
+		}
+		switch o.Op {
+		case dbtest.StepSet, dbtest.StepDelete:
+			fmt.Fprintf(w, "printWrite(%v, %v)\n", strLit(strings.TrimPrefix(call, "db.")), call)
+		case dbtest.StepGet, dbtest.StepList, dbtest.StepHistory:
+			fmt.Fprintln(w, "{")
+			fmt.Fprintf(w, "v, err := %v\n", call)
+			fmt.Fprintf(w, "printResult(%v, v, err)\n", strLit(strings.TrimPrefix(call, "db.")))
+			fmt.Fprintln(w, "}")
+		default:
+			return fmt.Errorf("unknown op: %v", o.Op)
+		}
+	}
+	fmt.Fprintln(w, "}")
+	_, _ = io.WriteString(w, helpers)
+	return nil
+}
+
+// callLit returns the source of the DB call for an operation, e.g. `db.Get("A", bt.AsOfValidTime(...))`.
+func callLit(o dbtest.RecordedOp) (string, error) {
+	var args []string
+	if o.Op != dbtest.StepList {
+		args = append(args, strconv.Quote(o.Key))
+	}
+	switch o.Op {
+	case dbtest.StepSet:
+		v, err := valueLit(o.Value)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, v)
+		fallthrough
+	case dbtest.StepDelete:
+		if o.ValidTime != nil {
+			args = append(args, "bt.WithValidTime("+timeLit(*o.ValidTime)+")")
+		}
+		if o.EndValidTime != nil {
+			args = append(args, "bt.WithEndValidTime("+timeLit(*o.EndValidTime)+")")
+		}
+	case dbtest.StepGet, dbtest.StepList:
+		if o.ValidTime != nil {
+			args = append(args, "bt.AsOfValidTime("+timeLit(*o.ValidTime)+")")
+		}
+		if o.TxTime != nil {
+			args = append(args, "bt.AsOfTransactionTime("+timeLit(*o.TxTime)+")")
+		}
+	}
+	return fmt.Sprintf("db.%v(%v)", o.Op, strings.Join(args, ", ")), nil
+}
+
+func writeFixtureProgram(w io.Writer, kvs []*bt.VersionedKV) error {
+	writeHeader(w, false)
+	fmt.Fprintln(w, "func main() {")
+	fmt.Fprintln(w, "db, err := memory.NewDB(memory.WithVersionedKVs([]*bt.VersionedKV{")
+	seen := map[string]bool{}
+	var keys []string
+	for _, kv := range kvs {
+		v, err := valueLit(kv.Value)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "{Key: %q, Value: %v, TxTimeStart: %v, TxTimeEnd: %v, ValidTimeStart: %v, ValidTimeEnd: %v},\n",
+			kv.Key, v, timeLit(kv.TxTimeStart), timePtrLit(kv.TxTimeEnd), timeLit(kv.ValidTimeStart),
+			timePtrLit(kv.ValidTimeEnd))
+		if !seen[kv.Key] {
+			seen[kv.Key] = true
+			keys = append(keys, kv.Key)
+		}
+	}
+	fmt.Fprintln(w, "}))")
+	fmt.Fprintln(w, "check(err)")
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintln(w, "{")
+		fmt.Fprintf(w, "v, err := db.History(%q)\n", key)
+		fmt.Fprintf(w, "printResult(%v, v, err)\n", strLit(fmt.Sprintf("History(%q)", key)))
+		fmt.Fprintln(w, "}")
+	}
+	fmt.Fprintln(w, "}")
+	_, _ = io.WriteString(w, helpers)
+	return nil
+}
+
+// strLit returns a Go string literal, preferring a raw string for legibility.
+func strLit(s string) string {
+	if strings.ContainsAny(s, "`\r") {
+		return strconv.Quote(s)
+	}
+	return "`" + s + "`"
+}
+
+func timeLit(t time.Time) string {
+	return fmt.Sprintf("mustParse(%q)", t.Format(time.RFC3339Nano))
+}
+
+func timePtrLit(t *time.Time) string {
+	if t == nil {
+		return "nil"
+	}
+	return "timePtr(" + timeLit(*t) + ")"
+}
+
+// valueLit returns the source of a JSON-decoded value.
+func valueLit(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "nil", nil
+	case string:
+		return strconv.Quote(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case []interface{}:
+		var elems []string
+		for _, e := range v {
+			s, err := valueLit(e)
+			if err != nil {
+				return "", err
+			}
+			elems = append(elems, s)
+		}
+		return "[]interface{}{" + strings.Join(elems, ", ") + "}", nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var elems []string
+		for _, k := range keys {
+			s, err := valueLit(v[k])
+			if err != nil {
+				return "", err
+			}
+			elems = append(elems, strconv.Quote(k)+": "+s)
+		}
+		return "map[string]interface{}{" + strings.Join(elems, ", ") + "}", nil
+	default:
+		return "", fmt.Errorf("unsupported value type %T", v)
+	}
+}
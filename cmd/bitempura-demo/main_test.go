@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"testing"
+	"time"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/elh/bitempura/dbtest"
+	"github.com/elh/bitempura/dbtest/tt"
+	"github.com/elh/bitempura/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	c := clock.New(tt.Day(1))
+	require.Nil(t, c.AutoAdvance(time.Hour))
+	rec := dbtest.NewRecorder(c)
+	db, err := memory.NewDB(memory.WithClock(rec.Clock()))
+	require.Nil(t, err)
+	rdb := rec.Wrap(db)
+	require.Nil(t, rdb.Set("p2", map[string]interface{}{"entry-pt": "SFO", "tags": []interface{}{"a", true, nil}}))
+	require.Nil(t, rdb.Delete("p2", bt.WithValidTime(tt.Day(1))))
+	_, _ = rdb.Get("p2")
+	_, _ = rdb.List()
+	_, _ = rdb.History("p2")
+
+	var oplog bytes.Buffer
+	require.Nil(t, rec.Log().Write(&oplog))
+	history, err := db.History("p2")
+	require.Nil(t, err)
+	fixture, err := json.Marshal(history)
+	require.Nil(t, err)
+
+	for name, scenario := range map[string][]byte{"op log": oplog.Bytes(), "fixture": fixture} {
+		src, err := generate(scenario)
+		require.Nil(t, err, name)
+		_, err = parser.ParseFile(token.NewFileSet(), "main.go", src, 0)
+		require.Nil(t, err, "%v: %s", name, src)
+		assert.Contains(t, string(src), `"entry-pt": "SFO"`, name)
+	}
+
+	_, err = generate([]byte(`{}`))
+	require.NotNil(t, err)
+}
@@ -0,0 +1,471 @@
+// Command bitempura is a command-line client for bitempura DBs.
+//
+// Usage:
+//
+//	bitempura [backend flags] <command> [command flags] [args]
+//
+// Backends (exactly one is required):
+//
+//	-file <path>        memory DB loaded from and saved to a JSON snapshot file of versioned key-values
+//	-sqlite <path>      sql.TableDB over a SQLite file. also requires -table and -pk. set values are JSON objects of columns
+//	-server <url>       remote DB served by server/http
+//
+// Snapshot flags (only with -file):
+//
+//	-encryption-key-file <path>  file with a hex-encoded 16, 24, or 32 byte AES key. values are encrypted at rest with
+//	                             AES-GCM and the snapshot is saved in the backup format of package backup
+//	-compression <algorithm>     snappy or zstd. values are compressed and the snapshot is saved in the backup format
+//
+// Commands:
+//
+//	get [-valid-time t] [-tx-time t] <key>
+//	list [-valid-time t] [-tx-time t]
+//	set [-valid-time t] [-end-valid-time t] <key> <JSON value>
+//	delete [-valid-time t] [-end-valid-time t] <key>
+//	history [-diff] <key>  -diff adds the field-level changes from the version each version replaced
+//	query <statement>   statement in the query language of package query
+//	sizes [-n 10]       keys with the most approximate stored bytes, largest first
+//
+// All times are RFC 3339 datetimes.
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/backup"
+	"github.com/elh/bitempura/memory"
+	"github.com/elh/bitempura/query"
+	bthttp "github.com/elh/bitempura/server/http"
+	btsql "github.com/elh/bitempura/sql"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// stdout is where command output is written.
+var stdout io.Writer = os.Stdout
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("bitempura", flag.ContinueOnError)
+	file := fs.String("file", "", "memory DB snapshot file")
+	sqlitePath := fs.String("sqlite", "", "SQLite file")
+	table := fs.String("table", "", "SQLite table name")
+	pk := fs.String("pk", "id", "SQLite table primary key column name")
+	serverURL := fs.String("server", "", "server URL")
+	encryptionKeyFile := fs.String("encryption-key-file", "", "file with a hex-encoded AES key for -file values")
+	compression := fs.String("compression", "", "compression of -file values. snappy or zstd")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		return errors.New("command is required. one of get, list, set, delete, history, query, sizes")
+	}
+
+	var b *backend
+	var err error
+	switch {
+	case *file != "" && *sqlitePath == "" && *serverURL == "":
+		var opts []backup.Opt
+		if *encryptionKeyFile != "" {
+			encryptor, err := readEncryptor(*encryptionKeyFile)
+			if err != nil {
+				return err
+			}
+			opts = append(opts, backup.WithEncryptor(encryptor))
+		}
+		if *compression != "" {
+			opts = append(opts, backup.WithCompression(backup.Compression(*compression)))
+		}
+		b, err = openFile(*file, opts...)
+	case *sqlitePath != "" && *file == "" && *serverURL == "":
+		if *table == "" {
+			return errors.New("-table is required with -sqlite")
+		}
+		b, err = openSQLite(*sqlitePath, *table, *pk)
+	case *serverURL != "" && *file == "" && *sqlitePath == "":
+		b = &backend{db: bthttp.NewClient(*serverURL, nil), close: func() error { return nil }}
+	default:
+		return errors.New("exactly one of -file, -sqlite, or -server is required")
+	}
+	// sql.TableDB values are the SQL-queryable columns of a table and server values are stored by the server
+	if *file == "" && (*encryptionKeyFile != "" || *compression != "") {
+		return errors.New("-encryption-key-file and -compression are only supported with -file")
+	}
+	if err != nil {
+		return err
+	}
+	defer func() { _ = b.close() }()
+
+	cmd, cmdArgs := fs.Arg(0), fs.Args()[1:]
+	switch cmd {
+	case "get":
+		return get(b.db, cmdArgs)
+	case "list":
+		return list(b.db, cmdArgs)
+	case "set":
+		if err := set(b.db, cmdArgs); err != nil {
+			return err
+		}
+	case "delete":
+		if err := del(b.db, cmdArgs); err != nil {
+			return err
+		}
+	case "history":
+		return history(b.db, cmdArgs)
+	case "sizes":
+		return sizes(b.db, cmdArgs)
+	case "query":
+		isWrite, err := runQuery(b.db, cmdArgs)
+		if err != nil || !isWrite {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown command: %v", cmd)
+	}
+	if b.save != nil {
+		return b.save()
+	}
+	return nil
+}
+
+type backend struct {
+	db    bt.DB
+	save  func() error // optional. called after writes
+	close func() error
+}
+
+// openFile loads a memory DB from a snapshot file. The file does not need to exist yet. Snapshots are JSON unless opts
+// are set, in which case they are saved in the backup format with them. Snapshots in either format can be loaded, so
+// setting opts converts a JSON snapshot on the next write.
+func openFile(path string, opts ...backup.Opt) (*backend, error) {
+	var kvs []*bt.VersionedKV
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if backup.IsBackup(b) {
+			if _, kvs, err = backup.RestoreAll(bytes.NewReader(b), opts...); err != nil {
+				return nil, fmt.Errorf("failed to read snapshot file: %v", err)
+			}
+		} else if err := json.Unmarshal(b, &kvs); err != nil {
+			return nil, fmt.Errorf("failed to parse snapshot file: %v", err)
+		}
+	}
+	keys := map[string]bool{}
+	for _, kv := range kvs {
+		keys[kv.Key] = true
+	}
+	db, err := memory.NewDB(memory.WithVersionedKVs(kvs))
+	if err != nil {
+		return nil, err
+	}
+
+	// track written keys so the snapshot can be rebuilt from histories
+	tdb := &keyTrackingDB{DB: db, keys: keys}
+	save := func() error {
+		keys := make([]string, 0, len(tdb.keys))
+		for key := range tdb.keys {
+			keys = append(keys, key)
+		}
+		// sort so snapshots of the same versions are the same
+		sort.Strings(keys)
+		out := []*bt.VersionedKV{}
+		for _, key := range keys {
+			vs, err := db.History(key)
+			if errors.Is(err, bt.ErrNotFound) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			out = append(out, vs...)
+		}
+		b, err := encodeSnapshot(out, opts...)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, b, 0644)
+	}
+	return &backend{db: tdb, save: save, close: func() error { return nil }}, nil
+}
+
+// encodeSnapshot encodes the versions of a snapshot as JSON, or in the backup format if opts are set.
+func encodeSnapshot(kvs []*bt.VersionedKV, opts ...backup.Opt) ([]byte, error) {
+	if len(opts) == 0 {
+		return json.MarshalIndent(kvs, "", "  ")
+	}
+	var buf bytes.Buffer
+	w, err := backup.NewWriter(&buf, backup.Header{CreatedAt: time.Now()}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	for _, kv := range kvs {
+		if err := w.Write(kv); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// readEncryptor returns an AES-GCM Encryptor using the hex-encoded key in the file at path for every DB key.
+func readEncryptor(path string) (bt.Encryptor, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("encryption key must be hex-encoded: %v", err)
+	}
+	if n := len(key); n != 16 && n != 24 && n != 32 {
+		return nil, fmt.Errorf("encryption key must be 16, 24, or 32 bytes. got %v", n)
+	}
+	return bt.NewAESGCMEncryptor(func(string) ([]byte, error) { return key, nil }), nil
+}
+
+type keyTrackingDB struct {
+	*memory.DB
+	keys map[string]bool
+}
+
+func (db *keyTrackingDB) Set(key string, value bt.Value, opts ...bt.WriteOpt) error {
+	db.keys[key] = true
+	return db.DB.Set(key, value, opts...)
+}
+
+func openSQLite(path, table, pk string) (*backend, error) {
+	sqlDB, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := btsql.NewTableDB(sqlDB, table, pk, nil, nil)
+	if err != nil {
+		_ = sqlDB.Close()
+		return nil, err
+	}
+	return &backend{db: db, close: sqlDB.Close}, nil
+}
+
+func get(db bt.DB, args []string) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	validTime := timeFlag(fs, "valid-time", "as of valid time")
+	txTime := timeFlag(fs, "tx-time", "as of transaction time")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: get [-valid-time t] [-tx-time t] <key>")
+	}
+	kv, err := db.Get(fs.Arg(0), readOpts(validTime, txTime)...)
+	if err != nil {
+		return err
+	}
+	return printJSON(kv)
+}
+
+func list(db bt.DB, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	validTime := timeFlag(fs, "valid-time", "as of valid time")
+	txTime := timeFlag(fs, "tx-time", "as of transaction time")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("usage: list [-valid-time t] [-tx-time t]")
+	}
+	kvs, err := db.List(readOpts(validTime, txTime)...)
+	if err != nil {
+		return err
+	}
+	return printJSON(kvs)
+}
+
+func set(db bt.DB, args []string) error {
+	fs := flag.NewFlagSet("set", flag.ContinueOnError)
+	validTime := timeFlag(fs, "valid-time", "valid time start")
+	endValidTime := timeFlag(fs, "end-valid-time", "valid time end")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("usage: set [-valid-time t] [-end-valid-time t] <key> <JSON value>")
+	}
+	var value bt.Value
+	if err := json.Unmarshal([]byte(fs.Arg(1)), &value); err != nil {
+		return fmt.Errorf("failed to parse value: %v", err)
+	}
+	return db.Set(fs.Arg(0), value, writeOpts(validTime, endValidTime)...)
+}
+
+func del(db bt.DB, args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ContinueOnError)
+	validTime := timeFlag(fs, "valid-time", "valid time start")
+	endValidTime := timeFlag(fs, "end-valid-time", "valid time end")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: delete [-valid-time t] [-end-valid-time t] <key>")
+	}
+	return db.Delete(fs.Arg(0), writeOpts(validTime, endValidTime)...)
+}
+
+func history(db bt.DB, args []string) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	diff := fs.Bool("diff", false, "include field-level changes")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: history [-diff] <key>")
+	}
+	kvs, err := db.History(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if !*diff {
+		return printJSON(kvs)
+	}
+	type versionChanges struct {
+		Version *bt.VersionedKV
+		Changes bt.ChangeSet
+	}
+	out := make([]versionChanges, len(kvs))
+	for i, kv := range kvs {
+		out[i] = versionChanges{Version: kv, Changes: bt.DiffVersions(replaced(kvs, kv), kv)}
+	}
+	return printJSON(out)
+}
+
+// keySize is a row of the output of sizes.
+type keySize struct {
+	Key         string
+	Versions    int
+	ApproxBytes int64
+}
+
+func sizes(db bt.DB, args []string) error {
+	fs := flag.NewFlagSet("sizes", flag.ContinueOnError)
+	n := fs.Int("n", 10, "number of keys. all keys if not positive")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("usage: sizes [-n 10]")
+	}
+	stats, err := bt.ReadStats(db)
+	if err != nil {
+		return err
+	}
+	out := []keySize{}
+	for _, key := range stats.LargestKeys(*n) {
+		ks := stats.PerKey[key]
+		out = append(out, keySize{Key: key, Versions: ks.Versions, ApproxBytes: ks.ApproxBytes})
+	}
+	return printJSON(out)
+}
+
+// replaced returns the version that kv replaced, the version that ended in transaction time when kv started and was
+// valid at kv's start valid time. It is nil if kv did not replace a version.
+func replaced(kvs []*bt.VersionedKV, kv *bt.VersionedKV) *bt.VersionedKV {
+	for _, v := range kvs {
+		if v.TxTimeEnd != nil && v.TxTimeEnd.Equal(kv.TxTimeStart) && v.ValidAt(kv.ValidTimeStart) {
+			return v
+		}
+	}
+	return nil
+}
+
+// runQuery executes a query statement and reports whether it was a write.
+func runQuery(db bt.DB, args []string) (isWrite bool, err error) {
+	if len(args) < 1 {
+		return false, errors.New("usage: query <statement>")
+	}
+	s, err := query.Parse(strings.Join(args, " "))
+	if err != nil {
+		return false, err
+	}
+	res, err := s.Exec(db)
+	if err != nil {
+		return false, err
+	}
+	if s.Op == query.OpSet || s.Op == query.OpDelete {
+		return true, nil
+	}
+	return false, printJSON(res)
+}
+
+// timeValue is a flag.Value for optional RFC 3339 times.
+type timeValue struct {
+	t *time.Time
+}
+
+func (v *timeValue) String() string {
+	if v.t == nil {
+		return ""
+	}
+	return v.t.Format(time.RFC3339)
+}
+
+func (v *timeValue) Set(s string) error {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return err
+	}
+	v.t = &t
+	return nil
+}
+
+func timeFlag(fs *flag.FlagSet, name, usage string) *timeValue {
+	v := &timeValue{}
+	fs.Var(v, name, usage+" (RFC 3339 datetime)")
+	return v
+}
+
+func readOpts(validTime, txTime *timeValue) []bt.ReadOpt {
+	var opts []bt.ReadOpt
+	if validTime.t != nil {
+		opts = append(opts, bt.AsOfValidTime(*validTime.t))
+	}
+	if txTime.t != nil {
+		opts = append(opts, bt.AsOfTransactionTime(*txTime.t))
+	}
+	return opts
+}
+
+func writeOpts(validTime, endValidTime *timeValue) []bt.WriteOpt {
+	var opts []bt.WriteOpt
+	if validTime.t != nil {
+		opts = append(opts, bt.WithValidTime(*validTime.t))
+	}
+	if endValidTime.t != nil {
+		opts = append(opts, bt.WithEndValidTime(*endValidTime.t))
+	}
+	return opts
+}
+
+func printJSON(v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, string(b))
+	return err
+}
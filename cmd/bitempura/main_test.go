@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/backup"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	var out bytes.Buffer
+	stdout = &out
+	t.Cleanup(func() { stdout = os.Stdout })
+	runJSON := func(v interface{}, args ...string) {
+		out.Reset()
+		require.Nil(t, run(append([]string{"-file", path}, args...)))
+		require.Nil(t, json.Unmarshal(out.Bytes(), v))
+	}
+
+	require.Nil(t, run([]string{"-file", path, "set", "-valid-time", "2022-01-01T00:00:00Z", "A", `{"n": 1}`}))
+	require.Nil(t, run([]string{"-file", path, "set", "A", `{"n": 2}`}))
+	require.Nil(t, run([]string{"-file", path, "query", "SET", "B", "=", `"x"`}))
+	require.Nil(t, run([]string{"-file", path, "set", "C", `true`}))
+	require.Nil(t, run([]string{"-file", path, "delete", "C"}))
+	assert.Empty(t, out.String(), "writes do not print")
+
+	// every run reloads the snapshot saved by the previous one
+	var kv bt.VersionedKV
+	runJSON(&kv, "get", "A")
+	assert.Equal(t, map[string]interface{}{"n": 2.0}, kv.Value)
+	runJSON(&kv, "get", "-valid-time", "2022-01-02T00:00:00Z", "A")
+	assert.Equal(t, map[string]interface{}{"n": 1.0}, kv.Value)
+	var kvs []*bt.VersionedKV
+	runJSON(&kvs, "list")
+	require.Len(t, kvs, 2)
+	values := map[string]bt.Value{}
+	for _, kv := range kvs {
+		values[kv.Key] = kv.Value
+	}
+	assert.Equal(t, map[string]bt.Value{"A": map[string]interface{}{"n": 2.0}, "B": "x"}, values)
+	runJSON(&kvs, "history", "A")
+	assert.Len(t, kvs, 3)
+	assert.ErrorIs(t, run([]string{"-file", path, "get", "C"}), bt.ErrNotFound)
+	runJSON(&kvs, "history", "C")
+	assert.Len(t, kvs, 2) // the deleted version and its re-assertion before the delete
+	var changes []struct {
+		Version *bt.VersionedKV
+		Changes bt.ChangeSet
+	}
+	runJSON(&changes, "history", "-diff", "A")
+	assert.Len(t, changes, 3)
+	runJSON(&kv, "query", "GET", "B")
+	assert.Equal(t, "x", kv.Value)
+	var sizes []keySize
+	runJSON(&sizes, "sizes", "-n", "1")
+	require.Len(t, sizes, 1)
+	assert.Equal(t, "A", sizes[0].Key)
+
+	// the snapshot holds every version
+	b, err := os.ReadFile(path)
+	require.Nil(t, err)
+	var snapshot []*bt.VersionedKV
+	require.Nil(t, json.Unmarshal(b, &snapshot))
+	assert.Len(t, snapshot, 6)
+}
+
+func TestRunFileEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "snapshot.json")
+	keyPath := filepath.Join(dir, "key")
+	require.Nil(t, os.WriteFile(keyPath, []byte(strings.Repeat("01", 32)+"\n"), 0600))
+	wrongKeyPath := filepath.Join(dir, "wrong-key")
+	require.Nil(t, os.WriteFile(wrongKeyPath, []byte(strings.Repeat("02", 32)), 0600))
+	var out bytes.Buffer
+	stdout = &out
+	t.Cleanup(func() { stdout = os.Stdout })
+
+	// a JSON snapshot is converted on the next write
+	require.Nil(t, run([]string{"-file", path, "set", "users/1", `{"name": "Alice"}`}))
+	require.Nil(t, run([]string{"-file", path, "-encryption-key-file", keyPath, "set", "users/2", `{"name": "Bob"}`}))
+	b, err := os.ReadFile(path)
+	require.Nil(t, err)
+	assert.True(t, backup.IsBackup(b))
+	assert.NotContains(t, string(b), "Alice")
+	assert.NotContains(t, string(b), "Bob")
+	assert.Contains(t, string(b), "users/1")
+
+	out.Reset()
+	require.Nil(t, run([]string{"-file", path, "-encryption-key-file", keyPath, "get", "users/1"}))
+	var kv bt.VersionedKV
+	require.Nil(t, json.Unmarshal(out.Bytes(), &kv))
+	assert.Equal(t, map[string]interface{}{"name": "Alice"}, kv.Value)
+	assert.NotNil(t, run([]string{"-file", path, "get", "users/1"}), "the key is required")
+	assert.NotNil(t, run([]string{"-file", path, "-encryption-key-file", wrongKeyPath, "get", "users/1"}))
+}
+
+func TestRunFileCompressed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	var out bytes.Buffer
+	stdout = &out
+	t.Cleanup(func() { stdout = os.Stdout })
+
+	doc := strings.Repeat("near-identical large document ", 100)
+	for i := 0; i < 5; i++ {
+		require.Nil(t, run([]string{"-file", path, "set", "A", fmt.Sprintf("%q", fmt.Sprint(doc, i))}))
+	}
+	b, err := os.ReadFile(path)
+	require.Nil(t, err)
+	uncompressed := len(b)
+	require.Nil(t, run([]string{"-file", path, "-compression", "zstd", "set", "A", fmt.Sprintf("%q", doc)}))
+	b, err = os.ReadFile(path)
+	require.Nil(t, err)
+	assert.True(t, backup.IsBackup(b))
+	assert.Less(t, len(b), uncompressed/2)
+
+	// the header records the compression, so the flag is not needed to read the snapshot
+	out.Reset()
+	require.Nil(t, run([]string{"-file", path, "get", "A"}))
+	var kv bt.VersionedKV
+	require.Nil(t, json.Unmarshal(out.Bytes(), &kv))
+	assert.Equal(t, doc, kv.Value)
+}
+
+func TestRunErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	for _, tC := range []struct {
+		desc string
+		args []string
+	}{
+		{desc: "no command", args: []string{"-file", path}},
+		{desc: "no backend", args: []string{"get", "A"}},
+		{desc: "multiple backends", args: []string{"-file", path, "-server", "http://localhost", "get", "A"}},
+		{desc: "sqlite without table", args: []string{"-sqlite", path, "get", "A"}},
+		{desc: "unknown command", args: []string{"-file", path, "put", "A"}},
+		{desc: "bad usage", args: []string{"-file", path, "set", "A"}},
+		{desc: "bad value", args: []string{"-file", path, "set", "A", "{"}},
+		{desc: "bad time", args: []string{"-file", path, "get", "-valid-time", "yesterday", "A"}},
+		{desc: "not found", args: []string{"-file", path, "get", "A"}},
+		{desc: "encryption without file",
+			args: []string{"-server", "http://localhost", "-encryption-key-file", path, "get", "A"}},
+		{desc: "compression without file", args: []string{"-server", "http://localhost", "-compression", "zstd", "get", "A"}},
+		{desc: "unknown compression", args: []string{"-file", path, "-compression", "lzma", "set", "A", "1"}},
+		{desc: "missing encryption key", args: []string{"-file", path, "-encryption-key-file", path + ".key", "get", "A"}},
+	} {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.NotNil(t, run(tC.args))
+		})
+	}
+	_, err := os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist, "failed commands do not save")
+}
@@ -0,0 +1,52 @@
+package bitempura
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Codec encodes and decodes Values, for example to persist, export, or transmit them.
+type Codec interface {
+	Marshal(v Value) ([]byte, error)
+	Unmarshal(b []byte) (Value, error)
+}
+
+// JSONCodec encodes Values as JSON. Decoded values have the types of encoding/json, so numbers are float64 and objects
+// are map[string]interface{}.
+var JSONCodec Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v Value) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(b []byte) (Value, error) {
+	var v Value
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// CheckSerializable verifies that value round-trips through codec: it must encode, decode, and encode again to the same
+// bytes. Decoded values may have different Go types than value, but must not lose information.
+func CheckSerializable(codec Codec, value Value) error {
+	b, err := codec.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("value is not serializable: %w", err)
+	}
+	decoded, err := codec.Unmarshal(b)
+	if err != nil {
+		return fmt.Errorf("value is not deserializable: %w", err)
+	}
+	reencoded, err := codec.Marshal(decoded)
+	if err != nil {
+		return fmt.Errorf("decoded value is not serializable: %w", err)
+	}
+	if !bytes.Equal(b, reencoded) {
+		return fmt.Errorf("value does not round-trip: encoded %s, then %s", b, reencoded)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package constraint
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	bt "github.com/elh/bitempura"
+)
+
+var _ bt.DB = (*DB)(nil)
+
+// ErrViolation is the error wrapped by Violations.
+var ErrViolation = errors.New("constraint violated")
+
+// Rule declares dependencies between keys.
+type Rule struct {
+	Name string
+	// Requires returns the keys that a Set of value to key depends on. It returns none if the rule does not apply.
+	Requires func(key string, value bt.Value) []string
+}
+
+// Violation is a write whose required key is not valid over the write's valid time range.
+type Violation struct {
+	Rule     string
+	Key      string
+	Required string
+	// ValidTime is the earliest valid time in the write's range at which Required is not valid.
+	ValidTime time.Time
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("%v: rule %q: key=%v requires key=%v valid at %v", ErrViolation, v.Rule, v.Key, v.Required,
+		v.ValidTime)
+}
+
+// Unwrap returns ErrViolation.
+func (v *Violation) Unwrap() error {
+	return ErrViolation
+}
+
+// Mode controls how a DB handles writes that violate a rule.
+type Mode int
+
+const (
+	// ModeReject fails the write with the Violation. This is the default.
+	ModeReject Mode = iota
+	// ModeWarn makes the write and reports the Violation to the handler set by WithViolationHandler.
+	ModeWarn
+	// ModeOff does not check rules.
+	ModeOff
+)
+
+func (m Mode) String() string {
+	switch m {
+	case ModeReject:
+		return "reject"
+	case ModeWarn:
+		return "warn"
+	case ModeOff:
+		return "off"
+	default:
+		return fmt.Sprintf("Mode(%d)", int(m))
+	}
+}
+
+// Wrap returns a DB that checks rules on Set. Rules are checked against the current state of the wrapped DB before the
+// write, so checks are not atomic with concurrent writes to required keys. Deleting a required key is not checked.
+func Wrap(db bt.DB, rules []*Rule, opts ...Opt) *DB {
+	options := &options{
+		clock:       &bt.DefaultClock{},
+		onViolation: func(*Violation) {},
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return &DB{db: db, rules: rules, clock: options.clock, mode: options.mode, onViolation: options.onViolation}
+}
+
+// DB is a DB that enforces rules between keys.
+type DB struct {
+	db          bt.DB
+	rules       []*Rule
+	clock       bt.Clock
+	mode        Mode
+	onViolation func(*Violation)
+}
+
+// options is a struct for processing Opt's to be used by DB
+type options struct {
+	clock       bt.Clock
+	mode        Mode
+	onViolation func(*Violation)
+}
+
+// Opt is an option for wrapping databases
+type Opt func(*options)
+
+// WithClock wraps the database with a clock to resolve defaulted valid times. It should be the wrapped DB's clock.
+func WithClock(clock bt.Clock) Opt {
+	return func(os *options) {
+		os.clock = clock
+	}
+}
+
+// WithMode wraps the database with an enforcement mode. The default is ModeReject.
+func WithMode(m Mode) Opt {
+	return func(os *options) {
+		os.mode = m
+	}
+}
+
+// WithViolationHandler wraps the database with a handler that is called with each Violation of a write made in
+// ModeWarn.
+func WithViolationHandler(fn func(*Violation)) Opt {
+	return func(os *options) {
+		os.onViolation = fn
+	}
+}
+
+// Get data by key (as of optional valid and transaction times).
+func (db *DB) Get(key string, opts ...bt.ReadOpt) (*bt.VersionedKV, error) {
+	return db.db.Get(key, opts...)
+}
+
+// List all data (as of optional valid and transaction times).
+func (db *DB) List(opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	return db.db.List(opts...)
+}
+
+// Set stores value (with optional start and end valid time) if the keys it requires are valid over its valid time
+// range.
+func (db *DB) Set(key string, value bt.Value, opts ...bt.WriteOpt) error {
+	if db.mode != ModeOff {
+		violations, err := db.Check(key, value, opts...)
+		if err != nil {
+			return err
+		}
+		if len(violations) > 0 {
+			if db.mode == ModeReject {
+				return violations[0]
+			}
+			for _, v := range violations {
+				db.onViolation(v)
+			}
+		}
+	}
+	return db.db.Set(key, value, opts...)
+}
+
+// Delete removes value (with optional start and end valid time).
+func (db *DB) Delete(key string, opts ...bt.WriteOpt) error {
+	return db.db.Delete(key, opts...)
+}
+
+// History returns versions by descending end transaction time, descending end valid time
+func (db *DB) History(key string, opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	return db.db.History(key, opts...)
+}
+
+// Check returns the Violations that a Set of value to key (with optional start and end valid time) would have, without
+// writing. Rules are checked regardless of the DB's mode.
+func (db *DB) Check(key string, value bt.Value, opts ...bt.WriteOpt) ([]*Violation, error) {
+	options := bt.ApplyWriteOpts(opts)
+	start := db.clock.Now()
+	if options.ValidTime != nil {
+		start = *options.ValidTime
+	}
+
+	var violations []*Violation
+	for _, rule := range db.rules {
+		for _, required := range rule.Requires(key, value) {
+			invalidAt, ok, err := db.firstInvalid(required, start, options.EndValidTime)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				violations = append(violations, &Violation{Rule: rule.Name, Key: key, Required: required,
+					ValidTime: invalidAt})
+			}
+		}
+	}
+	return violations, nil
+}
+
+// firstInvalid returns the earliest valid time in [start, end) at which key is not found as of now. An end of nil is
+// unbounded. ok is false if key is valid over the whole range.
+func (db *DB) firstInvalid(key string, start time.Time, end *time.Time) (invalidAt time.Time, ok bool, err error) {
+	for t := start; end == nil || t.Before(*end); {
+		kv, err := db.db.Get(key, bt.AsOfValidTime(t))
+		if errors.Is(err, bt.ErrNotFound) {
+			return t, true, nil
+		} else if err != nil {
+			return time.Time{}, false, err
+		}
+		if kv.ValidTimeEnd == nil {
+			return time.Time{}, false, nil
+		}
+		t = *kv.ValidTimeEnd
+	}
+	return time.Time{}, false, nil
+}
@@ -0,0 +1,79 @@
+package constraint_test
+
+import (
+	"strings"
+	"testing"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/elh/bitempura/constraint"
+	"github.com/elh/bitempura/dbtest/tt"
+	"github.com/elh/bitempura/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// orders require their customer.
+var rules = []*constraint.Rule{{
+	Name: "order requires customer",
+	Requires: func(key string, value bt.Value) []string {
+		if !strings.HasPrefix(key, "order/") {
+			return nil
+		}
+		return []string{"customer/" + value.(string)}
+	},
+}}
+
+func TestDB(t *testing.T) {
+	newDB := func(opts ...constraint.Opt) *constraint.DB {
+		c := clock.New(tt.Day(5))
+		inner, err := memory.NewDB(memory.WithClock(c), memory.WithVersionedKVs([]*bt.VersionedKV{
+			{Key: "customer/1", Value: "Alice", TxTimeStart: tt.Day(1), ValidTimeStart: tt.Day(1), ValidTimeEnd: tt.DayPtr(3)},
+			{Key: "customer/2", Value: "Bob", TxTimeStart: tt.Day(1), ValidTimeStart: tt.Day(1)},
+		}))
+		require.Nil(t, err)
+		return constraint.Wrap(inner, rules, append([]constraint.Opt{constraint.WithClock(c)}, opts...)...)
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		db := newDB()
+		require.Nil(t, db.Set("order/A", "2"))
+		require.Nil(t, db.Set("order/B", "1", bt.WithValidTime(tt.Day(1)), bt.WithEndValidTime(tt.Day(3))))
+		require.Nil(t, db.Set("other", "1"))
+
+		// customer/1 is not valid from day 3
+		err := db.Set("order/C", "1", bt.WithValidTime(tt.Day(2)))
+		require.ErrorIs(t, err, constraint.ErrViolation)
+		var v *constraint.Violation
+		require.ErrorAs(t, err, &v)
+		assert.Equal(t, &constraint.Violation{Rule: "order requires customer", Key: "order/C", Required: "customer/1",
+			ValidTime: tt.Day(3)}, v)
+		_, err = db.Get("order/C", bt.AsOfValidTime(tt.Day(2)))
+		assert.ErrorIs(t, err, bt.ErrNotFound)
+
+		// missing key
+		err = db.Set("order/D", "3")
+		assert.ErrorIs(t, err, constraint.ErrViolation)
+
+		// deletes are not checked
+		require.Nil(t, db.Delete("customer/2"))
+		violations, err := db.Check("order/A", "2")
+		require.Nil(t, err)
+		assert.Len(t, violations, 1)
+	})
+	t.Run("warn", func(t *testing.T) {
+		var violations []*constraint.Violation
+		db := newDB(constraint.WithMode(constraint.ModeWarn), constraint.WithViolationHandler(func(v *constraint.Violation) {
+			violations = append(violations, v)
+		}))
+		require.Nil(t, db.Set("order/D", "3"))
+		_, err := db.Get("order/D")
+		require.Nil(t, err)
+		require.Len(t, violations, 1)
+		assert.Equal(t, "customer/3", violations[0].Required)
+	})
+	t.Run("off", func(t *testing.T) {
+		db := newDB(constraint.WithMode(constraint.ModeOff))
+		require.Nil(t, db.Set("order/D", "3"))
+	})
+}
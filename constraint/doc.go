@@ -0,0 +1,4 @@
+// Package constraint provides a DB decorator that enforces referential integrity between keys. Rules declare the keys
+// that a write depends on, such as "order/X requires customer/Y", and the required keys must be valid over the written
+// valid time range when the write is made. It is usable with any bitempura.DB.
+package constraint
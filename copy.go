@@ -0,0 +1,141 @@
+package bitempura
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Importer is implemented by DBs that can store versions with their original transaction times, e.g. to restore a
+// backup or copy another DB.
+type Importer interface {
+	// Import stores versioned key-values as is. It fails without storing any of them if they are invalid or overlap
+	// each other or stored versions of the same key in both transaction time and valid time.
+	Import(kvs []*VersionedKV) error
+}
+
+// CopyProgress describes the progress of CopyAll.
+type CopyProgress struct {
+	Keys     int    // keys copied
+	Skipped  int    // keys skipped because they already had versions in the destination
+	Versions int    // versions copied
+	LastKey  string // last key copied or skipped. pass it to ResumeCopyAfter to resume an interrupted copy
+}
+
+// copyOptions is a struct for processing CopyOpt's to be used by CopyAll
+type copyOptions struct {
+	keys        []string
+	batchSize   int
+	resumeAfter *string
+	progress    func(CopyProgress)
+}
+
+// CopyOpt is an option for CopyAll
+type CopyOpt func(*copyOptions)
+
+// WithCopyKeys copies only keys instead of every key of the source DB, so the source does not need to be a KeyLister.
+func WithCopyKeys(keys []string) CopyOpt {
+	return func(os *copyOptions) {
+		os.keys = keys
+	}
+}
+
+// WithCopyBatchSize configures the number of keys whose histories are read and imported at a time. The default is 100.
+func WithCopyBatchSize(n int) CopyOpt {
+	return func(os *copyOptions) {
+		os.batchSize = n
+	}
+}
+
+// WithCopyProgress configures fn to be called with the progress of CopyAll after each batch of keys is imported.
+func WithCopyProgress(fn func(CopyProgress)) CopyOpt {
+	return func(os *copyOptions) {
+		os.progress = fn
+	}
+}
+
+// ResumeCopyAfter configures CopyAll to only copy keys after key, e.g. the LastKey of the last progress reported by an
+// interrupted copy.
+func ResumeCopyAfter(key string) CopyOpt {
+	return func(os *copyOptions) {
+		os.resumeAfter = &key
+	}
+}
+
+// CopyAll copies the full history of every key of src to dst, which must be an Importer, in ascending key order.
+// Histories are streamed in batches of keys, so src is never read in full. Keys that already have versions in dst are
+// skipped, so an interrupted copy can be rerun, or resumed from its last progress with ResumeCopyAfter. Each key is
+// imported atomically.
+func CopyAll(dst, src DB, opts ...CopyOpt) (*CopyProgress, error) {
+	options := &copyOptions{batchSize: 100}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if options.batchSize <= 0 {
+		return nil, errors.New("batch size must be positive")
+	}
+	importer, ok := dst.(Importer)
+	if !ok {
+		return nil, errors.New("destination DB must be an Importer")
+	}
+	keys := options.keys
+	if keys == nil {
+		kl, ok := src.(KeyLister)
+		if !ok {
+			return nil, errors.New("keys are required if source DB is not a KeyLister")
+		}
+		var err error
+		if keys, err = kl.Keys(); err != nil {
+			return nil, fmt.Errorf("failed to list keys: %w", err)
+		}
+	}
+	keys = append([]string(nil), keys...)
+	sort.Strings(keys)
+	if options.resumeAfter != nil {
+		keys = keys[sort.Search(len(keys), func(i int) bool { return keys[i] > *options.resumeAfter }):]
+	}
+
+	progress := &CopyProgress{}
+	for len(keys) > 0 {
+		n := options.batchSize
+		if n > len(keys) {
+			n = len(keys)
+		}
+		batch := keys[:n]
+		keys = keys[n:]
+
+		existing, err := Histories(dst, batch)
+		if err != nil {
+			return progress, err
+		}
+		histories, err := Histories(src, batch)
+		if err != nil {
+			return progress, err
+		}
+		var kvs []*VersionedKV
+		copied, skipped := 0, 0
+		for _, key := range batch {
+			if _, ok := existing[key]; ok {
+				skipped++
+				continue
+			}
+			if vs, ok := histories[key]; ok {
+				kvs = append(kvs, vs...)
+				copied++
+			}
+		}
+		if len(kvs) > 0 {
+			if err := importer.Import(kvs); err != nil {
+				return progress, fmt.Errorf("failed to import keys %v to %v: %w", batch[0], batch[len(batch)-1], err)
+			}
+		}
+		progress.Keys += copied
+		progress.Skipped += skipped
+		progress.Versions += len(kvs)
+		progress.LastKey = batch[len(batch)-1]
+		if options.progress != nil {
+			options.progress(*progress)
+		}
+	}
+	return progress, nil
+}
@@ -0,0 +1,62 @@
+package bitempura_test
+
+import (
+	"testing"
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/dbtest"
+	"github.com/elh/bitempura/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyAll(t *testing.T) {
+	kvs := dbtest.Generate(1, dbtest.WithKeyCount(5), dbtest.WithVersionsPerKey(4))
+	src, err := memory.NewDB(memory.WithVersionedKVs(kvs))
+	require.Nil(t, err)
+	keys, err := src.Keys()
+	require.Nil(t, err)
+	require.Len(t, keys, 5)
+
+	t.Run("copies every history", func(t *testing.T) {
+		dst, err := memory.NewDB()
+		require.Nil(t, err)
+		var reports []CopyProgress
+		progress, err := CopyAll(dst, src, WithCopyBatchSize(2), WithCopyProgress(func(p CopyProgress) {
+			reports = append(reports, p)
+		}))
+		require.Nil(t, err)
+		assert.Equal(t, &CopyProgress{Keys: 5, Versions: len(kvs), LastKey: keys[4]}, progress)
+		require.Len(t, reports, 3)
+		assert.Equal(t, keys[1], reports[0].LastKey)
+		assert.Equal(t, 2, reports[0].Keys)
+		for _, key := range keys {
+			expected, err := src.History(key)
+			require.Nil(t, err)
+			actual, err := dst.History(key)
+			require.Nil(t, err)
+			assert.ElementsMatch(t, expected, actual)
+		}
+		require.Nil(t, dbtest.CheckInvariants(dst, keys))
+	})
+	t.Run("resumes and skips copied keys", func(t *testing.T) {
+		dst, err := memory.NewDB()
+		require.Nil(t, err)
+		_, err = CopyAll(dst, src, WithCopyKeys(keys[:2]))
+		require.Nil(t, err)
+
+		progress, err := CopyAll(dst, src, ResumeCopyAfter(keys[0]))
+		require.Nil(t, err)
+		assert.Equal(t, 3, progress.Keys)
+		assert.Equal(t, 1, progress.Skipped)
+		dstKeys, err := dst.Keys()
+		require.Nil(t, err)
+		assert.Equal(t, keys, dstKeys)
+	})
+	t.Run("destination must be an Importer", func(t *testing.T) {
+		dst, err := memory.NewDB()
+		require.Nil(t, err)
+		_, err = CopyAll(struct{ DB }{dst}, src)
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,2 @@
+// Package csvimport imports CSV/TSV files into a bitempura.DB with configurable key, value, and time column mapping.
+package csvimport
@@ -0,0 +1,205 @@
+package csvimport
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+)
+
+// Config maps CSV columns (by header name) onto writes.
+type Config struct {
+	Comma rune // field delimiter. defaults to ','. use '\t' for TSV
+
+	KeyColumn string // required
+	// ValueColumns are stored as a map[string]interface{} of column name to cell. Ignored if ValueFn is set.
+	ValueColumns []string
+	// ValueFn optionally builds the value from the record of column name to cell.
+	ValueFn func(record map[string]string) (bt.Value, error)
+
+	ValidTimeColumn    string // optional. empty cells default to "now"
+	EndValidTimeColumn string // optional. empty cells are open ended
+	// TxTimeColumn optionally controls transaction times. Rows must be in non-decreasing transaction time order and
+	// Clock must be the clock of the DB.
+	TxTimeColumn string
+	Clock        clock.Settable
+
+	TimeLayout string // defaults to time.RFC3339
+	BatchSize  int    // rows read per batch. defaults to 1000
+}
+
+// Row is a single parsed CSV row.
+type Row struct {
+	Line         int
+	Key          string
+	Value        bt.Value
+	ValidTime    *time.Time
+	EndValidTime *time.Time
+	TxTime       *time.Time
+}
+
+// WriteOpts returns the write options for the row.
+func (r *Row) WriteOpts() []bt.WriteOpt {
+	var opts []bt.WriteOpt
+	if r.ValidTime != nil {
+		opts = append(opts, bt.WithValidTime(*r.ValidTime))
+	}
+	if r.EndValidTime != nil {
+		opts = append(opts, bt.WithEndValidTime(*r.EndValidTime))
+	}
+	return opts
+}
+
+// NewReader reads the header row and returns a Reader of Rows.
+func NewReader(r io.Reader, cfg Config) (*Reader, error) {
+	if cfg.KeyColumn == "" {
+		return nil, errors.New("key column is required")
+	}
+	if cfg.TxTimeColumn != "" && cfg.Clock == nil {
+		return nil, errors.New("clock is required with tx time column")
+	}
+	if cfg.TimeLayout == "" {
+		cfg.TimeLayout = time.RFC3339
+	}
+
+	cr := csv.NewReader(r)
+	if cfg.Comma != 0 {
+		cr.Comma = cfg.Comma
+	}
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %v", err)
+	}
+	cols := map[string]int{}
+	for i, name := range header {
+		cols[name] = i
+	}
+	for _, name := range append([]string{cfg.KeyColumn, cfg.ValidTimeColumn, cfg.EndValidTimeColumn, cfg.TxTimeColumn},
+		cfg.ValueColumns...) {
+		if _, ok := cols[name]; name != "" && !ok {
+			return nil, fmt.Errorf("missing column %v", name)
+		}
+	}
+	return &Reader{cr: cr, cfg: cfg, header: header, line: 1}, nil
+}
+
+// Reader reads Rows from CSV.
+type Reader struct {
+	cr     *csv.Reader
+	cfg    Config
+	header []string
+	line   int
+}
+
+// Read returns the next Row. It returns io.EOF when there are no more.
+func (r *Reader) Read() (*Row, error) {
+	cells, err := r.cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	r.line++
+
+	record := map[string]string{}
+	for i, name := range r.header {
+		if i < len(cells) {
+			record[name] = cells[i]
+		}
+	}
+	row := &Row{Line: r.line, Key: record[r.cfg.KeyColumn]}
+	if row.Key == "" {
+		return nil, fmt.Errorf("line %v: key is required", r.line)
+	}
+	if r.cfg.ValueFn != nil {
+		if row.Value, err = r.cfg.ValueFn(record); err != nil {
+			return nil, fmt.Errorf("line %v: %v", r.line, err)
+		}
+	} else {
+		value := map[string]interface{}{}
+		for _, name := range r.cfg.ValueColumns {
+			value[name] = record[name]
+		}
+		row.Value = value
+	}
+	if row.ValidTime, err = r.parseTime(record, r.cfg.ValidTimeColumn); err != nil {
+		return nil, err
+	}
+	if row.EndValidTime, err = r.parseTime(record, r.cfg.EndValidTimeColumn); err != nil {
+		return nil, err
+	}
+	if row.TxTime, err = r.parseTime(record, r.cfg.TxTimeColumn); err != nil {
+		return nil, err
+	}
+	if r.cfg.TxTimeColumn != "" && row.TxTime == nil {
+		return nil, fmt.Errorf("line %v: tx time is required", r.line)
+	}
+	return row, nil
+}
+
+func (r *Reader) parseTime(record map[string]string, column string) (*time.Time, error) {
+	if column == "" || record[column] == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(r.cfg.TimeLayout, record[column])
+	if err != nil {
+		return nil, fmt.Errorf("line %v: failed to parse %v: %v", r.line, column, err)
+	}
+	return &t, nil
+}
+
+// Import reads all rows and writes them to db in batches. It returns the number of rows written. If an error occurs,
+// rows before the failing row have already been written.
+func Import(r io.Reader, db bt.DB, cfg Config) (int, error) {
+	cr, err := NewReader(r, cfg)
+	if err != nil {
+		return 0, err
+	}
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+
+	var n int
+	for {
+		batch, readErr := readBatch(cr, batchSize)
+		if err := writeBatch(db, cfg.Clock, batch); err != nil {
+			return n, err
+		}
+		n += len(batch)
+		if errors.Is(readErr, io.EOF) {
+			return n, nil
+		} else if readErr != nil {
+			return n, readErr
+		}
+	}
+}
+
+// readBatch reads up to n rows. A non-nil error is returned with the rows read before it.
+func readBatch(cr *Reader, n int) ([]*Row, error) {
+	batch := make([]*Row, 0, n)
+	for len(batch) < n {
+		row, err := cr.Read()
+		if err != nil {
+			return batch, err
+		}
+		batch = append(batch, row)
+	}
+	return batch, nil
+}
+
+func writeBatch(db bt.DB, clock clock.Settable, batch []*Row) error {
+	for _, row := range batch {
+		if row.TxTime != nil {
+			if err := clock.SetNow(*row.TxTime); err != nil {
+				return fmt.Errorf("line %v: %v", row.Line, err)
+			}
+		}
+		if err := db.Set(row.Key, row.Value, row.WriteOpts()...); err != nil {
+			return fmt.Errorf("line %v: %v", row.Line, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package csvimport_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/elh/bitempura/csvimport"
+	"github.com/elh/bitempura/dbtest/tt"
+	"github.com/elh/bitempura/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	t1 = tt.Day(1)
+	t2 = tt.Day(2)
+	t3 = tt.Day(3)
+)
+
+func TestImport(t *testing.T) {
+	clock := &clock.Clock{}
+	db, err := memory.NewDB(memory.WithClock(clock))
+	require.Nil(t, err)
+
+	tsv := strings.Join([]string{
+		"account\tbalance\tfrom\tto\trecorded",
+		"Bob\t100\t2022-01-01\t\t2022-01-01",
+		"Alice\t50\t2022-01-01\t\t2022-01-01",
+		"Bob\t90\t2022-01-02\t2022-01-03\t2022-01-03",
+	}, "\n")
+	n, err := csvimport.Import(strings.NewReader(tsv), db, csvimport.Config{
+		Comma:     '\t',
+		KeyColumn: "account",
+		ValueFn: func(record map[string]string) (bt.Value, error) {
+			return strconv.Atoi(record["balance"])
+		},
+		ValidTimeColumn:    "from",
+		EndValidTimeColumn: "to",
+		TxTimeColumn:       "recorded",
+		Clock:              clock,
+		TimeLayout:         "2006-01-02",
+		BatchSize:          2,
+	})
+	require.Nil(t, err)
+	assert.Equal(t, 3, n)
+
+	kv, err := db.Get("Bob", bt.AsOfValidTime(t2))
+	require.Nil(t, err)
+	assert.Equal(t, 90, kv.Value)
+	assert.Equal(t, t3, kv.TxTimeStart)
+	kv, err = db.Get("Bob", bt.AsOfValidTime(t2), bt.AsOfTransactionTime(t1))
+	require.Nil(t, err)
+	assert.Equal(t, 100, kv.Value)
+	kv, err = db.Get("Alice")
+	require.Nil(t, err)
+	assert.Equal(t, 50, kv.Value)
+}
+
+func TestImport_Errors(t *testing.T) {
+	db, err := memory.NewDB()
+	require.Nil(t, err)
+
+	_, err = csvimport.Import(strings.NewReader("id,v\nA,1"), db, csvimport.Config{KeyColumn: "key"})
+	assert.NotNil(t, err, "missing key column")
+
+	n, err := csvimport.Import(strings.NewReader("id,v,from\nA,1,2022-01-01T00:00:00Z\nB,2,yesterday"), db,
+		csvimport.Config{KeyColumn: "id", ValueColumns: []string{"v"}, ValidTimeColumn: "from"})
+	assert.NotNil(t, err, "bad time")
+	assert.Equal(t, 1, n)
+	kv, err := db.Get("A")
+	require.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"v": "1"}, kv.Value)
+}
@@ -1,6 +1,8 @@
 package bitempura
 
 import (
+	"errors"
+	"fmt"
 	"time"
 )
 
@@ -8,7 +10,7 @@ import (
 //
 // Temporal control options.
 // ReadOpt's: AsOfValidTime, AsOfTransactionTime.
-// WriteOpt's: WithValidTime, WithEndValidTime.
+// WriteOpt's: WithValidTime, WithEndValidTime, WithOverlapPolicy, WithOverhangPolicy.
 type DB interface {
 	// Get data by key (as of optional valid and transaction times).
 	Get(key string, opts ...ReadOpt) (*VersionedKV, error)
@@ -19,46 +21,342 @@ type DB interface {
 	// Delete removes value (with optional start and end valid time).
 	Delete(key string, opts ...WriteOpt) error
 
-	// History returns all versioned key-values for key by descending end transaction time, descending end valid time.
-	History(key string) ([]*VersionedKV, error)
+	// History returns all versioned key-values for key by descending end transaction time, descending end valid time
+	// (filtered by optional valid and transaction times). See FilterHistory.
+	History(key string, opts ...ReadOpt) ([]*VersionedKV, error)
+}
+
+// KeyLister is implemented by DBs that can enumerate every key with versions, regardless of valid and transaction time.
+type KeyLister interface {
+	// Keys returns all keys in ascending order.
+	Keys() ([]string, error)
+}
+
+// HistoriesReader is implemented by DBs that can read the histories of many keys in one call, e.g. a single query or
+// lock acquisition.
+type HistoriesReader interface {
+	// Histories returns the versioned key-values of each key, ordered as History. Keys with no versions are omitted.
+	Histories(keys []string) (map[string][]*VersionedKV, error)
+}
+
+// Histories returns the versioned key-values of each key, ordered as History. Keys with no versions are omitted. If db is
+// a HistoriesReader, histories are read in one call. Otherwise, History is called for each key.
+func Histories(db DB, keys []string) (map[string][]*VersionedKV, error) {
+	if hr, ok := db.(HistoriesReader); ok {
+		return hr.Histories(keys)
+	}
+	out := make(map[string][]*VersionedKV, len(keys))
+	for _, key := range keys {
+		vs, err := db.History(key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to get history for key=%v: %w", key, err)
+		}
+		out[key] = vs
+	}
+	return out, nil
+}
+
+// ChangeLister is implemented by DBs that can find changed keys without reading every history, e.g. by an index on
+// transaction times.
+type ChangeLister interface {
+	// ChangedKeys returns the keys that gained or closed versions after transaction time since, in ascending order.
+	ChangedKeys(since time.Time) ([]string, error)
+}
+
+// ChangedKeys returns the keys that gained or closed versions after transaction time since, in ascending order. It
+// enables incremental syncs that read only changed keys. If db is a ChangeLister, changed keys are found by the DB.
+// Otherwise, db must be a KeyLister and the histories of all keys are read.
+func ChangedKeys(db DB, since time.Time) ([]string, error) {
+	if cl, ok := db.(ChangeLister); ok {
+		return cl.ChangedKeys(since)
+	}
+	kl, ok := db.(KeyLister)
+	if !ok {
+		return nil, errors.New("DB must be a ChangeLister or KeyLister")
+	}
+	keys, err := kl.Keys()
+	if err != nil {
+		return nil, err
+	}
+	histories, err := Histories(db, keys)
+	if err != nil {
+		return nil, err
+	}
+	var changed []string
+	for _, key := range keys {
+		for _, v := range histories[key] {
+			if v.TxTimeStart.After(since) || (v.TxTimeEnd != nil && v.TxTimeEnd.After(since)) {
+				changed = append(changed, key)
+				break
+			}
+		}
+	}
+	return changed, nil
+}
+
+// MultiGetter is implemented by DBs that can read many keys in one call, e.g. a single query or lock acquisition.
+type MultiGetter interface {
+	// GetMulti returns the data of each key (as of optional valid and transaction times) in the order of keys. Results
+	// are nil for keys that are not found.
+	GetMulti(keys []string, opts ...ReadOpt) ([]*VersionedKV, error)
+}
+
+// GetMulti returns the data of each key (as of optional valid and transaction times) in the order of keys. Results are
+// nil for keys that are not found. If db is a MultiGetter, keys are read in one call. Otherwise, Get is called for each
+// key.
+func GetMulti(db DB, keys []string, opts ...ReadOpt) ([]*VersionedKV, error) {
+	if mg, ok := db.(MultiGetter); ok {
+		return mg.GetMulti(keys, opts...)
+	}
+	out := make([]*VersionedKV, len(keys))
+	for i, key := range keys {
+		kv, err := db.Get(key, opts...)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to get key=%v: %w", key, err)
+		}
+		out[i] = kv
+	}
+	return out, nil
+}
+
+// ListStreamer is implemented by DBs that can stream List results without building the full slice.
+type ListStreamer interface {
+	// ListFunc calls fn with each result of List (as of optional valid and transaction times) until fn returns false.
+	ListFunc(fn func(*VersionedKV) bool, opts ...ReadOpt) error
+}
+
+// ListFunc calls fn with each result of List (as of optional valid and transaction times) until fn returns false. If db
+// is a ListStreamer, results are streamed with bounded memory. Otherwise, they are read with List.
+func ListFunc(db DB, fn func(*VersionedKV) bool, opts ...ReadOpt) error {
+	if ls, ok := db.(ListStreamer); ok {
+		return ls.ListFunc(fn, opts...)
+	}
+	kvs, err := db.List(opts...)
+	if err != nil {
+		return err
+	}
+	for _, kv := range kvs {
+		if !fn(kv) {
+			break
+		}
+	}
+	return nil
 }
 
 // WriteOptions is a struct for processing WriteOpt's specified on writes.
 type WriteOptions struct {
-	ValidTime    *time.Time
-	EndValidTime *time.Time
+	ValidTime      *time.Time
+	EndValidTime   *time.Time
+	ValidDuration  *time.Duration // resolved to EndValidTime by ApplyWriteOpts if ValidTime is set
+	AllValidTime   bool
+	OverlapPolicy  *OverlapPolicy
+	OverhangPolicy *OverhangPolicy
+	DecisionTime   *time.Time
+	IdempotencyKey string
+
+	FutureValidTime bool // valid times may be after the transaction time. see WithFutureValidTime
 }
 
-// ApplyWriteOpts applies WriteOpt's to a WriteOptions struct for usage by the DB.
+// ApplyWriteOpts applies WriteOpt's to a WriteOptions struct for usage by the DB. A valid duration is resolved to an end
+// valid time if a valid time is set and an end valid time is not. DBs reject writes with an unresolved ValidDuration.
 func ApplyWriteOpts(opts []WriteOpt) *WriteOptions {
 	os := &WriteOptions{}
 	for _, opt := range opts {
 		opt(os)
 	}
+	if os.ValidDuration != nil && os.ValidTime != nil && os.EndValidTime == nil {
+		end := os.ValidTime.Add(*os.ValidDuration)
+		os.EndValidTime, os.ValidDuration = &end, nil
+	}
 	return os
 }
 
 // WriteOpt is an option for database writes
 type WriteOpt func(*WriteOptions)
 
-// WithValidTime allows writer to configure explicit valid time. Valid times cannot be set in the future.
+// WithValidTime allows writer to configure explicit valid time. Valid times cannot be set in the future unless
+// WithFutureValidTime is set. Facts that have been valid since forever can be written WithValidTime(BeginningOfTime).
 func WithValidTime(t time.Time) WriteOpt {
 	return func(os *WriteOptions) {
 		os.ValidTime = &t
 	}
 }
 
-// WithEndValidTime allows writer to configure explicit end valid time. Valid times cannot be set in the future.
+// WithEndValidTime allows writer to configure explicit end valid time. Valid times cannot be set in the future unless
+// WithFutureValidTime is set.
 func WithEndValidTime(t time.Time) WriteOpt {
 	return func(os *WriteOptions) {
 		os.EndValidTime = &t
 	}
 }
 
+// WithValidDuration allows writer to configure the end valid time as the valid time plus d, e.g. for a fact valid for
+// exactly 30 days. It requires WithValidTime, since the default valid time is the transaction time, and cannot be
+// combined with WithEndValidTime.
+func WithValidDuration(d time.Duration) WriteOpt {
+	return func(os *WriteOptions) {
+		os.ValidDuration = &d
+	}
+}
+
+// WithAllValidTime allows writer to Delete a key at every valid time, ending all current versions of the key as of the
+// transaction time without re-asserting any of their values. It is only valid for Delete and cannot be combined with
+// WithValidTime or WithEndValidTime.
+func WithAllValidTime() WriteOpt {
+	return func(os *WriteOptions) {
+		os.AllValidTime = true
+	}
+}
+
+// WithFutureValidTime allows writer to set valid times after the transaction time, e.g. to record ahead of time that a
+// price takes effect next week. Versions are not visible at valid times before they start, so reads as of now exclude
+// them until they take effect. Other versions of the key are clipped as of the transaction time as usual, so a later
+// write valid from now without an end replaces the scheduled value.
+func WithFutureValidTime() WriteOpt {
+	return func(os *WriteOptions) {
+		os.FutureValidTime = true
+	}
+}
+
+// WithDecisionTime allows writer to record when the written fact was decided, for domains that distinguish when a
+// decision was made from when it was recorded. Decision times cannot be after the transaction time. Overhangs of
+// clipped versions retain their original decision time. Decision times are opt-in and supported by memory.DB.
+func WithDecisionTime(t time.Time) WriteOpt {
+	return func(os *WriteOptions) {
+		os.DecisionTime = &t
+	}
+}
+
+// WithIdempotencyKey allows writer to make retries of a write no-ops. A DB that supports idempotency keys remembers
+// recently applied keys and returns nil without writing if a write has a key it has applied. Keys are scoped to the DB,
+// not the written key, so they should identify the write, e.g. an ingest pipeline's message ID.
+func WithIdempotencyKey(k string) WriteOpt {
+	return func(os *WriteOptions) {
+		os.IdempotencyKey = k
+	}
+}
+
+// OverlapPolicy controls how a Set is handled if its valid time range overlaps current versions of the key.
+type OverlapPolicy int
+
+const (
+	// OverlapClip ends the overlapped versions and retains their values outside of the new valid time range. This is
+	// the default.
+	OverlapClip OverlapPolicy = iota
+	// OverlapReject fails the Set with ErrOverlap, treating facts as append-only in valid time. Delete is unaffected.
+	OverlapReject
+)
+
+func (p OverlapPolicy) String() string {
+	switch p {
+	case OverlapClip:
+		return "clip"
+	case OverlapReject:
+		return "reject"
+	default:
+		return fmt.Sprintf("OverlapPolicy(%d)", int(p))
+	}
+}
+
+// WithOverlapPolicy allows writer to override the DB's overlap policy for a write. For example, a correction to a DB
+// that rejects overlap can be made with WithOverlapPolicy(OverlapClip).
+func WithOverlapPolicy(p OverlapPolicy) WriteOpt {
+	return func(os *WriteOptions) {
+		os.OverlapPolicy = &p
+	}
+}
+
+// OverhangPolicy controls how a write with an end valid time handles versions that remain valid after the write's valid
+// time range. Their values for the valid time before the write are always re-asserted.
+type OverhangPolicy int
+
+const (
+	// OverhangReassert re-asserts the old values after the write's end valid time, so they resume after the write's
+	// valid time range. This is the default.
+	OverhangReassert OverhangPolicy = iota
+	// OverhangTruncate ends the old versions at the write's start valid time, so nothing is valid after the write's
+	// valid time range unless it is written.
+	OverhangTruncate
+	// OverhangReject fails the write with ErrOverhang if old values would resume after the write's valid time range.
+	OverhangReject
+)
+
+func (p OverhangPolicy) String() string {
+	switch p {
+	case OverhangReassert:
+		return "reassert"
+	case OverhangTruncate:
+		return "truncate"
+	case OverhangReject:
+		return "reject"
+	default:
+		return fmt.Sprintf("OverhangPolicy(%d)", int(p))
+	}
+}
+
+// WithOverhangPolicy allows writer to choose how versions that remain valid after the write's end valid time are
+// handled. See OverhangPolicy.
+func WithOverhangPolicy(p OverhangPolicy) WriteOpt {
+	return func(os *WriteOptions) {
+		os.OverhangPolicy = &p
+	}
+}
+
+// NilValuePolicy controls how a DB handles Set with a nil Value.
+type NilValuePolicy int
+
+const (
+	// NilValueAllow stores nil like any other value. This is the default.
+	NilValueAllow NilValuePolicy = iota
+	// NilValueReject fails the Set with ErrNilValue.
+	NilValueReject
+	// NilValueDelete converts the Set into a Delete with the same write options.
+	NilValueDelete
+)
+
+// TxTimePolicy controls how a DB handles a write whose clock time precedes the latest transaction time it has issued,
+// for example after a restart with a skewed system clock. Such writes are retroactive in transaction time and change
+// what the DB reports it knew in the past.
+type TxTimePolicy int
+
+const (
+	// TxTimeAllow writes at the clock's time. This is the default.
+	TxTimeAllow TxTimePolicy = iota
+	// TxTimeReject fails the write with ErrTxTimeRegressed.
+	TxTimeReject
+	// TxTimeAdjust writes at the latest issued transaction time instead. Defaulted valid times are adjusted as well.
+	TxTimeAdjust
+)
+
+// HistoryLimitPolicy controls how a DB with a limit on versions per key handles a write that would exceed it, for
+// example from a runaway writer correcting the same key in a loop.
+type HistoryLimitPolicy int
+
+const (
+	// HistoryLimitReject fails the write with ErrHistoryLimit.
+	HistoryLimitReject HistoryLimitPolicy = iota
+	// HistoryLimitCompact makes the write and then permanently removes the key's versions with the earliest
+	// transaction time ends until it is within the limit. Versions that are current in transaction time are never
+	// removed, so the limit may be exceeded by current versions. Reads as of the removed transaction times change.
+	HistoryLimitCompact
+)
+
 // ReadOptions is a struct for processing ReadOpt's specified on reads.
 type ReadOptions struct {
-	ValidTime *time.Time
-	TxTime    *time.Time
+	ValidTime    *time.Time
+	TxTime       *time.Time
+	DecisionTime *time.Time
+	KeyFilter    KeyFilter // only scopes List and ListFunc
+
+	ValidTimeWindow *TimeWindow // only filters History. see WithValidTimeWindow
+
+	// relative times are resolved against the DB's clock. see ResolveAgo
+	ValidTimeAgo *time.Duration
+	TxTimeAgo    *time.Duration
 }
 
 // ApplyReadOpts applies ReadOpt's to a ReadOptions struct for usage by the DB.
@@ -76,13 +374,22 @@ type ReadOpt func(*ReadOptions)
 // AsOfValidTime allows reader to read as of a specified valid time
 func AsOfValidTime(t time.Time) ReadOpt {
 	return func(os *ReadOptions) {
-		os.ValidTime = &t
+		os.ValidTime, os.ValidTimeAgo, os.ValidTimeWindow = &t, nil, nil
 	}
 }
 
 // AsOfTransactionTime allows reader to read as of a specified transaction time
 func AsOfTransactionTime(t time.Time) ReadOpt {
 	return func(os *ReadOptions) {
-		os.TxTime = &t
+		os.TxTime, os.TxTimeAgo = &t, nil
+	}
+}
+
+// AsOfDecisionTime allows reader to only read versions decided at or before a specified decision time. See
+// VersionedKV.DecidedAt. It filters the version read as of valid and transaction time and does not fall back to an
+// earlier version, so a key whose visible version was decided later is not found.
+func AsOfDecisionTime(t time.Time) ReadOpt {
+	return func(os *ReadOptions) {
+		os.DecisionTime = &t
 	}
 }
@@ -0,0 +1,59 @@
+package bitempura_test
+
+import (
+	"testing"
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/dbtest"
+	"github.com/elh/bitempura/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistories(t *testing.T) {
+	kvs := dbtest.Generate(1, dbtest.WithKeyCount(3), dbtest.WithVersionsPerKey(10))
+	db, err := memory.NewDB(memory.WithVersionedKVs(kvs))
+	require.Nil(t, err)
+	keys := []string{"key-000", "key-002", "missing"}
+
+	expected := map[string][]*VersionedKV{}
+	for _, key := range keys[:2] {
+		vs, err := db.History(key)
+		require.Nil(t, err)
+		expected[key] = vs
+	}
+
+	histories, err := Histories(db, keys)
+	require.Nil(t, err)
+	assert.Equal(t, expected, histories)
+
+	// without HistoriesReader
+	histories, err = Histories(struct{ DB }{db}, keys)
+	require.Nil(t, err)
+	assert.Equal(t, expected, histories)
+}
+
+func TestListFunc(t *testing.T) {
+	kvs := dbtest.Generate(1, dbtest.WithKeyCount(5), dbtest.WithVersionsPerKey(5))
+	db, err := memory.NewDB(memory.WithVersionedKVs(kvs))
+	require.Nil(t, err)
+	expected, err := db.List()
+	require.Nil(t, err)
+	require.Len(t, expected, 5)
+
+	for _, db := range []DB{db, struct{ DB }{db}} { // with and without ListStreamer
+		var got []*VersionedKV
+		require.Nil(t, ListFunc(db, func(kv *VersionedKV) bool {
+			got = append(got, kv)
+			return true
+		}))
+		assert.ElementsMatch(t, expected, got)
+
+		var n int
+		require.Nil(t, ListFunc(db, func(kv *VersionedKV) bool {
+			n++
+			return n < 2
+		}))
+		assert.Equal(t, 2, n, "stops when fn returns false")
+	}
+}
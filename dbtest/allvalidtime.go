@@ -0,0 +1,53 @@
+package dbtest
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestAllValidTime tests that a Delete with WithAllValidTime ends every current version of a key, including versions
+// before and after the default valid time, that it retains the key's history, and that it is rejected for Set. dbFn
+// must return an empty DB using clock for transaction times.
+func TestAllValidTime(t *testing.T, oldValue, newValue Value, dbFn func(clock Clock) (DB, error)) {
+	c := clock.New(t2)
+	db, err := dbFn(c)
+	require.Nil(t, err)
+	require.Nil(t, db.Set("A", oldValue, WithValidTime(t1), WithEndValidTime(t2)))
+	require.Nil(t, db.Set("A", newValue))
+	require.Nil(t, db.Set("B", oldValue))
+
+	require.NotNil(t, db.Set("A", newValue, WithAllValidTime()))
+	require.NotNil(t, db.Delete("A", WithAllValidTime(), WithValidTime(t1)))
+
+	require.Nil(t, c.SetNow(t3))
+	require.Nil(t, db.Delete("A", WithAllValidTime()))
+	for _, vt := range []time.Time{t1, t2, t3} {
+		_, err = db.Get("A", AsOfValidTime(vt))
+		assert.ErrorIs(t, err, ErrNotFound, "valid time %v", vt)
+	}
+	// no values are re-asserted
+	vs, err := db.History("A")
+	require.Nil(t, err)
+	assert.Len(t, vs, 2)
+	for _, v := range vs {
+		assert.NotNil(t, v.TxTimeEnd)
+	}
+	// as of before the delete
+	kv, err := db.Get("A", AsOfValidTime(t1), AsOfTransactionTime(t2))
+	require.Nil(t, err)
+	assert.Equal(t, oldValue, kv.Value)
+	kv, err = db.Get("A", AsOfTransactionTime(t2))
+	require.Nil(t, err)
+	assert.Equal(t, newValue, kv.Value)
+
+	// other keys are unaffected and deleting a deleted key is a no-op
+	_, err = db.Get("B")
+	require.Nil(t, err)
+	require.Nil(t, db.Delete("A", WithAllValidTime()))
+	require.Nil(t, CheckInvariants(db, []string{"A", "B"}))
+}
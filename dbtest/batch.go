@@ -0,0 +1,128 @@
+package dbtest
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestWriteBatch tests that a WriteBatch applies its writes in order at a single transaction time, and that a failed
+// batch applies none of them. dbFn must return an empty DB using clock for transaction times that is a BatchWriter.
+func TestWriteBatch(t *testing.T, oldValue, newValue Value, dbFn func(clock Clock) (DB, error)) {
+	c := clock.New(t1)
+	db, err := dbFn(c)
+	require.Nil(t, err)
+	require.Nil(t, db.Set("A", oldValue))
+	require.Nil(t, db.Set("B", oldValue))
+
+	// every write has the same transaction time even though the clock advances
+	require.Nil(t, c.SetNow(t2))
+	require.Nil(t, c.AutoAdvance(time.Minute))
+	b := &WriteBatch{}
+	b.Set("A", newValue)
+	b.Delete("B")
+	b.Set("C", oldValue, WithValidTime(t1))
+	require.Equal(t, 3, b.Len())
+	require.Nil(t, ApplyBatch(db, b))
+	a, err := db.Get("A")
+	require.Nil(t, err)
+	assert.Equal(t, newValue, a.Value)
+	_, err = db.Get("B")
+	assert.ErrorIs(t, err, ErrNotFound)
+	kv, err := db.Get("C")
+	require.Nil(t, err)
+	assert.Equal(t, oldValue, kv.Value)
+	assert.True(t, kv.TxTimeStart.Equal(a.TxTimeStart), "tx times %v and %v", kv.TxTimeStart, a.TxTimeStart)
+	vs, err := db.History("B")
+	require.Nil(t, err)
+	require.Len(t, vs, 2)
+	assert.True(t, vs[0].TxTimeStart.Equal(a.TxTimeStart), "tx times %v and %v", vs[0].TxTimeStart, a.TxTimeStart)
+	require.NotNil(t, vs[1].TxTimeEnd)
+	assert.True(t, vs[1].TxTimeEnd.Equal(a.TxTimeStart), "tx times %v and %v", vs[1].TxTimeEnd, a.TxTimeStart)
+
+	// a key may be written at most once
+	b = &WriteBatch{}
+	b.Set("D", oldValue)
+	b.Set("E", oldValue)
+	b.Set("D", newValue)
+	err = ApplyBatch(db, b)
+	require.ErrorIs(t, err, ErrInvalidWrite)
+	var batchErr *BatchWriteError
+	require.True(t, errors.As(err, &batchErr))
+	assert.Equal(t, 2, batchErr.Index)
+	assert.Equal(t, "D", batchErr.Key)
+	_, err = db.History("D")
+	assert.ErrorIs(t, err, ErrNotFound)
+	b = &WriteBatch{}
+	b.Set("D", newValue)
+	require.Nil(t, ApplyBatch(db, b))
+	vs, err = db.History("D")
+	require.Nil(t, err)
+	require.Len(t, vs, 1)
+	assert.Equal(t, newValue, vs[0].Value)
+	assert.Nil(t, vs[0].TxTimeEnd)
+	assert.Nil(t, vs[0].Validate())
+
+	// a failed write fails the batch without applying earlier writes
+	b = &WriteBatch{}
+	b.Set("E", oldValue)
+	b.Set("C", newValue)
+	b.Set("A", oldValue, WithValidTime(t1), WithOverlapPolicy(OverlapReject))
+	err = ApplyBatch(db, b)
+	require.ErrorIs(t, err, ErrOverlap)
+	require.True(t, errors.As(err, &batchErr))
+	assert.Equal(t, 2, batchErr.Index)
+	assert.Equal(t, "A", batchErr.Key)
+	_, err = db.Get("E")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = db.History("E")
+	assert.ErrorIs(t, err, ErrNotFound)
+	kv, err = db.Get("C")
+	require.Nil(t, err)
+	assert.Equal(t, oldValue, kv.Value)
+	vs, err = db.History("C")
+	require.Nil(t, err)
+	assert.Len(t, vs, 1)
+	kv, err = db.Get("A")
+	require.Nil(t, err)
+	assert.Equal(t, newValue, kv.Value)
+
+	// invalid writes fail the batch before any are applied
+	b = &WriteBatch{}
+	b.Set("E", oldValue)
+	b.Set("C", newValue, WithValidTime(t4))
+	assert.NotNil(t, ApplyBatch(db, b))
+	_, err = db.History("E")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// writes without options default their valid time to the batch's transaction time
+	b = &WriteBatch{}
+	var keys []string
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("F%02d", i)
+		keys = append(keys, key)
+		if i == 50 {
+			b.Set(key, oldValue, WithValidTime(t1))
+			continue
+		}
+		b.Set(key, oldValue)
+	}
+	require.Nil(t, ApplyBatch(db, b))
+	for i, key := range keys {
+		kv, err := db.Get(key)
+		require.Nil(t, err)
+		validTime := kv.TxTimeStart
+		if i == 50 {
+			validTime = t1
+		}
+		assert.True(t, kv.ValidTimeStart.Equal(validTime), "key %v valid time %v", key, kv.ValidTimeStart)
+	}
+
+	require.Nil(t, CheckInvariants(db, append([]string{"A", "B", "C", "D"}, keys...)))
+}
@@ -0,0 +1,52 @@
+package dbtest
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBeginningOfTime tests that a fact written WithValidTime(BeginningOfTime) is read as of every valid time,
+// including times before BeginningOfTime, that clipping it retains BeginningOfTime as the start of its overhang, and
+// that other valid times before BeginningOfTime are rejected. dbFn must return an empty DB using clock for transaction
+// times.
+func TestBeginningOfTime(t *testing.T, oldValue, newValue Value, dbFn func(clock Clock) (DB, error)) {
+	c := clock.New(t1)
+	db, err := dbFn(c)
+	require.Nil(t, err)
+	require.Nil(t, db.Set("A", oldValue, WithValidTime(BeginningOfTime)))
+
+	ancient := time.Date(1, 1, 2, 0, 0, 0, 0, time.UTC)
+	medieval := time.Date(1500, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, vt := range []time.Time{ancient, medieval, BeginningOfTime, t1} {
+		kv, err := db.Get("A", AsOfValidTime(vt))
+		require.Nil(t, err, "valid time %v", vt)
+		assert.Equal(t, oldValue, kv.Value)
+		assert.True(t, kv.ValidSinceBeginning(), "valid time start %v", kv.ValidTimeStart)
+		assert.True(t, kv.ValidAt(vt))
+	}
+	kvs, err := db.List(AsOfValidTime(ancient))
+	require.Nil(t, err)
+	assert.Len(t, kvs, 1)
+
+	// other times before BeginningOfTime cannot be written
+	assert.NotNil(t, db.Set("B", oldValue, WithValidTime(medieval)))
+
+	// clipping retains the beginning of time
+	require.Nil(t, c.SetNow(t2))
+	require.Nil(t, db.Set("A", newValue, WithValidTime(t1)))
+	kv, err := db.Get("A", AsOfValidTime(medieval))
+	require.Nil(t, err)
+	assert.Equal(t, oldValue, kv.Value)
+	assert.True(t, kv.ValidSinceBeginning())
+	require.NotNil(t, kv.ValidTimeEnd)
+	assert.True(t, kv.ValidTimeEnd.Equal(t1))
+	kv, err = db.Get("A")
+	require.Nil(t, err)
+	assert.Equal(t, newValue, kv.Value)
+	require.Nil(t, CheckInvariants(db, []string{"A"}))
+}
@@ -0,0 +1,286 @@
+package dbtest
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/elh/bitempura"
+	"github.com/stretchr/testify/require"
+)
+
+// Capability is an optional feature of a backend. Suites declare the capabilities they require and RunSuites skips
+// suites a backend does not support.
+type Capability string
+
+// Capabilities
+const (
+	// CapabilitySeed means the backend can be constructed with VersionedKVs. Without it, fixtures are built by
+	// replaying writes, which requires CapabilityWrite and CapabilityClock.
+	CapabilitySeed Capability = "seed"
+	// CapabilityWrite means the backend implements Set and Delete.
+	CapabilityWrite Capability = "write"
+	// CapabilityClock means the backend uses the provided clock for transaction times.
+	CapabilityClock Capability = "clock"
+	// CapabilityKeys means the backend implements KeyLister.
+	CapabilityKeys Capability = "keys"
+	// CapabilityConcurrency means the backend is safe for concurrent use.
+	CapabilityConcurrency Capability = "concurrency"
+	// CapabilityBatch means the backend implements BatchWriter.
+	CapabilityBatch Capability = "batch"
+)
+
+// Backend describes a DB implementation under test for RunSuites.
+type Backend struct {
+	// Capabilities the backend supports.
+	Capabilities []Capability
+	// NewDB returns a DB under test and a function to close it after the test is complete. kvs are the VersionedKVs to
+	// seed the DB with and are always empty if the backend does not have CapabilitySeed. clock provides transaction
+	// times and may be ignored if the backend does not have CapabilityClock.
+	NewDB func(kvs []*VersionedKV, clock Clock) (db DB, closeFn func(), err error)
+	// OldValue and NewValue are the values used by fixtures. Defaults to "OLD" and "NEW".
+	OldValue, NewValue Value
+	// Skip names suites that RunSuites skips, such as suites of known limitations of the backend.
+	Skip []string
+}
+
+func (b *Backend) has(c Capability) bool {
+	for _, bc := range b.Capabilities {
+		if bc == c {
+			return true
+		}
+	}
+	return false
+}
+
+// canBuildFixtures returns true if the backend can be seeded or fixtures can be replayed.
+func (b *Backend) canBuildFixtures() bool {
+	return b.has(CapabilitySeed) || (b.has(CapabilityWrite) && b.has(CapabilityClock))
+}
+
+// seeded returns a dbFn for the read suites.
+func (b *Backend) seeded() func(kvs []*VersionedKV) (DB, func(), error) {
+	if b.has(CapabilitySeed) {
+		return func(kvs []*VersionedKV) (DB, func(), error) {
+			return b.NewDB(kvs, &DefaultClock{})
+		}
+	}
+	return FixturesByReplay(b.empty)
+}
+
+// seededWithClock returns a dbFn for the write suites.
+func (b *Backend) seededWithClock() func(kvs []*VersionedKV, clock Clock) (DB, func(), error) {
+	if b.has(CapabilitySeed) {
+		return b.NewDB
+	}
+	return FixturesByReplayWithClock(b.empty)
+}
+
+func (b *Backend) empty(clock Clock) (DB, func(), error) {
+	return b.NewDB(nil, clock)
+}
+
+// emptyFn returns a dbFn for the suites of empty DBs that closes each DB when t completes.
+func (b *Backend) emptyFn(t *testing.T) func(clock Clock) (DB, error) {
+	return func(clock Clock) (DB, error) {
+		db, closeFn, err := b.empty(clock)
+		if err == nil {
+			t.Cleanup(closeFn)
+		}
+		return db, err
+	}
+}
+
+// suite is a dbtest suite runnable by RunSuites.
+type suite struct {
+	name     string
+	requires []Capability
+	run      func(t *testing.T, b *Backend, opts []SuiteOpt)
+}
+
+// suites in the order they are run.
+var suites = []suite{
+	{
+		name: "Get",
+		run: func(t *testing.T, b *Backend, opts []SuiteOpt) {
+			TestGet(t, b.OldValue, b.NewValue, b.seeded(), opts...)
+		},
+	},
+	{
+		name: "List",
+		run: func(t *testing.T, b *Backend, opts []SuiteOpt) {
+			TestList(t, b.OldValue, b.NewValue, b.seeded(), opts...)
+		},
+	},
+	{
+		name: "History",
+		run: func(t *testing.T, b *Backend, opts []SuiteOpt) {
+			TestHistory(t, b.OldValue, b.NewValue, b.seeded(), opts...)
+		},
+	},
+	{
+		name:     "Set",
+		requires: []Capability{CapabilityWrite, CapabilityClock},
+		run: func(t *testing.T, b *Backend, opts []SuiteOpt) {
+			dbFn := b.seededWithClock()
+			TestSet(t, func(kvs []*VersionedKV, clock Clock) (DB, error) {
+				db, closeFn, err := dbFn(kvs, clock)
+				if err == nil {
+					t.Cleanup(closeFn)
+				}
+				return db, err
+			}, opts...)
+		},
+	},
+	{
+		name:     "Delete",
+		requires: []Capability{CapabilityWrite, CapabilityClock},
+		run: func(t *testing.T, b *Backend, opts []SuiteOpt) {
+			TestDelete(t, b.OldValue, b.NewValue, b.seededWithClock(), opts...)
+		},
+	},
+	{
+		name:     "OverlapPolicy",
+		requires: []Capability{CapabilityWrite, CapabilityClock},
+		run: func(t *testing.T, b *Backend, opts []SuiteOpt) {
+			TestOverlapPolicy(t, b.OldValue, b.NewValue, b.emptyFn(t))
+		},
+	},
+	{
+		name:     "OverhangPolicy",
+		requires: []Capability{CapabilityWrite, CapabilityClock},
+		run: func(t *testing.T, b *Backend, opts []SuiteOpt) {
+			TestOverhangPolicy(t, b.OldValue, b.NewValue, b.emptyFn(t))
+		},
+	},
+	{
+		name:     "AllValidTime",
+		requires: []Capability{CapabilityWrite, CapabilityClock},
+		run: func(t *testing.T, b *Backend, opts []SuiteOpt) {
+			TestAllValidTime(t, b.OldValue, b.NewValue, b.emptyFn(t))
+		},
+	},
+	{
+		name:     "WriteBatch",
+		requires: []Capability{CapabilityWrite, CapabilityClock, CapabilityBatch},
+		run: func(t *testing.T, b *Backend, opts []SuiteOpt) {
+			TestWriteBatch(t, b.OldValue, b.NewValue, b.emptyFn(t))
+		},
+	},
+	{
+		name:     "KeyFilter",
+		requires: []Capability{CapabilityWrite, CapabilityClock},
+		run: func(t *testing.T, b *Backend, opts []SuiteOpt) {
+			TestKeyFilter(t, b.OldValue, b.NewValue, b.emptyFn(t))
+		},
+	},
+	{
+		name:     "ValidDuration",
+		requires: []Capability{CapabilityWrite, CapabilityClock},
+		run: func(t *testing.T, b *Backend, opts []SuiteOpt) {
+			TestValidDuration(t, b.OldValue, b.NewValue, b.emptyFn(t))
+		},
+	},
+	{
+		name:     "FutureValidTime",
+		requires: []Capability{CapabilityWrite, CapabilityClock},
+		run: func(t *testing.T, b *Backend, opts []SuiteOpt) {
+			TestFutureValidTime(t, b.OldValue, b.NewValue, b.emptyFn(t))
+		},
+	},
+	{
+		name:     "BeginningOfTime",
+		requires: []Capability{CapabilityWrite, CapabilityClock},
+		run: func(t *testing.T, b *Backend, opts []SuiteOpt) {
+			TestBeginningOfTime(t, b.OldValue, b.NewValue, b.emptyFn(t))
+		},
+	},
+	{
+		name:     "Keys",
+		requires: []Capability{CapabilityKeys},
+		run: func(t *testing.T, b *Backend, opts []SuiteOpt) {
+			TestKeys(t, b.OldValue, b.seeded())
+		},
+	},
+	{
+		name:     "Oracle",
+		requires: []Capability{CapabilityWrite, CapabilityClock},
+		run: func(t *testing.T, b *Backend, opts []SuiteOpt) {
+			TestOracle(t, b.emptyFn(t))
+		},
+	},
+	{
+		name:     "ChaosClock",
+		requires: []Capability{CapabilityWrite, CapabilityClock},
+		run: func(t *testing.T, b *Backend, opts []SuiteOpt) {
+			TestChaosClock(t, b.emptyFn(t))
+		},
+	},
+	{
+		name:     "Race",
+		requires: []Capability{CapabilityWrite, CapabilityClock, CapabilityConcurrency},
+		run: func(t *testing.T, b *Backend, opts []SuiteOpt) {
+			TestRace(t, b.emptyFn(t))
+		},
+	},
+	{
+		name:     "Concurrency",
+		requires: []Capability{CapabilityWrite, CapabilityClock, CapabilityConcurrency},
+		run: func(t *testing.T, b *Backend, opts []SuiteOpt) {
+			TestConcurrency(t, b.emptyFn(t))
+		},
+	},
+}
+
+// RunSuites runs every suite supported by the backend's capabilities as a subtest. Unsupported suites are skipped with
+// the missing capabilities reported.
+func RunSuites(t *testing.T, b Backend, opts ...SuiteOpt) {
+	if b.OldValue == nil {
+		b.OldValue = "OLD"
+	}
+	if b.NewValue == nil {
+		b.NewValue = "NEW"
+	}
+	for _, s := range suites {
+		s := s
+		t.Run(s.name, func(t *testing.T) {
+			for _, name := range b.Skip {
+				if name == s.name {
+					t.Skip("skipped by backend")
+				}
+			}
+			var missing []Capability
+			for _, c := range s.requires {
+				if !b.has(c) {
+					missing = append(missing, c)
+				}
+			}
+			if len(missing) > 0 {
+				t.Skipf("backend does not support capabilities: %v", missing)
+			}
+			if !b.canBuildFixtures() {
+				t.Skipf("backend does not support capabilities: %v or %v", CapabilitySeed,
+					[]Capability{CapabilityWrite, CapabilityClock})
+			}
+			s.run(t, &b, opts)
+		})
+	}
+}
+
+// TestKeys tests the Keys function of a KeyLister. dbFn must return a DB under test with the VersionedKV's stored in
+// the database and a function to close the DB after the test is complete.
+func TestKeys(t *testing.T, value Value, dbFn func(kvs []*VersionedKV) (db DB, closeFn func(), err error)) {
+	kvs := []*VersionedKV{
+		{Key: "B", TxTimeStart: t1, ValidTimeStart: t1, Value: value},
+		{Key: "A", TxTimeStart: t1, TxTimeEnd: &t2, ValidTimeStart: t1, Value: value},
+		{Key: "B", TxTimeStart: t2, ValidTimeStart: t0, ValidTimeEnd: &t1, Value: value},
+	}
+	db, closeFn, err := dbFn(kvs)
+	require.Nil(t, err)
+	defer closeFn()
+
+	kl, ok := db.(KeyLister)
+	require.True(t, ok, fmt.Sprintf("%T does not implement KeyLister", db))
+	keys, err := kl.Keys()
+	require.Nil(t, err)
+	require.Equal(t, []string{"A", "B"}, keys)
+}
@@ -0,0 +1,111 @@
+package dbtest
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	chaosRuns      = 20
+	chaosOpsPerRun = 100
+)
+
+// TestChaosClock runs random operation sequences against a DB whose clock is a clock.Chaos, producing repeated
+// transaction times, nanosecond increments, and times in many locations. Results are compared against the reference
+// model of TestOracle, and the resulting histories must be well-formed with every version readable at its own
+// coordinates. Reads use the observed times converted to UTC half of the time so DBs may not depend on the location of
+// times. dbFn must return an empty DB using clock for transaction times.
+func TestChaosClock(t *testing.T, dbFn func(clock Clock) (DB, error)) {
+	for seed := int64(1); seed <= chaosRuns; seed++ {
+		c := &recordingClock{clock: clock.NewChaos(seed, t1)}
+		db, err := dbFn(c)
+		require.Nil(t, err)
+		if log, err := runChaos(db, c, rand.New(rand.NewSource(seed))); err != nil {
+			t.Fatalf("chaos clock mismatch (seed %v): %v\noperations:\n%v", seed, err, strings.Join(log, "\n"))
+		}
+	}
+}
+
+// runChaos runs one random operation sequence. It returns the log of operations run and the first mismatch.
+func runChaos(db DB, c *recordingClock, r *rand.Rand) ([]string, error) {
+	ref := &refModel{}
+	observed := []time.Time{t1}
+	randObserved := func() time.Time {
+		t := observed[r.Intn(len(observed))]
+		if r.Intn(2) == 0 {
+			t = t.UTC()
+		}
+		return t
+	}
+
+	var log []string
+	for i := 0; i < chaosOpsPerRun; i++ {
+		key := oracleKeys[r.Intn(len(oracleKeys))]
+		if r.Intn(3) > 0 {
+			s := Step{Op: StepSet, Key: key, Value: r.Intn(5)}
+			if r.Intn(4) == 0 {
+				s.Op, s.Value = StepDelete, nil
+			}
+			if r.Intn(2) == 0 {
+				s.WriteOpts = append(s.WriteOpts, WithValidTime(randObserved()))
+			}
+			if r.Intn(3) == 0 {
+				s.WriteOpts = append(s.WriteOpts, WithEndValidTime(randObserved()))
+			}
+
+			c.reset()
+			var err error
+			if s.Op == StepDelete {
+				err = db.Delete(key, s.WriteOpts...)
+			} else {
+				err = db.Set(key, s.Value, s.WriteOpts...)
+			}
+			now, ok := c.last()
+			if !ok {
+				return log, errors.New("DB did not use the clock for a write")
+			}
+			observed = append(observed, now)
+			s.Now = now
+			log = append(log, s.String())
+
+			refErr := ref.write(key, s.Value, s.Op == StepDelete, now, ApplyWriteOpts(s.WriteOpts))
+			if (err == nil) != (refErr == nil) {
+				return log, fmt.Errorf("write error mismatch: got %v, expected %v", err, refErr)
+			}
+			continue
+		}
+
+		validTime, txTime := randObserved(), randObserved()
+		log = append(log, fmt.Sprintf("Get(%v, AsOfValidTime(%v), AsOfTransactionTime(%v))", key,
+			validTime.Format(time.RFC3339Nano), txTime.Format(time.RFC3339Nano)))
+		kv, err := db.Get(key, AsOfValidTime(validTime), AsOfTransactionTime(txTime))
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return log, fmt.Errorf("get failed: %v", err)
+		}
+		if err := compareKV(kv, ref.get(key, validTime, txTime)); err != nil {
+			return log, err
+		}
+	}
+
+	last := observed[len(observed)-1]
+	for _, key := range oracleKeys {
+		vs, err := db.History(key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return log, err
+		}
+		if err := checkHistory(db, key, vs, t1, last); err != nil {
+			return log, fmt.Errorf("key %v: %v", key, err)
+		}
+	}
+	return log, nil
+}
@@ -0,0 +1,98 @@
+package dbtest
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConcurrency writes to and reads from a DB from many goroutines at once and then verifies invariants of the
+// resulting histories: versions are well-formed, no two versions of a key overlap both transaction and valid time,
+// transaction times were produced by the clock, and every version is readable at its own coordinates. Run with -race
+// to also detect unsynchronized access. dbFn must return an empty DB using clock for transaction times.
+func TestConcurrency(t *testing.T, dbFn func(clock Clock) (DB, error)) {
+	c := clock.New(t5)
+	require.Nil(t, c.AutoAdvance(time.Millisecond))
+	db, err := dbFn(c)
+	require.Nil(t, err)
+
+	keys := []string{"A", "B", "C", "D"}
+	concurrency := 8
+	callCount := 50
+
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func(id int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(id)))
+			for j := 0; j < callCount; j++ {
+				key := keys[r.Intn(len(keys))]
+				validTime := t1.Add(time.Duration(r.Intn(72)) * time.Hour)
+				switch r.Intn(6) {
+				case 0, 1:
+					_ = db.Set(key, id*callCount+j)
+				case 2:
+					_ = db.Set(key, id*callCount+j, WithValidTime(validTime))
+				case 3:
+					_ = db.Delete(key, WithValidTime(validTime), WithEndValidTime(validTime.Add(12*time.Hour)))
+				case 4:
+					_, _ = db.Get(key, AsOfValidTime(validTime))
+					_, _ = db.List()
+				default:
+					_, _ = db.History(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	end := c.Now()
+	for _, key := range keys {
+		vs, err := db.History(key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		require.Nil(t, err)
+		require.Nil(t, checkHistory(db, key, vs, t5, end), "key: %v, history: %v", key, toJSON(vs))
+	}
+}
+
+// checkHistory verifies the invariants of a key's history written with transaction times in [start, end].
+func checkHistory(db DB, key string, vs []*VersionedKV, start, end time.Time) error {
+	if err := violationsError(CheckHistory(key, vs)); err != nil {
+		return err
+	}
+	for _, v := range vs {
+		if v.TxTimeStart.Before(start) || v.TxTimeStart.After(end) {
+			return fmt.Errorf("transaction time start %v was not produced by the clock", v.TxTimeStart)
+		}
+		if v.TxTimeEnd != nil && !v.TxTimeStart.Before(*v.TxTimeEnd) {
+			continue
+		}
+		got, err := db.Get(key, AsOfValidTime(v.ValidTimeStart), AsOfTransactionTime(v.TxTimeStart))
+		if err != nil {
+			return fmt.Errorf("failed to read version at its coordinates: %v: %v", toJSON(v), err)
+		}
+		if !reflect.DeepEqual(got.Value, v.Value) {
+			return fmt.Errorf("read %v at coordinates of version %v", toJSON(got), toJSON(v))
+		}
+	}
+	return nil
+}
+
+// overlaps returns true if the non-empty intervals [aStart, aEnd) and [bStart, bEnd) intersect. nil ends are unbounded.
+func overlaps(aStart time.Time, aEnd *time.Time, bStart time.Time, bEnd *time.Time) bool {
+	if (aEnd != nil && !aStart.Before(*aEnd)) || (bEnd != nil && !bStart.Before(*bEnd)) {
+		return false
+	}
+	return (aEnd == nil || bStart.Before(*aEnd)) && (bEnd == nil || aStart.Before(*bEnd))
+}
@@ -0,0 +1,159 @@
+package dbtest
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+)
+
+var crashSeed int64
+
+func init() {
+	flag.Int64Var(&crashSeed, "crash-seed", 0, "seed for TestCrashConsistency. if 0, a random seed is used")
+}
+
+const (
+	crashOpsPerRun = 40
+	crashEvery     = 5 // a crash happens every crashEvery operations on average
+)
+
+// CrashBackend is a persistent backend under test for TestCrashConsistency.
+type CrashBackend struct {
+	// Open opens the DB, recovering its persisted state. The first call opens an empty DB. clock provides transaction
+	// times.
+	Open func(clock Clock) (DB, error)
+	// Kill abruptly stops the most recently opened DB without flushing or closing it gracefully, as if its process
+	// crashed. It may be called concurrently with a write, which may or may not be persisted. The DB is not used after
+	// it is killed.
+	Kill func()
+}
+
+// TestCrashConsistency runs a random workload of Set and Delete operations against a persistent backend while randomly
+// killing and reopening it. After every recovery, the DB must pass CheckInvariants and its reads at every valid and
+// transaction time must match a reference model of every acknowledged write. A write that was in flight when the DB
+// was killed may or may not have been persisted, but it must be atomic.
+//
+// The workload is seeded by the -crash-seed flag (random if unset) and the seed is logged on failure for reproduction.
+func TestCrashConsistency(t *testing.T, oldValue, newValue Value, b CrashBackend) {
+	flag.Parse()
+	seed := crashSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	if log, err := runCrash(oldValue, newValue, b, rand.New(rand.NewSource(seed))); err != nil {
+		t.Fatalf("crash consistency failure (-crash-seed=%v): %v\noperations:\n%v", seed, err, strings.Join(log, "\n"))
+	}
+}
+
+// runCrash runs the workload. It returns the log of operations run and the first failure.
+func runCrash(oldValue, newValue Value, b CrashBackend, r *rand.Rand) ([]string, error) {
+	c := &clock.Clock{}
+	db, err := b.Open(c)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open: %w", err)
+	}
+	ref := &refModel{}
+	nowTick := oracleStartTick
+	var log []string
+	for i := 0; i < crashOpsPerRun; i++ {
+		nowTick++
+		now := tickTime(nowTick)
+		if err := c.SetNow(now); err != nil {
+			return log, err
+		}
+
+		key := oracleKeys[r.Intn(len(oracleKeys))]
+		value := []Value{oldValue, newValue}[r.Intn(2)]
+		isDelete := r.Intn(3) == 0
+		start := r.Intn(nowTick + 1)
+		opts := []WriteOpt{WithValidTime(tickTime(start))}
+		op := fmt.Sprintf("now=%v Set(%v, %v, WithValidTime(%v)", nowTick, key, value, start)
+		if isDelete {
+			op = fmt.Sprintf("now=%v Delete(%v, WithValidTime(%v)", nowTick, key, start)
+		}
+		if start < nowTick && r.Intn(2) == 0 {
+			end := start + 1 + r.Intn(nowTick-start)
+			opts = append(opts, WithEndValidTime(tickTime(end)))
+			op += fmt.Sprintf(", WithEndValidTime(%v)", end)
+		}
+		write := func() error {
+			if isDelete {
+				return db.Delete(key, opts...)
+			}
+			return db.Set(key, value, opts...)
+		}
+
+		if r.Intn(crashEvery) > 0 {
+			log = append(log, op+")")
+			if err := write(); err != nil {
+				return log, fmt.Errorf("write failed: %w", err)
+			}
+			if err := ref.write(key, value, isDelete, now, ApplyWriteOpts(opts)); err != nil {
+				return log, err
+			}
+			continue
+		}
+
+		// crash during or after the write
+		log = append(log, op+") and crash")
+		done := make(chan error, 1)
+		go func() { done <- write() }()
+		var writeErr error
+		if r.Intn(2) == 0 {
+			writeErr = <-done
+			b.Kill()
+		} else {
+			b.Kill()
+			writeErr = <-done
+		}
+		if db, err = b.Open(c); err != nil {
+			return log, fmt.Errorf("failed to reopen: %w", err)
+		}
+		if err := CheckInvariants(db, oracleKeys); err != nil {
+			return log, err
+		}
+
+		withWrite := &refModel{writes: append([]refWrite(nil), ref.writes...)}
+		if err := withWrite.write(key, value, isDelete, now, ApplyWriteOpts(opts)); err != nil {
+			return log, err
+		}
+		if writeErr == nil {
+			// the write was acknowledged so it must have been persisted
+			ref = withWrite
+		} else if compareCrash(db, withWrite, nowTick) == nil {
+			ref = withWrite
+		}
+		if err := compareCrash(db, ref, nowTick); err != nil {
+			return log, fmt.Errorf("recovered state does not match acknowledged writes: %w", err)
+		}
+	}
+	b.Kill()
+	return log, nil
+}
+
+// compareCrash compares reads of db at every valid and transaction time tick up to nowTick with ref.
+func compareCrash(db DB, ref *refModel, nowTick int) error {
+	for _, key := range oracleKeys {
+		for txTick := 0; txTick <= nowTick; txTick++ {
+			for validTick := 0; validTick <= nowTick; validTick++ {
+				validTime, txTime := tickTime(validTick), tickTime(txTick)
+				kv, err := db.Get(key, AsOfValidTime(validTime), AsOfTransactionTime(txTime))
+				if err != nil && !errors.Is(err, ErrNotFound) {
+					return fmt.Errorf("get failed: %w", err)
+				}
+				if err := compareKV(kv, ref.get(key, validTime, txTime)); err != nil {
+					return fmt.Errorf("Get(%v, AsOfValidTime(%v), AsOfTransactionTime(%v)): %w", key, validTick, txTick,
+						err)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,272 @@
+package dbtest
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+)
+
+var (
+	registryMu sync.Mutex
+	registry   = map[string]Backend{}
+)
+
+// RegisterBackend registers a named backend for TestRegisteredEquivalence. Backends must have CapabilityWrite and
+// CapabilityClock to take part in equivalence tests. Registering a name twice panics.
+func RegisterBackend(name string, b Backend) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("dbtest: backend %v already registered", name))
+	}
+	registry[name] = b
+}
+
+// RegisteredBackends returns the names of registered backends in ascending order.
+func RegisteredBackends() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	var names []string
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StepOp is the operation of a Step.
+type StepOp string
+
+// Step operations
+const (
+	StepSet     StepOp = "Set"
+	StepDelete  StepOp = "Delete"
+	StepGet     StepOp = "Get"
+	StepList    StepOp = "List"
+	StepHistory StepOp = "History"
+)
+
+// Step is one operation of an equivalence script. Now is the transaction time the operation runs at and must not
+// decrease through a script.
+type Step struct {
+	Now       time.Time
+	Op        StepOp
+	Key       string
+	Value     Value
+	ReadOpts  []ReadOpt
+	WriteOpts []WriteOpt
+}
+
+func (s Step) String() string {
+	out := fmt.Sprintf("now=%v %v(", s.Now.Format(time.RFC3339Nano), s.Op)
+	var args []string
+	if s.Op != StepList {
+		args = append(args, s.Key)
+	}
+	if s.Op == StepSet {
+		args = append(args, fmt.Sprintf("%v", s.Value))
+	}
+	if len(s.ReadOpts) > 0 {
+		o := ApplyReadOpts(s.ReadOpts)
+		if o.ValidTime != nil {
+			args = append(args, "AsOfValidTime("+o.ValidTime.Format(time.RFC3339Nano)+")")
+		}
+		if o.TxTime != nil {
+			args = append(args, "AsOfTransactionTime("+o.TxTime.Format(time.RFC3339Nano)+")")
+		}
+	}
+	if len(s.WriteOpts) > 0 {
+		o := ApplyWriteOpts(s.WriteOpts)
+		if o.ValidTime != nil {
+			args = append(args, "WithValidTime("+o.ValidTime.Format(time.RFC3339Nano)+")")
+		}
+		if o.EndValidTime != nil {
+			args = append(args, "WithEndValidTime("+o.EndValidTime.Format(time.RFC3339Nano)+")")
+		}
+	}
+	return out + strings.Join(args, ", ") + ")"
+}
+
+// RandomScript returns a reproducible script of n random operations over a few keys. Writes use random valid time
+// ranges, including invalid ones, and reads use random as-of coordinates so interval edges collide often.
+func RandomScript(seed int64, n int) []Step {
+	r := rand.New(rand.NewSource(seed))
+	nowTick := oracleStartTick
+	var steps []Step
+	for i := 0; i < n; i++ {
+		nowTick += r.Intn(3)
+		s := Step{Now: tickTime(nowTick), Key: oracleKeys[r.Intn(len(oracleKeys))]}
+		switch n := r.Intn(10); {
+		case n < 6:
+			s.Op = StepSet
+			if n >= 4 {
+				s.Op = StepDelete
+			} else {
+				s.Value = r.Intn(5)
+			}
+			validTime, endValidTime := randValidRange(r, nowTick)
+			if validTime != nil {
+				s.WriteOpts = append(s.WriteOpts, WithValidTime(tickTime(*validTime)))
+			}
+			if endValidTime != nil {
+				s.WriteOpts = append(s.WriteOpts, WithEndValidTime(tickTime(*endValidTime)))
+			}
+		case n < 8:
+			s.Op = StepGet
+			s.ReadOpts = []ReadOpt{
+				AsOfValidTime(tickTime(r.Intn(nowTick + 3))),
+				AsOfTransactionTime(tickTime(r.Intn(nowTick + 3))),
+			}
+		case n < 9:
+			s.Op = StepList
+			s.ReadOpts = []ReadOpt{
+				AsOfValidTime(tickTime(r.Intn(nowTick + 3))),
+				AsOfTransactionTime(tickTime(r.Intn(nowTick + 3))),
+			}
+		default:
+			s.Op = StepHistory
+		}
+		steps = append(steps, s)
+	}
+	return steps
+}
+
+// TestEquivalence runs script against empty DBs of backends a and b and requires that every step has the same
+// outcome: whether writes error, and the results of Get, List, and History. Results are compared in a canonical form
+// so backends may differ in List and History order and in value and time representations that encode to the same
+// JSON. Both backends must have CapabilityWrite and CapabilityClock.
+func TestEquivalence(t *testing.T, a, b Backend, script []Step) {
+	for _, backend := range []Backend{a, b} {
+		if !backend.has(CapabilityWrite) || !backend.has(CapabilityClock) {
+			t.Skipf("backend does not support capabilities: %v", []Capability{CapabilityWrite, CapabilityClock})
+		}
+	}
+	aClock, bClock := &clock.Clock{}, &clock.Clock{}
+	aDB, aCloseFn, err := a.NewDB(nil, aClock)
+	if err != nil {
+		t.Fatalf("failed to construct DB: %v", err)
+	}
+	defer aCloseFn()
+	bDB, bCloseFn, err := b.NewDB(nil, bClock)
+	if err != nil {
+		t.Fatalf("failed to construct DB: %v", err)
+	}
+	defer bCloseFn()
+
+	for i, s := range script {
+		if err := aClock.SetNow(s.Now); err != nil {
+			t.Fatalf("step %v: %v", i, err)
+		}
+		if err := bClock.SetNow(s.Now); err != nil {
+			t.Fatalf("step %v: %v", i, err)
+		}
+		aRes, err := runStep(aDB, s)
+		if err != nil {
+			t.Fatalf("step %v: %v: %v", i, s, err)
+		}
+		bRes, err := runStep(bDB, s)
+		if err != nil {
+			t.Fatalf("step %v: %v: %v", i, s, err)
+		}
+		if aRes != bRes {
+			var log []string
+			for _, s := range script[:i+1] {
+				log = append(log, s.String())
+			}
+			t.Fatalf("step %v: results differ: %v\na:\n%v\nb:\n%v\noperations:\n%v", i, s, aRes, bRes,
+				strings.Join(log, "\n"))
+		}
+	}
+}
+
+// TestRegisteredEquivalence runs TestEquivalence for every pair of registered backends as subtests.
+func TestRegisteredEquivalence(t *testing.T, script []Step) {
+	names := RegisteredBackends()
+	if len(names) < 2 {
+		t.Skipf("at least 2 registered backends are required. got %v", names)
+	}
+	for i := range names {
+		for j := i + 1; j < len(names); j++ {
+			registryMu.Lock()
+			a, b := registry[names[i]], registry[names[j]]
+			registryMu.Unlock()
+			t.Run(names[i]+"_vs_"+names[j], func(t *testing.T) {
+				TestEquivalence(t, a, b, script)
+			})
+		}
+	}
+}
+
+// runStep runs a step and returns its outcome in canonical form. Errors other than ErrNotFound from reads are returned.
+func runStep(db DB, s Step) (string, error) {
+	var kv *VersionedKV
+	var kvs []*VersionedKV
+	var err error
+	switch s.Op {
+	case StepSet:
+		err = db.Set(s.Key, s.Value, s.WriteOpts...)
+	case StepDelete:
+		err = db.Delete(s.Key, s.WriteOpts...)
+	case StepGet:
+		kv, err = db.Get(s.Key, s.ReadOpts...)
+	case StepList:
+		kvs, err = db.List(s.ReadOpts...)
+	case StepHistory:
+		kvs, err = db.History(s.Key, s.ReadOpts...)
+	default:
+		return "", fmt.Errorf("unknown step op: %v", s.Op)
+	}
+	return canonicalResult(s.Op, kv, kvs, err)
+}
+
+// canonicalResult returns the outcome of an operation in canonical form. Errors other than ErrNotFound from reads are
+// returned.
+func canonicalResult(op StepOp, kv *VersionedKV, kvs []*VersionedKV, err error) (string, error) {
+	switch op {
+	case StepSet, StepDelete:
+		if err != nil {
+			return "write error", nil
+		}
+		return "ok", nil
+	case StepGet:
+		if errors.Is(err, ErrNotFound) {
+			return "not found", nil
+		} else if err != nil {
+			return "", err
+		}
+		return toJSON(canonicalKVs([]*VersionedKV{kv})[0]), nil
+	case StepList:
+		if err != nil {
+			return "", err
+		}
+		kvs = canonicalKVs(kvs)
+		sort.SliceStable(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+		return toJSON(kvs), nil
+	case StepHistory:
+		if errors.Is(err, ErrNotFound) {
+			return "not found", nil
+		} else if err != nil {
+			return "", err
+		}
+		return toJSON(canonicalOrder(canonicalKVs(kvs))), nil
+	default:
+		return "", fmt.Errorf("unknown step op: %v", op)
+	}
+}
+
+// canonicalKVs returns copies of kvs with all times in UTC.
+func canonicalKVs(kvs []*VersionedKV) []*VersionedKV {
+	out := make([]*VersionedKV, len(kvs))
+	for i, kv := range kvs {
+		out[i] = kv.Normalize(0)
+	}
+	return out
+}
@@ -0,0 +1,67 @@
+package dbtest
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFutureValidTime tests that writes with valid times in the future are rejected unless made WithFutureValidTime,
+// and that reads exclude versions that are not yet valid until they take effect. dbFn must return an empty DB using
+// clock for transaction times.
+func TestFutureValidTime(t *testing.T, oldValue, newValue Value, dbFn func(clock Clock) (DB, error)) {
+	c := clock.New(t2)
+	require.Nil(t, c.AutoAdvance(time.Minute))
+	db, err := dbFn(c)
+	require.Nil(t, err)
+
+	require.Nil(t, db.Set("A", oldValue, WithValidTime(t1)))
+	assert.ErrorIs(t, db.Set("A", newValue, WithValidTime(t4)), ErrInvalidWrite)
+	assert.ErrorIs(t, db.Set("A", newValue, WithValidTime(t1), WithEndValidTime(t4)), ErrInvalidWrite)
+	assert.ErrorIs(t, db.Delete("A", WithValidTime(t4)), ErrInvalidWrite)
+
+	// schedule newValue to take effect at t4
+	require.Nil(t, db.Set("A", newValue, WithValidTime(t4), WithFutureValidTime()))
+	kv, err := db.Get("A")
+	require.Nil(t, err)
+	assert.Equal(t, oldValue, kv.Value)
+	require.NotNil(t, kv.ValidTimeEnd)
+	assert.True(t, kv.ValidTimeEnd.Equal(t4), "valid time end %v", kv.ValidTimeEnd)
+	kv, err = db.Get("A", AsOfValidTime(t4))
+	require.Nil(t, err)
+	assert.Equal(t, newValue, kv.Value)
+	kvs, err := db.List()
+	require.Nil(t, err)
+	require.Len(t, kvs, 1)
+	assert.Equal(t, oldValue, kvs[0].Value)
+
+	// schedule B to end at t4
+	require.Nil(t, db.Set("B", oldValue, WithValidTime(t1), WithEndValidTime(t4), WithFutureValidTime()))
+	kv, err = db.Get("B")
+	require.Nil(t, err)
+	assert.Equal(t, oldValue, kv.Value)
+	_, err = db.Get("B", AsOfValidTime(t4))
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// a scheduled value is replaced by a later write valid from now
+	require.Nil(t, db.Set("C", newValue, WithValidTime(t4), WithFutureValidTime()))
+	_, err = db.Get("C")
+	assert.ErrorIs(t, err, ErrNotFound)
+	require.Nil(t, db.Set("C", oldValue))
+	kv, err = db.Get("C", AsOfValidTime(t4))
+	require.Nil(t, err)
+	assert.Equal(t, oldValue, kv.Value)
+
+	// scheduled versions take effect once now reaches them
+	require.Nil(t, c.SetNow(t4))
+	kv, err = db.Get("A")
+	require.Nil(t, err)
+	assert.Equal(t, newValue, kv.Value)
+	_, err = db.Get("B")
+	assert.ErrorIs(t, err, ErrNotFound)
+	require.Nil(t, CheckInvariants(db, []string{"A", "B", "C"}))
+}
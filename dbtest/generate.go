@@ -0,0 +1,149 @@
+package dbtest
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	. "github.com/elh/bitempura"
+)
+
+// GenerateOpt is an option for Generate.
+type GenerateOpt func(*generateOptions)
+
+type generateOptions struct {
+	keyCount              int
+	versionsPerKey        int
+	correctionProbability float64
+	start                 time.Time
+	step                  time.Duration
+}
+
+// WithKeyCount sets the number of keys generated. Defaults to 10.
+func WithKeyCount(n int) GenerateOpt {
+	return func(o *generateOptions) {
+		o.keyCount = n
+	}
+}
+
+// WithVersionsPerKey sets the number of writes generated per key. Each write creates a version and may close and
+// split existing versions. Defaults to 10.
+func WithVersionsPerKey(n int) GenerateOpt {
+	return func(o *generateOptions) {
+		o.versionsPerKey = n
+	}
+}
+
+// WithCorrectionProbability sets the probability that a write is a correction of a past valid time range instead of
+// an update from "now" onwards. Defaults to 0.2.
+func WithCorrectionProbability(p float64) GenerateOpt {
+	return func(o *generateOptions) {
+		o.correctionProbability = p
+	}
+}
+
+// WithTimeRange sets the time of the first write and the transaction time step between writes. Valid times are also
+// aligned to step. Defaults to 2022-01-01 and 1 hour.
+func WithTimeRange(start time.Time, step time.Duration) GenerateOpt {
+	return func(o *generateOptions) {
+		o.start = start
+		o.step = step
+	}
+}
+
+// Generate returns a seeded-random, valid bitemporal history for use as fixtures in load tests and fuzzing. The same
+// seed and options always produce the same history. Writes to random keys are simulated one transaction time step
+// apart: updates set a value from "now" onwards and corrections set a value for a past valid time range. Existing
+// versions are closed and split as a DB would. Keys are "key-000", "key-001", etc. and values are ints.
+func Generate(seed int64, opts ...GenerateOpt) []*VersionedKV {
+	options := &generateOptions{
+		keyCount:              10,
+		versionsPerKey:        10,
+		correctionProbability: 0.2,
+		start:                 t1,
+		step:                  time.Hour,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	r := rand.New(rand.NewSource(seed))
+	var keys []string
+	remaining := map[string]int{}
+	for i := 0; i < options.keyCount; i++ {
+		key := fmt.Sprintf("key-%03d", i)
+		keys = append(keys, key)
+		remaining[key] = options.versionsPerKey
+	}
+
+	g := &generator{current: map[string][]*VersionedKV{}}
+	now := options.start
+	for len(keys) > 0 {
+		i := r.Intn(len(keys))
+		key := keys[i]
+		if remaining[key]--; remaining[key] == 0 {
+			keys = append(keys[:i], keys[i+1:]...)
+		}
+
+		validTime, endValidTime := now, (*time.Time)(nil)
+		if len(g.current[key]) > 0 && r.Float64() < options.correctionProbability {
+			// correct a range starting on or after the key's first valid time
+			first := g.firstValidTime(key)
+			steps := int(now.Sub(first) / options.step)
+			if steps > 0 {
+				validTime = first.Add(time.Duration(r.Intn(steps)) * options.step)
+				if r.Intn(2) == 0 {
+					remainingSteps := int(now.Sub(validTime) / options.step)
+					end := validTime.Add(time.Duration(1+r.Intn(remainingSteps)) * options.step)
+					endValidTime = &end
+				}
+			}
+		}
+		g.write(key, r.Intn(1000), validTime, endValidTime, now)
+		now = now.Add(options.step)
+	}
+	return g.out
+}
+
+// generator simulates writes. current holds each key's versions with open transaction time.
+type generator struct {
+	out     []*VersionedKV
+	current map[string][]*VersionedKV
+}
+
+func (g *generator) firstValidTime(key string) time.Time {
+	first := g.current[key][0].ValidTimeStart
+	for _, v := range g.current[key] {
+		if v.ValidTimeStart.Before(first) {
+			first = v.ValidTimeStart
+		}
+	}
+	return first
+}
+
+func (g *generator) write(key string, value Value, validTime time.Time, endValidTime *time.Time, now time.Time) {
+	var kept []*VersionedKV
+	for _, v := range g.current[key] {
+		if !overlaps(validTime, endValidTime, v.ValidTimeStart, v.ValidTimeEnd) {
+			kept = append(kept, v)
+			continue
+		}
+		txTimeEnd := now
+		v.TxTimeEnd = &txTimeEnd
+		// re-assert the parts of the closed version outside of the written range
+		if v.ValidTimeStart.Before(validTime) {
+			start := validTime
+			kept = append(kept, g.add(key, v.Value, v.ValidTimeStart, &start, now))
+		}
+		if endValidTime != nil && (v.ValidTimeEnd == nil || endValidTime.Before(*v.ValidTimeEnd)) {
+			kept = append(kept, g.add(key, v.Value, *endValidTime, v.ValidTimeEnd, now))
+		}
+	}
+	g.current[key] = append(kept, g.add(key, value, validTime, endValidTime, now))
+}
+
+func (g *generator) add(key string, value Value, validTime time.Time, endValidTime *time.Time, now time.Time) *VersionedKV {
+	v := &VersionedKV{Key: key, Value: value, TxTimeStart: now, ValidTimeStart: validTime, ValidTimeEnd: endValidTime}
+	g.out = append(g.out, v)
+	return v
+}
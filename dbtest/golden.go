@@ -0,0 +1,74 @@
+package dbtest
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"testing"
+
+	. "github.com/elh/bitempura"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden bool
+
+func init() {
+	flag.BoolVar(&updateGolden, "update-golden", false, "if true, golden files are rewritten instead of compared")
+}
+
+// WithGolden makes TestSet and TestDelete compare the resulting history of each test case against golden files in dir.
+// Run tests with -update-golden to write the golden files.
+func WithGolden(dir string) SuiteOpt {
+	return func(o *suiteOptions) {
+		o.goldenDir = dir
+	}
+}
+
+var nonGoldenFileChars = regexp.MustCompile("[^a-zA-Z0-9]+")
+
+// AssertGolden compares the histories of keys against the golden file for the test in dir. If the -update-golden flag is
+// set, the golden file is written instead. Versions are compared in a canonical order so golden files only change when
+// version layouts do.
+func AssertGolden(t *testing.T, dir string, db DB, keys []string) {
+	histories := map[string][]*VersionedKV{}
+	for _, key := range keys {
+		vs, err := db.History(key)
+		if errors.Is(err, ErrNotFound) {
+			vs = []*VersionedKV{}
+		} else {
+			require.Nil(t, err)
+		}
+		histories[key] = canonicalOrder(vs)
+	}
+	got := toJSON(histories) + "\n"
+
+	path := filepath.Join(dir, nonGoldenFileChars.ReplaceAllString(t.Name(), "_")+".json")
+	if updateGolden {
+		require.Nil(t, os.MkdirAll(dir, 0777))
+		require.Nil(t, os.WriteFile(path, []byte(got), 0644))
+		return
+	}
+	expected, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("golden file %v does not exist. run with -update-golden to create it", path)
+	}
+	require.Nil(t, err)
+	require.Equal(t, string(expected), got, "history does not match golden file %v. run with -update-golden if the "+
+		"change is intended", path)
+}
+
+// canonicalOrder returns versions sorted by transaction time start, then valid time start.
+func canonicalOrder(vs []*VersionedKV) []*VersionedKV {
+	out := make([]*VersionedKV, len(vs))
+	copy(out, vs)
+	sort.SliceStable(out, func(i, j int) bool {
+		if !out[i].TxTimeStart.Equal(out[j].TxTimeStart) {
+			return out[i].TxTimeStart.Before(out[j].TxTimeStart)
+		}
+		return out[i].ValidTimeStart.Before(out[j].ValidTimeStart)
+	})
+	return out
+}
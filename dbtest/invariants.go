@@ -0,0 +1,55 @@
+package dbtest
+
+import (
+	"fmt"
+	"sort"
+
+	. "github.com/elh/bitempura"
+)
+
+// WithInvariantChecks makes TestSet and TestDelete run CheckInvariants on the DB's full state after every write,
+// catching corruption that targeted reads miss. If the DB is a KeyLister, all of its keys are checked. Otherwise, the
+// keys of the fixtures and the written key are checked.
+func WithInvariantChecks() SuiteOpt {
+	return func(o *suiteOptions) {
+		o.checkInvariants = true
+	}
+}
+
+// CheckInvariants verifies the structural invariants of the full history of each key with Check.
+func CheckInvariants(db DB, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	violations, err := Check(db, keys...)
+	if err != nil {
+		return err
+	}
+	return violationsError(violations)
+}
+
+// violationsError returns an error describing the first violation, if any.
+func violationsError(violations []*Violation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	v := violations[0]
+	return fmt.Errorf("%v: %v", v.Error(), toJSON(v.Versions))
+}
+
+// invariantKeys returns the keys to check after a write in a suite.
+func invariantKeys(db DB, kvs []*VersionedKV, key string) ([]string, error) {
+	if kl, ok := db.(KeyLister); ok {
+		return kl.Keys()
+	}
+	set := map[string]bool{key: true}
+	for _, kv := range kvs {
+		set[kv.Key] = true
+	}
+	var keys []string
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
@@ -0,0 +1,58 @@
+package dbtest
+
+import (
+	"sort"
+	"testing"
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestKeyFilter tests that List and ListFunc with WithKeyPrefix and WithKeyGlob only return matching keys, that
+// matching is case sensitive and treats LIKE wildcards literally, and that malformed patterns fail. dbFn must return an
+// empty DB using clock for transaction times.
+func TestKeyFilter(t *testing.T, oldValue, newValue Value, dbFn func(clock Clock) (DB, error)) {
+	c := clock.New(t1)
+	db, err := dbFn(c)
+	require.Nil(t, err)
+	for _, key := range []string{"Alice/balance", "Alice/positions", "Alice/positions/AAPL", "alice/balance",
+		"Alice_x", "AliceXx", "Bob/balance"} {
+		require.Nil(t, db.Set(key, oldValue))
+	}
+	require.Nil(t, c.SetNow(t2))
+	require.Nil(t, db.Delete("Alice/positions"))
+
+	keys := func(opts ...ReadOpt) []string {
+		kvs, err := db.List(opts...)
+		require.Nil(t, err)
+		var out []string
+		for _, kv := range kvs {
+			out = append(out, kv.Key)
+		}
+		sort.Strings(out)
+
+		var streamed []string
+		require.Nil(t, ListFunc(db, func(kv *VersionedKV) bool {
+			streamed = append(streamed, kv.Key)
+			return true
+		}, opts...))
+		sort.Strings(streamed)
+		assert.Equal(t, out, streamed)
+		return out
+	}
+
+	assert.Equal(t, []string{"Alice/balance", "Alice/positions/AAPL"}, keys(WithKeyPrefix("Alice/")))
+	assert.Equal(t, []string{"Alice/balance", "Alice/positions", "Alice/positions/AAPL"},
+		keys(WithKeyPrefix("Alice/"), AsOfTransactionTime(t1)))
+	assert.Equal(t, []string{"Alice_x"}, keys(WithKeyPrefix("Alice_")))
+	assert.Equal(t, []string{"Alice/balance", "Bob/balance"}, keys(WithKeyGlob("[AB]*/balance")))
+	assert.Equal(t, []string{"Alice/balance"}, keys(WithKeyGlob("Alice/*")))
+	assert.Equal(t, []string{"Alice/positions/AAPL"}, keys(WithKeyPrefix("Alice/"), WithKeyGlob("*/*/*")))
+	assert.Empty(t, keys(WithKeyPrefix("Carol/")))
+	assert.Len(t, keys(), 6)
+
+	_, err = db.List(WithKeyGlob("[Alice"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,73 @@
+package dbtest
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	. "github.com/elh/bitempura"
+	"github.com/stretchr/testify/require"
+)
+
+// Exporter exports every version of keys from a DB, e.g. by writing and then reading a backup.
+type Exporter func(db DB, keys []string) ([]*VersionedKV, error)
+
+// HistoryExporter is an Exporter that reads the History of each key.
+func HistoryExporter(db DB, keys []string) ([]*VersionedKV, error) {
+	var out []*VersionedKV
+	for _, key := range keys {
+		vs, err := db.History(key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to get history for key=%v: %w", key, err)
+		}
+		out = append(out, vs...)
+	}
+	return out, nil
+}
+
+// TestMigration populates a DB of backend src with a generated history, exports it with export, imports the exported
+// versions into a DB of backend dst, and requires that the History of every key is identical in both. Histories are
+// compared in a canonical form so backends may differ in History order. This is the conformance test for export,
+// import, and copy features. Backends are populated by seeding or, without CapabilitySeed, by replaying writes.
+func TestMigration(t *testing.T, src, dst Backend, export Exporter) {
+	for _, b := range []Backend{src, dst} {
+		if !b.canBuildFixtures() {
+			t.Skipf("backend does not support capabilities: %v or %v", CapabilitySeed,
+				[]Capability{CapabilityWrite, CapabilityClock})
+		}
+	}
+
+	for seed := int64(1); seed <= 5; seed++ {
+		t.Run(fmt.Sprintf("seed %v", seed), func(t *testing.T) {
+			kvs := Generate(seed, WithKeyCount(5), WithVersionsPerKey(8))
+			var keys []string
+			seen := map[string]bool{}
+			for _, kv := range kvs {
+				if !seen[kv.Key] {
+					seen[kv.Key] = true
+					keys = append(keys, kv.Key)
+				}
+			}
+
+			srcDB, closeFn, err := src.seeded()(kvs)
+			require.Nil(t, err)
+			defer closeFn()
+			exported, err := export(srcDB, keys)
+			require.Nil(t, err)
+			dstDB, closeFn, err := dst.seeded()(exported)
+			require.Nil(t, err)
+			defer closeFn()
+
+			for _, key := range keys {
+				expected, err := HistoryExporter(srcDB, []string{key})
+				require.Nil(t, err)
+				actual, err := HistoryExporter(dstDB, []string{key})
+				require.Nil(t, err)
+				require.Equal(t, toJSON(canonicalOrder(canonicalKVs(expected))),
+					toJSON(canonicalOrder(canonicalKVs(actual))), "key: %v", key)
+			}
+		})
+	}
+}
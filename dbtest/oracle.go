@@ -0,0 +1,277 @@
+package dbtest
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+)
+
+var (
+	oracleSeed int64
+	oracleRuns int
+)
+
+func init() {
+	flag.Int64Var(&oracleSeed, "oracle-seed", 0, "seed for TestOracle. if 0, a random seed is used")
+	flag.IntVar(&oracleRuns, "oracle-runs", 100, "number of random operation sequences run by TestOracle")
+}
+
+// oracle test time grid. operation times are whole ticks after the epoch so interval edges collide often
+var (
+	oracleEpoch = t1
+	oracleTick  = time.Hour
+)
+
+const (
+	oracleOpsPerRun = 60
+	oracleStartTick = 8 // initial "now" so writes have past valid times to choose from
+)
+
+var oracleKeys = []string{"A", "B", "C"}
+
+// TestOracle generates random sequences of Set, Delete, Get, and List operations with random valid and transaction
+// times. Each sequence is run against the DB under test and a brute-force reference model and results must be
+// identical: whether writes error, which values reads return, and the valid time intervals of returned versions.
+// dbFn must return an empty DB using clock for transaction times.
+//
+// Sequences are seeded by the -oracle-seed flag (random if unset) and the seed is logged on failure for reproduction.
+func TestOracle(t *testing.T, dbFn func(clock Clock) (DB, error)) {
+	flag.Parse()
+	seed := oracleSeed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	r := rand.New(rand.NewSource(seed))
+
+	for i := 0; i < oracleRuns; i++ {
+		runSeed := r.Int63()
+		clock := &clock.Clock{}
+		db, err := dbFn(clock)
+		if err != nil {
+			t.Fatalf("failed to construct DB: %v", err)
+		}
+		if log, err := runOracle(db, clock, rand.New(rand.NewSource(runSeed))); err != nil {
+			t.Fatalf("oracle mismatch (-oracle-seed=%v, run %v): %v\noperations:\n%v", seed, i, err,
+				strings.Join(log, "\n"))
+		}
+	}
+}
+
+// runOracle runs one random operation sequence. It returns the log of operations run and the first mismatch.
+func runOracle(db DB, clock *clock.Clock, r *rand.Rand) ([]string, error) {
+	ref := &refModel{}
+	nowTick := oracleStartTick
+	var log []string
+	for i := 0; i < oracleOpsPerRun; i++ {
+		nowTick += r.Intn(3) // 0 allows multiple writes at the same transaction time
+		now := tickTime(nowTick)
+		if err := clock.SetNow(now); err != nil {
+			return log, err
+		}
+
+		key := oracleKeys[r.Intn(len(oracleKeys))]
+		switch n := r.Intn(10); {
+		case n < 6:
+			isDelete := n >= 4
+			value := r.Intn(5)
+			validTime, endValidTime := randValidRange(r, nowTick)
+			var opts []WriteOpt
+			op := fmt.Sprintf("now=%v Set(%v, %v", nowTick, key, value)
+			if isDelete {
+				op = fmt.Sprintf("now=%v Delete(%v", nowTick, key)
+			}
+			if validTime != nil {
+				opts = append(opts, WithValidTime(tickTime(*validTime)))
+				op += fmt.Sprintf(", WithValidTime(%v)", *validTime)
+			}
+			if endValidTime != nil {
+				opts = append(opts, WithEndValidTime(tickTime(*endValidTime)))
+				op += fmt.Sprintf(", WithEndValidTime(%v)", *endValidTime)
+			}
+			log = append(log, op+")")
+
+			var err error
+			if isDelete {
+				err = db.Delete(key, opts...)
+			} else {
+				err = db.Set(key, value, opts...)
+			}
+			refErr := ref.write(key, value, isDelete, now, ApplyWriteOpts(opts))
+			if (err == nil) != (refErr == nil) {
+				return log, fmt.Errorf("write error mismatch: got %v, expected %v", err, refErr)
+			}
+		case n < 9:
+			validTick, txTick := r.Intn(nowTick+3), r.Intn(nowTick+3)
+			validTime, txTime := tickTime(validTick), tickTime(txTick)
+			log = append(log, fmt.Sprintf("now=%v Get(%v, AsOfValidTime(%v), AsOfTransactionTime(%v))", nowTick, key,
+				validTick, txTick))
+
+			kv, err := db.Get(key, AsOfValidTime(validTime), AsOfTransactionTime(txTime))
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return log, fmt.Errorf("get failed: %v", err)
+			}
+			if err := compareKV(kv, ref.get(key, validTime, txTime)); err != nil {
+				return log, err
+			}
+		default:
+			log = append(log, fmt.Sprintf("now=%v List()", nowTick))
+			kvs, err := db.List()
+			if err != nil {
+				return log, fmt.Errorf("list failed: %v", err)
+			}
+			byKey := map[string]*VersionedKV{}
+			for _, kv := range kvs {
+				byKey[kv.Key] = kv
+			}
+			for _, key := range oracleKeys {
+				if err := compareKV(byKey[key], ref.get(key, now, now)); err != nil {
+					return log, fmt.Errorf("list: %v", err)
+				}
+			}
+		}
+	}
+	return log, nil
+}
+
+// randValidRange returns optional valid time start and end ticks, sometimes invalid ones.
+func randValidRange(r *rand.Rand, nowTick int) (start, end *int) {
+	startTick := nowTick
+	if r.Intn(4) > 0 {
+		startTick = r.Intn(nowTick + 2) // may be in the future
+		start = &startTick
+	}
+	if r.Intn(2) > 0 {
+		endTick := startTick + r.Intn(6) // may be empty or in the future
+		end = &endTick
+	}
+	return start, end
+}
+
+func tickTime(tick int) time.Time {
+	return oracleEpoch.Add(time.Duration(tick) * oracleTick)
+}
+
+func compareKV(got *VersionedKV, expected *refVersion) error {
+	switch {
+	case got == nil && expected == nil:
+		return nil
+	case got == nil:
+		return fmt.Errorf("got not found, expected %v", expected)
+	case expected == nil:
+		return fmt.Errorf("got %v, expected not found", toJSON(got))
+	}
+	actual := &refVersion{value: got.Value, start: got.ValidTimeStart, end: got.ValidTimeEnd}
+	if !reflect.DeepEqual(actual.value, expected.value) || !actual.start.Equal(expected.start) ||
+		(actual.end == nil) != (expected.end == nil) || (actual.end != nil && !actual.end.Equal(*expected.end)) {
+		return fmt.Errorf("got %v, expected %v", actual, expected)
+	}
+	return nil
+}
+
+// refModel is a brute-force reference model of bitemporal semantics. It stores every accepted write and answers reads
+// by replaying them: the value at a (valid time, transaction time) coordinate is the last write that committed at or
+// before the transaction time and covers the valid time.
+type refModel struct {
+	writes []refWrite
+}
+
+type refWrite struct {
+	key      string
+	value    Value
+	isDelete bool
+	txTime   time.Time
+	start    time.Time
+	end      *time.Time
+}
+
+// refVersion is the expected result of a read.
+type refVersion struct {
+	value Value
+	start time.Time
+	end   *time.Time
+}
+
+func (v *refVersion) String() string {
+	end := "nil"
+	if v.end != nil {
+		end = v.end.Format(time.RFC3339)
+	}
+	return fmt.Sprintf("{value: %v, valid: [%v, %v)}", v.value, v.start.Format(time.RFC3339), end)
+}
+
+func (m *refModel) write(key string, value Value, isDelete bool, now time.Time, options *WriteOptions) error {
+	w := refWrite{key: key, value: value, isDelete: isDelete, txTime: now, start: now, end: options.EndValidTime}
+	if options.ValidTime != nil {
+		w.start = *options.ValidTime
+	}
+	if w.end != nil && !w.end.After(w.start) {
+		return fmt.Errorf("valid time start must be before end")
+	}
+	if w.start.After(now) || (w.end != nil && w.end.After(now)) {
+		return fmt.Errorf("valid times cannot be in the future")
+	}
+	m.writes = append(m.writes, w)
+	return nil
+}
+
+// winner returns the index of the write determining key's value at the coordinate or -1 if there is none.
+func (m *refModel) winner(key string, validTime, txTime time.Time) int {
+	out := -1
+	for i, w := range m.writes {
+		if w.key == key && !w.txTime.After(txTime) && !validTime.Before(w.start) &&
+			(w.end == nil || validTime.Before(*w.end)) {
+			out = i
+		}
+	}
+	return out
+}
+
+// get returns the version visible at the coordinate or nil if not found. The version's valid time interval is the
+// maximal interval around validTime determined by the same write.
+func (m *refModel) get(key string, validTime, txTime time.Time) *refVersion {
+	idx := m.winner(key, validTime, txTime)
+	if idx < 0 || m.writes[idx].isDelete {
+		return nil
+	}
+
+	// interval boundaries are the starts and ends of visible writes
+	seen := map[time.Time]bool{}
+	var bounds []time.Time
+	for _, w := range m.writes {
+		if w.key != key || w.txTime.After(txTime) {
+			continue
+		}
+		for _, b := range []*time.Time{&w.start, w.end} {
+			// key by UTC so equal instants in different locations are deduplicated
+			if b != nil && !seen[b.UTC()] {
+				seen[b.UTC()] = true
+				bounds = append(bounds, *b)
+			}
+		}
+	}
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i].Before(bounds[j]) })
+
+	// lo is the last boundary at or before validTime. hi is the first after
+	lo := sort.Search(len(bounds), func(i int) bool { return bounds[i].After(validTime) }) - 1
+	hi := lo + 1
+	for lo > 0 && m.winner(key, bounds[lo-1], txTime) == idx {
+		lo--
+	}
+	for hi < len(bounds) && m.winner(key, bounds[hi], txTime) == idx {
+		hi++
+	}
+	v := &refVersion{value: m.writes[idx].value, start: bounds[lo]}
+	if hi < len(bounds) {
+		v.end = &bounds[hi]
+	}
+	return v
+}
@@ -0,0 +1,184 @@
+package dbtest
+
+import (
+	"flag"
+	"sync"
+	"testing"
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/viz"
+)
+
+var (
+	outputHistory bool
+	outputDir     string
+	outputFile    string
+)
+
+func init() {
+	flag.BoolVar(&outputHistory, "output-history", false, "if true, output test result history to output dir")
+	flag.StringVar(&outputDir, "output-history-dir", "_testoutput/", "output dir")
+	flag.StringVar(&outputFile, "output-history-file", "", "if set, output all test result histories to this single file instead of output dir")
+}
+
+// TestOutput is the format for saving test data for debugging and visualization.
+type TestOutput = viz.Output
+
+// OutputWriter writes the TestOutput of tests, e.g. a viz.FileSink for a file per test in a directory, a
+// viz.CombinedFileSink for a single file, or a viz.SinkFunc callback.
+type OutputWriter = viz.Sink
+
+var (
+	defaultOutputWriterOnce sync.Once
+	defaultOutputWriter     OutputWriter
+)
+
+// DefaultOutputWriter returns the OutputWriter configured by flags: nil unless -output-history is set, then a file per
+// test in -output-history-dir or all tests in -output-history-file.
+func DefaultOutputWriter() OutputWriter {
+	if !outputHistory {
+		return nil
+	}
+	defaultOutputWriterOnce.Do(func() {
+		if outputFile != "" {
+			defaultOutputWriter = &viz.CombinedFileSink{Path: outputFile}
+		} else {
+			defaultOutputWriter = &viz.FileSink{Dir: outputDir}
+		}
+	})
+	return defaultOutputWriter
+}
+
+// SuiteOpt is an option for the test suites.
+type SuiteOpt func(*suiteOptions)
+
+type suiteOptions struct {
+	outputWriter    OutputWriter
+	goldenDir       string // optional. see WithGolden
+	checkInvariants bool   // see WithInvariantChecks
+	readRecording   bool   // see WithReadRecording
+}
+
+// WithOutputWriter sets where suites write the TestOutput of each test case. Defaults to DefaultOutputWriter.
+func WithOutputWriter(w OutputWriter) SuiteOpt {
+	return func(o *suiteOptions) {
+		o.outputWriter = w
+	}
+}
+
+// WithReadRecording makes suites record the reads of each test case and include them in its TestOutput.
+func WithReadRecording() SuiteOpt {
+	return func(o *suiteOptions) {
+		o.readRecording = true
+	}
+}
+
+func applySuiteOpts(opts []SuiteOpt) *suiteOptions {
+	options := &suiteOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// recordReads wraps db in a ReadRecorder if read recording is enabled.
+func (o *suiteOptions) recordReads(db DB) DB {
+	if !o.readRecording || db == nil {
+		return db
+	}
+	return RecordReads(db)
+}
+
+// RecordReads wraps a DB to record Get and List calls. If a ReadRecorder is passed to WriteOutput, its reads are
+// included in the TestOutput.
+func RecordReads(db DB) *ReadRecorder {
+	return &ReadRecorder{DB: db}
+}
+
+// ReadRecorder is a DB that records Get and List calls and their results.
+type ReadRecorder struct {
+	DB
+	m     sync.Mutex
+	reads []*viz.Read
+}
+
+// Get data by key (as of optional valid and transaction times).
+func (r *ReadRecorder) Get(key string, opts ...ReadOpt) (*VersionedKV, error) {
+	kv, err := r.DB.Get(key, opts...)
+	var result []*VersionedKV
+	if kv != nil {
+		result = []*VersionedKV{kv}
+	}
+	r.record("Get", key, opts, result, err)
+	return kv, err
+}
+
+// List all data (as of optional valid and transaction times).
+func (r *ReadRecorder) List(opts ...ReadOpt) ([]*VersionedKV, error) {
+	kvs, err := r.DB.List(opts...)
+	r.record("List", "", opts, kvs, err)
+	return kvs, err
+}
+
+// Reads returns the reads recorded so far.
+func (r *ReadRecorder) Reads() []*viz.Read {
+	r.m.Lock()
+	defer r.m.Unlock()
+	out := make([]*viz.Read, len(r.reads))
+	copy(out, r.reads)
+	return out
+}
+
+func (r *ReadRecorder) record(op, key string, opts []ReadOpt, result []*VersionedKV, err error) {
+	options := ApplyReadOpts(opts)
+	read := &viz.Read{
+		Op:        op,
+		Key:       key,
+		ValidTime: options.ValidTime,
+		TxTime:    options.TxTime,
+		Result:    result,
+	}
+	if read.Result == nil {
+		read.Result = []*VersionedKV{}
+	}
+	if err != nil {
+		read.Err = err.Error()
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.reads = append(r.reads, read)
+}
+
+// WriteOutput writes the final history of keys at the end of a test, named after the test and marked with whether it
+// passed. This is used for debugging and visualization. If db is a ReadRecorder, its reads are included. If w is nil,
+// DefaultOutputWriter is used and nothing is written if it is also nil.
+func WriteOutput(t *testing.T, w OutputWriter, db DB, keys []string, description string) {
+	if w == nil {
+		w = DefaultOutputWriter()
+	}
+	if w == nil || db == nil {
+		return
+	}
+	exportOpts := []viz.ExportOpt{viz.WithName(t.Name()), viz.WithPassed(!t.Failed())}
+	if r, ok := db.(*ReadRecorder); ok {
+		exportOpts = append(exportOpts, viz.WithReads(r.Reads()))
+	}
+	err := viz.ExportTo(w, db, keys, description, exportOpts...)
+	if err != nil {
+		t.Logf("failed to write output history for test=%v: %v", t.Name(), err)
+	}
+}
+
+// WriteOutputHistory writes the final history of keys at the end of a test with DefaultOutputWriter.
+//
+// Deprecated: use WriteOutput.
+func WriteOutputHistory(t *testing.T, db DB, keys []string, testName, description string) {
+	w := DefaultOutputWriter()
+	if w == nil || db == nil {
+		return
+	}
+	err := viz.ExportTo(w, db, keys, description, viz.WithName(testName), viz.WithPassed(!t.Failed()))
+	if err != nil {
+		t.Logf("failed to write output history for test=%v: %v", testName, err)
+	}
+}
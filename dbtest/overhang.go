@@ -0,0 +1,61 @@
+package dbtest
+
+import (
+	"testing"
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOverhangPolicy tests that a write with an end valid time re-asserts old values after its valid time range by
+// default, ends them at its start valid time with WithOverhangPolicy(OverhangTruncate), and fails with ErrOverhang with
+// WithOverhangPolicy(OverhangReject). dbFn must return an empty DB using clock for transaction times.
+func TestOverhangPolicy(t *testing.T, oldValue, newValue Value, dbFn func(clock Clock) (DB, error)) {
+	for _, policy := range []OverhangPolicy{OverhangReassert, OverhangTruncate, OverhangReject} {
+		t.Run(policy.String(), func(t *testing.T) {
+			c := clock.New(t1)
+			db, err := dbFn(c)
+			require.Nil(t, err)
+			require.Nil(t, db.Set("A", oldValue))
+			require.Nil(t, c.SetNow(t3))
+
+			err = db.Set("A", newValue, WithValidTime(t1), WithEndValidTime(t2), WithOverhangPolicy(policy))
+			if policy == OverhangReject {
+				require.ErrorIs(t, err, ErrOverhang)
+				kv, err := db.Get("A", AsOfValidTime(t1))
+				require.Nil(t, err)
+				assert.Equal(t, oldValue, kv.Value)
+				return
+			}
+			require.Nil(t, err)
+			kv, err := db.Get("A", AsOfValidTime(t1))
+			require.Nil(t, err)
+			assert.Equal(t, newValue, kv.Value)
+			kv, err = db.Get("A", AsOfValidTime(t2))
+			if policy == OverhangTruncate {
+				require.ErrorIs(t, err, ErrNotFound)
+			} else {
+				require.Nil(t, err)
+				assert.Equal(t, oldValue, kv.Value)
+			}
+			// old values are unchanged as of earlier transaction times
+			kv, err = db.Get("A", AsOfValidTime(t2), AsOfTransactionTime(t2))
+			require.Nil(t, err)
+			assert.Equal(t, oldValue, kv.Value)
+			require.Nil(t, CheckInvariants(db, []string{"A"}))
+		})
+	}
+
+	// overhangs before the write are always re-asserted and writes without an end valid time have no overhangs after
+	c := clock.New(t1)
+	db, err := dbFn(c)
+	require.Nil(t, err)
+	require.Nil(t, db.Set("A", oldValue))
+	require.Nil(t, c.SetNow(t3))
+	require.Nil(t, db.Set("A", newValue, WithValidTime(t2), WithOverhangPolicy(OverhangReject)))
+	kv, err := db.Get("A", AsOfValidTime(t1))
+	require.Nil(t, err)
+	assert.Equal(t, oldValue, kv.Value)
+}
@@ -0,0 +1,57 @@
+package dbtest
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestOverlapPolicy tests that a Set with WithOverlapPolicy(OverlapReject) fails with ErrOverlap if its valid time
+// range overlaps current versions of the key, and that WithOverlapPolicy(OverlapClip) overrides it. dbFn must return
+// an empty DB using clock for transaction times and clipping overlap by default.
+func TestOverlapPolicy(t *testing.T, oldValue, newValue Value, dbFn func(clock Clock) (DB, error)) {
+	reject := WithOverlapPolicy(OverlapReject)
+
+	c := clock.New(t2)
+	db, err := dbFn(c)
+	require.Nil(t, err)
+
+	// no current versions
+	require.Nil(t, db.Set("A", oldValue, WithValidTime(t1), WithEndValidTime(t2), reject))
+	require.Nil(t, c.SetNow(t3))
+	require.Nil(t, c.AutoAdvance(time.Minute))
+	// adjacent valid time ranges do not overlap
+	require.Nil(t, db.Set("A", oldValue, WithValidTime(t2), reject))
+
+	// overlapping Set is rejected and has no effect
+	err = db.Set("A", newValue, WithValidTime(t1), reject)
+	require.ErrorIs(t, err, ErrOverlap)
+	kv, err := db.Get("A", AsOfValidTime(t1))
+	require.Nil(t, err)
+	assert.Equal(t, oldValue, kv.Value)
+	vs, err := db.History("A")
+	require.Nil(t, err)
+	assert.Len(t, vs, 2)
+
+	// Delete is unaffected
+	require.Nil(t, db.Delete("A", WithValidTime(t2), reject))
+	_, err = db.Get("A")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	// explicit override clips
+	require.Nil(t, db.Set("A", newValue, WithValidTime(t1), WithOverlapPolicy(OverlapClip)))
+	kv, err = db.Get("A", AsOfValidTime(t1))
+	require.Nil(t, err)
+	assert.Equal(t, newValue, kv.Value)
+	kv, err = db.Get("A", AsOfValidTime(t1), AsOfTransactionTime(t2))
+	require.Nil(t, err)
+	assert.Equal(t, oldValue, kv.Value)
+
+	// default clips
+	require.Nil(t, db.Set("A", oldValue, WithValidTime(t2)))
+	require.Nil(t, CheckInvariants(db, []string{"A"}))
+}
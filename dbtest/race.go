@@ -0,0 +1,127 @@
+package dbtest
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/stretchr/testify/require"
+)
+
+// RaceOp is an operation run by TestRace.
+type RaceOp string
+
+// Race operations
+const (
+	RaceSet     RaceOp = "Set"
+	RaceGet     RaceOp = "Get"
+	RaceDelete  RaceOp = "Delete"
+	RaceList    RaceOp = "List"
+	RaceHistory RaceOp = "History"
+	RaceSetNow  RaceOp = "SetNow" // sets the clock, which is shared with the DB
+)
+
+// raceOptions is a struct for processing RaceOpt's to be used by TestRace
+type raceOptions struct {
+	concurrency int
+	callCount   int
+	opMix       map[RaceOp]int
+	keys        []string
+}
+
+// RaceOpt is an option for TestRace
+type RaceOpt func(*raceOptions)
+
+// WithConcurrency sets the number of goroutines calling the DB. Defaults to 4.
+func WithConcurrency(n int) RaceOpt {
+	return func(o *raceOptions) {
+		o.concurrency = n
+	}
+}
+
+// WithCallCount sets the number of operations each goroutine runs. Defaults to 150.
+func WithCallCount(n int) RaceOpt {
+	return func(o *raceOptions) {
+		o.callCount = n
+	}
+}
+
+// WithOpMix sets the relative weights of operations. Operations not in mix are not run. Defaults to equal weights of
+// all operations.
+func WithOpMix(mix map[RaceOp]int) RaceOpt {
+	return func(o *raceOptions) {
+		o.opMix = mix
+	}
+}
+
+// WithRaceKeys sets the keys operations are run on. Defaults to a single key so goroutines always conflict.
+func WithRaceKeys(keys ...string) RaceOpt {
+	return func(o *raceOptions) {
+		o.keys = keys
+	}
+}
+
+// TestRace calls all DB functions from many goroutines at once. It has no assertions on results and is meant to
+// trigger the data race detector, so run it with -race. Errors from operations are ignored. dbFn must return an empty
+// DB using clock for transaction times.
+func TestRace(t *testing.T, dbFn func(clock Clock) (DB, error), opts ...RaceOpt) {
+	options := &raceOptions{
+		concurrency: 4,
+		callCount:   150,
+		opMix: map[RaceOp]int{
+			RaceSet:     1,
+			RaceGet:     1,
+			RaceDelete:  1,
+			RaceList:    1,
+			RaceHistory: 1,
+			RaceSetNow:  1,
+		},
+		keys: []string{"A"},
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	// expand weights in a fixed order so runs are reproducible
+	var ops []RaceOp
+	for _, op := range []RaceOp{RaceSet, RaceGet, RaceDelete, RaceList, RaceHistory, RaceSetNow} {
+		for i := 0; i < options.opMix[op]; i++ {
+			ops = append(ops, op)
+		}
+	}
+	require.NotEmpty(t, ops, "op mix must have a positive weight")
+	require.NotEmpty(t, options.keys, "keys are required")
+
+	c := clock.New(t5)
+	db, err := dbFn(c)
+	require.Nil(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(options.concurrency)
+	for i := 0; i < options.concurrency; i++ {
+		go func(id int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(id)))
+			for j := 0; j < options.callCount; j++ {
+				key := options.keys[r.Intn(len(options.keys))]
+				switch ops[r.Intn(len(ops))] {
+				case RaceSet:
+					_ = db.Set(key, id)
+				case RaceGet:
+					_, _ = db.Get(key)
+				case RaceDelete:
+					_ = db.Delete(key)
+				case RaceList:
+					_, _ = db.List()
+				case RaceHistory:
+					_, _ = db.History(key)
+				case RaceSetNow:
+					_ = c.SetNow(t5)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,268 @@
+package dbtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+)
+
+// RecordedOp is a DB call captured by a Recorder. Times are resolved: defaulted valid and transaction times are
+// recorded as the clock times the DB used so the call can be replayed exactly.
+type RecordedOp struct {
+	Op  StepOp    `json:"op"`
+	Now time.Time `json:"now"` // clock time when the call was made
+	Key string    `json:"key,omitempty"`
+	// Value is the value written by Set.
+	Value Value `json:"value,omitempty"`
+	// ValidTime is the as of valid time for Get, List, and History and the valid time start for Set and Delete.
+	ValidTime *time.Time `json:"valid_time,omitempty"`
+	// TxTime is the as of transaction time for Get, List, and History.
+	TxTime *time.Time `json:"tx_time,omitempty"`
+	// ValidTimeWindow is the valid time window for History.
+	ValidTimeWindow *TimeWindow `json:"valid_time_window,omitempty"`
+	// EndValidTime is the valid time end for Set and Delete.
+	EndValidTime *time.Time `json:"end_valid_time,omitempty"`
+	// Result is the outcome of the call in the canonical form compared by TestEquivalence.
+	Result string `json:"result"`
+}
+
+// Step returns the operation as a Step with all times explicit.
+func (o RecordedOp) Step() Step {
+	s := Step{Now: o.Now, Op: o.Op, Key: o.Key, Value: o.Value}
+	switch o.Op {
+	case StepSet, StepDelete:
+		if o.ValidTime != nil {
+			s.WriteOpts = append(s.WriteOpts, WithValidTime(*o.ValidTime))
+		}
+		if o.EndValidTime != nil {
+			s.WriteOpts = append(s.WriteOpts, WithEndValidTime(*o.EndValidTime))
+		}
+	case StepGet, StepList:
+		if o.ValidTime != nil {
+			s.ReadOpts = append(s.ReadOpts, AsOfValidTime(*o.ValidTime))
+		}
+		if o.TxTime != nil {
+			s.ReadOpts = append(s.ReadOpts, AsOfTransactionTime(*o.TxTime))
+		}
+	case StepHistory:
+		if o.ValidTime != nil {
+			s.ReadOpts = append(s.ReadOpts, AsOfValidTime(*o.ValidTime))
+		}
+		if o.ValidTimeWindow != nil {
+			s.ReadOpts = append(s.ReadOpts, WithValidTimeWindow(o.ValidTimeWindow.Start, o.ValidTimeWindow.End))
+		}
+		if o.TxTime != nil {
+			s.ReadOpts = append(s.ReadOpts, AsOfTransactionTime(*o.TxTime))
+		}
+	}
+	return s
+}
+
+// OpLog is a serializable sequence of recorded DB calls.
+type OpLog []RecordedOp
+
+// Steps returns the operations as Steps for TestEquivalence.
+func (l OpLog) Steps() []Step {
+	out := make([]Step, len(l))
+	for i, o := range l {
+		out[i] = o.Step()
+	}
+	return out
+}
+
+// Write writes the op log as JSON.
+func (l OpLog) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(l)
+}
+
+// ReadOpLog reads an op log written by OpLog.Write.
+func ReadOpLog(r io.Reader) (OpLog, error) {
+	var l OpLog
+	if err := json.NewDecoder(r).Decode(&l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// NewRecorder constructs a Recorder. clock provides transaction times and must be passed to the recorded DB through
+// Recorder.Clock so the times the DB resolves are recorded.
+func NewRecorder(clock Clock) *Recorder {
+	return &Recorder{clock: &recordingClock{clock: clock}}
+}
+
+// Recorder captures every call made through a wrapped DB into an OpLog. Calls through the wrapped DB are serialized so
+// the log has a total order.
+type Recorder struct {
+	m     sync.Mutex
+	clock *recordingClock
+	log   OpLog
+}
+
+// Clock returns the clock the recorded DB must use.
+func (r *Recorder) Clock() Clock {
+	return r.clock
+}
+
+// Wrap returns a DB that records calls to db.
+func (r *Recorder) Wrap(db DB) DB {
+	return &recordedDB{db: db, r: r}
+}
+
+// Log returns the calls recorded so far.
+func (r *Recorder) Log() OpLog {
+	r.m.Lock()
+	defer r.m.Unlock()
+	out := make(OpLog, len(r.log))
+	copy(out, r.log)
+	return out
+}
+
+// record runs fn and appends the resolved operation.
+func (r *Recorder) record(op RecordedOp, fn func() (*VersionedKV, []*VersionedKV, error)) (*VersionedKV,
+	[]*VersionedKV, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.clock.reset()
+	kv, kvs, err := fn()
+	now, ok := r.clock.last()
+	if !ok {
+		// the DB did not use the clock. reuse the last recorded time so the clock is not advanced
+		if len(r.log) > 0 {
+			now = r.log[len(r.log)-1].Now
+		} else {
+			now = r.clock.Now()
+		}
+	}
+	op.Now = now
+	switch op.Op {
+	case StepSet, StepDelete:
+		if op.ValidTime == nil {
+			op.ValidTime = &now
+		}
+	case StepGet, StepList:
+		if op.ValidTime == nil {
+			op.ValidTime = &now
+		}
+		if op.TxTime == nil {
+			op.TxTime = &now
+		}
+	}
+	result, resultErr := canonicalResult(op.Op, kv, kvs, err)
+	if resultErr != nil {
+		result = "read error"
+	}
+	op.Result = result
+	r.log = append(r.log, op)
+	return kv, kvs, err
+}
+
+type recordedDB struct {
+	db DB
+	r  *Recorder
+}
+
+func (db *recordedDB) Get(key string, opts ...ReadOpt) (*VersionedKV, error) {
+	options := ApplyReadOpts(opts)
+	kv, _, err := db.r.record(RecordedOp{Op: StepGet, Key: key, ValidTime: options.ValidTime, TxTime: options.TxTime},
+		func() (*VersionedKV, []*VersionedKV, error) {
+			kv, err := db.db.Get(key, opts...)
+			return kv, nil, err
+		})
+	return kv, err
+}
+
+func (db *recordedDB) List(opts ...ReadOpt) ([]*VersionedKV, error) {
+	options := ApplyReadOpts(opts)
+	_, kvs, err := db.r.record(RecordedOp{Op: StepList, ValidTime: options.ValidTime, TxTime: options.TxTime},
+		func() (*VersionedKV, []*VersionedKV, error) {
+			kvs, err := db.db.List(opts...)
+			return nil, kvs, err
+		})
+	return kvs, err
+}
+
+func (db *recordedDB) Set(key string, value Value, opts ...WriteOpt) error {
+	options := ApplyWriteOpts(opts)
+	_, _, err := db.r.record(RecordedOp{Op: StepSet, Key: key, Value: value, ValidTime: options.ValidTime,
+		EndValidTime: options.EndValidTime}, func() (*VersionedKV, []*VersionedKV, error) {
+		return nil, nil, db.db.Set(key, value, opts...)
+	})
+	return err
+}
+
+func (db *recordedDB) Delete(key string, opts ...WriteOpt) error {
+	options := ApplyWriteOpts(opts)
+	_, _, err := db.r.record(RecordedOp{Op: StepDelete, Key: key, ValidTime: options.ValidTime,
+		EndValidTime: options.EndValidTime}, func() (*VersionedKV, []*VersionedKV, error) {
+		return nil, nil, db.db.Delete(key, opts...)
+	})
+	return err
+}
+
+func (db *recordedDB) History(key string, opts ...ReadOpt) ([]*VersionedKV, error) {
+	options := ApplyReadOpts(opts)
+	_, kvs, err := db.r.record(RecordedOp{Op: StepHistory, Key: key, ValidTime: options.ValidTime, TxTime: options.TxTime,
+		ValidTimeWindow: options.ValidTimeWindow}, func() (*VersionedKV, []*VersionedKV, error) {
+		kvs, err := db.db.History(key, opts...)
+		return nil, kvs, err
+	})
+	return kvs, err
+}
+
+// recordingClock remembers the last time it returned.
+type recordingClock struct {
+	clock Clock
+
+	m       sync.Mutex
+	lastNow *time.Time
+}
+
+func (c *recordingClock) Now() time.Time {
+	now := c.clock.Now()
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.lastNow = &now
+	return now
+}
+
+func (c *recordingClock) reset() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.lastNow = nil
+}
+
+func (c *recordingClock) last() (time.Time, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.lastNow == nil {
+		return time.Time{}, false
+	}
+	return *c.lastNow, true
+}
+
+// ReplayOpLog re-executes l against db, setting clock to each operation's time, and returns an error for the first
+// operation whose result differs from the recorded result. db must use clock for transaction times.
+func ReplayOpLog(db DB, clock clock.Settable, l OpLog) error {
+	for i, o := range l {
+		if err := clock.SetNow(o.Now); err != nil {
+			return fmt.Errorf("op %v: %v", i, err)
+		}
+		s := o.Step()
+		result, err := runStep(db, s)
+		if err != nil {
+			result = "read error"
+		}
+		if result != o.Result {
+			return fmt.Errorf("op %v: result differs: %v\nrecorded:\n%v\nreplayed:\n%v", i, s, o.Result, result)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package dbtest
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+)
+
+// ErrUnsupportedFixture is returned by ReplayFixtures for versions that can not be produced by writes. Suites skip test
+// cases with unsupported fixtures.
+var ErrUnsupportedFixture = errors.New("fixture can not be built by writes")
+
+// ReplayFixtures builds the state of versioned key-values in db by replaying Set and Delete calls in transaction time
+// order. clock must be the clock of the DB and not yet be past the first transaction time. This allows backends that
+// can not be seeded with versions directly to run the suites. Versions with valid times after their transaction time
+// start would be future writes and return ErrUnsupportedFixture.
+func ReplayFixtures(db DB, clock clock.Settable, kvs []*VersionedKV) error {
+	type event struct {
+		txTime time.Time
+		kv     *VersionedKV
+		isEnd  bool
+	}
+	var events []event
+	for _, kv := range kvs {
+		if err := kv.Validate(); err != nil {
+			return err
+		}
+		if kv.ValidTimeStart.After(kv.TxTimeStart) || (kv.ValidTimeEnd != nil && kv.ValidTimeEnd.After(kv.TxTimeStart)) {
+			return fmt.Errorf("%w: valid times are after transaction time start: %v", ErrUnsupportedFixture, toJSON(kv))
+		}
+		events = append(events, event{txTime: kv.TxTimeStart, kv: kv})
+		if kv.TxTimeEnd != nil {
+			events = append(events, event{txTime: *kv.TxTimeEnd, kv: kv, isEnd: true})
+		}
+	}
+	// at each transaction time, close versions before creating new ones
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].txTime.Equal(events[j].txTime) {
+			return events[i].txTime.Before(events[j].txTime)
+		}
+		return events[i].isEnd && !events[j].isEnd
+	})
+
+	for _, e := range events {
+		if err := clock.SetNow(e.txTime); err != nil {
+			return err
+		}
+		opts := []WriteOpt{WithValidTime(e.kv.ValidTimeStart)}
+		if e.kv.ValidTimeEnd != nil {
+			opts = append(opts, WithEndValidTime(*e.kv.ValidTimeEnd))
+		}
+		var err error
+		if e.isEnd {
+			err = db.Delete(e.kv.Key, opts...)
+		} else {
+			err = db.Set(e.kv.Key, e.kv.Value, opts...)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to replay version %v: %v", toJSON(e.kv), err)
+		}
+	}
+	return nil
+}
+
+// FixturesByReplay adapts a constructor of empty DBs into a dbFn for TestGet, TestList, and TestHistory by replaying
+// fixtures with ReplayFixtures. After replay, the DB's clock is the real time.
+func FixturesByReplay(newDB func(clock Clock) (DB, func(), error)) func(kvs []*VersionedKV) (DB, func(), error) {
+	return func(kvs []*VersionedKV) (DB, func(), error) {
+		return replay(newDB, kvs, &DefaultClock{})
+	}
+}
+
+// FixturesByReplayWithClock adapts a constructor of empty DBs into a dbFn for TestSet and TestDelete by replaying
+// fixtures with ReplayFixtures. After replay, the DB's clock is the clock provided by the suite.
+func FixturesByReplayWithClock(newDB func(clock Clock) (DB, func(), error)) func(kvs []*VersionedKV, clock Clock) (DB, func(), error) {
+	return func(kvs []*VersionedKV, clock Clock) (DB, func(), error) {
+		return replay(newDB, kvs, clock)
+	}
+}
+
+func replay(newDB func(clock Clock) (DB, func(), error), kvs []*VersionedKV, after Clock) (DB, func(), error) {
+	c := &replayClock{replay: &clock.Clock{}, after: after, replaying: true}
+	db, closeFn, err := newDB(c)
+	if err != nil {
+		return nil, func() {}, err
+	}
+	if err := ReplayFixtures(db, c.replay, kvs); err != nil {
+		closeFn()
+		return nil, func() {}, err
+	}
+	c.done()
+	return db, closeFn, nil
+}
+
+// replayClock is the replay clock while replaying fixtures and then switches to another clock.
+type replayClock struct {
+	m         sync.RWMutex
+	replay    *clock.Clock
+	after     Clock
+	replaying bool
+}
+
+func (c *replayClock) Now() time.Time {
+	c.m.RLock()
+	defer c.m.RUnlock()
+	if c.replaying {
+		return c.replay.Now()
+	}
+	return c.after.Now()
+}
+
+func (c *replayClock) done() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.replaying = false
+}
@@ -0,0 +1,140 @@
+package dbtest
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	. "github.com/elh/bitempura"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	stress         bool
+	stressKeys     int
+	stressVersions int
+)
+
+func init() {
+	flag.BoolVar(&stress, "stress", false, "if true, run TestStress. otherwise it is skipped")
+	flag.IntVar(&stressKeys, "stress-keys", 0, "if set, overrides the number of keys generated by TestStress")
+	flag.IntVar(&stressVersions, "stress-versions", 0, "if set, overrides the number of writes per key generated by "+
+		"TestStress")
+}
+
+// stressOptions is a struct for processing StressOpt's to be used by TestStress
+type stressOptions struct {
+	keyCount       int
+	versionsPerKey int
+	calls          int
+	budgets        map[StepOp]time.Duration
+}
+
+// StressOpt is an option for TestStress
+type StressOpt func(*stressOptions)
+
+// WithStressSize sets the number of keys and writes per key generated. Defaults to 100,000 keys and 50 writes per key.
+// The -stress-keys and -stress-versions flags take precedence.
+func WithStressSize(keyCount, versionsPerKey int) StressOpt {
+	return func(o *stressOptions) {
+		o.keyCount = keyCount
+		o.versionsPerKey = versionsPerKey
+	}
+}
+
+// WithStressCalls sets the number of Get and History calls measured. Defaults to 1,000.
+func WithStressCalls(n int) StressOpt {
+	return func(o *stressOptions) {
+		o.calls = n
+	}
+}
+
+// WithBudget sets the maximum mean wall time of a StepGet, StepList, or StepHistory call. Defaults to 1ms for Get and
+// History and 10s for List.
+func WithBudget(op StepOp, d time.Duration) StressOpt {
+	return func(o *stressOptions) {
+		o.budgets[op] = d
+	}
+}
+
+// TestStress seeds a DB with a large generated history and measures the wall time of Get, List, and History at random
+// coordinates. It fails if the mean time of a call exceeds its budget. Stress tests are slow and opt-in: they are
+// skipped unless the -stress flag is set. dbFn must return a DB under test with the VersionedKV's stored in the
+// database and a function to close the DB after the test is complete.
+func TestStress(t *testing.T, dbFn func(kvs []*VersionedKV) (db DB, closeFn func(), err error), opts ...StressOpt) {
+	flag.Parse()
+	if !stress {
+		t.Skip("stress tests are skipped. run with -stress")
+	}
+	options := &stressOptions{
+		keyCount:       100000,
+		versionsPerKey: 50,
+		calls:          1000,
+		budgets: map[StepOp]time.Duration{
+			StepGet:     time.Millisecond,
+			StepList:    10 * time.Second,
+			StepHistory: time.Millisecond,
+		},
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	if stressKeys > 0 {
+		options.keyCount = stressKeys
+	}
+	if stressVersions > 0 {
+		options.versionsPerKey = stressVersions
+	}
+
+	start := time.Now()
+	step := time.Second
+	kvs := Generate(1, WithKeyCount(options.keyCount), WithVersionsPerKey(options.versionsPerKey),
+		WithTimeRange(t1, step))
+	db, closeFn, err := dbFn(kvs)
+	require.Nil(t, err)
+	defer closeFn()
+	t.Logf("seeded %v versions of %v keys in %v", len(kvs), options.keyCount, time.Since(start))
+
+	// reads are at random coordinates within the generated time range
+	end := t1.Add(time.Duration(options.keyCount*options.versionsPerKey) * step)
+	r := rand.New(rand.NewSource(1))
+	randTime := func() time.Time {
+		return t1.Add(time.Duration(r.Int63n(int64(end.Sub(t1)) + 1)))
+	}
+	randKey := func() string {
+		return fmt.Sprintf("key-%03d", r.Intn(options.keyCount))
+	}
+
+	measure := func(op StepOp, calls int, fn func() error) {
+		start := time.Now()
+		for i := 0; i < calls; i++ {
+			require.Nil(t, fn())
+		}
+		mean := time.Since(start) / time.Duration(calls)
+		t.Logf("%v: mean %v over %v calls", op, mean, calls)
+		if budget, ok := options.budgets[op]; ok && mean > budget {
+			t.Errorf("%v: mean %v exceeds budget of %v", op, mean, budget)
+		}
+	}
+	measure(StepGet, options.calls, func() error {
+		_, err := db.Get(randKey(), AsOfValidTime(randTime()), AsOfTransactionTime(randTime()))
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		return nil
+	})
+	measure(StepList, 1, func() error {
+		_, err := db.List(AsOfValidTime(randTime()), AsOfTransactionTime(randTime()))
+		return err
+	})
+	measure(StepHistory, options.calls, func() error {
+		_, err := db.History(randKey())
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		return nil
+	})
+}
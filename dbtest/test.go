@@ -5,52 +5,33 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"log"
-	"os"
-	"regexp"
 	"sort"
 	"testing"
 	"time"
 
 	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/elh/bitempura/dbtest/tt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 var (
-	outputHistory bool
-	outputDir     string
-)
-
-func init() {
-	flag.BoolVar(&outputHistory, "output-history", false, "if true, output test result history to output dir")
-	flag.StringVar(&outputDir, "output-history-dir", "_testoutput/", "output dir")
-}
-
-var (
-	shortForm = "2006-01-02" // simple time format
-
 	// these test dates are always in the real-world past
-	t0 = mustParseTime(shortForm, "2021-12-31")
-	t1 = mustParseTime(shortForm, "2022-01-01")
-	t2 = mustParseTime(shortForm, "2022-01-02")
-	t3 = mustParseTime(shortForm, "2022-01-03")
-	t4 = mustParseTime(shortForm, "2022-01-04")
-	t5 = mustParseTime(shortForm, "2022-01-05")
+	t0 = tt.Day(0)
+	t1 = tt.Day(1)
+	t2 = tt.Day(2)
+	t3 = tt.Day(3)
+	t4 = tt.Day(4)
+	t5 = tt.Day(5)
 )
 
-func mustParseTime(layout, value string) time.Time {
-	t, err := time.Parse(layout, value)
-	if err != nil {
-		panic(err)
-	}
-	return t
-}
-
 // TestGet tests the Get function. dbFn must return a DB under test with the VersionedKV's stored in the database and
 // a function to close the DB after the test is complete.
-func TestGet(t *testing.T, oldValue, newValue Value, dbFn func(kvs []*VersionedKV) (db DB, closeFn func(), err error)) {
+func TestGet(t *testing.T, oldValue, newValue Value, dbFn func(kvs []*VersionedKV) (db DB, closeFn func(), err error),
+	opts ...SuiteOpt) {
 	flag.Parse()
+	options := applySuiteOpts(opts)
 	type fixtures struct {
 		name string
 		// make sure structs isolated between tests while doing in-mem mutations
@@ -310,8 +291,12 @@ func TestGet(t *testing.T, oldValue, newValue Value, dbFn func(kvs []*VersionedK
 			tC := tC
 			t.Run(fmt.Sprintf("%v: %v", s.fixtures.name, tC.desc), func(t *testing.T) {
 				db, closeFn, err := dbFn(s.fixtures.vKVs())
+				if errors.Is(err, ErrUnsupportedFixture) {
+					t.Skip(err)
+				}
 				defer closeFn()
-				defer WriteOutputHistory(t, db, []string{"A"}, t.Name(), "")
+				db = options.recordReads(db)
+				defer WriteOutput(t, options.outputWriter, db, []string{"A"}, "")
 				require.Nil(t, err)
 				ret, err := db.Get(tC.key, tC.readOpts...)
 				if tC.expectErrNotFound {
@@ -331,7 +316,9 @@ func TestGet(t *testing.T, oldValue, newValue Value, dbFn func(kvs []*VersionedK
 
 // TestList tests the List function. dbFn must return a DB under test with the VersionedKV's stored in the database and
 // a function to close the DB after the test is complete.
-func TestList(t *testing.T, oldValue, newValue Value, dbFn func(kvs []*VersionedKV) (db DB, closeFn func(), err error)) {
+func TestList(t *testing.T, oldValue, newValue Value, dbFn func(kvs []*VersionedKV) (db DB, closeFn func(), err error),
+	opts ...SuiteOpt) {
+	options := applySuiteOpts(opts)
 	type fixtures struct {
 		name string
 		// make sure structs isolated between tests while doing in-mem mutations
@@ -448,8 +435,12 @@ func TestList(t *testing.T, oldValue, newValue Value, dbFn func(kvs []*Versioned
 			tC := tC
 			t.Run(fmt.Sprintf("%v: %v", s.fixtures.name, tC.desc), func(t *testing.T) {
 				db, closeFn, err := dbFn(s.fixtures.vKVs())
+				if errors.Is(err, ErrUnsupportedFixture) {
+					t.Skip(err)
+				}
 				defer closeFn()
-				defer WriteOutputHistory(t, db, []string{"A"}, t.Name(), "")
+				db = options.recordReads(db)
+				defer WriteOutput(t, options.outputWriter, db, []string{"A"}, "")
 				require.Nil(t, err)
 				ret, err := db.List(tC.readOpts...)
 				if tC.expectErr {
@@ -470,7 +461,8 @@ func TestList(t *testing.T, oldValue, newValue Value, dbFn func(kvs []*Versioned
 
 // TestSet tests the Set function. dbFn must return a DB under test with the VersionedKV's stored in the database and
 // transaction times provided by the clock.
-func TestSet(t *testing.T, dbFn func(kvs []*VersionedKV, clock Clock) (DB, error)) {
+func TestSet(t *testing.T, dbFn func(kvs []*VersionedKV, clock Clock) (DB, error), opts ...SuiteOpt) {
+	options := applySuiteOpts(opts)
 	type fixtures struct {
 		name string
 		// make sure structs isolated between tests while doing in-mem mutations
@@ -919,19 +911,31 @@ func TestSet(t *testing.T, dbFn func(kvs []*VersionedKV, clock Clock) (DB, error
 		for _, tC := range s.testCases {
 			tC := tC
 			t.Run(fmt.Sprintf("%v: %v", s.fixtures.name, tC.desc), func(t *testing.T) {
-				clock := &TestClock{}
+				clock := &clock.Clock{}
 				db, err := dbFn(s.fixtures.vKVs(), clock)
-				defer WriteOutputHistory(t, db, []string{"A"}, t.Name(), "")
+				if errors.Is(err, ErrUnsupportedFixture) {
+					t.Skip(err)
+				}
+				db = options.recordReads(db)
+				defer WriteOutput(t, options.outputWriter, db, []string{"A"}, "")
 				require.Nil(t, err)
 				if tC.now != nil {
 					require.Nil(t, clock.SetNow(*tC.now))
 				}
 				err = db.Set(tC.key, tC.value, tC.writeOpts...)
+				if options.checkInvariants {
+					keys, keysErr := invariantKeys(db, s.fixtures.vKVs(), tC.key)
+					require.Nil(t, keysErr)
+					require.Nil(t, CheckInvariants(db, keys))
+				}
 				if tC.expectErr {
 					require.NotNil(t, err)
 					return
 				}
 				require.Nil(t, err)
+				if options.goldenDir != "" {
+					AssertGolden(t, options.goldenDir, db, []string{tC.key})
+				}
 
 				for _, findCheck := range tC.findChecks {
 					ret, err := db.Get(tC.key, findCheck.readOpts...)
@@ -952,7 +956,8 @@ func TestSet(t *testing.T, dbFn func(kvs []*VersionedKV, clock Clock) (DB, error
 // and set transaction times provided by the clock. It must also return a function to close the DB after the test is
 // complete.
 func TestDelete(t *testing.T, oldValue, newValue Value, dbFn func(kvs []*VersionedKV, clock Clock) (db DB,
-	closeFn func(), err error)) {
+	closeFn func(), err error), opts ...SuiteOpt) {
+	options := applySuiteOpts(opts)
 	type fixtures struct {
 		name string
 		// make sure structs isolated between tests while doing in-mem mutations
@@ -1258,20 +1263,32 @@ func TestDelete(t *testing.T, oldValue, newValue Value, dbFn func(kvs []*Version
 		for _, tC := range s.testCases {
 			tC := tC
 			t.Run(fmt.Sprintf("%v: %v", s.fixtures.name, tC.desc), func(t *testing.T) {
-				clock := &TestClock{}
+				clock := &clock.Clock{}
 				db, closeFn, err := dbFn(s.fixtures.vKVs(), clock)
+				if errors.Is(err, ErrUnsupportedFixture) {
+					t.Skip(err)
+				}
 				defer closeFn()
-				defer WriteOutputHistory(t, db, []string{"A"}, t.Name(), "")
+				db = options.recordReads(db)
+				defer WriteOutput(t, options.outputWriter, db, []string{"A"}, "")
 				require.Nil(t, err)
 				if tC.now != nil {
 					require.Nil(t, clock.SetNow(*tC.now))
 				}
 				err = db.Delete(tC.key, tC.writeOpts...)
+				if options.checkInvariants {
+					keys, keysErr := invariantKeys(db, s.fixtures.vKVs(), tC.key)
+					require.Nil(t, keysErr)
+					require.Nil(t, CheckInvariants(db, keys))
+				}
 				if tC.expectErr {
 					require.NotNil(t, err)
 					return
 				}
 				require.Nil(t, err)
+				if options.goldenDir != "" {
+					AssertGolden(t, options.goldenDir, db, []string{tC.key})
+				}
 
 				for _, findCheck := range tC.findChecks {
 					ret, err := db.Get(tC.key, findCheck.readOpts...)
@@ -1290,7 +1307,9 @@ func TestDelete(t *testing.T, oldValue, newValue Value, dbFn func(kvs []*Version
 
 // TestHistory tests the History function. dbFn must return a DB under test with the VersionedKV's stored in the
 // database and a function to close the DB after the test is complete.
-func TestHistory(t *testing.T, oldValue, newValue Value, dbFn func(kvs []*VersionedKV) (db DB, closeFn func(), err error)) {
+func TestHistory(t *testing.T, oldValue, newValue Value, dbFn func(kvs []*VersionedKV) (db DB, closeFn func(), err error),
+	opts ...SuiteOpt) {
+	options := applySuiteOpts(opts)
 	type fixtures struct {
 		name string
 		// make sure structs isolated between tests while doing in-mem mutations
@@ -1390,6 +1409,7 @@ func TestHistory(t *testing.T, oldValue, newValue Value, dbFn func(kvs []*Versio
 		desc              string
 		key               string
 		expectErrNotFound bool
+		readOpts          []ReadOpt
 		expectErr         bool // this is exclusive of ErrNotFound. this is for unexepcted errors
 		expectValues      []*VersionedKV
 	}
@@ -1482,6 +1502,97 @@ func TestHistory(t *testing.T, oldValue, newValue Value, dbFn func(kvs []*Versio
 						},
 					},
 				},
+				{
+					desc:     "as of transaction time, versions are as they were known",
+					key:      "A",
+					readOpts: []ReadOpt{AsOfTransactionTime(t2)},
+					expectValues: []*VersionedKV{
+						{
+							Key:            "A",
+							TxTimeStart:    t1,
+							TxTimeEnd:      nil,
+							ValidTimeStart: t1,
+							ValidTimeEnd:   nil,
+							Value:          oldValue,
+						},
+					},
+				},
+				{
+					desc:              "as of transaction time before first version",
+					key:               "A",
+					readOpts:          []ReadOpt{AsOfTransactionTime(t0)},
+					expectErrNotFound: true,
+				},
+				{
+					desc:     "as of valid time, versions valid at it",
+					key:      "A",
+					readOpts: []ReadOpt{AsOfValidTime(t1)},
+					expectValues: []*VersionedKV{
+						{
+							Key:            "A",
+							TxTimeStart:    t3,
+							TxTimeEnd:      nil,
+							ValidTimeStart: t1,
+							ValidTimeEnd:   &t3,
+							Value:          oldValue,
+						},
+						{
+							Key:            "A",
+							TxTimeStart:    t1,
+							TxTimeEnd:      &t3,
+							ValidTimeStart: t1,
+							ValidTimeEnd:   nil,
+							Value:          oldValue,
+						},
+					},
+				},
+				{
+					desc:     "valid time window, versions overlapping it",
+					key:      "A",
+					readOpts: []ReadOpt{WithValidTimeWindow(t3, t4)},
+					expectValues: []*VersionedKV{
+						{
+							Key:            "A",
+							TxTimeStart:    t3,
+							TxTimeEnd:      nil,
+							ValidTimeStart: t3,
+							ValidTimeEnd:   nil,
+							Value:          newValue,
+						},
+						{
+							Key:            "A",
+							TxTimeStart:    t1,
+							TxTimeEnd:      &t3,
+							ValidTimeStart: t1,
+							ValidTimeEnd:   nil,
+							Value:          oldValue,
+						},
+					},
+				},
+				{
+					desc:     "as of valid time and transaction time, ended versions are kept",
+					key:      "A",
+					readOpts: []ReadOpt{AsOfValidTime(t4), AsOfTransactionTime(t3)},
+					expectValues: []*VersionedKV{
+						{
+							Key:            "A",
+							TxTimeStart:    t3,
+							TxTimeEnd:      nil,
+							ValidTimeStart: t3,
+							ValidTimeEnd:   nil,
+							Value:          newValue,
+						},
+
+						{
+							Key:            "A",
+							TxTimeStart:    t1,
+							TxTimeEnd:      &t3,
+							ValidTimeStart: t1,
+							ValidTimeEnd:   nil,
+							Value:          oldValue,
+						},
+					},
+				},
 			},
 		},
 		{
@@ -1616,10 +1727,14 @@ func TestHistory(t *testing.T, oldValue, newValue Value, dbFn func(kvs []*Versio
 			tC := tC
 			t.Run(fmt.Sprintf("%v: %v", s.fixtures.name, tC.desc), func(t *testing.T) {
 				db, closeFn, err := dbFn(s.fixtures.vKVs())
+				if errors.Is(err, ErrUnsupportedFixture) {
+					t.Skip(err)
+				}
 				defer closeFn()
-				defer WriteOutputHistory(t, db, []string{"A"}, t.Name(), "")
+				db = options.recordReads(db)
+				defer WriteOutput(t, options.outputWriter, db, []string{"A"}, "")
 				require.Nil(t, err)
-				ret, err := db.History(tC.key)
+				ret, err := db.History(tC.key, tC.readOpts...)
 				if tC.expectErrNotFound {
 					require.ErrorIs(t, err, ErrNotFound)
 					return
@@ -1649,51 +1764,3 @@ func toJSON(v interface{}) string {
 	}
 	return string(out)
 }
-
-// TestOutput is the format for saving test data for debugging and visualization.
-type TestOutput struct {
-	TestName    string
-	Passed      bool                      // true is test passed
-	Histories   map[string][]*VersionedKV // key -> history
-	Description string                    // optional description. Markdown is supported.
-}
-
-// WriteOutputHistory writes to a file the final "history" for specified keys at the end of a test. This is used for
-// debugging and visualization.
-func WriteOutputHistory(t *testing.T, db DB, keys []string, testName, description string) {
-	if !outputHistory {
-		return
-	}
-
-	histories := map[string][]*VersionedKV{}
-	for _, key := range keys {
-		kvs, err := db.History(key)
-		if errors.Is(err, ErrNotFound) {
-			kvs = []*VersionedKV{}
-		} else if err != nil {
-			fmt.Printf("failed to get output history for test=%v\n: %v", testName, err)
-			return
-		}
-		histories[key] = kvs
-	}
-	o := TestOutput{
-		TestName:    testName,
-		Passed:      !t.Failed(),
-		Histories:   histories,
-		Description: description,
-	}
-	kvsJSON := toJSON(o)
-
-	// format test name for file friendliness
-	reg, err := regexp.Compile("[^a-zA-Z0-9]+")
-	if err != nil {
-		log.Fatal(err)
-	}
-	fileName := reg.ReplaceAllString(testName, "_")
-	_ = os.Mkdir(outputDir, 0777)
-	err = os.WriteFile(fmt.Sprintf("%s/%s.json", outputDir, fileName), []byte(kvsJSON), 0644)
-	if err != nil {
-		fmt.Printf("failed to write output history for test=%v\n: %v", testName, err)
-		return
-	}
-}
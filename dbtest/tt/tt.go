@@ -0,0 +1,45 @@
+// Package tt provides consistent test times.
+//
+// Day(n) is n days after Epoch. Tests conventionally name these t0, t1, ... so Day(1) is t1. All times are UTC
+// midnights in the real-world past so they are valid transaction times.
+package tt
+
+import "time"
+
+// Epoch is Day(0).
+var Epoch = time.Date(2021, 12, 31, 0, 0, 0, 0, time.UTC)
+
+const shortForm = "2006-01-02"
+
+// Day returns the time n days after Epoch.
+func Day(n int) time.Time {
+	return Epoch.AddDate(0, 0, n)
+}
+
+// DayPtr returns a pointer to Day(n) for optional times like end valid and transaction times.
+func DayPtr(n int) *time.Time {
+	return Ptr(Day(n))
+}
+
+// RangeDays returns Day(from) through Day(to) inclusive.
+func RangeDays(from, to int) []time.Time {
+	var out []time.Time
+	for n := from; n <= to; n++ {
+		out = append(out, Day(n))
+	}
+	return out
+}
+
+// Date returns the UTC midnight of a "2006-01-02" formatted date. It panics if value is malformed.
+func Date(value string) time.Time {
+	t, err := time.Parse(shortForm, value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Ptr returns a pointer to t.
+func Ptr(t time.Time) *time.Time {
+	return &t
+}
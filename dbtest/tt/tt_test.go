@@ -0,0 +1,18 @@
+package tt_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elh/bitempura/dbtest/tt"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimes(t *testing.T) {
+	require.Equal(t, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), tt.Day(1))
+	require.Equal(t, tt.Day(3), *tt.DayPtr(3))
+	require.Equal(t, []time.Time{tt.Day(1), tt.Day(2), tt.Day(3), tt.Day(4)}, tt.RangeDays(1, 4))
+	require.Empty(t, tt.RangeDays(2, 1))
+	require.Equal(t, tt.Day(0), tt.Date("2021-12-31"))
+	require.Panics(t, func() { tt.Date("12/31/2021") })
+}
@@ -0,0 +1,42 @@
+package dbtest
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestValidDuration tests that a write WithValidDuration ends at its valid time plus the duration, and that it is
+// rejected without a valid time or with an end valid time. dbFn must return an empty DB using clock for transaction
+// times.
+func TestValidDuration(t *testing.T, oldValue, newValue Value, dbFn func(clock Clock) (DB, error)) {
+	c := clock.New(t4)
+	db, err := dbFn(c)
+	require.Nil(t, err)
+
+	require.Nil(t, db.Set("A", oldValue, WithValidTime(t1), WithValidDuration(48*time.Hour)))
+	kv, err := db.Get("A", AsOfValidTime(t2))
+	require.Nil(t, err)
+	assert.Equal(t, oldValue, kv.Value)
+	require.NotNil(t, kv.ValidTimeEnd)
+	assert.True(t, kv.ValidTimeEnd.Equal(t3), "valid time end %v", kv.ValidTimeEnd)
+	_, err = db.Get("A", AsOfValidTime(t3))
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// the default valid time is now, so the end would be in the future
+	assert.NotNil(t, db.Set("A", newValue, WithValidDuration(time.Hour)))
+	assert.NotNil(t, db.Set("A", newValue, WithValidTime(t1), WithEndValidTime(t2), WithValidDuration(time.Hour)))
+	assert.NotNil(t, db.Set("A", newValue, WithValidTime(t1), WithValidDuration(-time.Hour)))
+
+	require.Nil(t, db.Delete("A", WithValidTime(t1), WithValidDuration(24*time.Hour)))
+	_, err = db.Get("A", AsOfValidTime(t1))
+	assert.ErrorIs(t, err, ErrNotFound)
+	kv, err = db.Get("A", AsOfValidTime(t2))
+	require.Nil(t, err)
+	assert.Equal(t, oldValue, kv.Value)
+	require.Nil(t, CheckInvariants(db, []string{"A"}))
+}
@@ -0,0 +1,41 @@
+// Package demo runs examples that declare their dates anywhere, including the Go playground. The playground fixes
+// time.Now at 2009-11-10, so a DB using the real clock rejects writes at later declared dates as valid times in the
+// future. demo DBs instead take transaction times from a clock seeded from the declared dates.
+//
+//	dec30, jan1 := ...
+//	db, err := demo.NewDB([]time.Time{dec30, jan1})
+//	err = db.Set("Bob/balance", 90, bt.WithValidTime(dec30), bt.WithEndValidTime(jan1))
+package demo
+
+import (
+	"time"
+
+	"github.com/elh/bitempura/clock"
+	"github.com/elh/bitempura/memory"
+)
+
+// Step is how far clocks from NewClock advance after every read, so every write has a distinct transaction time.
+const Step = time.Millisecond
+
+// NewClock returns an auto-advancing clock starting at the latest of dates, so none of them are in the future. Without
+// dates, it starts at the current time.
+func NewClock(dates ...time.Time) *clock.Clock {
+	var start time.Time
+	if len(dates) == 0 {
+		start = time.Now()
+	}
+	for _, d := range dates {
+		if d.After(start) {
+			start = d
+		}
+	}
+	c := clock.New(start)
+	_ = c.AutoAdvance(Step) // Step is positive
+	return c
+}
+
+// NewDB constructs an in-memory DB whose transaction times come from NewClock(dates...). opts are applied after the
+// clock, so they may override it.
+func NewDB(dates []time.Time, opts ...memory.DBOpt) (*memory.DB, error) {
+	return memory.NewDB(append([]memory.DBOpt{memory.WithClock(NewClock(dates...))}, opts...)...)
+}
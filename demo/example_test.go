@@ -0,0 +1,51 @@
+package demo_test
+
+import (
+	"fmt"
+	"time"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/demo"
+)
+
+// The front page example. It runs unmodified in the Go playground.
+func Example() {
+	date := func(month time.Month, day, year int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	dec30, jan1, jan3, jan8 := date(time.December, 30, 2021), date(time.January, 1, 2022), date(time.January, 3, 2022), date(time.January, 8, 2022)
+
+	db, err := demo.NewDB([]time.Time{dec30, jan1, jan3, jan8})
+	if err != nil {
+		panic(err)
+	}
+	if err := db.Set("Bob/balance", 100, bt.WithValidTime(dec30)); err != nil {
+		panic(err)
+	}
+	// we later learn that Bob had a temporary pending charge we missed from Dec 30 to Jan 3
+	if err := db.Set("Bob/balance", 90, bt.WithValidTime(dec30), bt.WithEndValidTime(jan3)); err != nil {
+		panic(err)
+	}
+
+	// "what was Bob's balance on Jan 1 as best we knew on Jan 8?"
+	kv, err := db.Get("Bob/balance", bt.AsOfValidTime(jan1), bt.AsOfTransactionTime(jan8))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(kv.Value)
+	// "but what was it on Jan 1 as best we now know?"
+	kv, err = db.Get("Bob/balance", bt.AsOfValidTime(jan1))
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(kv.Value)
+	versions, err := db.History("Bob/balance")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(len(versions))
+	// Output:
+	// 100
+	// 90
+	// 3
+}
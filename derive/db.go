@@ -0,0 +1,226 @@
+package derive
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	bt "github.com/elh/bitempura"
+)
+
+var _ bt.DB = (*DB)(nil)
+
+// Derivation declares a derived key.
+type Derivation struct {
+	Key string
+	// IsInput returns whether key is an input of the derived key.
+	IsInput func(key string) bool
+	// Compute returns the value of the derived key from its inputs valid at a valid time, in ascending key order. If ok
+	// is false, the derived key is deleted at that valid time.
+	Compute func(inputs []*bt.VersionedKV) (value bt.Value, ok bool, err error)
+}
+
+// Wrap returns a DB that maintains derivations. db must be a KeyLister. A derived key may be an input of derivations
+// registered after it, but derivations must not form cycles.
+func Wrap(db bt.DB, derivations []*Derivation, opts ...Opt) (*DB, error) {
+	kl, ok := db.(bt.KeyLister)
+	if !ok {
+		return nil, errors.New("db must be a KeyLister")
+	}
+	options := &options{
+		clock: &bt.DefaultClock{},
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	derived := map[string]bool{}
+	for _, d := range derivations {
+		derived[d.Key] = true
+	}
+	return &DB{db: db, keyLister: kl, derivations: derivations, derived: derived, clock: options.clock}, nil
+}
+
+// DB is a DB that maintains derived keys. Derived keys cannot be written directly.
+type DB struct {
+	db          bt.DB
+	keyLister   bt.KeyLister
+	derivations []*Derivation
+	derived     map[string]bool // derived keys
+	clock       bt.Clock
+	writeM      sync.Mutex // serialize writes so derived keys are computed from the write's inputs
+}
+
+// options is a struct for processing Opt's to be used by DB
+type options struct {
+	clock bt.Clock
+}
+
+// Opt is an option for wrapping databases
+type Opt func(*options)
+
+// WithClock wraps the database with a clock to resolve defaulted valid times. It should be the wrapped DB's clock.
+func WithClock(clock bt.Clock) Opt {
+	return func(os *options) {
+		os.clock = clock
+	}
+}
+
+// Get data by key (as of optional valid and transaction times).
+func (db *DB) Get(key string, opts ...bt.ReadOpt) (*bt.VersionedKV, error) {
+	return db.db.Get(key, opts...)
+}
+
+// List all data (as of optional valid and transaction times).
+func (db *DB) List(opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	return db.db.List(opts...)
+}
+
+// Set stores value (with optional start and end valid time) and recomputes the derived keys it is an input of.
+func (db *DB) Set(key string, value bt.Value, opts ...bt.WriteOpt) error {
+	return db.write(key, opts, func() error {
+		return db.db.Set(key, value, opts...)
+	})
+}
+
+// Delete removes value (with optional start and end valid time) and recomputes the derived keys it is an input of.
+func (db *DB) Delete(key string, opts ...bt.WriteOpt) error {
+	return db.write(key, opts, func() error {
+		return db.db.Delete(key, opts...)
+	})
+}
+
+// History returns versions by descending end transaction time, descending end valid time
+func (db *DB) History(key string, opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	return db.db.History(key, opts...)
+}
+
+// Keys returns all keys in ascending order.
+func (db *DB) Keys() ([]string, error) {
+	return db.keyLister.Keys()
+}
+
+func (db *DB) write(key string, opts []bt.WriteOpt, fn func() error) error {
+	if db.derived[key] {
+		return fmt.Errorf("key=%v is derived and cannot be written", key)
+	}
+	options := bt.ApplyWriteOpts(opts)
+	start := db.clock.Now()
+	if options.ValidTime != nil {
+		start = *options.ValidTime
+	}
+
+	db.writeM.Lock()
+	defer db.writeM.Unlock()
+	if err := fn(); err != nil {
+		return err
+	}
+	return db.propagate(key, start, options.EndValidTime)
+}
+
+// propagate recomputes the derivations that key is an input of over the valid time range [start, end), followed by
+// the derivations that those are inputs of. An end of nil is unbounded.
+func (db *DB) propagate(key string, start time.Time, end *time.Time) error {
+	for _, d := range db.derivations {
+		if d.Key == key || !d.IsInput(key) {
+			continue
+		}
+		if err := db.recompute(d, start, end); err != nil {
+			return fmt.Errorf("failed to derive key=%v: %w", d.Key, err)
+		}
+		if err := db.propagate(d.Key, start, end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recompute re-asserts the derived key over [start, end). The range is split at every valid time that an input's
+// current version starts or ends, and each segment is computed from the inputs valid at its start. Adjacent segments
+// with equal values are written together.
+func (db *DB) recompute(d *Derivation, start time.Time, end *time.Time) error {
+	keys, err := db.keyLister.Keys()
+	if err != nil {
+		return err
+	}
+	var inputs []string
+	for _, k := range keys {
+		if k != d.Key && d.IsInput(k) {
+			inputs = append(inputs, k)
+		}
+	}
+
+	// valid time boundaries within (start, end)
+	boundaries := []time.Time{start}
+	addBoundary := func(t time.Time) {
+		if t.After(start) && (end == nil || t.Before(*end)) {
+			boundaries = append(boundaries, t)
+		}
+	}
+	histories, err := bt.Histories(db.db, inputs)
+	if err != nil {
+		return err
+	}
+	for _, vs := range histories {
+		for _, v := range vs {
+			if v.TxTimeEnd != nil {
+				continue
+			}
+			addBoundary(v.ValidTimeStart)
+			if v.ValidTimeEnd != nil {
+				addBoundary(*v.ValidTimeEnd)
+			}
+		}
+	}
+	sort.Slice(boundaries, func(i, j int) bool { return boundaries[i].Before(boundaries[j]) })
+
+	type segment struct {
+		start time.Time
+		value bt.Value
+		ok    bool
+	}
+	var segments []segment
+	for i, t := range boundaries {
+		if i > 0 && t.Equal(boundaries[i-1]) {
+			continue
+		}
+		var valid []*bt.VersionedKV
+		for _, k := range inputs {
+			kv, err := db.db.Get(k, bt.AsOfValidTime(t))
+			if errors.Is(err, bt.ErrNotFound) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			valid = append(valid, kv)
+		}
+		value, ok, err := d.Compute(valid)
+		if err != nil {
+			return err
+		}
+		if n := len(segments); n > 0 && segments[n-1].ok == ok && reflect.DeepEqual(segments[n-1].value, value) {
+			continue
+		}
+		segments = append(segments, segment{start: t, value: value, ok: ok})
+	}
+
+	for i, s := range segments {
+		opts := []bt.WriteOpt{bt.WithValidTime(s.start)}
+		if i+1 < len(segments) {
+			opts = append(opts, bt.WithEndValidTime(segments[i+1].start))
+		} else if end != nil {
+			opts = append(opts, bt.WithEndValidTime(*end))
+		}
+		if s.ok {
+			err = db.db.Set(d.Key, s.value, opts...)
+		} else {
+			err = db.db.Delete(d.Key, opts...)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package derive_test
+
+import (
+	"strings"
+	"testing"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/elh/bitempura/dbtest"
+	"github.com/elh/bitempura/dbtest/tt"
+	"github.com/elh/bitempura/derive"
+	"github.com/elh/bitempura/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// account/total is the sum of account balances. total/doubled is twice account/total.
+var derivations = []*derive.Derivation{
+	{
+		Key: "account/total",
+		IsInput: func(key string) bool {
+			return strings.HasPrefix(key, "account/")
+		},
+		Compute: func(inputs []*bt.VersionedKV) (bt.Value, bool, error) {
+			if len(inputs) == 0 {
+				return nil, false, nil
+			}
+			var total int
+			for _, kv := range inputs {
+				total += kv.Value.(int)
+			}
+			return total, true, nil
+		},
+	},
+	{
+		Key: "total/doubled",
+		IsInput: func(key string) bool {
+			return key == "account/total"
+		},
+		Compute: func(inputs []*bt.VersionedKV) (bt.Value, bool, error) {
+			if len(inputs) == 0 {
+				return nil, false, nil
+			}
+			return 2 * inputs[0].Value.(int), true, nil
+		},
+	},
+}
+
+func TestDB(t *testing.T) {
+	c := clock.New(tt.Day(1))
+	inner, err := memory.NewDB(memory.WithClock(c))
+	require.Nil(t, err)
+	db, err := derive.Wrap(inner, derivations, derive.WithClock(c))
+	require.Nil(t, err)
+	expectTotal := func(day int, expected int) {
+		t.Helper()
+		kv, err := db.Get("account/total", bt.AsOfValidTime(tt.Day(day)))
+		require.Nil(t, err)
+		assert.Equal(t, expected, kv.Value)
+		kv, err = db.Get("total/doubled", bt.AsOfValidTime(tt.Day(day)))
+		require.Nil(t, err)
+		assert.Equal(t, 2*expected, kv.Value)
+	}
+
+	require.Nil(t, db.Set("account/a", 10))
+	require.Nil(t, c.SetNow(tt.Day(2)))
+	require.Nil(t, db.Set("account/b", 5))
+	expectTotal(1, 10)
+	expectTotal(2, 15)
+
+	// a retroactive correction is propagated over its valid time range
+	require.Nil(t, c.SetNow(tt.Day(3)))
+	require.Nil(t, db.Set("account/a", 20, bt.WithValidTime(tt.Day(1)), bt.WithEndValidTime(tt.Day(2))))
+	expectTotal(1, 20)
+	expectTotal(2, 15)
+	expectTotal(3, 15)
+	kv, err := db.Get("account/total", bt.AsOfValidTime(tt.Day(1)), bt.AsOfTransactionTime(tt.Day(2)))
+	require.Nil(t, err)
+	assert.Equal(t, 10, kv.Value)
+
+	// derived keys are deleted where they have no inputs
+	require.Nil(t, db.Delete("account/a"))
+	require.Nil(t, db.Delete("account/b"))
+	_, err = db.Get("account/total")
+	assert.ErrorIs(t, err, bt.ErrNotFound)
+	_, err = db.Get("total/doubled")
+	assert.ErrorIs(t, err, bt.ErrNotFound)
+	expectTotal(2, 15)
+
+	// derived keys cannot be written
+	assert.NotNil(t, db.Set("account/total", 0))
+	require.Nil(t, dbtest.CheckInvariants(db, []string{"account/a", "account/b", "account/total", "total/doubled"}))
+}
+
+func TestWrap(t *testing.T) {
+	_, err := derive.Wrap(struct{ bt.DB }{}, derivations)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,5 @@
+// Package derive provides a DB decorator that maintains derived keys, such as "account/total" as the sum of account
+// balances. Derived keys are recomputed from their inputs and re-asserted over the valid time range of every write to an
+// input, so they have the same valid time history as if they had been written by hand. It is usable with any
+// bitempura.DB that is a bitempura.KeyLister.
+package derive
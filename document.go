@@ -2,6 +2,7 @@ package bitempura
 
 import (
 	"errors"
+	"reflect"
 	"time"
 )
 
@@ -15,6 +16,10 @@ type VersionedKV struct {
 	TxTimeEnd      *time.Time // exclusive
 	ValidTimeStart time.Time  // inclusive
 	ValidTimeEnd   *time.Time // exclusive
+
+	// DecisionTime is an optional third time axis for when the fact was decided, as opposed to when it was recorded
+	// (TxTimeStart). It is nil if not recorded. See WithDecisionTime and AsOfDecisionTime.
+	DecisionTime *time.Time `json:",omitempty"`
 }
 
 // Value is the user-controlled data associated with a key (and valid and transaction time information) in the database.
@@ -47,5 +52,108 @@ func (d *VersionedKV) Validate() error {
 			return errors.New("valid time start must be before end")
 		}
 	}
+	if d.DecisionTime != nil {
+		if d.DecisionTime.IsZero() {
+			return errors.New("decision time cannot be zero value")
+		}
+		if d.DecisionTime.After(d.TxTimeStart) {
+			return errors.New("decision time cannot be after transaction time start")
+		}
+	}
 	return nil
 }
+
+// DecidedAt returns whether the version was decided at or before decision time dt. Versions without a DecisionTime
+// were decided when they were recorded at TxTimeStart.
+func (d *VersionedKV) DecidedAt(dt time.Time) bool {
+	if d.DecisionTime != nil {
+		return !d.DecisionTime.After(dt)
+	}
+	return !d.TxTimeStart.After(dt)
+}
+
+// ValidAt returns whether the version is valid at valid time vt. See ClampValidTime.
+func (d *VersionedKV) ValidAt(vt time.Time) bool {
+	return inRange(ClampValidTime(vt), d.ValidTimeStart, d.ValidTimeEnd)
+}
+
+// KnownAt returns whether the version is current as of transaction time tt.
+func (d *VersionedKV) KnownAt(tt time.Time) bool {
+	return inRange(tt, d.TxTimeStart, d.TxTimeEnd)
+}
+
+// VisibleAt returns whether the version is read as of valid time vt and transaction time tt.
+func (d *VersionedKV) VisibleAt(vt, tt time.Time) bool {
+	return d.ValidAt(vt) && d.KnownAt(tt)
+}
+
+// Overlaps returns whether the versions overlap both transaction time and valid time. Keys are not compared. Empty
+// ranges, such as the transaction time range of a version replaced at the transaction time it was written, overlap
+// nothing.
+func (d *VersionedKV) Overlaps(other *VersionedKV) bool {
+	return overlaps(d.TxTimeStart, d.TxTimeEnd, other.TxTimeStart, other.TxTimeEnd) &&
+		overlaps(d.ValidTimeStart, d.ValidTimeEnd, other.ValidTimeStart, other.ValidTimeEnd)
+}
+
+// Equal returns whether the versions have the same key, value, and times, including decision times. Times are compared with time.Time.Equal, so
+// locations and monotonic clock readings are ignored, and end times are compared by value rather than by pointer.
+// Values are compared with reflect.DeepEqual.
+func (d *VersionedKV) Equal(other *VersionedKV) bool {
+	if d == nil || other == nil {
+		return d == other
+	}
+	return d.Key == other.Key &&
+		reflect.DeepEqual(d.Value, other.Value) &&
+		d.TxTimeStart.Equal(other.TxTimeStart) &&
+		equalEnd(d.TxTimeEnd, other.TxTimeEnd) &&
+		d.ValidTimeStart.Equal(other.ValidTimeStart) &&
+		equalEnd(d.ValidTimeEnd, other.ValidTimeEnd) &&
+		equalEnd(d.DecisionTime, other.DecisionTime)
+}
+
+// Normalize returns a copy of the version with all times in UTC, stripped of monotonic clock readings, and rounded to
+// precision if it is positive. End times are new pointers. Normalized versions can be compared with reflect.DeepEqual
+// or serialized deterministically.
+func (d *VersionedKV) Normalize(precision time.Duration) *VersionedKV {
+	normalize := func(t time.Time) time.Time {
+		if precision > 0 {
+			return t.Round(precision).UTC()
+		}
+		return t.Round(0).UTC()
+	}
+	normalizeEnd := func(t *time.Time) *time.Time {
+		if t == nil {
+			return nil
+		}
+		n := normalize(*t)
+		return &n
+	}
+	c := *d
+	c.TxTimeStart = normalize(c.TxTimeStart)
+	c.TxTimeEnd = normalizeEnd(c.TxTimeEnd)
+	c.ValidTimeStart = normalize(c.ValidTimeStart)
+	c.ValidTimeEnd = normalizeEnd(c.ValidTimeEnd)
+	c.DecisionTime = normalizeEnd(c.DecisionTime)
+	return &c
+}
+
+func equalEnd(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// inRange returns whether t is in [start, end). A nil end is unbounded.
+func inRange(t, start time.Time, end *time.Time) bool {
+	return !t.Before(start) && (end == nil || t.Before(*end))
+}
+
+// overlaps returns whether two [start, end) intervals with optional unbounded ends intersect. Empty intervals never
+// overlap.
+func overlaps(aStart time.Time, aEnd *time.Time, bStart time.Time, bEnd *time.Time) bool {
+	if (aEnd != nil && !aStart.Before(*aEnd)) || (bEnd != nil && !bStart.Before(*bEnd)) {
+		return false
+	}
+	return (aEnd == nil || bStart.Before(*aEnd)) && (bEnd == nil || aStart.Before(*bEnd))
+}
@@ -0,0 +1,109 @@
+package bitempura_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/dbtest/tt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionedKVPredicates(t *testing.T) {
+	kv := &VersionedKV{Key: "A", TxTimeStart: tt.Day(2), TxTimeEnd: tt.DayPtr(4), ValidTimeStart: tt.Day(1),
+		ValidTimeEnd: tt.DayPtr(3)}
+
+	assert.False(t, kv.ValidAt(tt.Day(0)))
+	assert.True(t, kv.ValidAt(tt.Day(1)), "start is inclusive")
+	assert.True(t, kv.ValidAt(tt.Day(2)))
+	assert.False(t, kv.ValidAt(tt.Day(3)), "end is exclusive")
+
+	assert.False(t, kv.KnownAt(tt.Day(1)))
+	assert.True(t, kv.KnownAt(tt.Day(2)), "start is inclusive")
+	assert.False(t, kv.KnownAt(tt.Day(4)), "end is exclusive")
+
+	assert.True(t, kv.VisibleAt(tt.Day(1), tt.Day(2)))
+	assert.False(t, kv.VisibleAt(tt.Day(1), tt.Day(1)))
+	assert.False(t, kv.VisibleAt(tt.Day(3), tt.Day(2)))
+
+	current := &VersionedKV{Key: "A", TxTimeStart: tt.Day(2), ValidTimeStart: tt.Day(1)}
+	assert.True(t, current.VisibleAt(tt.Day(100), tt.Day(100)), "nil ends are unbounded")
+
+	empty := &VersionedKV{Key: "A", TxTimeStart: tt.Day(2), TxTimeEnd: tt.DayPtr(2), ValidTimeStart: tt.Day(1)}
+	assert.False(t, empty.KnownAt(tt.Day(2)), "empty transaction time range")
+
+	forever := &VersionedKV{Key: "A", TxTimeStart: tt.Day(2), ValidTimeStart: BeginningOfTime, ValidTimeEnd: tt.DayPtr(1)}
+	assert.True(t, forever.ValidSinceBeginning())
+	assert.False(t, kv.ValidSinceBeginning())
+	assert.True(t, forever.ValidAt(time.Date(1, 1, 2, 0, 0, 0, 0, time.UTC)), "valid times before the beginning are clamped")
+	assert.True(t, forever.ValidAt(BeginningOfTime))
+	assert.False(t, forever.ValidAt(tt.Day(1)))
+
+	testCases := []struct {
+		desc     string
+		other    *VersionedKV
+		expected bool
+	}{
+		{
+			desc:     "overlaps both",
+			other:    &VersionedKV{TxTimeStart: tt.Day(3), ValidTimeStart: tt.Day(2)},
+			expected: true,
+		},
+		{
+			desc:     "adjacent transaction time",
+			other:    &VersionedKV{TxTimeStart: tt.Day(4), ValidTimeStart: tt.Day(1)},
+			expected: false,
+		},
+		{
+			desc:     "adjacent valid time",
+			other:    &VersionedKV{TxTimeStart: tt.Day(2), ValidTimeStart: tt.Day(3)},
+			expected: false,
+		},
+		{
+			desc:     "empty transaction time range",
+			other:    empty,
+			expected: false,
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, kv.Overlaps(tC.other))
+			assert.Equal(t, tC.expected, tC.other.Overlaps(kv))
+		})
+	}
+}
+
+func TestVersionedKVEqual(t *testing.T) {
+	est := time.FixedZone("EST", -5*60*60)
+	kv := &VersionedKV{Key: "A", Value: map[string]interface{}{"balance": 100.0}, TxTimeStart: tt.Day(2),
+		TxTimeEnd: tt.DayPtr(4), ValidTimeStart: tt.Day(1)}
+	same := &VersionedKV{Key: "A", Value: map[string]interface{}{"balance": 100.0}, TxTimeStart: tt.Day(2).In(est),
+		TxTimeEnd: tt.Ptr(tt.Day(4).In(est)), ValidTimeStart: tt.Day(1)}
+	assert.True(t, kv.Equal(same))
+	assert.NotEqual(t, kv, same)
+	assert.Equal(t, kv, same.Normalize(0))
+
+	different := *same
+	different.TxTimeEnd = nil
+	assert.False(t, kv.Equal(&different))
+	different = *same
+	different.Value = map[string]interface{}{"balance": 90.0}
+	assert.False(t, kv.Equal(&different))
+
+	assert.True(t, (*VersionedKV)(nil).Equal(nil))
+	assert.False(t, kv.Equal(nil))
+}
+
+func TestVersionedKVNormalize(t *testing.T) {
+	now := time.Now()
+	kv := &VersionedKV{Key: "A", TxTimeStart: now, ValidTimeStart: now, ValidTimeEnd: &now}
+	n := kv.Normalize(0)
+	assert.Equal(t, time.UTC, n.TxTimeStart.Location())
+	assert.Equal(t, now.Round(0).UTC(), n.TxTimeStart)
+	assert.True(t, n.Equal(kv))
+	assert.NotSame(t, kv.ValidTimeEnd, n.ValidTimeEnd)
+
+	rounded := kv.Normalize(time.Second)
+	assert.Equal(t, now.Round(time.Second).UTC(), rounded.TxTimeStart)
+	assert.Equal(t, rounded.TxTimeStart, *rounded.ValidTimeEnd)
+}
@@ -0,0 +1,66 @@
+package bitempura
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+)
+
+// Encryptor encrypts encoded values at rest. key is the DB key of the value, so implementations can use per-key or
+// per-namespace encryption keys. Encryptors are applied by backups (see backup.WithEncryptor) and by the file snapshots
+// of cmd/bitempura, which are saved in the backup format. sql.TableDB does not encrypt values, since they are stored as
+// the SQL-queryable columns of an application table; use the database's own encryption at rest for them.
+type Encryptor interface {
+	Encrypt(key string, plaintext []byte) ([]byte, error)
+	Decrypt(key string, ciphertext []byte) ([]byte, error)
+}
+
+// NewAESGCMEncryptor returns an Encryptor using AES-GCM with the encryption key returned by keyFn for each DB key.
+// Encryption keys must be 16, 24, or 32 bytes. For per-namespace keys, keyFn can select a key by the DB key's prefix.
+// The DB key is authenticated as additional data, so ciphertexts cannot be moved between keys.
+func NewAESGCMEncryptor(keyFn func(key string) ([]byte, error)) Encryptor {
+	return &aesGCMEncryptor{keyFn: keyFn}
+}
+
+type aesGCMEncryptor struct {
+	keyFn func(key string) ([]byte, error)
+}
+
+func (e *aesGCMEncryptor) aead(key string) (cipher.AEAD, error) {
+	k, err := e.keyFn(key)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt returns the nonce followed by the sealed plaintext.
+func (e *aesGCMEncryptor) Encrypt(key string, plaintext []byte) ([]byte, error) {
+	aead, err := e.aead(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, []byte(key)), nil
+}
+
+func (e *aesGCMEncryptor) Decrypt(key string, ciphertext []byte) ([]byte, error) {
+	aead, err := e.aead(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, sealed, []byte(key))
+}
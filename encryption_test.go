@@ -0,0 +1,50 @@
+package bitempura_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	. "github.com/elh/bitempura"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAESGCMEncryptor(t *testing.T) {
+	// per-namespace keys
+	keys := map[string][]byte{
+		"users/":  bytes.Repeat([]byte{1}, 32),
+		"orders/": bytes.Repeat([]byte{2}, 16),
+	}
+	e := NewAESGCMEncryptor(func(key string) ([]byte, error) {
+		for prefix, k := range keys {
+			if strings.HasPrefix(key, prefix) {
+				return k, nil
+			}
+		}
+		return nil, errors.New("no key")
+	})
+
+	plaintext := []byte(`{"name":"Alice"}`)
+	ciphertext, err := e.Encrypt("users/1", plaintext)
+	require.Nil(t, err)
+	assert.NotContains(t, string(ciphertext), "Alice")
+	again, err := e.Encrypt("users/1", plaintext)
+	require.Nil(t, err)
+	assert.NotEqual(t, ciphertext, again)
+
+	decrypted, err := e.Decrypt("users/1", ciphertext)
+	require.Nil(t, err)
+	assert.Equal(t, plaintext, decrypted)
+
+	// keys are authenticated
+	_, err = e.Decrypt("users/2", ciphertext)
+	assert.NotNil(t, err)
+	_, err = e.Decrypt("orders/1", ciphertext)
+	assert.NotNil(t, err)
+	_, err = e.Encrypt("other", plaintext)
+	assert.NotNil(t, err)
+	_, err = e.Decrypt("users/1", ciphertext[:4])
+	assert.NotNil(t, err)
+}
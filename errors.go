@@ -1,6 +1,69 @@
 package bitempura
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 // ErrNotFound error is returned when key not found in DB (as of relevant valid and transaction times).
 var ErrNotFound = errors.New("not found")
+
+// ErrNilValue error is returned when a Set has a nil value and the DB's nil value policy is NilValueReject.
+var ErrNilValue = errors.New("value cannot be nil")
+
+// ErrInvalidWrite error is returned when a write is rejected because its key, value, or write options are invalid, such
+// as a valid time in the future. Backends wrap it with the reason.
+var ErrInvalidWrite = errors.New("invalid write")
+
+// ErrTxTimeRegressed error is returned when a write's transaction time precedes the latest transaction time issued by
+// the DB and the DB's transaction time policy is TxTimeReject.
+var ErrTxTimeRegressed = errors.New("transaction time precedes latest transaction time")
+
+// NotFoundError is an ErrNotFound with the key and the resolved valid and transaction times of the failed read. Times
+// are zero for reads without them, such as History. It matches ErrNotFound with errors.Is.
+type NotFoundError struct {
+	Key       string
+	ValidTime time.Time
+	TxTime    time.Time
+}
+
+func (e *NotFoundError) Error() string {
+	if e.ValidTime.IsZero() && e.TxTime.IsZero() {
+		return fmt.Sprintf("%v: key=%v", ErrNotFound, e.Key)
+	}
+	return fmt.Sprintf("%v: key=%v, valid_time=%v, tx_time=%v", ErrNotFound, e.Key,
+		e.ValidTime.Format(time.RFC3339Nano), e.TxTime.Format(time.RFC3339Nano))
+}
+
+// Unwrap returns ErrNotFound.
+func (e *NotFoundError) Unwrap() error {
+	return ErrNotFound
+}
+
+// ErrOverhang error is returned when a write would re-assert old values after its end valid time and the overhang
+// policy is OverhangReject.
+var ErrOverhang = errors.New("old values would resume after the valid time range")
+
+// ErrHistoryLimit error is returned when a write would exceed the DB's limit on versions per key and the history limit
+// policy is HistoryLimitReject.
+var ErrHistoryLimit = errors.New("write exceeds versions per key limit")
+
+// ErrOverlap error is returned when a Set overlaps current versions of the key and the overlap policy is OverlapReject.
+var ErrOverlap = errors.New("valid time overlaps current versions")
+
+// BatchWriteError is the error of a failed WriteBatch. It wraps the error of the write that failed.
+type BatchWriteError struct {
+	Index int // index of the write in the batch
+	Key   string
+	Err   error
+}
+
+func (e *BatchWriteError) Error() string {
+	return fmt.Sprintf("batch write %v: key=%v: %v", e.Index, e.Key, e.Err)
+}
+
+// Unwrap returns the error of the write.
+func (e *BatchWriteError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,170 @@
+// Package ledger is an example application built on a bitemporal DB: a double-entry balance tracker.
+//
+// Every posting moves an amount from one account to another, so balances always sum to zero. Postings are stored under
+// "posting/<id>" keys, valid from their effective time onward. The DB then answers the questions a ledger is asked
+// without any bookkeeping of its own: backdated postings and retroactive charges are writes with a past valid time,
+// corrections and voids replace a posting as of its effective time, and statements can be produced as of any effective
+// time as best known at any transaction time.
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	bt "github.com/elh/bitempura"
+)
+
+const postingPrefix = "posting/"
+
+// Posting moves Amount from account From to account To.
+type Posting struct {
+	From   string
+	To     string
+	Amount int64 // in minor units, e.g. cents
+	Memo   string
+}
+
+// Validate a posting
+func (p Posting) Validate() error {
+	if p.From == "" || p.To == "" {
+		return errors.New("from and to accounts are required")
+	}
+	if p.From == p.To {
+		return errors.New("from and to accounts must differ")
+	}
+	if p.Amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+	return nil
+}
+
+// Ledger is a double-entry balance tracker stored in a DB.
+type Ledger struct {
+	db bt.DB
+}
+
+// New constructs a ledger stored in db.
+func New(db bt.DB) *Ledger {
+	return &Ledger{db: db}
+}
+
+// Post records a new posting that takes effect at effective, which may be in the past.
+func (l *Ledger) Post(id string, p Posting, effective time.Time) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	// IDs of voided postings are not reused so that audits stay unambiguous
+	if _, err := l.db.History(postingPrefix + id); err == nil {
+		return fmt.Errorf("posting %v already exists", id)
+	} else if !errors.Is(err, bt.ErrNotFound) {
+		return err
+	}
+	return l.db.Set(postingPrefix+id, p, bt.WithValidTime(effective))
+}
+
+// Correct replaces a posting as of its effective time. Statements as of earlier transaction times are unchanged.
+func (l *Ledger) Correct(id string, p Posting) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	kv, err := l.db.Get(postingPrefix + id)
+	if err != nil {
+		return err
+	}
+	return l.db.Set(postingPrefix+id, p, bt.WithValidTime(kv.ValidTimeStart))
+}
+
+// Void removes a posting as of its effective time. Statements as of earlier transaction times are unchanged.
+func (l *Ledger) Void(id string) error {
+	kv, err := l.db.Get(postingPrefix + id)
+	if err != nil {
+		return err
+	}
+	return l.db.Delete(postingPrefix+id, bt.WithValidTime(kv.ValidTimeStart))
+}
+
+// Line is a posting as it affects one account.
+type Line struct {
+	ID        string
+	Effective time.Time
+	Amount    int64 // negative if the posting is from the account
+	Memo      string
+}
+
+// Statement is the balance of an account and the postings it is made of.
+type Statement struct {
+	Account string
+	Balance int64
+	Lines   []Line // by ascending effective time, then ID
+}
+
+// Statement returns the statement of account (as of optional valid and transaction times).
+func (l *Ledger) Statement(account string, opts ...bt.ReadOpt) (*Statement, error) {
+	s := &Statement{Account: account}
+	err := l.postings(func(id string, p Posting, effective time.Time) {
+		var amount int64
+		switch account {
+		case p.From:
+			amount = -p.Amount
+		case p.To:
+			amount = p.Amount
+		default:
+			return
+		}
+		s.Balance += amount
+		s.Lines = append(s.Lines, Line{ID: id, Effective: effective, Amount: amount, Memo: p.Memo})
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(s.Lines, func(i, j int) bool {
+		if !s.Lines[i].Effective.Equal(s.Lines[j].Effective) {
+			return s.Lines[i].Effective.Before(s.Lines[j].Effective)
+		}
+		return s.Lines[i].ID < s.Lines[j].ID
+	})
+	return s, nil
+}
+
+// Balances returns the balance of every account with postings (as of optional valid and transaction times). Balances
+// sum to zero.
+func (l *Ledger) Balances(opts ...bt.ReadOpt) (map[string]int64, error) {
+	balances := map[string]int64{}
+	err := l.postings(func(_ string, p Posting, _ time.Time) {
+		balances[p.From] -= p.Amount
+		balances[p.To] += p.Amount
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return balances, nil
+}
+
+// Audit returns every recorded version of a posting, including corrected and voided ones, ordered as bt.DB History.
+func (l *Ledger) Audit(id string) ([]*bt.VersionedKV, error) {
+	return l.db.History(postingPrefix + id)
+}
+
+// postings calls fn with each posting (as of optional valid and transaction times).
+func (l *Ledger) postings(fn func(id string, p Posting, effective time.Time), opts ...bt.ReadOpt) error {
+	var err error
+	listErr := bt.ListFunc(l.db, func(kv *bt.VersionedKV) bool {
+		if !strings.HasPrefix(kv.Key, postingPrefix) {
+			return true
+		}
+		p, ok := kv.Value.(Posting)
+		if !ok {
+			err = fmt.Errorf("key=%v: value is a %T, not a Posting", kv.Key, kv.Value)
+			return false
+		}
+		fn(strings.TrimPrefix(kv.Key, postingPrefix), p, kv.ValidTimeStart)
+		return true
+	}, opts...)
+	if listErr != nil {
+		return listErr
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+package ledger_test
+
+import (
+	"testing"
+	"time"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/elh/bitempura/dbtest/tt"
+	"github.com/elh/bitempura/examples/ledger"
+	"github.com/elh/bitempura/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLedger(t *testing.T) {
+	c := clock.New(tt.Day(1))
+	db, err := memory.NewDB(memory.WithClock(c))
+	require.Nil(t, err)
+	l := ledger.New(db)
+
+	// day 1: Alice deposits 100. day 2: Alice pays Bob 30
+	require.Nil(t, l.Post("1", ledger.Posting{From: "cash", To: "alice", Amount: 100, Memo: "deposit"}, tt.Day(1)))
+	require.Nil(t, c.SetNow(tt.Day(2)))
+	require.Nil(t, l.Post("2", ledger.Posting{From: "alice", To: "bob", Amount: 30, Memo: "rent"}, tt.Day(2)))
+	require.NotNil(t, l.Post("2", ledger.Posting{From: "alice", To: "bob", Amount: 30}, tt.Day(2)))
+	require.NotNil(t, l.Post("3", ledger.Posting{From: "alice", To: "alice", Amount: 30}, tt.Day(2)))
+
+	// day 4: a fee effective day 3 is charged retroactively. day 5: the rent is corrected. day 6: the fee is voided
+	require.Nil(t, c.SetNow(tt.Day(4)))
+	require.Nil(t, l.Post("3", ledger.Posting{From: "alice", To: "bank", Amount: 5, Memo: "fee"}, tt.Day(3)))
+	require.Nil(t, c.SetNow(tt.Day(5)))
+	require.Nil(t, l.Correct("2", ledger.Posting{From: "alice", To: "bob", Amount: 25, Memo: "rent"}))
+	require.Nil(t, c.SetNow(tt.Day(6)))
+	require.Nil(t, l.Void("3"))
+
+	// alice's balance on day 3 as known at each transaction time
+	expected := map[int]int64{3: 70, 4: 65, 5: 70, 6: 75}
+	for day, balance := range expected {
+		s, err := l.Statement("alice", bt.AsOfValidTime(tt.Day(3)), bt.AsOfTransactionTime(tt.Day(day)))
+		require.Nil(t, err)
+		assert.Equal(t, balance, s.Balance, "known at day %v", day)
+
+		balances, err := l.Balances(bt.AsOfValidTime(tt.Day(3)), bt.AsOfTransactionTime(tt.Day(day)))
+		require.Nil(t, err)
+		var sum int64
+		for _, b := range balances {
+			sum += b
+		}
+		assert.Zero(t, sum, "known at day %v", day)
+	}
+
+	s, err := l.Statement("alice", bt.AsOfTransactionTime(tt.Day(4)))
+	require.Nil(t, err)
+	assert.Equal(t, &ledger.Statement{
+		Account: "alice",
+		Balance: 65,
+		Lines: []ledger.Line{
+			{ID: "1", Effective: tt.Day(1), Amount: 100, Memo: "deposit"},
+			{ID: "2", Effective: tt.Day(2), Amount: -30, Memo: "rent"},
+			{ID: "3", Effective: tt.Day(3), Amount: -5, Memo: "fee"},
+		},
+	}, s)
+	// before the first posting
+	s, err = l.Statement("alice", bt.AsOfValidTime(tt.Day(1).Add(-time.Hour)))
+	require.Nil(t, err)
+	assert.Zero(t, s.Balance)
+	assert.Empty(t, s.Lines)
+
+	vs, err := l.Audit("2")
+	require.Nil(t, err)
+	assert.Len(t, vs, 2)
+	violations, err := bt.Check(db)
+	require.Nil(t, err)
+	assert.Empty(t, violations)
+}
@@ -0,0 +1,252 @@
+package federate
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	bt "github.com/elh/bitempura"
+)
+
+var _ bt.DB = (*DB)(nil)
+var _ bt.KeyLister = (*DB)(nil)
+var _ bt.HistoriesReader = (*DB)(nil)
+var _ bt.MultiGetter = (*DB)(nil)
+
+// ErrNoRoute error is returned when a key matches no route and there is no default DB.
+var ErrNoRoute = errors.New("no route for key")
+
+// Route routes keys with a prefix to a DB.
+type Route struct {
+	Prefix string
+	DB     bt.DB
+}
+
+// New constructs a DB that routes each key to the DB of the route with the longest matching prefix. Keys that match no
+// route are routed to the DB set by WithDefault or fail with ErrNoRoute. DBs must be comparable, e.g. pointers, and the
+// same DB may be used by many routes.
+func New(routes []Route, opts ...Opt) (*DB, error) {
+	options := &options{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	db := &DB{routes: append([]Route(nil), routes...), fallback: options.fallback}
+	seen := map[string]bool{}
+	for _, r := range db.routes {
+		if r.DB == nil {
+			return nil, fmt.Errorf("route %q has no DB", r.Prefix)
+		}
+		if seen[r.Prefix] {
+			return nil, fmt.Errorf("duplicate route %q", r.Prefix)
+		}
+		seen[r.Prefix] = true
+		db.addBackend(r.DB)
+	}
+	if db.fallback != nil {
+		db.addBackend(db.fallback)
+	}
+	// longest prefixes first so the first match is the most specific
+	sort.SliceStable(db.routes, func(i, j int) bool { return len(db.routes[i].Prefix) > len(db.routes[j].Prefix) })
+	return db, nil
+}
+
+// DB is a DB that routes keys to underlying DBs.
+type DB struct {
+	routes   []Route // by descending prefix length
+	fallback bt.DB
+	backends []bt.DB // distinct DBs of routes and fallback in the order they were configured
+}
+
+// options is a struct for processing Opt's to be used by DB
+type options struct {
+	fallback bt.DB
+}
+
+// Opt is an option for constructing federated DBs
+type Opt func(*options)
+
+// WithDefault routes keys that match no route to db.
+func WithDefault(db bt.DB) Opt {
+	return func(os *options) {
+		os.fallback = db
+	}
+}
+
+func (db *DB) addBackend(b bt.DB) {
+	for _, existing := range db.backends {
+		if existing == b {
+			return
+		}
+	}
+	db.backends = append(db.backends, b)
+}
+
+// Route returns the DB that key is routed to.
+func (db *DB) Route(key string) (bt.DB, error) {
+	for _, r := range db.routes {
+		if strings.HasPrefix(key, r.Prefix) {
+			return r.DB, nil
+		}
+	}
+	if db.fallback != nil {
+		return db.fallback, nil
+	}
+	return nil, fmt.Errorf("%w: key=%v", ErrNoRoute, key)
+}
+
+// routedTo returns whether key is routed to b, so keys stored in a DB that they are not routed to are ignored.
+func (db *DB) routedTo(key string, b bt.DB) bool {
+	routed, err := db.Route(key)
+	return err == nil && routed == b
+}
+
+// Get data by key (as of optional valid and transaction times).
+func (db *DB) Get(key string, opts ...bt.ReadOpt) (*bt.VersionedKV, error) {
+	b, err := db.Route(key)
+	if err != nil {
+		return nil, err
+	}
+	return b.Get(key, opts...)
+}
+
+// List all data (as of optional valid and transaction times) of every underlying DB.
+func (db *DB) List(opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	var out []*bt.VersionedKV
+	for _, b := range db.backends {
+		kvs, err := b.List(opts...)
+		if err != nil {
+			return nil, err
+		}
+		for _, kv := range kvs {
+			if db.routedTo(kv.Key, b) {
+				out = append(out, kv)
+			}
+		}
+	}
+	return out, nil
+}
+
+// Set stores value (with optional start and end valid time).
+func (db *DB) Set(key string, value bt.Value, opts ...bt.WriteOpt) error {
+	b, err := db.Route(key)
+	if err != nil {
+		return err
+	}
+	return b.Set(key, value, opts...)
+}
+
+// Delete removes value (with optional start and end valid time).
+func (db *DB) Delete(key string, opts ...bt.WriteOpt) error {
+	b, err := db.Route(key)
+	if err != nil {
+		return err
+	}
+	return b.Delete(key, opts...)
+}
+
+// History returns versions by descending end transaction time, descending end valid time
+func (db *DB) History(key string, opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	b, err := db.Route(key)
+	if err != nil {
+		return nil, err
+	}
+	return b.History(key, opts...)
+}
+
+// Keys returns all keys of every underlying DB in ascending order. Every underlying DB must be a bt.KeyLister.
+func (db *DB) Keys() ([]string, error) {
+	var out []string
+	for _, b := range db.backends {
+		kl, ok := b.(bt.KeyLister)
+		if !ok {
+			return nil, fmt.Errorf("%T is not a KeyLister", b)
+		}
+		keys, err := kl.Keys()
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if db.routedTo(key, b) {
+				out = append(out, key)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// Histories returns the versioned key-values of each key, ordered as History, with a call per underlying DB. Keys with
+// no versions are omitted.
+func (db *DB) Histories(keys []string) (map[string][]*bt.VersionedKV, error) {
+	groups, err := db.group(keys)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string][]*bt.VersionedKV, len(keys))
+	for _, g := range groups {
+		histories, err := bt.Histories(g.db, g.keys)
+		if err != nil {
+			return nil, err
+		}
+		for key, vs := range histories {
+			out[key] = vs
+		}
+	}
+	return out, nil
+}
+
+// GetMulti returns the data of each key (as of optional valid and transaction times) in the order of keys, with a call
+// per underlying DB. Results are nil for keys that are not found.
+func (db *DB) GetMulti(keys []string, opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	groups, err := db.group(keys)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*bt.VersionedKV, len(keys))
+	for _, g := range groups {
+		kvs, err := bt.GetMulti(g.db, g.keys, opts...)
+		if err != nil {
+			return nil, err
+		}
+		for i, kv := range kvs {
+			out[g.indexes[i]] = kv
+		}
+	}
+	return out, nil
+}
+
+// keyGroup is the keys routed to a DB and their indexes in the grouped keys.
+type keyGroup struct {
+	db      bt.DB
+	keys    []string
+	indexes []int
+}
+
+// group groups keys by the DB they are routed to, in the order of db.backends.
+func (db *DB) group(keys []string) ([]*keyGroup, error) {
+	groups := make([]*keyGroup, len(db.backends))
+	for i, b := range db.backends {
+		groups[i] = &keyGroup{db: b}
+	}
+	for i, key := range keys {
+		b, err := db.Route(key)
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range groups {
+			if g.db == b {
+				g.keys = append(g.keys, key)
+				g.indexes = append(g.indexes, i)
+				break
+			}
+		}
+	}
+	var out []*keyGroup
+	for _, g := range groups {
+		if len(g.keys) > 0 {
+			out = append(out, g)
+		}
+	}
+	return out, nil
+}
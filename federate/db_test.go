@@ -0,0 +1,89 @@
+package federate_test
+
+import (
+	"testing"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/dbtest"
+	"github.com/elh/bitempura/federate"
+	"github.com/elh/bitempura/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDB(t *testing.T) {
+	config, err := memory.NewDB()
+	require.Nil(t, err)
+	ledger, err := memory.NewDB()
+	require.Nil(t, err)
+	audit, err := memory.NewDB()
+	require.Nil(t, err)
+	db, err := federate.New([]federate.Route{
+		{Prefix: "config/", DB: config},
+		{Prefix: "ledger/", DB: ledger},
+		{Prefix: "ledger/audit/", DB: audit},
+	})
+	require.Nil(t, err)
+
+	require.Nil(t, db.Set("config/a", "A"))
+	require.Nil(t, db.Set("ledger/b", "B"))
+	require.Nil(t, db.Set("ledger/audit/c", "C"))
+	require.ErrorIs(t, db.Set("other", "X"), federate.ErrNoRoute)
+	// keys stored in a DB they are not routed to are ignored
+	require.Nil(t, config.Set("ledger/z", "Z"))
+
+	_, err = config.Get("config/a")
+	require.Nil(t, err)
+	_, err = audit.Get("ledger/audit/c") // longest prefix wins
+	require.Nil(t, err)
+	kv, err := db.Get("ledger/b")
+	require.Nil(t, err)
+	assert.Equal(t, "B", kv.Value)
+	_, err = db.Get("ledger/z")
+	require.ErrorIs(t, err, bt.ErrNotFound)
+
+	kvs, err := db.List()
+	require.Nil(t, err)
+	var values []bt.Value
+	for _, kv := range kvs {
+		values = append(values, kv.Value)
+	}
+	assert.ElementsMatch(t, []bt.Value{"A", "B", "C"}, values)
+	keys, err := db.Keys()
+	require.Nil(t, err)
+	assert.Equal(t, []string{"config/a", "ledger/audit/c", "ledger/b"}, keys)
+
+	histories, err := db.Histories([]string{"ledger/b", "config/a", "config/missing"})
+	require.Nil(t, err)
+	assert.Len(t, histories, 2)
+	kvs, err = db.GetMulti([]string{"ledger/b", "config/missing", "config/a"})
+	require.Nil(t, err)
+	require.Len(t, kvs, 3)
+	assert.Equal(t, "B", kvs[0].Value)
+	assert.Nil(t, kvs[1])
+	assert.Equal(t, "A", kvs[2].Value)
+	_, err = db.GetMulti([]string{"other"})
+	require.ErrorIs(t, err, federate.ErrNoRoute)
+
+	_, err = federate.New([]federate.Route{{Prefix: "a/", DB: config}, {Prefix: "a/", DB: ledger}})
+	assert.NotNil(t, err)
+}
+
+func TestSuites(t *testing.T) {
+	dbtest.RunSuites(t, dbtest.Backend{
+		Capabilities: []dbtest.Capability{dbtest.CapabilityWrite, dbtest.CapabilityClock, dbtest.CapabilityKeys,
+			dbtest.CapabilityConcurrency},
+		NewDB: func(_ []*bt.VersionedKV, clock bt.Clock) (bt.DB, func(), error) {
+			a, err := memory.NewDB(memory.WithClock(clock))
+			if err != nil {
+				return nil, nil, err
+			}
+			rest, err := memory.NewDB(memory.WithClock(clock))
+			if err != nil {
+				return nil, nil, err
+			}
+			db, err := federate.New([]federate.Route{{Prefix: "A", DB: a}}, federate.WithDefault(rest))
+			return db, func() {}, err
+		},
+	})
+}
@@ -0,0 +1,4 @@
+// Package federate provides a DB that routes keys to underlying DBs by key prefix, e.g. "config/" to one backend and
+// "ledger/" to another, and presents them as a single bitempura.DB. Reads of many keys, such as List and Keys, are made
+// against every underlying DB and merged.
+package federate
@@ -0,0 +1,85 @@
+package bitempura
+
+import (
+	"sort"
+	"time"
+)
+
+// TimeWindow is the time range [Start, End).
+type TimeWindow struct {
+	Start time.Time
+	End   time.Time
+}
+
+// WithValidTimeWindow allows reader to read only History versions whose valid time range overlaps [start, end). It
+// replaces AsOfValidTime.
+func WithValidTimeWindow(start, end time.Time) ReadOpt {
+	return func(os *ReadOptions) {
+		os.ValidTimeWindow = &TimeWindow{Start: start, End: end}
+		os.ValidTime, os.ValidTimeAgo = nil, nil
+	}
+}
+
+// FilterHistory returns the versions of a key's History read with options, ordered as History. Options without times
+// do not filter, so History without ReadOpts returns every version. DBs resolve relative times with ResolveAgo first.
+//
+//   - With a transaction time, versions are as they were known at it: versions written after it are omitted and
+//     versions ended after it are current.
+//   - With a valid time, only versions valid at it are returned. With a valid time window, only versions overlapping
+//     it are returned.
+//   - With a decision time, only versions decided at or before it are returned.
+//
+// vs is not modified.
+func FilterHistory(vs []*VersionedKV, options *ReadOptions) []*VersionedKV {
+	var out []*VersionedKV
+	for _, v := range vs {
+		if options.TxTime != nil {
+			if v.TxTimeStart.After(*options.TxTime) {
+				continue
+			}
+			if v.TxTimeEnd != nil && v.TxTimeEnd.After(*options.TxTime) {
+				c := *v
+				c.TxTimeEnd = nil
+				v = &c
+			}
+		}
+		if options.ValidTime != nil && !v.ValidAt(*options.ValidTime) {
+			continue
+		}
+		if w := options.ValidTimeWindow; w != nil &&
+			!overlaps(v.ValidTimeStart, v.ValidTimeEnd, ClampValidTime(w.Start), &w.End) {
+			continue
+		}
+		if options.DecisionTime != nil && !v.DecidedAt(*options.DecisionTime) {
+			continue
+		}
+		out = append(out, v)
+	}
+	if options.TxTime != nil {
+		// ended versions may have become current
+		sort.SliceStable(out, func(i, j int) bool {
+			if c := compareEnd(out[i].TxTimeEnd, out[j].TxTimeEnd); c != 0 {
+				return c > 0
+			}
+			return compareEnd(out[i].ValidTimeEnd, out[j].ValidTimeEnd) > 0
+		})
+	}
+	return out
+}
+
+// compareEnd compares end times, where nil is unbounded and after any time.
+func compareEnd(a, b *time.Time) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	case a.Before(*b):
+		return -1
+	case a.After(*b):
+		return 1
+	}
+	return 0
+}
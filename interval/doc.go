@@ -0,0 +1,7 @@
+// Package interval provides arithmetic on the half-open time intervals of bitemporal versions. It is the single
+// implementation of interval semantics used by the backends, so they cannot drift: an interval [Start, End) contains
+// its start but not its end, and an interval without an end is unbounded.
+//
+// Times are unix nanoseconds, as stored by package memory, so operations do not allocate times. Convert with Of and
+// Interval.Times.
+package interval
@@ -0,0 +1,170 @@
+package interval
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Interval is the half-open interval [Start, End) of unix nanosecond times. It is unbounded if HasEnd is false, in
+// which case End is ignored.
+type Interval struct {
+	Start  int64
+	End    int64
+	HasEnd bool
+}
+
+// From returns the unbounded interval [start, ∞).
+func From(start int64) Interval {
+	return Interval{Start: start}
+}
+
+// All is the interval containing every time.
+var All = From(math.MinInt64)
+
+// Of converts the interval [start, end). end is unbounded if nil. Times that cannot be represented as unix nanoseconds,
+// outside of the years 1678 to 2262, are clamped.
+func Of(start time.Time, end *time.Time) Interval {
+	i := Interval{Start: Nanos(start)}
+	if end != nil {
+		i.End, i.HasEnd = Nanos(*end), true
+	}
+	return i
+}
+
+// Times converts the interval to UTC times. end is nil if the interval is unbounded.
+func (i Interval) Times() (start time.Time, end *time.Time) {
+	start = time.Unix(0, i.Start).UTC()
+	if i.HasEnd {
+		e := time.Unix(0, i.End).UTC()
+		end = &e
+	}
+	return start, end
+}
+
+// times outside of (minTime, maxTime) cannot be stored. the bounds are exclusive so times clamped to them by Nanos never
+// equal a stored time.
+var (
+	minTime = time.Unix(0, math.MinInt64)
+	maxTime = time.Unix(0, math.MaxInt64)
+)
+
+// CheckTime returns an error if t cannot be stored as unix nanoseconds.
+func CheckTime(t time.Time) error {
+	if !t.After(minTime) || !t.Before(maxTime) {
+		return fmt.Errorf("time %v is out of range (%v, %v)", t, minTime.UTC(), maxTime.UTC())
+	}
+	return nil
+}
+
+// Nanos converts t to unix nanoseconds, clamping times that cannot be stored. It is used for read times, which may be
+// any time.
+func Nanos(t time.Time) int64 {
+	if !t.After(minTime) {
+		return math.MinInt64
+	}
+	if !t.Before(maxTime) {
+		return math.MaxInt64
+	}
+	return t.UnixNano()
+}
+
+// Empty returns whether the interval contains no times.
+func (i Interval) Empty() bool {
+	return i.HasEnd && i.End <= i.Start
+}
+
+// Contains returns whether t is in the interval.
+func (i Interval) Contains(t int64) bool {
+	return i.Start <= t && (!i.HasEnd || t < i.End)
+}
+
+// Overlaps returns whether the intervals have a time in common.
+func (i Interval) Overlaps(j Interval) bool {
+	return !i.Empty() && !j.Empty() && (!j.HasEnd || i.Start < j.End) && (!i.HasEnd || j.Start < i.End)
+}
+
+// Intersect returns the times in both intervals. ok is false if they do not overlap.
+func (i Interval) Intersect(j Interval) (out Interval, ok bool) {
+	if !i.Overlaps(j) {
+		return Interval{}, false
+	}
+	out = i
+	if j.Start > out.Start {
+		out.Start = j.Start
+	}
+	if j.HasEnd && (!out.HasEnd || j.End < out.End) {
+		out.End, out.HasEnd = j.End, true
+	}
+	return out, true
+}
+
+// Difference returns the times in i that are not in j, as up to two non-empty intervals in ascending order.
+func (i Interval) Difference(j Interval) []Interval {
+	return i.AppendDifference(nil, j)
+}
+
+// AppendDifference appends the times in i that are not in j to dst, as up to two non-empty intervals in ascending
+// order, and returns the extended slice.
+//
+// examples:
+//
+//	[5,50) - [10,20) -> [5,10), [20,50)
+//	[15,30) - [10,20) -> [20,30)
+//	[12,13) - [10,20) -> none
+func (i Interval) AppendDifference(dst []Interval, j Interval) []Interval {
+	if i.Empty() {
+		return dst
+	}
+	if !i.Overlaps(j) {
+		return append(dst, i)
+	}
+	if i.Start < j.Start {
+		dst = append(dst, Interval{Start: i.Start, End: j.Start, HasEnd: true})
+	}
+	if j.HasEnd && (!i.HasEnd || j.End < i.End) {
+		dst = append(dst, Interval{Start: j.End, End: i.End, HasEnd: i.HasEnd})
+	}
+	return dst
+}
+
+// Union returns the times in any of the intervals as non-empty, non-adjacent intervals in ascending order. Adjacent
+// intervals, where one ends at the other's start, are merged.
+func Union(is ...Interval) []Interval {
+	sorted := make([]Interval, 0, len(is))
+	for _, i := range is {
+		if !i.Empty() {
+			sorted = append(sorted, i)
+		}
+	}
+	sort.Slice(sorted, func(a, b int) bool { return sorted[a].Start < sorted[b].Start })
+
+	var out []Interval
+	for _, i := range sorted {
+		if n := len(out); n > 0 && (!out[n-1].HasEnd || i.Start <= out[n-1].End) {
+			last := &out[n-1]
+			if !i.HasEnd {
+				last.HasEnd = false
+			} else if last.HasEnd && i.End > last.End {
+				last.End = i.End
+			}
+			continue
+		}
+		out = append(out, i)
+	}
+	return out
+}
+
+// Covers returns whether every time in i is in one of the intervals.
+func Covers(is []Interval, i Interval) bool {
+	if i.Empty() {
+		return true
+	}
+	for _, u := range Union(is...) {
+		if u.Start <= i.Start && (!u.HasEnd || (i.HasEnd && i.End <= u.End)) {
+			return true
+		}
+	}
+	return false
+}
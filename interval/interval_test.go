@@ -0,0 +1,208 @@
+package interval_test
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/elh/bitempura/dbtest/tt"
+	. "github.com/elh/bitempura/interval"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gridMax bounds the grid of small intervals the property tests enumerate. Points in [-1, gridMax+1] are checked so
+// that times outside of every bounded interval are covered.
+const gridMax = 6
+
+// grid returns every interval with start in [0, gridMax] and end in [0, gridMax] or unbounded, including empty ones.
+func grid() []Interval {
+	var out []Interval
+	for start := int64(0); start <= gridMax; start++ {
+		out = append(out, From(start))
+		for end := int64(0); end <= gridMax; end++ {
+			out = append(out, Interval{Start: start, End: end, HasEnd: true})
+		}
+	}
+	return out
+}
+
+func points() []int64 {
+	var out []int64
+	for p := int64(-1); p <= gridMax+1; p++ {
+		out = append(out, p)
+	}
+	return out
+}
+
+func containedByAny(is []Interval, p int64) bool {
+	for _, i := range is {
+		if i.Contains(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// requireNormalized asserts that intervals are non-empty, sorted, and disjoint.
+func requireNormalized(t *testing.T, is []Interval, adjacentAllowed bool) {
+	for k, i := range is {
+		require.False(t, i.Empty(), "interval %v is empty", i)
+		if k == 0 {
+			continue
+		}
+		prev := is[k-1]
+		require.True(t, prev.HasEnd, "interval %v follows an unbounded interval", i)
+		if adjacentAllowed {
+			require.LessOrEqual(t, prev.End, i.Start)
+		} else {
+			require.Less(t, prev.End, i.Start)
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	i := Interval{Start: 1, End: 3, HasEnd: true}
+	assert.False(t, i.Contains(0))
+	assert.True(t, i.Contains(1))
+	assert.True(t, i.Contains(2))
+	assert.False(t, i.Contains(3))
+	assert.True(t, From(1).Contains(math.MaxInt64))
+	assert.True(t, All.Contains(math.MinInt64))
+	assert.False(t, Interval{Start: 1, End: 1, HasEnd: true}.Contains(1))
+}
+
+func TestOverlaps(t *testing.T) {
+	for _, i := range grid() {
+		for _, j := range grid() {
+			expected := false
+			for _, p := range points() {
+				expected = expected || (i.Contains(p) && j.Contains(p))
+			}
+			require.Equal(t, expected, i.Overlaps(j), "%v %v", i, j)
+			require.Equal(t, i.Overlaps(j), j.Overlaps(i), "%v %v", i, j)
+		}
+	}
+}
+
+func TestIntersect(t *testing.T) {
+	for _, i := range grid() {
+		for _, j := range grid() {
+			out, ok := i.Intersect(j)
+			require.Equal(t, i.Overlaps(j), ok, "%v %v", i, j)
+			if !ok {
+				continue
+			}
+			require.False(t, out.Empty())
+			for _, p := range points() {
+				require.Equal(t, i.Contains(p) && j.Contains(p), out.Contains(p), "%v ∩ %v at %v", i, j, p)
+			}
+			swapped, _ := j.Intersect(i)
+			require.Equal(t, out, swapped)
+		}
+	}
+}
+
+func TestDifference(t *testing.T) {
+	for _, i := range grid() {
+		for _, j := range grid() {
+			out := i.Difference(j)
+			require.LessOrEqual(t, len(out), 2)
+			requireNormalized(t, out, false)
+			for _, p := range points() {
+				require.Equal(t, i.Contains(p) && !j.Contains(p), containedByAny(out, p), "%v - %v at %v", i, j, p)
+			}
+			// unbounded results are the unbounded tail of i
+			for _, o := range out {
+				require.True(t, o.HasEnd || !i.HasEnd)
+			}
+		}
+	}
+
+	t.Run("append", func(t *testing.T) {
+		dst := []Interval{From(100)}
+		dst = Interval{Start: 5, End: 50, HasEnd: true}.AppendDifference(dst, Interval{Start: 10, End: 20, HasEnd: true})
+		assert.Equal(t, []Interval{
+			From(100),
+			{Start: 5, End: 10, HasEnd: true},
+			{Start: 20, End: 50, HasEnd: true},
+		}, dst)
+	})
+}
+
+func TestUnion(t *testing.T) {
+	is := grid()
+	for _, i := range is {
+		for _, j := range is {
+			for _, k := range []Interval{{Start: 2, End: 3, HasEnd: true}, From(5), {Start: 0, End: 0, HasEnd: true}} {
+				in := []Interval{i, j, k}
+				out := Union(in...)
+				requireNormalized(t, out, false)
+				for _, p := range points() {
+					require.Equal(t, containedByAny(in, p), containedByAny(out, p), "∪ %v at %v", in, p)
+				}
+			}
+		}
+	}
+	assert.Empty(t, Union())
+	assert.Equal(t, []Interval{{Start: 1, End: 4, HasEnd: true}}, Union(
+		Interval{Start: 3, End: 4, HasEnd: true},
+		Interval{Start: 1, End: 3, HasEnd: true},
+	))
+}
+
+func TestCovers(t *testing.T) {
+	for _, i := range grid() {
+		for _, j := range grid() {
+			for _, k := range grid() {
+				expected := true
+				for _, p := range points() {
+					if k.Contains(p) && !i.Contains(p) && !j.Contains(p) {
+						expected = false
+					}
+				}
+				// unbounded k needs an unbounded cover beyond the grid
+				if !k.Empty() && !k.HasEnd && i.HasEnd && j.HasEnd {
+					expected = false
+				}
+				require.Equal(t, expected, Covers([]Interval{i, j}, k), "%v %v cover %v", i, j, k)
+			}
+		}
+	}
+}
+
+func TestTimes(t *testing.T) {
+	end := tt.Day(2)
+	i := Of(tt.Day(1), &end)
+	assert.Equal(t, Interval{Start: tt.Day(1).UnixNano(), End: end.UnixNano(), HasEnd: true}, i)
+	start, gotEnd := i.Times()
+	assert.Equal(t, tt.Day(1), start)
+	assert.Equal(t, &end, gotEnd)
+
+	start, gotEnd = Of(tt.Day(1), nil).Times()
+	assert.Equal(t, tt.Day(1), start)
+	assert.Nil(t, gotEnd)
+}
+
+func TestCheckTime(t *testing.T) {
+	for _, tc := range []struct {
+		t     time.Time
+		valid bool
+	}{
+		{tt.Day(1), true},
+		{time.Time{}, false},
+		{time.Unix(0, math.MinInt64), false},
+		{time.Unix(0, math.MinInt64+1), true},
+		{time.Unix(0, math.MaxInt64), false},
+		{time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC), false},
+	} {
+		t.Run(fmt.Sprint(tc.t), func(t *testing.T) {
+			err := CheckTime(tc.t)
+			assert.Equal(t, tc.valid, err == nil, err)
+			if !tc.valid {
+				assert.Contains(t, []int64{math.MinInt64, math.MaxInt64}, Nanos(tc.t))
+			}
+		})
+	}
+}
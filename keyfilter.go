@@ -0,0 +1,63 @@
+package bitempura
+
+import (
+	"path"
+	"strings"
+)
+
+// KeyFilter scopes List to keys with a prefix and matching a glob pattern. Empty fields match every key.
+type KeyFilter struct {
+	Prefix string
+	// Glob is a pattern of path.Match, so * and ? do not match "/". For example, "Alice/*" matches "Alice/balance" but
+	// not "Alice/positions/AAPL".
+	Glob string
+}
+
+// WithKeyPrefix allows reader to List only keys that start with prefix, e.g. "Alice/" for keys like "Alice/balance".
+func WithKeyPrefix(prefix string) ReadOpt {
+	return func(os *ReadOptions) {
+		os.KeyFilter.Prefix = prefix
+	}
+}
+
+// WithKeyGlob allows reader to List only keys matching a path.Match pattern, e.g. "*/balance". Lists with malformed
+// patterns fail with path.ErrBadPattern.
+func WithKeyGlob(pattern string) ReadOpt {
+	return func(os *ReadOptions) {
+		os.KeyFilter.Glob = pattern
+	}
+}
+
+// Validate returns path.ErrBadPattern if the glob pattern is malformed.
+func (f KeyFilter) Validate() error {
+	if f.Glob == "" {
+		return nil
+	}
+	_, err := path.Match(f.Glob, "")
+	return err
+}
+
+// Match returns whether key passes the filter. Keys never match malformed patterns.
+func (f KeyFilter) Match(key string) bool {
+	if !strings.HasPrefix(key, f.Prefix) {
+		return false
+	}
+	if f.Glob == "" {
+		return true
+	}
+	ok, err := path.Match(f.Glob, key)
+	return ok && err == nil
+}
+
+// LiteralPrefix returns a prefix of every key that passes the filter, so DBs can narrow reads with a prefix scan before
+// calling Match. It is the longer of Prefix and the glob pattern up to its first special character.
+func (f KeyFilter) LiteralPrefix() string {
+	glob := f.Glob
+	if i := strings.IndexAny(glob, `*?[\`); i >= 0 {
+		glob = glob[:i]
+	}
+	if len(glob) > len(f.Prefix) && strings.HasPrefix(glob, f.Prefix) {
+		return glob
+	}
+	return f.Prefix
+}
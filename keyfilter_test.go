@@ -0,0 +1,70 @@
+package bitempura_test
+
+import (
+	"path"
+	"testing"
+
+	. "github.com/elh/bitempura"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyFilter(t *testing.T) {
+	testCases := []struct {
+		filter        KeyFilter
+		literalPrefix string
+		matches       []string
+		nonMatches    []string
+	}{
+		{
+			filter:     KeyFilter{},
+			matches:    []string{"", "A", "Alice/balance"},
+			nonMatches: nil,
+		},
+		{
+			filter:        KeyFilter{Prefix: "Alice/"},
+			literalPrefix: "Alice/",
+			matches:       []string{"Alice/", "Alice/balance", "Alice/positions/AAPL"},
+			nonMatches:    []string{"Alice", "alice/balance", "Bob/balance"},
+		},
+		{
+			filter:        KeyFilter{Glob: "Alice/*"},
+			literalPrefix: "Alice/",
+			matches:       []string{"Alice/balance"},
+			nonMatches:    []string{"Alice/positions/AAPL", "Bob/balance"},
+		},
+		{
+			filter:        KeyFilter{Prefix: "Al", Glob: "Alice/b?lance"},
+			literalPrefix: "Alice/b",
+			matches:       []string{"Alice/balance", "Alice/bxlance"},
+			nonMatches:    []string{"Alice/positions"},
+		},
+		{
+			filter:        KeyFilter{Prefix: "Alice/positions/", Glob: "Alice/*/*"},
+			literalPrefix: "Alice/positions/",
+			matches:       []string{"Alice/positions/AAPL"},
+			nonMatches:    []string{"Alice/orders/1"},
+		},
+		{
+			filter:        KeyFilter{Glob: `\*`},
+			literalPrefix: "",
+			matches:       []string{"*"},
+			nonMatches:    []string{"A"},
+		},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.filter.Prefix+"|"+tC.filter.Glob, func(t *testing.T) {
+			assert.Nil(t, tC.filter.Validate())
+			assert.Equal(t, tC.literalPrefix, tC.filter.LiteralPrefix())
+			for _, key := range tC.matches {
+				assert.True(t, tC.filter.Match(key), key)
+			}
+			for _, key := range tC.nonMatches {
+				assert.False(t, tC.filter.Match(key), key)
+			}
+		})
+	}
+
+	bad := KeyFilter{Glob: "[A"}
+	assert.ErrorIs(t, bad.Validate(), path.ErrBadPattern)
+	assert.False(t, bad.Match("A"))
+}
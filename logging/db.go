@@ -0,0 +1,180 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	bt "github.com/elh/bitempura"
+)
+
+var _ bt.DB = (*DB)(nil)
+
+// Entry is a structured log entry for a single DB call.
+type Entry struct {
+	Operation string
+	Key       string // empty for List
+	// resolved times. unset read times default to "now" of the clock. unset write valid time defaults to "now".
+	ValidTime    *time.Time // as of valid time for reads, valid time start for writes
+	TxTime       *time.Time // as of transaction time for reads
+	EndValidTime *time.Time // valid time end for writes
+	Duration     time.Duration
+	Err          error
+}
+
+// String formats the entry as a single line of key=value pairs.
+func (e Entry) String() string {
+	parts := []string{"op=" + e.Operation}
+	if e.Key != "" {
+		parts = append(parts, "key="+e.Key)
+	}
+	if e.ValidTime != nil {
+		parts = append(parts, "vt="+e.ValidTime.Format(time.RFC3339Nano))
+	}
+	if e.EndValidTime != nil {
+		parts = append(parts, "end_vt="+e.EndValidTime.Format(time.RFC3339Nano))
+	}
+	if e.TxTime != nil {
+		parts = append(parts, "tt="+e.TxTime.Format(time.RFC3339Nano))
+	}
+	parts = append(parts, fmt.Sprintf("duration=%v", e.Duration))
+	if e.Err != nil {
+		parts = append(parts, fmt.Sprintf("err=%q", e.Err.Error()))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Logger receives an Entry for every DB call.
+type Logger interface {
+	Log(e Entry)
+}
+
+// LoggerFunc is an adapter to allow the use of ordinary functions as Loggers.
+type LoggerFunc func(e Entry)
+
+// Log calls f(e).
+func (f LoggerFunc) Log(e Entry) {
+	f(e)
+}
+
+// StdLogger returns a Logger that prints entries with a standard library log.Logger.
+func StdLogger(l *log.Logger) Logger {
+	return LoggerFunc(func(e Entry) {
+		l.Println(e.String())
+	})
+}
+
+// NewDB wraps a DB so every call is logged.
+func NewDB(db bt.DB, logger Logger, opts ...DBOpt) *DB {
+	options := &dbOptions{
+		clock: &bt.DefaultClock{},
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return &DB{db: db, logger: logger, clock: options.clock}
+}
+
+// DB is a DB that logs every call to the underlying DB.
+type DB struct {
+	db     bt.DB
+	logger Logger
+	clock  bt.Clock // clock resolves default times for logging. it should match the underlying DB's clock
+}
+
+// dbOptions is a struct for processing DBOpt's to be used by DB
+type dbOptions struct {
+	clock bt.Clock
+}
+
+// DBOpt is an option for constructing logging DBs
+type DBOpt func(*dbOptions)
+
+// WithClock configures the clock used to resolve default times in log entries. It should match the clock of the
+// underlying DB.
+func WithClock(clock bt.Clock) DBOpt {
+	return func(os *dbOptions) {
+		os.clock = clock
+	}
+}
+
+// Get data by key (as of optional valid and transaction times).
+func (db *DB) Get(key string, opts ...bt.ReadOpt) (*bt.VersionedKV, error) {
+	e := db.readEntry("get", key, opts)
+	start := time.Now()
+	kv, err := db.db.Get(key, opts...)
+	db.log(e, start, err)
+	return kv, err
+}
+
+// List all data (as of optional valid and transaction times).
+func (db *DB) List(opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	e := db.readEntry("list", "", opts)
+	start := time.Now()
+	kvs, err := db.db.List(opts...)
+	db.log(e, start, err)
+	return kvs, err
+}
+
+// Set stores value (with optional start and end valid time).
+func (db *DB) Set(key string, value bt.Value, opts ...bt.WriteOpt) error {
+	e := db.writeEntry("set", key, opts)
+	start := time.Now()
+	err := db.db.Set(key, value, opts...)
+	db.log(e, start, err)
+	return err
+}
+
+// Delete removes value (with optional start and end valid time).
+func (db *DB) Delete(key string, opts ...bt.WriteOpt) error {
+	e := db.writeEntry("delete", key, opts)
+	start := time.Now()
+	err := db.db.Delete(key, opts...)
+	db.log(e, start, err)
+	return err
+}
+
+// History returns versions by descending end transaction time, descending end valid time
+func (db *DB) History(key string, opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	e := Entry{Operation: "history", Key: key}
+	if len(opts) > 0 {
+		options := bt.ApplyReadOpts(opts)
+		options.ResolveAgo(db.clock.Now())
+		e.ValidTime, e.TxTime = options.ValidTime, options.TxTime
+	}
+	start := time.Now()
+	kvs, err := db.db.History(key, opts...)
+	db.log(e, start, err)
+	return kvs, err
+}
+
+func (db *DB) readEntry(operation, key string, opts []bt.ReadOpt) Entry {
+	options := bt.ApplyReadOpts(opts)
+	now := db.clock.Now()
+	options.ResolveAgo(now)
+	e := Entry{Operation: operation, Key: key, ValidTime: &now, TxTime: &now}
+	if options.ValidTime != nil {
+		e.ValidTime = options.ValidTime
+	}
+	if options.TxTime != nil {
+		e.TxTime = options.TxTime
+	}
+	return e
+}
+
+func (db *DB) writeEntry(operation, key string, opts []bt.WriteOpt) Entry {
+	options := bt.ApplyWriteOpts(opts)
+	now := db.clock.Now()
+	e := Entry{Operation: operation, Key: key, ValidTime: &now, EndValidTime: options.EndValidTime}
+	if options.ValidTime != nil {
+		e.ValidTime = options.ValidTime
+	}
+	return e
+}
+
+func (db *DB) log(e Entry, start time.Time, err error) {
+	e.Duration = time.Since(start)
+	e.Err = err
+	db.logger.Log(e)
+}
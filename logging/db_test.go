@@ -0,0 +1,48 @@
+package logging_test
+
+import (
+	"testing"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/elh/bitempura/dbtest/tt"
+	"github.com/elh/bitempura/logging"
+	"github.com/elh/bitempura/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	t1 = tt.Day(1)
+	t2 = tt.Day(2)
+	t3 = tt.Day(3)
+)
+
+func TestDB(t *testing.T) {
+	clock := &clock.Clock{}
+	require.Nil(t, clock.SetNow(t3))
+	mdb, err := memory.NewDB(memory.WithClock(clock))
+	require.Nil(t, err)
+
+	var entries []logging.Entry
+	db := logging.NewDB(mdb, logging.LoggerFunc(func(e logging.Entry) {
+		entries = append(entries, e)
+	}), logging.WithClock(clock))
+
+	require.Nil(t, db.Set("A", "Old", bt.WithValidTime(t1), bt.WithEndValidTime(t2)))
+	_, err = db.Get("A", bt.AsOfValidTime(t1))
+	require.Nil(t, err)
+	_, err = db.Get("A")
+	require.ErrorIs(t, err, bt.ErrNotFound)
+
+	require.Len(t, entries, 3)
+	assert.Equal(t, "set", entries[0].Operation)
+	assert.Equal(t, t1, *entries[0].ValidTime)
+	assert.Equal(t, t2, *entries[0].EndValidTime)
+	assert.Nil(t, entries[0].Err)
+	assert.Equal(t, t1, *entries[1].ValidTime)
+	assert.Equal(t, t3, *entries[1].TxTime, "default transaction time is resolved")
+	assert.Equal(t, t3, *entries[2].ValidTime, "default valid time is resolved")
+	assert.ErrorIs(t, entries[2].Err, bt.ErrNotFound)
+	assert.Contains(t, entries[2].String(), "op=get key=A vt=2022-01-03T00:00:00Z tt=2022-01-03T00:00:00Z")
+}
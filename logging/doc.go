@@ -0,0 +1,3 @@
+// Package logging provides a DB decorator that logs every call with its resolved options, duration, and error via a
+// pluggable Logger. It is usable with any bitempura.DB.
+package logging
@@ -0,0 +1,161 @@
+package memory
+
+import (
+	"errors"
+	"time"
+
+	bt "github.com/elh/bitempura"
+)
+
+// batchWrite is a prepared write of a WriteBatch.
+type batchWrite struct {
+	key      string
+	value    bt.Value
+	isDelete bool
+	config   *writeConfig
+	result   *bt.WriteResult // non-nil if writes are notified
+}
+
+// stashedVersions are the versions of a key before a batch wrote to it.
+type stashedVersions struct {
+	vs []version
+	ok bool // the key had versions
+}
+
+// WriteBatch applies the writes of b in order with a single transaction time under one lock. It fails without applying
+// any of them if one fails, and reads never see a partially applied batch. Pre-write hooks are called for each write as
+// it is applied. Post-write hooks and watches are notified of each write that was not a no-op after the whole batch is
+// applied.
+func (db *DB) WriteBatch(b *bt.WriteBatch) error {
+	// decide once since watches may be canceled during the batch
+	notify := db.notifiesWrites()
+	writes, ticket, err := db.applyBatch(b, notify)
+	if err != nil {
+		return err
+	}
+	if !batchNotifies(notify, writes) {
+		return nil
+	}
+	db.notifyQueue.wait(ticket)
+	defer db.notifyQueue.done()
+	for _, w := range writes {
+		if !notifies(notify, w.result) {
+			continue
+		}
+		for _, hook := range db.postWriteHooks {
+			hook(w.key, w.result)
+		}
+		db.watchers.notify(w.key, w.isDelete, w.result)
+	}
+	return nil
+}
+
+// applyBatch prepares and applies the writes of b at a single transaction time, restoring the versions of every key
+// written to if one fails. If the batch is notified, it returns the batch's ticket in db.notifyQueue.
+func (db *DB) applyBatch(b *bt.WriteBatch, notify bool) (writes []batchWrite, ticket uint64, err error) {
+	db.m.Lock()
+	defer db.m.Unlock()
+	// issue the transaction time under the lock. see update
+	now := db.clock.Now()
+	if writes, err = db.prepareBatch(b, now, notify); err != nil {
+		return nil, 0, err
+	}
+
+	// versions are modified in place, so stash copies
+	stash := map[string]stashedVersions{}
+	var keys, idempotencyKeys []string
+	applied := map[string]bool{} // idempotency keys of the batch
+	latestTxTime := db.latestTxTime
+	for i, w := range writes {
+		if _, ok := stash[w.key]; !ok {
+			vs, ok := db.vKVs[w.key]
+			stash[w.key] = stashedVersions{vs: append([]version(nil), vs...), ok: ok}
+			keys = append(keys, w.key)
+		}
+		idempotencyKey := w.config.idempotencyKey
+		if idempotencyKey != "" && applied[idempotencyKey] {
+			continue
+		}
+		if err := db.apply(w.key, w.value, w.isDelete, w.result, w.config, now); err != nil {
+			for key, s := range stash {
+				if s.ok {
+					db.vKVs[key] = s.vs
+				} else {
+					delete(db.vKVs, key)
+				}
+			}
+			db.latestTxTime = latestTxTime
+			return nil, 0, &bt.BatchWriteError{Index: i, Key: w.key, Err: err}
+		}
+		if idempotencyKey != "" {
+			applied[idempotencyKey] = true
+			idempotencyKeys = append(idempotencyKeys, idempotencyKey)
+		}
+	}
+	for _, key := range idempotencyKeys {
+		db.appliedKeys.add(key)
+	}
+	db.refreshCurrent(keys...)
+	if batchNotifies(notify, writes) {
+		// take a ticket before unlocking so hooks are called in commit order. see write
+		ticket = db.notifyQueue.take()
+	}
+	return writes, ticket, nil
+}
+
+// prepareBatch validates the writes of b and resolves their options at transaction time now. Writes without options
+// share a single resolution of the DB's defaults, so large batches such as imports resolve options once.
+func (db *DB) prepareBatch(b *bt.WriteBatch, now time.Time, notify bool) ([]batchWrite, error) {
+	writes := make([]batchWrite, len(b.Writes))
+	keys := make(map[string]bool, len(b.Writes))
+	var defaults *writeConfig
+	for i, w := range b.Writes {
+		if keys[w.Key] {
+			return nil, &bt.BatchWriteError{Index: i, Key: w.Key,
+				Err: invalidWrite(errors.New("key is written more than once"))}
+		}
+		keys[w.Key] = true
+		value, isDelete := w.Value, w.Delete
+		if !isDelete && value == nil {
+			switch db.nilValuePolicy {
+			case bt.NilValueReject:
+				return nil, &bt.BatchWriteError{Index: i, Key: w.Key, Err: bt.ErrNilValue}
+			case bt.NilValueDelete:
+				isDelete = true
+			}
+		}
+		var config *writeConfig
+		var err error
+		if len(w.Opts) == 0 && w.Key != "" {
+			if defaults == nil {
+				if defaults, err = db.handleWriteOpts(nil, now); err != nil {
+					return nil, &bt.BatchWriteError{Index: i, Key: w.Key, Err: invalidWrite(err)}
+				}
+			}
+			// copy since apply may adjust it
+			c := *defaults
+			config = &c
+			err = db.checkWrite(value, isDelete, config)
+		} else {
+			config, err = db.prepareWrite(w.Key, value, isDelete, w.Opts, now)
+		}
+		if err != nil {
+			return nil, &bt.BatchWriteError{Index: i, Key: w.Key, Err: err}
+		}
+		writes[i] = batchWrite{key: w.Key, value: value, isDelete: isDelete, config: config}
+		if notify {
+			writes[i].result = &bt.WriteResult{}
+		}
+	}
+	return writes, nil
+}
+
+// batchNotifies returns whether a successful batch calls the post-write hooks and notifies watches.
+func batchNotifies(notify bool, writes []batchWrite) bool {
+	for _, w := range writes {
+		if notifies(notify, w.result) {
+			return true
+		}
+	}
+	return false
+}
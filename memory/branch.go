@@ -0,0 +1,164 @@
+package memory
+
+import (
+	"sort"
+	"sync"
+
+	bt "github.com/elh/bitempura"
+)
+
+var _ bt.DB = (*Branch)(nil)
+var _ bt.KeyLister = (*Branch)(nil)
+
+// Branch returns the branch of the DB with name, creating it if it does not exist. Branches layer hypothetical writes
+// over the DB for what-if analysis without copying the DB or changing its history.
+func (db *DB) Branch(name string) *Branch {
+	db.branchesM.Lock()
+	defer db.branchesM.Unlock()
+	if b, ok := db.branches[name]; ok {
+		return b
+	}
+	// the overlay has no versions, so construction cannot fail
+	overlay, _ := newDB(&dbOptions{
+		clock:                db.clock,
+		txTimePolicy:         db.txTimePolicy,
+		overlapPolicy:        db.overlapPolicy,
+		futureValidTimes:     db.futureValidTimes,
+		valueCodec:           db.valueCodec,
+		nilValuePolicy:       db.nilValuePolicy,
+		sharedViews:          db.sharedViews,
+		lockFreeReads:        db.lockFreeReads,
+		historyLimit:         db.historyLimit,
+		historyLimitPolicy:   db.historyLimitPolicy,
+		idempotencyWindow:    db.appliedKeys.window,
+		skipUnchanged:        db.skipUnchanged,
+		preWriteHooks:        db.preWriteHooks,
+		maxPooledWriteBuffer: db.maxPooledWriteBuffer,
+	})
+	b := &Branch{
+		name:    name,
+		base:    db,
+		overlay: overlay,
+		written: map[string]bool{},
+	}
+	if db.branches == nil {
+		db.branches = map[string]*Branch{}
+	}
+	db.branches[name] = b
+	return b
+}
+
+// Branch is a DB of hypothetical writes layered over a base DB. Reads resolve branch-first: keys written in the branch
+// are read from the branch, and all other keys from the base DB. The first write of a key in the branch copies the
+// key's history from the base, so later base writes to that key are not visible in the branch.
+type Branch struct {
+	name    string
+	base    *DB
+	overlay *DB
+
+	m       sync.RWMutex
+	written map[string]bool // keys written in the branch
+}
+
+// Name returns the name of the branch.
+func (b *Branch) Name() string {
+	return b.name
+}
+
+// dbFor returns the DB that key is read from.
+func (b *Branch) dbFor(key string) *DB {
+	b.m.RLock()
+	defer b.m.RUnlock()
+	if b.written[key] {
+		return b.overlay
+	}
+	return b.base
+}
+
+// Get data by key (as of optional valid and transaction times).
+func (b *Branch) Get(key string, opts ...bt.ReadOpt) (*bt.VersionedKV, error) {
+	return b.dbFor(key).Get(key, opts...)
+}
+
+// List all data (as of optional valid and transaction times).
+func (b *Branch) List(opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	b.m.RLock()
+	defer b.m.RUnlock()
+	ret, err := b.overlay.List(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.base.ListFunc(func(kv *bt.VersionedKV) bool {
+		if !b.written[kv.Key] {
+			ret = append(ret, kv)
+		}
+		return true
+	}, opts...); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Set stores value in the branch (with optional start and end valid time).
+func (b *Branch) Set(key string, value bt.Value, opts ...bt.WriteOpt) error {
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.copyOnWrite(key)
+	return b.overlay.Set(key, value, opts...)
+}
+
+// Delete removes value in the branch (with optional start and end valid time).
+func (b *Branch) Delete(key string, opts ...bt.WriteOpt) error {
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.copyOnWrite(key)
+	return b.overlay.Delete(key, opts...)
+}
+
+// History returns versions by descending end transaction time, descending end valid time
+func (b *Branch) History(key string, opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	return b.dbFor(key).History(key, opts...)
+}
+
+// Keys returns all keys of the base DB and the branch in ascending order.
+func (b *Branch) Keys() ([]string, error) {
+	b.m.RLock()
+	defer b.m.RUnlock()
+	keys, err := b.overlay.Keys()
+	if err != nil {
+		return nil, err
+	}
+	baseKeys, err := b.base.Keys()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range baseKeys {
+		if !b.written[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// copyOnWrite copies the history of key from the base DB the first time key is written. b.m must be held for writing.
+func (b *Branch) copyOnWrite(key string) {
+	if b.written[key] {
+		return
+	}
+	b.written[key] = true
+
+	b.base.m.RLock()
+	vs := make([]version, len(b.base.vKVs[key]))
+	copy(vs, b.base.vKVs[key])
+	latestTxTime := b.base.latestTxTime
+	b.base.m.RUnlock()
+
+	b.overlay.m.Lock()
+	defer b.overlay.m.Unlock()
+	b.overlay.observeTxTime(latestTxTime)
+	if len(vs) > 0 {
+		b.overlay.vKVs[key] = vs
+		b.overlay.refreshCurrent(key)
+	}
+}
@@ -0,0 +1,132 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	bt "github.com/elh/bitempura"
+)
+
+// BulkLoader stages versioned key-values for a large historical import into a DB. Add only validates each version on
+// its own. Checking that versions do not overlap each other or stored versions of the same key in both transaction time
+// and valid time is deferred to Commit, which checks each key in one pass and then stores every staged version
+// atomically. Staged versions are not visible to reads until Commit.
+//
+// A BulkLoader is not safe for concurrent use. It cannot be used after Commit or Discard.
+type BulkLoader struct {
+	db     *DB
+	staged map[string][]version
+	kvs    int
+	done   bool
+}
+
+// BulkLoad starts a bulk import into the DB. See BulkLoader.
+func (db *DB) BulkLoad() *BulkLoader {
+	return &BulkLoader{db: db, staged: map[string][]version{}}
+}
+
+// errBulkLoadDone is returned by a BulkLoader used after Commit or Discard.
+var errBulkLoadDone = errors.New("bulk load is already committed or discarded")
+
+// Add stages versioned key-values. It fails without staging any of them if one is invalid.
+func (l *BulkLoader) Add(kvs ...*bt.VersionedKV) error {
+	if l.done {
+		return errBulkLoadDone
+	}
+	versions := make([]version, len(kvs))
+	for i, kv := range kvs {
+		if err := kv.Validate(); err != nil {
+			return err
+		}
+		v, err := newVersion(kv)
+		if err != nil {
+			return err
+		}
+		versions[i] = v
+	}
+	for i, v := range versions {
+		l.staged[kvs[i].Key] = append(l.staged[kvs[i].Key], v)
+	}
+	l.kvs += len(kvs)
+	return nil
+}
+
+// Len returns the number of staged versioned key-values.
+func (l *BulkLoader) Len() int {
+	return l.kvs
+}
+
+// Commit stores the staged versioned key-values. It fails without storing any of them if they overlap each other or
+// stored versions of the same key in both transaction time and valid time. Transaction times of committed versions are
+// observed like those seeded by WithVersionedKVs.
+func (l *BulkLoader) Commit() error {
+	if l.done {
+		return errBulkLoadDone
+	}
+	l.done = true
+	db := l.db
+
+	db.m.Lock()
+	defer db.m.Unlock()
+	// check every key before storing any so a failed commit has no effect
+	merged := make(map[string][]version, len(l.staged))
+	for key, staged := range l.staged {
+		vs := make([]version, 0, len(db.vKVs[key])+len(staged))
+		vs = append(append(vs, db.vKVs[key]...), staged...)
+		if err := checkNoOverlap(vs); err != nil {
+			return fmt.Errorf("key=%v: %w", key, err)
+		}
+		merged[key] = vs
+	}
+	for key, vs := range merged {
+		for i := len(db.vKVs[key]); i < len(vs); i++ {
+			db.share(key, &vs[i])
+			db.observeTxTime(fromNanos(vs[i].txTimeStart))
+			if vs[i].hasTxTimeEnd {
+				db.observeTxTime(fromNanos(vs[i].txTimeEnd))
+			}
+		}
+		db.vKVs[key] = vs
+		db.refreshCurrent(key)
+	}
+	l.staged = nil
+	return nil
+}
+
+// Discard drops the staged versioned key-values.
+func (l *BulkLoader) Discard() {
+	l.done, l.staged = true, nil
+}
+
+// checkNoOverlap returns an error if any two versions of a key's history overlap both transaction time and valid time.
+// It sweeps the versions by transaction time start, so each version is only compared to the versions current at its
+// transaction time start, which do not overlap each other in valid time, instead of to every version.
+func checkNoOverlap(vs []version) error {
+	order := make([]int, len(vs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return vs[order[a]].txTimeStart < vs[order[b]].txTimeStart })
+
+	var active []int
+	for _, i := range order {
+		v := &vs[i]
+		// drop versions that end in transaction time before v starts
+		n := 0
+		for _, j := range active {
+			if !vs[j].hasTxTimeEnd || vs[j].txTimeEnd > v.txTimeStart {
+				active[n] = j
+				n++
+			}
+		}
+		active = active[:n]
+		for _, j := range active {
+			if v.validTimeRange().Overlaps(vs[j].validTimeRange()) {
+				return errors.New("versioned values for the same key overlap tx time and valid time")
+			}
+		}
+		active = append(active, i)
+	}
+	return nil
+}
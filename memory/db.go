@@ -3,48 +3,170 @@ package memory
 import (
 	"errors"
 	"fmt"
+	"math"
+	"reflect"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/interval"
 )
 
 var _ bt.DB = (*DB)(nil)
+var _ bt.KeyLister = (*DB)(nil)
+var _ bt.HistoriesReader = (*DB)(nil)
+var _ bt.ListStreamer = (*DB)(nil)
+var _ bt.StatsReader = (*DB)(nil)
+var _ bt.MultiGetter = (*DB)(nil)
+var _ bt.ChangeLister = (*DB)(nil)
+var _ bt.ResultWriter = (*DB)(nil)
+var _ bt.BatchWriter = (*DB)(nil)
+var _ bt.Watcher = (*DB)(nil)
 
 // NewDB constructs a in-memory, bitemporal key-value database.
 func NewDB(opts ...DBOpt) (*DB, error) {
 	options := &dbOptions{
-		clock: &bt.DefaultClock{},
+		clock:                &bt.DefaultClock{},
+		idempotencyWindow:    1024,
+		maxPooledWriteBuffer: 1024,
 	}
 	for _, opt := range opts {
 		opt(options)
 	}
+	return newDB(options)
+}
+
+func newDB(options *dbOptions) (*DB, error) {
+	if options.historyLimit < 0 {
+		return nil, errors.New("history limit must be positive")
+	}
+	if options.idempotencyWindow < 0 {
+		return nil, errors.New("idempotency window must be positive")
+	}
+	db := &DB{
+		vKVs:             map[string][]version{},
+		current:          map[string]*currentVersion{},
+		clock:            options.clock,
+		txTimePolicy:     options.txTimePolicy,
+		overlapPolicy:    options.overlapPolicy,
+		futureValidTimes: options.futureValidTimes,
+		valueCodec:       options.valueCodec,
+		nilValuePolicy:   options.nilValuePolicy,
+		sharedViews:      options.sharedViews,
+		lockFreeReads:    options.lockFreeReads,
+
+		historyLimit:       options.historyLimit,
+		historyLimitPolicy: options.historyLimitPolicy,
+		appliedKeys:        newIdempotencyKeys(options.idempotencyWindow),
+		skipUnchanged:      options.skipUnchanged,
+		preWriteHooks:      options.preWriteHooks,
+		postWriteHooks:     options.postWriteHooks,
 
-	db := &DB{vKVs: map[string][]*bt.VersionedKV{}, clock: options.clock}
+		maxPooledWriteBuffer: options.maxPooledWriteBuffer,
+	}
+	db.writeBuffers.New = func() interface{} {
+		db.poolStats.News++
+		return &writeBuffer{}
+	}
 	for _, kv := range options.versionedKVs {
 		if err := kv.Validate(); err != nil {
 			return nil, err
 		}
-		if err := db.assertNoOverlap(kv, db.vKVs[kv.Key]); err != nil {
+		v, err := newVersion(kv)
+		if err != nil {
+			return nil, err
+		}
+		db.share(kv.Key, &v)
+		db.vKVs[kv.Key] = append(db.vKVs[kv.Key], v)
+		db.observeTxTime(kv.TxTimeStart)
+		if kv.TxTimeEnd != nil {
+			db.observeTxTime(*kv.TxTimeEnd)
+		}
+	}
+	if options.lastTxTime != nil {
+		db.observeTxTime(*options.lastTxTime)
+	}
+	for key, vs := range db.vKVs {
+		if err := checkNoOverlap(vs); err != nil {
 			return nil, err
 		}
-		db.vKVs[kv.Key] = append(db.vKVs[kv.Key], kv)
+		db.refreshCurrent(key)
+	}
+	if db.lockFreeReads {
+		snapshot := make(map[string]*currentVersion, len(db.current))
+		for key, c := range db.current {
+			snapshot[key] = c
+		}
+		db.snapshot.Store(snapshot)
 	}
 	return db, nil
 }
 
-// DB is an in-memory, bitemporal key-value database.
+// DB is an in-memory, bitemporal key-value database. Times are stored with nanosecond precision as unix times, so they
+// must be between the years 1678 and 2262, and they are returned in UTC. Returned VersionedKVs are copies owned by the
+// caller.
 type DB struct {
-	vKVs  map[string][]*bt.VersionedKV // key -> all versioned key-values with the key
-	m     sync.RWMutex                 // synchronize access to vKVs
-	clock bt.Clock                     // clock provides transaction times
+	vKVs  map[string][]version // key -> all versions with the key
+	m     sync.RWMutex         // synchronize access to vKVs
+	clock bt.Clock             // clock provides transaction times
+
+	current map[string]*currentVersion // key -> cache of the current version. refreshed on writes to the key
+
+	lockFreeReads bool         // if set, snapshot is maintained for Get as of now
+	snapshot      atomic.Value // immutable copy of current. map[string]*currentVersion replaced by each write
+
+	txTimePolicy bt.TxTimePolicy // handling of writes with transaction times before latestTxTime
+	latestTxTime time.Time       // latest transaction time issued or of any stored version
+
+	overlapPolicy    bt.OverlapPolicy // default overlap policy for Set
+	valueCodec       bt.Codec         // if set, values must round-trip through valueCodec
+	futureValidTimes bool             // if set, writes may have valid times after their transaction time
+
+	nilValuePolicy bt.NilValuePolicy // handling of Set with a nil value
+	sharedViews    bool              // if set, versions hold a shared, immutable view that reads return
+
+	historyLimit       int // max versions per key. unlimited if 0
+	historyLimitPolicy bt.HistoryLimitPolicy
+
+	appliedKeys    idempotencyKeys          // guarded by m
+	skipUnchanged  func(a, b bt.Value) bool // if set, Set is a no-op if values are equal. see WithSkipUnchanged
+	preWriteHooks  []PreWriteHook
+	postWriteHooks []PostWriteHook
+	notifyQueue    notifyQueue // orders post-write hooks and watch notifications by commit
+	watchers       watchers
+
+	branches  map[string]*Branch // name -> branch. see Branch
+	branchesM sync.Mutex         // synchronize access to branches
+
+	writeBuffers         sync.Pool // *writeBuffer scratch space reused across writes
+	maxPooledWriteBuffer int       // write buffers that grow beyond this many overlapping versions are not pooled
+	poolStats            PoolStats // guarded by m
 }
 
 // dbOptions is a struct for processing WriteOpt's to be used by DB
 type dbOptions struct {
-	versionedKVs []*bt.VersionedKV
-	clock        bt.Clock
+	versionedKVs     []*bt.VersionedKV
+	clock            bt.Clock
+	txTimePolicy     bt.TxTimePolicy
+	lastTxTime       *time.Time
+	overlapPolicy    bt.OverlapPolicy
+	valueCodec       bt.Codec
+	futureValidTimes bool
+
+	nilValuePolicy bt.NilValuePolicy
+	sharedViews    bool
+	lockFreeReads  bool
+
+	historyLimit       int
+	historyLimitPolicy bt.HistoryLimitPolicy
+
+	idempotencyWindow    int
+	skipUnchanged        func(a, b bt.Value) bool
+	preWriteHooks        []PreWriteHook
+	postWriteHooks       []PostWriteHook
+	maxPooledWriteBuffer int
 }
 
 // DBOpt is an option for constructing databases
@@ -65,179 +187,783 @@ func WithClock(clock bt.Clock) DBOpt {
 	}
 }
 
+// WithStrictTxTime constructs database that rejects writes if the clock's time precedes the latest transaction time of
+// any stored version. Without it, a regressing clock can write versions into the transaction time past. It is
+// equivalent to WithTxTimePolicy(bt.TxTimeReject).
+func WithStrictTxTime() DBOpt {
+	return WithTxTimePolicy(bt.TxTimeReject)
+}
+
+// WithTxTimePolicy constructs database with a policy for writes whose clock time precedes the latest transaction time
+// issued by the DB or of any stored version.
+func WithTxTimePolicy(p bt.TxTimePolicy) DBOpt {
+	return func(os *dbOptions) {
+		os.txTimePolicy = p
+	}
+}
+
+// WithLastTxTime constructs database that has already issued transaction times up to t, such as the UntilTxTime of the
+// backup it is restored from. Use it with WithTxTimePolicy so a restarted DB does not issue earlier transaction times.
+func WithLastTxTime(t time.Time) DBOpt {
+	return func(os *dbOptions) {
+		os.lastTxTime = &t
+	}
+}
+
+// WithOverlapPolicy constructs database with a default overlap policy for Set. Writes can override it with
+// bt.WithOverlapPolicy.
+func WithOverlapPolicy(p bt.OverlapPolicy) DBOpt {
+	return func(os *dbOptions) {
+		os.overlapPolicy = p
+	}
+}
+
+// WithFutureValidTimes constructs database that allows every write to have valid times after its transaction time, as
+// if it were made with bt.WithFutureValidTime.
+func WithFutureValidTimes() DBOpt {
+	return func(os *dbOptions) {
+		os.futureValidTimes = true
+	}
+}
+
+// WithSerializableValues constructs database that rejects Sets of values that do not round-trip through codec, such as
+// bt.JSONCodec. Without it, non-serializable values are only detected when they are later exported or transmitted.
+func WithSerializableValues(codec bt.Codec) DBOpt {
+	return func(os *dbOptions) {
+		os.valueCodec = codec
+	}
+}
+
+// WithHistoryLimit constructs database that holds at most n versions per key, handling writes that would exceed it with
+// policy p. n must be positive. Versions seeded by WithVersionedKVs are not limited until the key is written.
+func WithHistoryLimit(n int, p bt.HistoryLimitPolicy) DBOpt {
+	return func(os *dbOptions) {
+		os.historyLimit, os.historyLimitPolicy = n, p
+	}
+}
+
+// WithSkipUnchanged constructs database where a Set is a no-op if the value is equal to the current values over its
+// whole valid time range, so that ingest jobs re-writing the same values do not create new versions. Values are compared
+// with equal, or reflect.DeepEqual if equal is nil.
+func WithSkipUnchanged(equal func(a, b bt.Value) bool) DBOpt {
+	return func(os *dbOptions) {
+		if equal == nil {
+			equal = func(a, b bt.Value) bool { return reflect.DeepEqual(a, b) }
+		}
+		os.skipUnchanged = equal
+	}
+}
+
+// WithIdempotencyWindow constructs database that remembers the last n idempotency keys of applied writes. The default is
+// 1024. See bt.WithIdempotencyKey.
+func WithIdempotencyWindow(n int) DBOpt {
+	return func(os *dbOptions) {
+		os.idempotencyWindow = n
+	}
+}
+
+// WithNilValuePolicy constructs database with a policy for Set with a nil value. By default, nil is stored like any
+// other value.
+func WithNilValuePolicy(p bt.NilValuePolicy) DBOpt {
+	return func(os *dbOptions) {
+		os.nilValuePolicy = p
+	}
+}
+
+// WithSharedViews constructs database where Get, List, and History return read-only views shared by all readers
+// instead of copies. Views must not be modified. Each version is converted to a view when it is written, trading
+// memory for avoiding an allocation per read. Writes do not modify views that have already been returned.
+func WithSharedViews() DBOpt {
+	return func(os *dbOptions) {
+		os.sharedViews = true
+	}
+}
+
+// WithLockFreeReads constructs database where Get without ReadOpts reads an atomically swapped snapshot of current
+// versions and does not wait for writers. Each write copies the snapshot, so writes are O(keys). It suits read heavy
+// workloads that are sensitive to read latency.
+func WithLockFreeReads() DBOpt {
+	return func(os *dbOptions) {
+		os.lockFreeReads = true
+	}
+}
+
+// WithMaxPooledWriteBuffer constructs database that only pools write buffers for writes that overlapped at most n
+// versions, so that an occasional large write does not pin memory. The default is 1024. See DB.PoolStats.
+func WithMaxPooledWriteBuffer(n int) DBOpt {
+	return func(os *dbOptions) {
+		os.maxPooledWriteBuffer = n
+	}
+}
+
 // Get data by key (as of optional valid and transaction times).
 func (db *DB) Get(key string, opts ...bt.ReadOpt) (*bt.VersionedKV, error) {
 	config := db.handleReadOpts(opts)
+	if db.lockFreeReads && len(opts) == 0 {
+		if kv, ok, err := db.getSnapshot(key, config); ok {
+			return kv, err
+		}
+	}
 
 	db.m.RLock()
 	defer db.m.RUnlock()
 	vs, ok := db.vKVs[key]
 	if !ok {
-		return nil, bt.ErrNotFound
+		return nil, &bt.NotFoundError{Key: key, ValidTime: config.validTime, TxTime: config.txTime}
 	}
-	return db.findVersionByTime(vs, config.validTime, config.txTime)
+	i, err := db.findVisibleVersion(key, vs, config.validNanos, config.txNanos)
+	if errors.Is(err, bt.ErrNotFound) || (err == nil && !config.decided(&vs[i])) {
+		return nil, &bt.NotFoundError{Key: key, ValidTime: config.validTime, TxTime: config.txTime}
+	} else if err != nil {
+		return nil, err
+	}
+	return db.export(key, &vs[i]), nil
 }
 
-// List all data (as of optional valid and transaction times).
-func (db *DB) List(opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+// GetMulti returns the data of each key (as of optional valid and transaction times) in the order of keys. Results are
+// nil for keys that are not found. Keys are read under a single lock acquisition.
+func (db *DB) GetMulti(keys []string, opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
 	config := db.handleReadOpts(opts)
 
-	var ret []*bt.VersionedKV
 	db.m.RLock()
 	defer db.m.RUnlock()
-	for _, vs := range db.vKVs {
-		v, err := db.findVersionByTime(vs, config.validTime, config.txTime)
-		if errors.Is(err, bt.ErrNotFound) {
+	out := make([]*bt.VersionedKV, len(keys))
+	for j, key := range keys {
+		vs, ok := db.vKVs[key]
+		if !ok {
+			continue
+		}
+		i, err := db.findVisibleVersion(key, vs, config.validNanos, config.txNanos)
+		if errors.Is(err, bt.ErrNotFound) || (err == nil && !config.decided(&vs[i])) {
 			continue
 		} else if err != nil {
 			return nil, err
 		}
+		out[j] = db.export(key, &vs[i])
+	}
+	return out, nil
+}
+
+// getSnapshot reads key as of now from the current version snapshot without locking. ok is false if the snapshot cannot
+// determine the result, such as when the clock precedes the key's current version.
+func (db *DB) getSnapshot(key string, config readConfig) (kv *bt.VersionedKV, ok bool, err error) {
+	snapshot := db.snapshot.Load().(map[string]*currentVersion)
+	c, found := snapshot[key]
+	if !found {
+		return nil, true, &bt.NotFoundError{Key: key, ValidTime: config.validTime, TxTime: config.txTime}
+	}
+	if c.i >= 0 && c.v.visibleAt(config.validNanos, config.txNanos) {
+		return db.export(key, &c.v), true, nil
+	}
+	if config.validNanos >= c.horizon && config.txNanos >= c.horizon {
+		return nil, true, &bt.NotFoundError{Key: key, ValidTime: config.validTime, TxTime: config.txTime}
+	}
+	return nil, false, nil
+}
+
+// List all data (as of optional valid and transaction times).
+func (db *DB) List(opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	var ret []*bt.VersionedKV
+	if err := db.ListFunc(func(v *bt.VersionedKV) bool {
 		ret = append(ret, v)
+		return true
+	}, opts...); err != nil {
+		return nil, err
 	}
 	return ret, nil
 }
 
+// ListFunc calls fn with each result of List (as of optional valid and transaction times) until fn returns false. The
+// DB is read locked while fn is called so fn must not write to the DB.
+func (db *DB) ListFunc(fn func(*bt.VersionedKV) bool, opts ...bt.ReadOpt) error {
+	config := db.handleReadOpts(opts)
+	if err := config.keyFilter.Validate(); err != nil {
+		return err
+	}
+
+	db.m.RLock()
+	defer db.m.RUnlock()
+	for key, vs := range db.vKVs {
+		if !config.keyFilter.Match(key) {
+			continue
+		}
+		i, err := db.findVisibleVersion(key, vs, config.validNanos, config.txNanos)
+		if errors.Is(err, bt.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if !config.decided(&vs[i]) {
+			continue
+		}
+		if !fn(db.export(key, &vs[i])) {
+			return nil
+		}
+	}
+	return nil
+}
+
 // Set stores value (with optional start and end valid time).
 func (db *DB) Set(key string, value bt.Value, opts ...bt.WriteOpt) error {
-	return db.update(key, value, false, opts...)
+	return db.set(key, value, nil, opts...)
+}
+
+// SetWithResult stores value (with optional start and end valid time) and returns the affected versions.
+func (db *DB) SetWithResult(key string, value bt.Value, opts ...bt.WriteOpt) (*bt.WriteResult, error) {
+	result := &bt.WriteResult{}
+	if err := db.set(key, value, result, opts...); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (db *DB) set(key string, value bt.Value, result *bt.WriteResult, opts ...bt.WriteOpt) error {
+	if value == nil {
+		switch db.nilValuePolicy {
+		case bt.NilValueReject:
+			return bt.ErrNilValue
+		case bt.NilValueDelete:
+			return db.write(key, nil, true, result, opts...)
+		}
+	}
+	return db.write(key, value, false, result, opts...)
 }
 
 // Delete removes value (with optional start and end valid time).
 func (db *DB) Delete(key string, opts ...bt.WriteOpt) error {
-	return db.update(key, nil, true, opts...)
+	return db.write(key, nil, true, nil, opts...)
 }
 
-// History returns versions by descending end transaction time, descending end valid time
-func (db *DB) History(key string) ([]*bt.VersionedKV, error) {
+// DeleteWithResult removes value (with optional start and end valid time) and returns the affected versions.
+func (db *DB) DeleteWithResult(key string, opts ...bt.WriteOpt) (*bt.WriteResult, error) {
+	result := &bt.WriteResult{}
+	if err := db.write(key, nil, true, result, opts...); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// History returns versions by descending end transaction time, descending end valid time (filtered by optional valid
+// and transaction times). See bt.FilterHistory.
+func (db *DB) History(key string, opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	var options *bt.ReadOptions
+	if len(opts) > 0 {
+		options = bt.ApplyReadOpts(opts)
+		options.ResolveAgo(db.clock.Now())
+	}
+
 	db.m.RLock()
 	defer db.m.RUnlock()
 	vs, ok := db.vKVs[key]
 	if !ok {
-		return nil, bt.ErrNotFound
+		return nil, &bt.NotFoundError{Key: key}
+	}
+	kvs := db.sortedHistory(key, vs)
+	if options == nil {
+		return kvs, nil
+	}
+	if kvs = bt.FilterHistory(kvs, options); len(kvs) == 0 {
+		return nil, &bt.NotFoundError{Key: key}
+	}
+	return kvs, nil
+}
+
+// Histories returns the versions of each key, ordered as History. Keys with no versions are omitted.
+func (db *DB) Histories(keys []string) (map[string][]*bt.VersionedKV, error) {
+	db.m.RLock()
+	defer db.m.RUnlock()
+	out := make(map[string][]*bt.VersionedKV, len(keys))
+	for _, key := range keys {
+		if vs, ok := db.vKVs[key]; ok {
+			out[key] = db.sortedHistory(key, vs)
+		}
 	}
+	return out, nil
+}
 
-	out := make([]*bt.VersionedKV, len(vs))
-	copy(out, vs)
-	sort.Slice(out, func(i, j int) bool { // reversed. flip i and j
-		return (out[j].TxTimeEnd != nil && out[i].TxTimeEnd != nil && out[j].TxTimeEnd.Before(*out[i].TxTimeEnd)) ||
-			(out[j].TxTimeEnd != nil && out[i].TxTimeEnd == nil) ||
-			(out[j].TxTimeEnd == out[i].TxTimeEnd &&
-				(out[j].ValidTimeEnd != nil && out[i].ValidTimeEnd != nil && out[j].ValidTimeEnd.Before(*out[i].ValidTimeEnd)) ||
-				(out[j].ValidTimeEnd != nil && out[i].ValidTimeEnd == nil))
+// sortedHistory converts versions of key, ordered by descending end transaction time, descending end valid time.
+func (db *DB) sortedHistory(key string, vs []version) []*bt.VersionedKV {
+	sorted := make([]version, len(vs))
+	copy(sorted, vs)
+	sort.Slice(sorted, func(i, j int) bool { // reversed. flip i and j
+		vi, vj := &sorted[i], &sorted[j]
+		sameTxTimeEnd := vj.hasTxTimeEnd == vi.hasTxTimeEnd && vj.txTimeEnd == vi.txTimeEnd
+		return (vj.hasTxTimeEnd && vi.hasTxTimeEnd && vj.txTimeEnd < vi.txTimeEnd) ||
+			(vj.hasTxTimeEnd && !vi.hasTxTimeEnd) ||
+			(sameTxTimeEnd &&
+				(vj.hasValidTimeEnd && vi.hasValidTimeEnd && vj.validTimeEnd < vi.validTimeEnd)) ||
+			(vj.hasValidTimeEnd && !vi.hasValidTimeEnd)
 	})
-	return out, nil
+	out := make([]*bt.VersionedKV, len(sorted))
+	for i := range sorted {
+		out[i] = db.export(key, &sorted[i])
+	}
+	return out
 }
 
-// Common logic of Set and Delete. Handling of existing records and "overhand" is the same. If for Delete, do not create
-// new VersionedKV.
-func (db *DB) update(key string, value bt.Value, isDelete bool, opts ...bt.WriteOpt) error {
-	writeConfig, now, err := db.handleWriteOpts(opts)
-	if err != nil {
-		return err
+// Keys returns all keys in ascending order.
+func (db *DB) Keys() ([]string, error) {
+	db.m.RLock()
+	defer db.m.RUnlock()
+	keys := make([]string, 0, len(db.vKVs))
+	for key := range db.vKVs {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
+	return keys, nil
+}
 
+// ChangedKeys returns the keys that gained or closed versions after transaction time since, in ascending order.
+func (db *DB) ChangedKeys(since time.Time) ([]string, error) {
+	sinceNanos := interval.Nanos(since)
+
+	db.m.RLock()
+	defer db.m.RUnlock()
+	var keys []string
+	for key, vs := range db.vKVs {
+		for i := range vs {
+			if vs[i].txTimeStart > sinceNanos || (vs[i].hasTxTimeEnd && vs[i].txTimeEnd > sinceNanos) {
+				keys = append(keys, key)
+				break
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Stats returns per-key and total statistics of all versions.
+func (db *DB) Stats() (*bt.Stats, error) {
+	db.m.RLock()
+	defer db.m.RUnlock()
+	stats := &bt.Stats{PerKey: make(map[string]*bt.KeyStats, len(db.vKVs))}
+	for key, vs := range db.vKVs {
+		ks := &bt.KeyStats{}
+		for i := range vs {
+			ks.Add(vs[i].toVersionedKV(key))
+		}
+		stats.AddKey(key, ks)
+	}
+	return stats, nil
+}
+
+// PoolStats reports reuse of the scratch buffers of writes. Gets - News writes reused a pooled buffer. Many News
+// relative to Gets indicates that buffers are being garbage collected between writes, and many Discards indicates that
+// WithMaxPooledWriteBuffer is too low for the workload.
+type PoolStats struct {
+	Gets     uint64 // buffers taken by writes
+	News     uint64 // buffers allocated because none were pooled
+	Discards uint64 // buffers not returned to the pool because they grew beyond the max pooled size
+}
+
+// PoolStats returns cumulative statistics of write buffer pooling.
+func (db *DB) PoolStats() PoolStats {
+	db.m.RLock()
+	defer db.m.RUnlock()
+	return db.poolStats
+}
+
+// writeBuffer is scratch space for finding the versions a write overlaps. overhangs of all overlapping versions share
+// one slice.
+type writeBuffer struct {
+	overlapping []overlappingVersion
+	overhangs   []interval.Interval
+}
+
+// getWriteBuffer takes a reset buffer from the pool. db.m must be held for writing.
+func (db *DB) getWriteBuffer() *writeBuffer {
+	db.poolStats.Gets++
+	buf := db.writeBuffers.Get().(*writeBuffer)
+	buf.overlapping, buf.overhangs = buf.overlapping[:0], buf.overhangs[:0]
+	return buf
+}
+
+// putWriteBuffer returns a buffer to the pool unless it has grown too large. db.m must be held for writing.
+func (db *DB) putWriteBuffer(buf *writeBuffer) {
+	if cap(buf.overlapping) > db.maxPooledWriteBuffer {
+		db.poolStats.Discards++
+		return
+	}
+	db.writeBuffers.Put(buf)
+}
+
+// Common logic of Set and Delete. Handling of existing records and "overhand" is the same. If for Delete, do not create
+// new version. If result is non-nil, the affected versions are recorded in it. If notify is set, result must be non-nil.
+// If the write is notified, it returns the write's ticket in db.notifyQueue.
+func (db *DB) update(key string, value bt.Value, isDelete bool, result *bt.WriteResult, notify bool,
+	opts ...bt.WriteOpt) (ticket uint64, err error) {
 	db.m.Lock()
 	defer db.m.Unlock()
-	vs, ok := db.vKVs[key]
-	if ok {
-		overlappingVs, err := db.findOverlappingValidTimeVersions(vs, writeConfig.validTime, writeConfig.endValidTime, now)
-		if err != nil {
+	// issue the transaction time under the lock so writes are applied in transaction time order. see ReadTx
+	now := db.clock.Now()
+	writeConfig, err := db.prepareWrite(key, value, isDelete, opts, now)
+	if err != nil {
+		return 0, err
+	}
+	defer db.refreshCurrent(key)
+	if err := db.apply(key, value, isDelete, result, writeConfig, now); err != nil {
+		return 0, err
+	}
+	// only remember the key if the write is applied
+	if writeConfig.idempotencyKey != "" {
+		db.appliedKeys.add(writeConfig.idempotencyKey)
+	}
+	if notifies(notify, result) {
+		// take a ticket before unlocking so hooks are called in commit order. see write
+		ticket = db.notifyQueue.take()
+	}
+	return ticket, nil
+}
+
+// prepareWrite validates a write and resolves its options at transaction time now.
+func (db *DB) prepareWrite(key string, value bt.Value, isDelete bool, opts []bt.WriteOpt, now time.Time) (*writeConfig, error) {
+	if key == "" {
+		return nil, invalidWrite(errors.New("key is required"))
+	}
+	writeConfig, err := db.handleWriteOpts(opts, now)
+	if err != nil {
+		return nil, invalidWrite(err)
+	}
+	if err := db.checkWrite(value, isDelete, writeConfig); err != nil {
+		return nil, err
+	}
+	return writeConfig, nil
+}
+
+// checkWrite validates a write's value and resolved options.
+func (db *DB) checkWrite(value bt.Value, isDelete bool, writeConfig *writeConfig) error {
+	if !isDelete && writeConfig.allValidTime {
+		return invalidWrite(errors.New("all valid time is only supported for Delete"))
+	}
+	if !isDelete && db.valueCodec != nil {
+		if err := bt.CheckSerializable(db.valueCodec, value); err != nil {
+			return invalidWrite(err)
+		}
+	}
+	return nil
+}
+
+// invalidWrite wraps the reason a write is invalid with bt.ErrInvalidWrite.
+func invalidWrite(err error) error {
+	return fmt.Errorf("%w: %v", bt.ErrInvalidWrite, err)
+}
+
+// apply applies a prepared write of key at transaction time now. The caller refreshes the current version cache of key
+// and remembers the write's idempotency key if it is applied. db.m must be held for writing.
+func (db *DB) apply(key string, value bt.Value, isDelete bool, result *bt.WriteResult, writeConfig *writeConfig,
+	now time.Time) error {
+	if writeConfig.idempotencyKey != "" && db.appliedKeys.contains(writeConfig.idempotencyKey) {
+		return nil
+	}
+	if now.Before(db.latestTxTime) {
+		switch db.txTimePolicy {
+		case bt.TxTimeReject:
+			return fmt.Errorf("%w: %v is before %v", bt.ErrTxTimeRegressed, now, db.latestTxTime)
+		case bt.TxTimeAdjust:
+			now = db.latestTxTime
+			if writeConfig.defaultValidTime {
+				writeConfig.validTime = interval.From(interval.Nanos(now))
+			}
+		}
+	}
+	db.observeTxTime(now)
+	nowNanos := interval.Nanos(now)
+
+	if _, ok := db.vKVs[key]; ok {
+		buf := db.getWriteBuffer()
+		defer db.putWriteBuffer(buf)
+		db.findOverlappingValidTimeVersions(buf, db.vKVs[key], writeConfig.validTime, nowNanos)
+		if !isDelete && db.skipUnchanged != nil &&
+			db.unchanged(db.vKVs[key], buf.overlapping, value, writeConfig.validTime) {
+			return nil
+		}
+		if !isDelete && len(buf.overlapping) > 0 && writeConfig.overlapPolicy == bt.OverlapReject {
+			return bt.ErrOverlap
+		}
+		if writeConfig.overhangPolicy == bt.OverhangReject {
+			for _, overhang := range buf.overhangs {
+				if writeConfig.isAfter(overhang) {
+					return bt.ErrOverhang
+				}
+			}
+		}
+		if db.historyLimit > 0 && db.historyLimitPolicy == bt.HistoryLimitReject {
+			n := len(db.vKVs[key]) + len(buf.overhangs)
+			if !isDelete {
+				n++
+			}
+			if n > db.historyLimit {
+				return fmt.Errorf("%w: key=%v would have %v versions", bt.ErrHistoryLimit, key, n)
+			}
+		}
+		if err := db.preWrite(key, value, isDelete, writeConfig, now); err != nil {
 			return err
 		}
 
-		for _, overlappingV := range overlappingVs {
-			// NOTE(elh): playing fast and loose with just mutating versioned value by ptr
-			overlappingV.v.TxTimeEnd = &now
+		for _, overlappingV := range buf.overlapping {
+			// index on each use since appending overhangs may reallocate the slice
+			db.vKVs[key][overlappingV.i].txTimeEnd = nowNanos
+			db.vKVs[key][overlappingV.i].hasTxTimeEnd = true
+			db.share(key, &db.vKVs[key][overlappingV.i])
+			if result != nil {
+				result.TxTime = now
+				result.Closed = append(result.Closed, db.export(key, &db.vKVs[key][overlappingV.i]))
+			}
 
-			for _, overhang := range overlappingV.overhangs {
-				overhangV := &bt.VersionedKV{
-					Key:            key,
-					Value:          overlappingV.v.Value,
-					TxTimeStart:    now,
-					TxTimeEnd:      nil,
-					ValidTimeStart: overhang.start,
-					ValidTimeEnd:   overhang.end,
+			for _, overhang := range buf.overhangs[overlappingV.overhangsStart:overlappingV.overhangsEnd] {
+				if writeConfig.overhangPolicy == bt.OverhangTruncate && writeConfig.isAfter(overhang) {
+					continue
 				}
-				if err := overhangV.Validate(); err != nil {
+				overhangV := version{
+					value:           db.vKVs[key][overlappingV.i].value,
+					txTimeStart:     nowNanos,
+					validTimeStart:  overhang.Start,
+					validTimeEnd:    overhang.End,
+					hasValidTimeEnd: overhang.HasEnd,
+					decisionTime:    db.vKVs[key][overlappingV.i].decisionTime,
+					hasDecisionTime: db.vKVs[key][overlappingV.i].hasDecisionTime,
+				}
+				if err := overhangV.validate(); err != nil {
 					return err
 				}
 				if err := db.assertNoOverlap(overhangV, db.vKVs[key]); err != nil {
 					return err
 				}
+				db.share(key, &overhangV)
 				db.vKVs[key] = append(db.vKVs[key], overhangV)
+				if result != nil {
+					result.Overhangs = append(result.Overhangs, db.export(key, &overhangV))
+				}
 			}
 		}
+	} else if !isDelete {
+		if err := db.preWrite(key, value, isDelete, writeConfig, now); err != nil {
+			return err
+		}
 	}
 
 	// add value for Set, add nothing for Delete
 	if !isDelete {
-		newV := &bt.VersionedKV{
-			Key:            key,
-			Value:          value,
-			TxTimeStart:    now,
-			TxTimeEnd:      nil,
-			ValidTimeStart: writeConfig.validTime,
-			ValidTimeEnd:   writeConfig.endValidTime,
-		}
-		if err := newV.Validate(); err != nil {
+		newV := version{
+			value:           value,
+			txTimeStart:     nowNanos,
+			validTimeStart:  writeConfig.validTime.Start,
+			validTimeEnd:    writeConfig.validTime.End,
+			hasValidTimeEnd: writeConfig.validTime.HasEnd,
+			decisionTime:    writeConfig.decisionTime,
+			hasDecisionTime: writeConfig.hasDecisionTime,
+		}
+		if err := newV.validate(); err != nil {
 			return err
 		}
 		if err := db.assertNoOverlap(newV, db.vKVs[key]); err != nil {
 			return err
 		}
+		db.share(key, &newV)
 		db.vKVs[key] = append(db.vKVs[key], newV)
+		if result != nil {
+			result.TxTime = now
+			result.Created = db.export(key, &newV)
+		}
 	}
 
+	if db.historyLimit > 0 && db.historyLimitPolicy == bt.HistoryLimitCompact {
+		db.compact(key)
+	}
 	return nil
 }
 
+// compact removes the versions of key with the earliest transaction time ends until it has at most historyLimit
+// versions or only current versions remain. db.m must be held for writing.
+func (db *DB) compact(key string) {
+	vs := db.vKVs[key]
+	excess := len(vs) - db.historyLimit
+	if excess <= 0 {
+		return
+	}
+	var closed []int
+	for i := range vs {
+		if vs[i].hasTxTimeEnd {
+			closed = append(closed, i)
+		}
+	}
+	sort.Slice(closed, func(a, b int) bool {
+		return vs[closed[a]].txTimeEnd < vs[closed[b]].txTimeEnd
+	})
+	if excess > len(closed) {
+		excess = len(closed)
+	}
+	removed := make(map[int]bool, excess)
+	for _, i := range closed[:excess] {
+		removed[i] = true
+	}
+	kept := vs[:0]
+	for i := range vs {
+		if !removed[i] {
+			kept = append(kept, vs[i])
+		}
+	}
+	// clear the tail so removed values can be garbage collected
+	for i := len(kept); i < len(vs); i++ {
+		vs[i] = version{}
+	}
+	db.vKVs[key] = kept
+}
+
+// share sets the shared view of a new or modified version if WithSharedViews is set.
+func (db *DB) share(key string, v *version) {
+	if db.sharedViews {
+		v.view = v.toVersionedKV(key)
+	}
+}
+
+// export returns the version's shared view or a copy.
+func (db *DB) export(key string, v *version) *bt.VersionedKV {
+	if v.view != nil {
+		return v.view
+	}
+	return v.toVersionedKV(key)
+}
+
+// observeTxTime advances latestTxTime. db.m must be held for writing.
+func (db *DB) observeTxTime(t time.Time) {
+	if t.After(db.latestTxTime) {
+		db.latestTxTime = t
+	}
+}
+
 type writeConfig struct {
-	validTime    time.Time
-	endValidTime *time.Time
+	validTime      interval.Interval
+	overlapPolicy  bt.OverlapPolicy
+	overhangPolicy bt.OverhangPolicy
+	idempotencyKey string
+	allValidTime   bool // validTime is unbounded. only valid for Delete
+
+	decisionTime    int64
+	hasDecisionTime bool
+
+	defaultValidTime bool // validTime was defaulted to the transaction time
 }
 
-func (db *DB) handleWriteOpts(opts []bt.WriteOpt) (config *writeConfig, now time.Time, err error) {
+// isAfter returns whether the overhang r is after the write's valid time range.
+func (c *writeConfig) isAfter(r interval.Interval) bool {
+	return c.validTime.HasEnd && r.Start >= c.validTime.End
+}
+
+func (db *DB) handleWriteOpts(opts []bt.WriteOpt, now time.Time) (config *writeConfig, err error) {
 	options := bt.ApplyWriteOpts(opts)
 
-	now = db.clock.Now()
+	if err := interval.CheckTime(now); err != nil {
+		return nil, err
+	}
+	validTime, endValidTime := now, (*time.Time)(nil)
 	config = &writeConfig{
-		validTime:    now,
-		endValidTime: nil,
+		overlapPolicy:    db.overlapPolicy,
+		defaultValidTime: true,
 	}
 	if options.ValidTime != nil {
-		config.validTime = *options.ValidTime
+		validTime = *options.ValidTime
+		config.defaultValidTime = false
 	}
 	if options.EndValidTime != nil {
-		config.endValidTime = options.EndValidTime
+		endValidTime = options.EndValidTime
+	}
+	if options.OverlapPolicy != nil {
+		config.overlapPolicy = *options.OverlapPolicy
+	}
+	if options.OverhangPolicy != nil {
+		config.overhangPolicy = *options.OverhangPolicy
+	}
+	config.idempotencyKey = options.IdempotencyKey
+	if options.ValidDuration != nil {
+		return nil, errors.New("valid duration requires a valid time and cannot be combined with an end valid time")
+	}
+	if options.AllValidTime {
+		if options.ValidTime != nil || options.EndValidTime != nil {
+			return nil, errors.New("all valid time cannot be combined with a valid time")
+		}
+		config.allValidTime, config.defaultValidTime = true, false
 	}
 
 	// validate write option times. this is relevant for Delete even if Set is validated at resource level
-	if config.endValidTime != nil && !config.endValidTime.After(config.validTime) {
-		return nil, time.Time{}, errors.New("valid time start must be before end")
+	if endValidTime != nil && !endValidTime.After(validTime) {
+		return nil, errors.New("valid time start must be before end")
 	}
-	// disallow valid times being set in the future
-	if config.validTime.After(now) {
-		return nil, time.Time{}, errors.New("valid time start cannot be in the future")
+	// disallow valid times being set in the future unless scheduled
+	if !options.FutureValidTime && !db.futureValidTimes {
+		if validTime.After(now) {
+			return nil, errors.New("valid time start cannot be in the future")
+		}
+		if endValidTime != nil && endValidTime.After(now) {
+			return nil, errors.New("valid time end cannot be in the future")
+		}
+	}
+	if endValidTime != nil {
+		if err := interval.CheckTime(*endValidTime); err != nil {
+			return nil, err
+		}
 	}
-	if config.endValidTime != nil && config.endValidTime.After(now) {
-		return nil, time.Time{}, errors.New("valid time end cannot be in the future")
+	if err := checkValidTimeStart(validTime); err != nil {
+		return nil, err
+	}
+	if options.DecisionTime != nil {
+		if options.DecisionTime.After(now) {
+			return nil, errors.New("decision time cannot be after transaction time")
+		}
+		if err := interval.CheckTime(*options.DecisionTime); err != nil {
+			return nil, err
+		}
+		config.decisionTime, config.hasDecisionTime = options.DecisionTime.UnixNano(), true
+	}
+	config.validTime = interval.Of(validTime, endValidTime)
+	if config.allValidTime {
+		config.validTime = interval.All
 	}
 
-	return config, now, nil
+	return config, nil
 }
 
 type readConfig struct {
 	validTime time.Time
 	txTime    time.Time
+
+	validNanos int64 // validTime as unix nanoseconds, clamped to the range of stored times
+	txNanos    int64 // txTime as unix nanoseconds, clamped to the range of stored times
+
+	decisionNanos   int64 // only versions decided at or before decisionNanos are read if hasDecisionTime is set
+	hasDecisionTime bool
+
+	keyFilter bt.KeyFilter
+}
+
+// decided returns whether v is read as of the config's decision time.
+func (c *readConfig) decided(v *version) bool {
+	return !c.hasDecisionTime || v.decidedAt(c.decisionNanos)
 }
 
-func (db *DB) handleReadOpts(opts []bt.ReadOpt) *readConfig {
-	options := bt.ApplyReadOpts(opts)
+// readOptionsPool reuses bt.ReadOptions. ReadOpt's escape the options they are applied to, so they would otherwise be
+// heap allocated on every read.
+var readOptionsPool = sync.Pool{
+	New: func() interface{} {
+		return &bt.ReadOptions{}
+	},
+}
 
-	now := db.clock.Now()
-	config := &readConfig{
-		validTime: now,
-		txTime:    now,
+// handleReadOpts resolves read options. The config is returned by value and the clock is only read if an as of time
+// is defaulted so reads do not allocate.
+func (db *DB) handleReadOpts(opts []bt.ReadOpt) readConfig {
+	options := readOptionsPool.Get().(*bt.ReadOptions)
+	defer readOptionsPool.Put(options)
+	*options = bt.ReadOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	var config readConfig
+	if options.ValidTime == nil || options.TxTime == nil {
+		now := db.clock.Now()
+		options.ResolveAgo(now)
+		config.validTime, config.txTime = now, now
 	}
 	if options.ValidTime != nil {
 		config.validTime = *options.ValidTime
@@ -245,94 +971,140 @@ func (db *DB) handleReadOpts(opts []bt.ReadOpt) *readConfig {
 	if options.TxTime != nil {
 		config.txTime = *options.TxTime
 	}
-
+	config.validNanos, config.txNanos = interval.Nanos(config.validTime), interval.Nanos(config.txTime)
+	if options.DecisionTime != nil {
+		config.decisionNanos, config.hasDecisionTime = interval.Nanos(*options.DecisionTime), true
+	}
+	config.keyFilter = options.KeyFilter
 	return config
 }
 
 // handle time properties
 
+// currentVersion caches the version of a key that is open in both transaction time and valid time. At most one such
+// version exists per key, and if it is visible at a read's coordinates, no other version of the key can be.
+type currentVersion struct {
+	i int     // index of the open version in the key's versions. -1 if the key has no open version
+	v version // copy of the open version so that snapshot reads do not access the key's versions
+	// all other versions end transaction time or valid time at or before horizon, so none are visible at coordinates
+	// both at or after it
+	horizon int64
+}
+
+// refreshCurrent recomputes the current version cache of keys and publishes a new snapshot if WithLockFreeReads is set.
+// currentVersions are not modified after they are cached, so snapshots share them. db.m must be held for writing.
+func (db *DB) refreshCurrent(keys ...string) {
+	for _, key := range keys {
+		db.current[key] = db.currentVersion(key)
+	}
+
+	// the constructor stores the first snapshot after caching all keys
+	if prev, ok := db.snapshot.Load().(map[string]*currentVersion); ok {
+		snapshot := make(map[string]*currentVersion, len(prev)+len(keys))
+		for k, v := range prev {
+			snapshot[k] = v
+		}
+		for _, key := range keys {
+			snapshot[key] = db.current[key]
+		}
+		db.snapshot.Store(snapshot)
+	}
+}
+
+// currentVersion computes the current version cache of a key. db.m must be held.
+func (db *DB) currentVersion(key string) *currentVersion {
+	c := &currentVersion{i: -1, horizon: math.MinInt64}
+	for i, v := range db.vKVs[key] {
+		if !v.hasTxTimeEnd && !v.hasValidTimeEnd {
+			c.i, c.v = i, v
+			continue
+		}
+		end := v.txTimeEnd
+		if !v.hasTxTimeEnd || (v.hasValidTimeEnd && v.validTimeEnd < end) {
+			end = v.validTimeEnd
+		}
+		if end > c.horizon {
+			c.horizon = end
+		}
+	}
+	return c
+}
+
+// findVisibleVersion finds the index of the version of a key visible at validTime and txTime, using the current version
+// cache to avoid visiting every version for reads as of now.
+func (db *DB) findVisibleVersion(key string, vs []version, validTime, txTime int64) (int, error) {
+	if c, ok := db.current[key]; ok {
+		if c.i >= 0 && vs[c.i].visibleAt(validTime, txTime) {
+			return c.i, nil
+		}
+		if validTime >= c.horizon && txTime >= c.horizon {
+			return -1, bt.ErrNotFound
+		}
+	}
+	return db.findVersionByTime(vs, validTime, txTime)
+}
+
 // if no match, return ErrNotFound
 // if more than 1 possible match, return error
-func (db *DB) findVersionByTime(vs []*bt.VersionedKV, validTime, txTime time.Time) (*bt.VersionedKV, error) {
-	var out *bt.VersionedKV
-	for _, v := range vs {
-		if db.isInRange(validTime, timeRange{v.ValidTimeStart, v.ValidTimeEnd}) &&
-			db.isInRange(txTime, timeRange{v.TxTimeStart, v.TxTimeEnd}) {
-			if out != nil {
-				return nil, fmt.Errorf("multiple versions matched find for validTime: %v, txTime: %v", validTime, txTime)
+func (db *DB) findVersionByTime(vs []version, validTime, txTime int64) (int, error) {
+	out := -1
+	for i := range vs {
+		if vs[i].visibleAt(validTime, txTime) {
+			if out >= 0 {
+				return -1, fmt.Errorf("multiple versions matched find for validTime: %v, txTime: %v", fromNanos(validTime), fromNanos(txTime))
 			}
-			out = v
+			out = i
 		}
 	}
-	if out == nil {
-		return nil, bt.ErrNotFound
+	if out < 0 {
+		return -1, bt.ErrNotFound
 	}
 	return out, nil
 }
 
 type overlappingVersion struct {
-	v         *bt.VersionedKV
-	overhangs []timeRange
+	i int // index in the key's versions
+	// overhangs are writeBuffer.overhangs[overhangsStart:overhangsEnd]
+	overhangsStart, overhangsEnd int
 }
 
-func (db *DB) findOverlappingValidTimeVersions(vs []*bt.VersionedKV, validTimeStart time.Time, validTimeEnd *time.Time, txTime time.Time) ([]overlappingVersion, error) {
-	var out []overlappingVersion
-	for _, v := range vs {
-		if !db.isInRange(txTime, timeRange{v.TxTimeStart, v.TxTimeEnd}) {
+// findOverlappingValidTimeVersions appends the versions current at txTime that overlap validTime to buf.
+func (db *DB) findOverlappingValidTimeVersions(buf *writeBuffer, vs []version, validTime interval.Interval, txTime int64) {
+	for i := range vs {
+		if !vs[i].knownAt(txTime) {
 			continue
 		}
-		hasOverlap, curOverhang := db.hasOverlap(timeRange{validTimeStart, validTimeEnd}, timeRange{v.ValidTimeStart, v.ValidTimeEnd})
-		if !hasOverlap {
+		if !validTime.Overlaps(vs[i].validTimeRange()) {
 			continue
 		}
-		out = append(out, overlappingVersion{
-			v:         v,
-			overhangs: curOverhang,
+		start := len(buf.overhangs)
+		buf.overhangs = vs[i].validTimeRange().AppendDifference(buf.overhangs, validTime)
+		buf.overlapping = append(buf.overlapping, overlappingVersion{
+			i:              i,
+			overhangsStart: start,
+			overhangsEnd:   len(buf.overhangs),
 		})
 	}
-
-	return out, nil
-}
-
-// start is inclusive, end is exclusive
-type timeRange struct {
-	start time.Time
-	end   *time.Time
 }
 
-func (db *DB) isInRange(t time.Time, r timeRange) bool {
-	return (t.Equal(r.start) || t.After(r.start)) && (r.end == nil || t.Before(*r.end))
-}
-
-// given 2 time ranges, hasOverlap = true if the two ranges intersect.
-// if they overlap, yOverhangs represents that intervals within y that are not in x.
-// hasOverlap(a, b) =/= hasOverlap(b, a)
-// examples:
-//     hasOverlap(|10,20|, |5,50|) -> yOverhangs: [|5,10|, |20,50|]
-//     hasOverlap(|10,20|, |15,30|) -> yOverhangs: [|20,30|]
-//     hasOverlap(|10,20|, |15,20|) -> yOverhangs: []
-//     hasOverlap(|10,20|, |12,13|) -> yOverhangs: []
-func (db *DB) hasOverlap(x, y timeRange) (hasOverlap bool, yOverhangs []timeRange) {
-	hasOverlap = (y.end == nil || x.start.Before(*y.end)) && (x.end == nil || y.start.Before(*x.end))
-	if hasOverlap {
-		// come up with fancier interval math here
-		if y.start.Before(x.start) {
-			yOverhangs = append(yOverhangs, timeRange{y.start, &x.start})
-		}
-		if x.end != nil && (y.end == nil || x.end.Before(*y.end)) {
-			yOverhangs = append(yOverhangs, timeRange{*x.end, y.end})
+// unchanged returns whether the overlapping versions all have value and cover validTime, so a Set would not change any
+// value.
+func (db *DB) unchanged(vs []version, overlapping []overlappingVersion, value bt.Value, validTime interval.Interval) bool {
+	ranges := make([]interval.Interval, len(overlapping))
+	for j, o := range overlapping {
+		if !db.skipUnchanged(vs[o.i].value, value) {
+			return false
 		}
+		ranges[j] = vs[o.i].validTimeRange()
 	}
-
-	return hasOverlap, yOverhangs
+	return interval.Covers(ranges, validTime)
 }
 
 // when updating version records, ensure we do not create ambiguous overlap
-func (db *DB) assertNoOverlap(candidate *bt.VersionedKV, xs []*bt.VersionedKV) error {
-	for _, x := range xs {
-		txTimeOverlaps, _ := db.hasOverlap(timeRange{candidate.TxTimeStart, candidate.TxTimeEnd}, timeRange{x.TxTimeStart, x.TxTimeEnd})
-		validTimeOverlaps, _ := db.hasOverlap(timeRange{candidate.ValidTimeStart, candidate.ValidTimeEnd}, timeRange{x.ValidTimeStart, x.ValidTimeEnd})
-		if txTimeOverlaps && validTimeOverlaps {
+func (db *DB) assertNoOverlap(candidate version, xs []version) error {
+	for i := range xs {
+		if candidate.txTimeRange().Overlaps(xs[i].txTimeRange()) &&
+			candidate.validTimeRange().Overlaps(xs[i].validTimeRange()) {
 			return fmt.Errorf("versioned values for the same key overlap tx time and valid time")
 		}
 	}
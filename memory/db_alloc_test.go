@@ -0,0 +1,46 @@
+//go:build !race
+// +build !race
+
+package memory_test
+
+import (
+	"testing"
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The race detector randomly drops pooled objects, so allocations are only checked without it. Get allocates only the
+// returned copy of the version.
+func TestReadAllocations(t *testing.T) {
+	db, err := memory.NewDB(memory.WithVersionedKVs([]*VersionedKV{
+		{Key: "A", Value: "Old", TxTimeStart: t1, ValidTimeStart: t1},
+	}))
+	require.Nil(t, err)
+
+	kv, err := db.Get("A", AsOfValidTime(t2), AsOfTransactionTime(t2))
+	require.Nil(t, err)
+	assert.Nil(t, kv.TxTimeEnd)
+
+	validTime, txTime := AsOfValidTime(t2), AsOfTransactionTime(t2)
+	assert.Equal(t, 1.0, testing.AllocsPerRun(100, func() {
+		_, _ = db.Get("A", validTime, txTime)
+	}))
+	assert.Equal(t, 1.0, testing.AllocsPerRun(100, func() {
+		_, _ = db.Get("A")
+	}))
+}
+
+func TestSharedViewReadAllocations(t *testing.T) {
+	db, err := memory.NewDB(memory.WithSharedViews(), memory.WithVersionedKVs([]*VersionedKV{
+		{Key: "A", Value: "Old", TxTimeStart: t1, ValidTimeStart: t1},
+	}))
+	require.Nil(t, err)
+
+	validTime, txTime := AsOfValidTime(t2), AsOfTransactionTime(t2)
+	assert.Zero(t, testing.AllocsPerRun(100, func() {
+		_, _ = db.Get("A", validTime, txTime)
+	}))
+}
@@ -6,7 +6,9 @@ import (
 	"testing"
 
 	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
 	"github.com/elh/bitempura/dbtest"
+	"github.com/elh/bitempura/dbtest/tt"
 	"github.com/elh/bitempura/memory"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -22,12 +24,12 @@ import (
 // > the investigator will step through this sequence to monitor a set of suspects. These events will arrive in an
 // > undetermined chronological order based on how and when each checkpoint is able to manually relay the information.
 func TestTXDBCrimeInvestigationExample(t *testing.T) {
-	clock := &dbtest.TestClock{}
+	clock := &clock.Clock{}
 	db, err := memory.NewDB(memory.WithClock(clock))
 	require.Nil(t, err)
 	keys := []string{"p1", "p2", "p3", "p4", "p5", "p6", "p7"}
 	// TODO: render as markdown so we can have links and code blocks?
-	defer dbtest.WriteOutputHistory(t, db, keys, t.Name(), strings.TrimSpace(`
+	defer dbtest.WriteOutput(t, nil, db, keys, strings.TrimSpace(`
 This is a recreation of the example from the [XTDB docs](https://docs.xtdb.com/concepts/bitemporality/).
 
 It doesn't display as well because this visualization is oriented around single objects at the moment. See `+"`TestRobinhoodExample`"+" for a more thorough demonstration."))
@@ -37,7 +39,7 @@ It doesn't display as well because this visualization is oriented around single
 	// -------------------- Day 0 --------------------
 	// The first document shows that Person 2 was recorded entering via :SFO and the second document shows that Person 3
 	// was recorded entering :LA.
-	day0 := mustParseTime(shortForm, "2018-12-31")
+	day0 := tt.Date("2018-12-31")
 	require.Nil(t, clock.SetNow(day0))
 	require.Nil(t, db.Set("p2", Doc{
 		"entry-pt":       "SFO",
@@ -312,15 +314,15 @@ It doesn't display as well because this visualization is oriented around single
 // see https://medium.com/robinhood-engineering/tracking-temporal-data-at-robinhood-b62291644a31
 // > At Robinhood, accounting is a central part of our business...
 func TestRobinhoodExample(t *testing.T) {
-	clock := &dbtest.TestClock{}
+	clock := &clock.Clock{}
 	db, err := memory.NewDB(memory.WithClock(clock))
 	require.Nil(t, err)
-	defer dbtest.WriteOutputHistory(t, db, []string{"user-1"}, t.Name(), strings.TrimSpace(`
+	defer dbtest.WriteOutput(t, nil, db, []string{"user-1"}, strings.TrimSpace(`
 This is a recreation of the example in a Robinhood blog post: [Tracking Temporal Data at Robinhood](https://medium.com/robinhood-engineering/tracking-temporal-data-at-robinhood-b62291644a31). ([code↗](https://github.com/elh/bitempura/blob/main/memory/db_examples_test.go))
 
 `+"```"+`
 // Say you deposit $100 in your account on 3/14.
-mar14 := mustParseTime(shortForm, "2021-03-14")
+mar14 := tt.Date("2021-03-14")
 require.Nil(t, clock.SetNow(mar14))
 require.Nil(t, db.Set("user-1", Balance{
 	"cash-balance": 100,
@@ -328,7 +330,7 @@ require.Nil(t, db.Set("user-1", Balance{
 }))
 
 // On 3/20, you purchase 1 share of ABC stock at $25.
-mar20 := mustParseTime(shortForm, "2021-03-20")
+mar20 := tt.Date("2021-03-20")
 require.Nil(t, clock.SetNow(mar20))
 require.Nil(t, db.Set("user-1", Balance{
 	"cash-balance": 75,
@@ -337,7 +339,7 @@ require.Nil(t, db.Set("user-1", Balance{
 
 // On 3/21, Robinhood received a price improvement, indicating the execution for your 1 share of ABC was
 // actually $10.
-mar21 := mustParseTime(shortForm, "2021-03-21")
+mar21 := tt.Date("2021-03-21")
 require.Nil(t, clock.SetNow(mar21))
 require.Nil(t, db.Set("user-1", Balance{
 	"cash-balance": 90,
@@ -347,7 +349,7 @@ require.Nil(t, db.Set("user-1", Balance{
 Let's query our bitemporal history. Hover over the diagram to see changes over valid and transaction time.
 `+"```"+`
 // Now let's check the price at interesting points. See the diagram below
-mar13 := mustParseTime(shortForm, "2021-03-13") // before any VT, TT
+mar13 := tt.Date("2021-03-13") // before any VT, TT
 // VT=now, TT=now. as of now
 assert.Equal(t, 90, findBalance())
 // VT=now, TT=3/20. before price correction
@@ -369,14 +371,14 @@ expectErrGetBalance(AsOfTransactionTime(mar13), AsOfValidTime(mar14))
 	type Balance map[string]interface{}
 
 	// Say you deposit $100 in your account on 3/14.
-	mar14 := mustParseTime(shortForm, "2021-03-14")
+	mar14 := tt.Date("2021-03-14")
 	require.Nil(t, clock.SetNow(mar14))
 	require.Nil(t, db.Set("user-1", Balance{
 		"cash-balance": 100,
 		"description":  "Deposit", // description of last event??
 	}))
 	// On 3/20, you purchase 1 share of ABC stock at $25.
-	mar20 := mustParseTime(shortForm, "2021-03-20")
+	mar20 := tt.Date("2021-03-20")
 	require.Nil(t, clock.SetNow(mar20))
 	require.Nil(t, db.Set("user-1", Balance{
 		"cash-balance": 75,
@@ -384,7 +386,7 @@ expectErrGetBalance(AsOfTransactionTime(mar13), AsOfValidTime(mar14))
 	}))
 	// On 3/21, Robinhood received a price improvement, indicating the execution for your 1 share of ABC was
 	// actually $10.
-	mar21 := mustParseTime(shortForm, "2021-03-21")
+	mar21 := tt.Date("2021-03-21")
 	require.Nil(t, clock.SetNow(mar21))
 	require.Nil(t, db.Set("user-1", Balance{
 		"cash-balance": 90,
@@ -403,7 +405,7 @@ expectErrGetBalance(AsOfTransactionTime(mar13), AsOfValidTime(mar14))
 	}
 
 	// Now let's check the price at interesting points. See the diagram below
-	mar13 := mustParseTime(shortForm, "2021-03-13") // before any VT, TT
+	mar13 := tt.Date("2021-03-13") // before any VT, TT
 	// VT=now, TT=now. as of now
 	assert.Equal(t, 90, findBalance())
 	// VT=now, TT=3/20. before price correction
@@ -1,35 +1,34 @@
 package memory_test
 
 import (
+	"bytes"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/backup"
+	"github.com/elh/bitempura/changefeed"
+	"github.com/elh/bitempura/clock"
 	"github.com/elh/bitempura/dbtest"
+	"github.com/elh/bitempura/dbtest/tt"
 	"github.com/elh/bitempura/memory"
+	"github.com/elh/bitempura/viz"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 var (
-	shortForm = "2006-01-02" // simple time format
-
 	// these test dates are always in the real-world past
-	t0 = mustParseTime(shortForm, "2021-12-31")
-	t1 = mustParseTime(shortForm, "2022-01-01")
-	t2 = mustParseTime(shortForm, "2022-01-02")
-	t3 = mustParseTime(shortForm, "2022-01-03")
-	t4 = mustParseTime(shortForm, "2022-01-04")
+	t0 = tt.Day(0)
+	t1 = tt.Day(1)
+	t2 = tt.Day(2)
+	t3 = tt.Day(3)
+	t4 = tt.Day(4)
 )
 
-func mustParseTime(layout, value string) time.Time {
-	t, err := time.Parse(layout, value)
-	if err != nil {
-		panic(err)
-	}
-	return t
-}
-
 // values can be any type but I will standardize on "Old", "New", and "Newest" in these tests for legibility
 
 func TestConstructor(t *testing.T) {
@@ -184,14 +183,14 @@ func TestList(t *testing.T) {
 func TestSet(t *testing.T) {
 	dbtest.TestSet(t, func(kvs []*VersionedKV, clock Clock) (DB, error) {
 		return memory.NewDB(memory.WithVersionedKVs(kvs), memory.WithClock(clock))
-	})
+	}, dbtest.WithGolden("testdata/golden"), dbtest.WithInvariantChecks())
 }
 
 func TestDelete(t *testing.T) {
 	dbtest.TestDelete(t, "OLD", "NEW", func(kvs []*VersionedKV, clock Clock) (DB, func(), error) {
 		db, err := memory.NewDB(memory.WithVersionedKVs(kvs), memory.WithClock(clock))
 		return db, func() {}, err
-	})
+	}, dbtest.WithGolden("testdata/golden"), dbtest.WithInvariantChecks())
 }
 
 func TestHistory(t *testing.T) {
@@ -200,3 +199,1177 @@ func TestHistory(t *testing.T) {
 		return db, func() {}, err
 	})
 }
+
+// TestFixturesByReplay runs the suites with fixtures built by writes instead of seeding.
+func TestFixturesByReplay(t *testing.T) {
+	dbtest.RunSuites(t, dbtest.Backend{
+		Capabilities: []dbtest.Capability{dbtest.CapabilityWrite, dbtest.CapabilityClock, dbtest.CapabilityKeys,
+			dbtest.CapabilityBatch},
+		NewDB: func(_ []*VersionedKV, clock Clock) (DB, func(), error) {
+			db, err := memory.NewDB(memory.WithClock(clock))
+			return db, func() {}, err
+		},
+	})
+}
+
+func TestOracle(t *testing.T) {
+	dbtest.TestOracle(t, func(clock Clock) (DB, error) {
+		return memory.NewDB(memory.WithClock(clock))
+	})
+}
+
+func TestConcurrency(t *testing.T) {
+	dbtest.TestConcurrency(t, func(clock Clock) (DB, error) {
+		return memory.NewDB(memory.WithClock(clock))
+	})
+}
+
+func TestGenerate(t *testing.T) {
+	for seed := int64(1); seed <= 20; seed++ {
+		kvs := dbtest.Generate(seed, dbtest.WithKeyCount(3), dbtest.WithVersionsPerKey(20),
+			dbtest.WithCorrectionProbability(0.5))
+		require.Equal(t, kvs, dbtest.Generate(seed, dbtest.WithKeyCount(3), dbtest.WithVersionsPerKey(20),
+			dbtest.WithCorrectionProbability(0.5)), "generation is not reproducible")
+
+		// the memory DB validates versions and rejects overlapping versions
+		_, err := memory.NewDB(memory.WithVersionedKVs(kvs))
+		require.Nil(t, err, "seed: %v", seed)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	dbtest.TestKeys(t, "OLD", func(kvs []*VersionedKV) (DB, func(), error) {
+		db, err := memory.NewDB(memory.WithVersionedKVs(kvs))
+		return db, func() {}, err
+	})
+}
+
+func TestRecordReplay(t *testing.T) {
+	c := clock.New(t1)
+	require.Nil(t, c.AutoAdvance(time.Hour))
+	rec := dbtest.NewRecorder(c)
+	db, err := memory.NewDB(memory.WithClock(rec.Clock()))
+	require.Nil(t, err)
+	rdb := rec.Wrap(db)
+
+	require.Nil(t, rdb.Set("A", "Old"))
+	require.Nil(t, rdb.Set("A", "New"))
+	require.NotNil(t, rdb.Set("A", "Future", WithValidTime(t4)))
+	require.Nil(t, rdb.Delete("A", WithValidTime(t1), WithEndValidTime(t1.Add(time.Hour))))
+	_, err = rdb.Get("A")
+	require.Nil(t, err)
+	_, err = rdb.Get("A", AsOfValidTime(t1))
+	require.ErrorIs(t, err, ErrNotFound)
+	_, err = rdb.List()
+	require.Nil(t, err)
+	_, err = rdb.History("A")
+	require.Nil(t, err)
+
+	var buf bytes.Buffer
+	require.Nil(t, rec.Log().Write(&buf))
+	l, err := dbtest.ReadOpLog(&buf)
+	require.Nil(t, err)
+	require.Len(t, l, 8)
+	require.Equal(t, rec.Log()[1].Now, *l[1].ValidTime, "defaulted valid time is resolved")
+
+	replayClock := &clock.Clock{}
+	replayDB, err := memory.NewDB(memory.WithClock(replayClock))
+	require.Nil(t, err)
+	require.Nil(t, dbtest.ReplayOpLog(replayDB, replayClock, l))
+
+	// the replayed DB already has the writes so results differ
+	require.NotNil(t, dbtest.ReplayOpLog(replayDB, replayClock, l))
+}
+
+func TestStress(t *testing.T) {
+	dbtest.TestStress(t, func(kvs []*VersionedKV) (DB, func(), error) {
+		db, err := memory.NewDB(memory.WithVersionedKVs(kvs))
+		return db, func() {}, err
+	})
+}
+
+func TestChaosClock(t *testing.T) {
+	dbtest.TestChaosClock(t, func(clock Clock) (DB, error) {
+		return memory.NewDB(memory.WithClock(clock))
+	})
+}
+
+func TestReadRecording(t *testing.T) {
+	var outputs []*dbtest.TestOutput
+	sink := viz.SinkFunc(func(o *viz.Output) error {
+		outputs = append(outputs, o)
+		return nil
+	})
+	dbtest.TestGet(t, "OLD", "NEW", func(kvs []*VersionedKV) (DB, func(), error) {
+		db, err := memory.NewDB(memory.WithVersionedKVs(kvs))
+		return db, func() {}, err
+	}, dbtest.WithOutputWriter(sink), dbtest.WithReadRecording())
+
+	require.NotEmpty(t, outputs)
+	for _, o := range outputs {
+		require.Len(t, o.Reads, 1, o.TestName)
+		assert.Equal(t, "Get", o.Reads[0].Op)
+		assert.Equal(t, "A", o.Reads[0].Key)
+	}
+}
+
+// settableClock is a clock that, unlike clock.Clock, can be set backwards.
+type settableClock struct {
+	now time.Time
+}
+
+func (c *settableClock) Now() time.Time {
+	return c.now
+}
+
+func TestStrictTxTime(t *testing.T) {
+	c := &settableClock{t2}
+	db, err := memory.NewDB(memory.WithClock(c), memory.WithStrictTxTime(), memory.WithVersionedKVs([]*VersionedKV{
+		{Key: "A", Value: "Old", TxTimeStart: t1, TxTimeEnd: &t3, ValidTimeStart: t1},
+	}))
+	require.Nil(t, err)
+
+	// clock precedes the seeded transaction time end
+	assert.ErrorIs(t, db.Set("B", "New"), ErrTxTimeRegressed)
+	assert.NotNil(t, db.Delete("A"))
+
+	c.now = t3
+	require.Nil(t, db.Set("B", "New"))
+	require.Nil(t, db.Set("B", "Newest"), "equal transaction times are allowed")
+
+	c.now = t2
+	assert.NotNil(t, db.Set("B", "Old"))
+	kv, err := db.Get("B", AsOfValidTime(t3), AsOfTransactionTime(t3))
+	require.Nil(t, err)
+	assert.Equal(t, "Newest", kv.Value)
+
+	// the same writes are accepted without the option
+	lax, err := memory.NewDB(memory.WithClock(c), memory.WithVersionedKVs([]*VersionedKV{
+		{Key: "A", Value: "Old", TxTimeStart: t1, TxTimeEnd: &t3, ValidTimeStart: t1},
+	}))
+	require.Nil(t, err)
+	assert.Nil(t, lax.Set("B", "New"))
+}
+
+func TestTxTimePolicy(t *testing.T) {
+	c := &settableClock{t3}
+	db, err := memory.NewDB(memory.WithClock(c), memory.WithTxTimePolicy(TxTimeAdjust))
+	require.Nil(t, err)
+	require.Nil(t, db.Set("A", "Old"))
+
+	// restart from a backup with a skewed clock
+	var buf bytes.Buffer
+	header, err := backup.Backup(&buf, db)
+	require.Nil(t, err)
+	_, kvs, err := backup.RestoreAll(&buf)
+	require.Nil(t, err)
+	c.now = t2
+	restored, err := memory.NewDB(memory.WithClock(c), memory.WithTxTimePolicy(TxTimeAdjust),
+		memory.WithVersionedKVs(kvs), memory.WithLastTxTime(*header.UntilTxTime))
+	require.Nil(t, err)
+
+	require.Nil(t, restored.Set("B", "New"))
+	kv, err := restored.Get("B", AsOfValidTime(t3), AsOfTransactionTime(t3))
+	require.Nil(t, err)
+	assert.Equal(t, t3, kv.TxTimeStart, "transaction time is adjusted")
+	assert.Equal(t, t3, kv.ValidTimeStart, "defaulted valid time is adjusted")
+	require.Nil(t, restored.Set("B", "Newest", WithValidTime(t1)))
+	vs, err := restored.History("B")
+	require.Nil(t, err)
+	for _, v := range vs {
+		assert.False(t, v.TxTimeStart.Before(t3))
+	}
+
+	// the last transaction time is respected without any versions
+	empty, err := memory.NewDB(memory.WithClock(c), memory.WithTxTimePolicy(TxTimeReject), memory.WithLastTxTime(t3))
+	require.Nil(t, err)
+	require.ErrorIs(t, empty.Delete("A"), ErrTxTimeRegressed)
+}
+
+func TestOverlapPolicy(t *testing.T) {
+	db, err := memory.NewDB(memory.WithOverlapPolicy(OverlapReject), memory.WithVersionedKVs([]*VersionedKV{
+		{Key: "A", Value: "Old", TxTimeStart: t1, ValidTimeStart: t1},
+	}))
+	require.Nil(t, err)
+	require.ErrorIs(t, db.Set("A", "New"), ErrOverlap)
+	require.Nil(t, db.Set("A", "New", WithOverlapPolicy(OverlapClip)))
+}
+
+func TestNotFoundError(t *testing.T) {
+	db, err := memory.NewDB(memory.WithClock(clock.New(t3)), memory.WithVersionedKVs([]*VersionedKV{
+		{Key: "A", Value: "Old", TxTimeStart: t2, ValidTimeStart: t2},
+	}))
+	require.Nil(t, err)
+
+	_, err = db.Get("A", AsOfValidTime(t1))
+	require.ErrorIs(t, err, ErrNotFound)
+	var notFound *NotFoundError
+	require.ErrorAs(t, err, &notFound)
+	assert.Equal(t, &NotFoundError{Key: "A", ValidTime: t1, TxTime: t3}, notFound)
+	assert.Equal(t, "not found: key=A, valid_time=2022-01-01T00:00:00Z, tx_time=2022-01-03T00:00:00Z", err.Error())
+
+	_, err = db.Get("B")
+	require.ErrorAs(t, err, &notFound)
+	assert.Equal(t, &NotFoundError{Key: "B", ValidTime: t3, TxTime: t3}, notFound)
+
+	_, err = db.History("B")
+	require.ErrorAs(t, err, &notFound)
+	assert.Equal(t, "not found: key=B", err.Error())
+}
+
+func TestSerializableValues(t *testing.T) {
+	db, err := memory.NewDB(memory.WithSerializableValues(JSONCodec))
+	require.Nil(t, err)
+
+	require.Nil(t, db.Set("A", map[string]interface{}{"balance": 100, "owner": "Bob"}))
+	require.Nil(t, db.Set("A", nil))
+	assert.NotNil(t, db.Set("A", make(chan int)))
+	assert.NotNil(t, db.Set("A", func() {}))
+	assert.NotNil(t, db.Set("A", int64(1<<53+1)), "loses precision as a JSON number")
+	require.Nil(t, db.Delete("A"))
+
+	lax, err := memory.NewDB()
+	require.Nil(t, err)
+	assert.Nil(t, lax.Set("A", make(chan int)))
+}
+
+func TestNilValuePolicy(t *testing.T) {
+	kvs := func() []*VersionedKV { // DBs mutate seeded versions
+		return []*VersionedKV{{Key: "A", Value: "Old", TxTimeStart: t1, ValidTimeStart: t1}}
+	}
+
+	db, err := memory.NewDB(memory.WithNilValuePolicy(NilValueAllow), memory.WithVersionedKVs(kvs()))
+	require.Nil(t, err)
+	require.Nil(t, db.Set("A", nil))
+	kv, err := db.Get("A")
+	require.Nil(t, err)
+	assert.Nil(t, kv.Value)
+
+	db, err = memory.NewDB(memory.WithNilValuePolicy(NilValueReject), memory.WithVersionedKVs(kvs()))
+	require.Nil(t, err)
+	require.ErrorIs(t, db.Set("A", nil), ErrNilValue)
+	kv, err = db.Get("A")
+	require.Nil(t, err)
+	assert.Equal(t, "Old", kv.Value)
+
+	db, err = memory.NewDB(memory.WithNilValuePolicy(NilValueDelete), memory.WithVersionedKVs(kvs()))
+	require.Nil(t, err)
+	require.Nil(t, db.Set("A", nil, WithValidTime(t2)))
+	_, err = db.Get("A")
+	require.ErrorIs(t, err, ErrNotFound)
+	kv, err = db.Get("A", AsOfValidTime(t1))
+	require.Nil(t, err)
+	assert.Equal(t, "Old", kv.Value)
+}
+
+// TestCurrentVersionCache compares reads served with the current version cache against a scan of every version.
+func TestCurrentVersionCache(t *testing.T) {
+	for seed := int64(1); seed <= 5; seed++ {
+		kvs := dbtest.Generate(seed, dbtest.WithKeyCount(3), dbtest.WithVersionsPerKey(20),
+			dbtest.WithCorrectionProbability(0.5))
+		c := clock.New(t1.Add(100 * time.Hour))
+		db, err := memory.NewDB(memory.WithClock(c), memory.WithVersionedKVs(kvs))
+		require.Nil(t, err)
+		// writes refresh the cache
+		require.Nil(t, db.Set("key-000", "New"))
+		require.Nil(t, db.Delete("key-001", WithValidTime(t1.Add(10*time.Hour))))
+
+		for vt := t1.Add(-time.Hour); vt.Before(t1.Add(102 * time.Hour)); vt = vt.Add(90 * time.Minute) {
+			for tt := t1.Add(-time.Hour); tt.Before(t1.Add(102 * time.Hour)); tt = tt.Add(90 * time.Minute) {
+				var expected []*VersionedKV
+				for _, key := range []string{"key-000", "key-001", "key-002"} {
+					vs, err := db.History(key)
+					require.Nil(t, err)
+					var visible *VersionedKV
+					for _, v := range vs {
+						if v.VisibleAt(vt, tt) {
+							visible = v
+							expected = append(expected, v)
+						}
+					}
+					got, err := db.Get(key, AsOfValidTime(vt), AsOfTransactionTime(tt))
+					if visible == nil {
+						require.ErrorIs(t, err, ErrNotFound)
+					} else {
+						require.Nil(t, err)
+						require.Equal(t, visible, got)
+					}
+				}
+				got, err := db.List(AsOfValidTime(vt), AsOfTransactionTime(tt))
+				require.Nil(t, err)
+				require.ElementsMatch(t, expected, got, "seed: %v, valid time: %v, tx time: %v", seed, vt, tt)
+			}
+		}
+	}
+}
+
+func TestVersionRepresentation(t *testing.T) {
+	t.Run("times are returned in UTC", func(t *testing.T) {
+		est := time.FixedZone("EST", -5*60*60)
+		db, err := memory.NewDB(memory.WithClock(&settableClock{t2.In(est)}))
+		require.Nil(t, err)
+		require.Nil(t, db.Set("A", "Old", WithValidTime(t1.In(est)), WithEndValidTime(t2.In(est))))
+		kv, err := db.Get("A", AsOfValidTime(t1))
+		require.Nil(t, err)
+		assert.Equal(t, &VersionedKV{Key: "A", Value: "Old", TxTimeStart: t2, ValidTimeStart: t1, ValidTimeEnd: &t2}, kv)
+	})
+	t.Run("returned versions are copies", func(t *testing.T) {
+		db, err := memory.NewDB(memory.WithVersionedKVs([]*VersionedKV{
+			{Key: "A", Value: "Old", TxTimeStart: t1, ValidTimeStart: t1},
+		}))
+		require.Nil(t, err)
+		vs, err := db.History("A")
+		require.Nil(t, err)
+		require.Nil(t, db.Set("A", "New", WithValidTime(t1)))
+		assert.Nil(t, vs[0].TxTimeEnd)
+
+		kv, err := db.Get("A")
+		require.Nil(t, err)
+		kv.ValidTimeStart = t2
+		kv, err = db.Get("A")
+		require.Nil(t, err)
+		assert.Equal(t, t1, kv.ValidTimeStart)
+	})
+	t.Run("times must be representable", func(t *testing.T) {
+		tooEarly := time.Date(1600, 1, 1, 0, 0, 0, 0, time.UTC)
+		_, err := memory.NewDB(memory.WithVersionedKVs([]*VersionedKV{
+			{Key: "A", Value: "Old", TxTimeStart: t1, ValidTimeStart: tooEarly},
+		}))
+		assert.NotNil(t, err)
+
+		db, err := memory.NewDB()
+		require.Nil(t, err)
+		assert.NotNil(t, db.Set("A", "Old", WithValidTime(tooEarly)))
+		require.Nil(t, db.Set("A", "Old"))
+		// reads may be as of any time
+		_, err = db.Get("A", AsOfValidTime(tooEarly))
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = db.Get("A", AsOfValidTime(time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC)))
+		assert.Nil(t, err)
+	})
+}
+
+func TestPoolStats(t *testing.T) {
+	db, err := memory.NewDB()
+	require.Nil(t, err)
+	require.Nil(t, db.Set("A", "Old"))
+	assert.Equal(t, memory.PoolStats{}, db.PoolStats())
+	require.Nil(t, db.Set("A", "New"))
+	require.Nil(t, db.Delete("A"))
+	stats := db.PoolStats()
+	assert.Equal(t, uint64(2), stats.Gets)
+	assert.GreaterOrEqual(t, stats.News, uint64(1))
+	assert.LessOrEqual(t, stats.News, stats.Gets)
+	assert.Zero(t, stats.Discards)
+
+	db, err = memory.NewDB(memory.WithMaxPooledWriteBuffer(0))
+	require.Nil(t, err)
+	require.Nil(t, db.Set("A", "Old"))
+	require.Nil(t, db.Set("A", "New"))
+	assert.Equal(t, memory.PoolStats{Gets: 1, News: 1, Discards: 1}, db.PoolStats())
+}
+
+func TestSharedViews(t *testing.T) {
+	db, err := memory.NewDB(memory.WithSharedViews(), memory.WithVersionedKVs([]*VersionedKV{
+		{Key: "A", Value: "Old", TxTimeStart: t1, ValidTimeStart: t1},
+	}))
+	require.Nil(t, err)
+	kv, err := db.Get("A")
+	require.Nil(t, err)
+	kv2, err := db.Get("A")
+	require.Nil(t, err)
+	assert.Same(t, kv, kv2)
+	vs, err := db.List()
+	require.Nil(t, err)
+	assert.Same(t, kv, vs[0])
+
+	// writes replace views rather than modifying them
+	require.Nil(t, db.Set("A", "New", WithValidTime(t2)))
+	assert.Nil(t, kv.TxTimeEnd)
+	vs, err = db.History("A")
+	require.Nil(t, err)
+	require.Len(t, vs, 3)
+	assert.NotNil(t, vs[2].TxTimeEnd) // the replaced version is ordered last
+	assert.NotSame(t, kv, vs[2])
+	require.Nil(t, dbtest.CheckInvariants(db, []string{"A"}))
+}
+
+func TestLockFreeReads(t *testing.T) {
+	c := &settableClock{t2}
+	db, err := memory.NewDB(memory.WithLockFreeReads(), memory.WithClock(c), memory.WithVersionedKVs([]*VersionedKV{
+		{Key: "A", Value: "Old", TxTimeStart: t1, ValidTimeStart: t1},
+		{Key: "B", Value: "Old", TxTimeStart: t1, ValidTimeStart: t1, ValidTimeEnd: &t2},
+	}))
+	require.Nil(t, err)
+
+	kv, err := db.Get("A")
+	require.Nil(t, err)
+	assert.Equal(t, "Old", kv.Value)
+	_, err = db.Get("B")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = db.Get("C")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// writes are visible
+	c.now = t3
+	require.Nil(t, db.Set("A", "New"))
+	require.Nil(t, db.Set("C", "New"))
+	kv, err = db.Get("A")
+	require.Nil(t, err)
+	assert.Equal(t, "New", kv.Value)
+	kv, err = db.Get("C")
+	require.Nil(t, err)
+	assert.Equal(t, "New", kv.Value)
+	require.Nil(t, db.Delete("C"))
+	_, err = db.Get("C")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// falls back to locked reads if the clock precedes the current version
+	c.now = t2
+	kv, err = db.Get("A")
+	require.Nil(t, err)
+	assert.Equal(t, "Old", kv.Value)
+
+	// Get does not wait for a pending writer, which blocks other readers
+	c.now = t3
+	require.Nil(t, db.ListFunc(func(*VersionedKV) bool {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_ = db.Set("A", "Newest")
+		}()
+		time.Sleep(10 * time.Millisecond)
+		kv, err := db.Get("A")
+		require.Nil(t, err)
+		assert.Equal(t, "New", kv.Value)
+		t.Cleanup(func() { <-done })
+		return false
+	}))
+}
+
+func TestBranch(t *testing.T) {
+	c := &settableClock{t3}
+	db, err := memory.NewDB(memory.WithClock(c), memory.WithVersionedKVs([]*VersionedKV{
+		{Key: "A", Value: "Old", TxTimeStart: t1, ValidTimeStart: t1},
+		{Key: "B", Value: "Old", TxTimeStart: t1, ValidTimeStart: t1},
+	}))
+	require.Nil(t, err)
+	branch := db.Branch("what-if-1")
+	assert.Equal(t, "what-if-1", branch.Name())
+	assert.Same(t, branch, db.Branch("what-if-1"))
+	assert.NotSame(t, branch, db.Branch("what-if-2"))
+
+	// hypothetical writes are read from the branch
+	require.Nil(t, branch.Set("A", "New", WithValidTime(t3)))
+	require.Nil(t, branch.Delete("B"))
+	require.Nil(t, branch.Set("C", "New"))
+	kv, err := branch.Get("A", AsOfValidTime(t3))
+	require.Nil(t, err)
+	assert.Equal(t, "New", kv.Value)
+	kv, err = branch.Get("A", AsOfValidTime(t2))
+	require.Nil(t, err)
+	assert.Equal(t, "Old", kv.Value)
+	_, err = branch.Get("B")
+	assert.ErrorIs(t, err, ErrNotFound)
+	kv, err = branch.Get("B", AsOfTransactionTime(t1))
+	require.Nil(t, err)
+	assert.Equal(t, "Old", kv.Value)
+	vs, err := branch.History("A")
+	require.Nil(t, err)
+	assert.Len(t, vs, 3)
+	keys, err := branch.Keys()
+	require.Nil(t, err)
+	assert.Equal(t, []string{"A", "B", "C"}, keys)
+	require.Nil(t, dbtest.CheckInvariants(branch, keys))
+
+	// the base DB is unchanged
+	kv, err = db.Get("A", AsOfValidTime(t3))
+	require.Nil(t, err)
+	assert.Equal(t, "Old", kv.Value)
+	_, err = db.Get("C")
+	assert.ErrorIs(t, err, ErrNotFound)
+	vs, err = db.History("A")
+	require.Nil(t, err)
+	assert.Len(t, vs, 1)
+
+	// unwritten keys resolve to the base DB
+	c.now = t4
+	require.Nil(t, db.Set("D", "New"))
+	require.Nil(t, db.Set("A", "Base"))
+	kvs, err := branch.List()
+	require.Nil(t, err)
+	values := map[string]Value{}
+	for _, kv := range kvs {
+		values[kv.Key] = kv.Value
+	}
+	assert.Equal(t, map[string]Value{"A": "New", "C": "New", "D": "New"}, values)
+}
+
+func TestDecisionTime(t *testing.T) {
+	c := &settableClock{t2}
+	db, err := memory.NewDB(memory.WithClock(c), memory.WithVersionedKVs([]*VersionedKV{
+		{Key: "A", Value: "Old", TxTimeStart: t1, ValidTimeStart: t1},
+	}))
+	require.Nil(t, err)
+
+	// decided at t1 but recorded at t2
+	require.Nil(t, db.Set("A", "New", WithDecisionTime(t1), WithValidTime(t2)))
+	kv, err := db.Get("A")
+	require.Nil(t, err)
+	assert.Equal(t, "New", kv.Value)
+	require.NotNil(t, kv.DecisionTime)
+	assert.Equal(t, t1, *kv.DecisionTime)
+	kv, err = db.Get("A", AsOfDecisionTime(t1))
+	require.Nil(t, err)
+	assert.Equal(t, "New", kv.Value)
+
+	// versions without a decision time were decided when recorded
+	c.now = t3
+	require.Nil(t, db.Set("A", "Newest"))
+	_, err = db.Get("A", AsOfDecisionTime(t2))
+	assert.ErrorIs(t, err, ErrNotFound)
+	kvs, err := db.List(AsOfDecisionTime(t2))
+	require.Nil(t, err)
+	assert.Empty(t, kvs)
+	kv, err = db.Get("A", AsOfDecisionTime(t3))
+	require.Nil(t, err)
+	assert.Equal(t, "Newest", kv.Value)
+
+	// overhangs retain their decision time
+	vs, err := db.History("A")
+	require.Nil(t, err)
+	for _, v := range vs {
+		if v.Value == "New" {
+			require.NotNil(t, v.DecisionTime)
+			assert.Equal(t, t1, *v.DecisionTime)
+		}
+	}
+
+	err = db.Set("A", "Newest", WithDecisionTime(t4))
+	assert.NotNil(t, err)
+	_, err = memory.NewDB(memory.WithVersionedKVs([]*VersionedKV{
+		{Key: "A", Value: "Old", TxTimeStart: t1, ValidTimeStart: t1, DecisionTime: &t2},
+	}))
+	assert.NotNil(t, err)
+}
+
+func TestHistoryLimit(t *testing.T) {
+	t.Run("reject", func(t *testing.T) {
+		c := clock.New(t1)
+		require.Nil(t, c.AutoAdvance(time.Minute))
+		db, err := memory.NewDB(memory.WithClock(c), memory.WithHistoryLimit(3, HistoryLimitReject))
+		require.Nil(t, err)
+		require.Nil(t, db.Set("A", "Old"))
+		// closes Old and re-asserts it before New
+		require.Nil(t, db.Set("A", "New"))
+		err = db.Set("A", "Newest")
+		assert.ErrorIs(t, err, ErrHistoryLimit)
+		vs, err := db.History("A")
+		require.Nil(t, err)
+		assert.Len(t, vs, 3)
+		require.Nil(t, db.Set("B", "Old"))
+	})
+	t.Run("compact", func(t *testing.T) {
+		c := clock.New(t1)
+		require.Nil(t, c.AutoAdvance(time.Minute))
+		db, err := memory.NewDB(memory.WithClock(c), memory.WithHistoryLimit(3, HistoryLimitCompact))
+		require.Nil(t, err)
+		for i := 0; i < 10; i++ {
+			require.Nil(t, db.Set("A", i, WithValidTime(t1)))
+		}
+		vs, err := db.History("A")
+		require.Nil(t, err)
+		require.Len(t, vs, 3)
+		// the latest versions are kept
+		for i, v := range vs {
+			assert.Equal(t, 9-i, v.Value)
+		}
+		require.Nil(t, dbtest.CheckInvariants(db, []string{"A"}))
+	})
+	t.Run("current versions are not compacted", func(t *testing.T) {
+		c := clock.New(t2)
+		require.Nil(t, c.AutoAdvance(time.Minute))
+		db, err := memory.NewDB(memory.WithClock(c), memory.WithHistoryLimit(1, HistoryLimitCompact))
+		require.Nil(t, err)
+		require.Nil(t, db.Set("A", "Old", WithValidTime(t1)))
+		require.Nil(t, db.Set("A", "New", WithValidTime(t1), WithEndValidTime(tt.Day(1).Add(time.Hour))))
+		vs, err := db.History("A")
+		require.Nil(t, err)
+		assert.Len(t, vs, 2)
+		kv, err := db.Get("A")
+		require.Nil(t, err)
+		assert.Equal(t, "Old", kv.Value)
+	})
+	_, err := memory.NewDB(memory.WithHistoryLimit(-1, HistoryLimitReject))
+	assert.NotNil(t, err)
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	c := clock.New(t1)
+	require.Nil(t, c.AutoAdvance(time.Minute))
+	db, err := memory.NewDB(memory.WithClock(c), memory.WithIdempotencyWindow(2))
+	require.Nil(t, err)
+
+	// retries are no-ops
+	require.Nil(t, db.Set("A", "Old", WithIdempotencyKey("1")))
+	require.Nil(t, db.Set("A", "Old", WithIdempotencyKey("1")))
+	vs, err := db.History("A")
+	require.Nil(t, err)
+	assert.Len(t, vs, 1)
+	require.Nil(t, db.Delete("A", WithIdempotencyKey("1")))
+	_, err = db.Get("A")
+	require.Nil(t, err)
+
+	// failed writes are not remembered
+	require.NotNil(t, db.Set("A", "New", WithValidTime(t4), WithIdempotencyKey("2")))
+	require.Nil(t, db.Set("A", "New", WithIdempotencyKey("2")))
+	kv, err := db.Get("A")
+	require.Nil(t, err)
+	assert.Equal(t, "New", kv.Value)
+
+	// only the last keys in the window are remembered
+	require.Nil(t, db.Set("B", "Old", WithIdempotencyKey("3")))
+	require.Nil(t, db.Set("A", "Newest", WithIdempotencyKey("1")))
+	kv, err = db.Get("A")
+	require.Nil(t, err)
+	assert.Equal(t, "Newest", kv.Value)
+	require.Nil(t, db.Set("B", "New", WithIdempotencyKey("3")))
+	kv, err = db.Get("B")
+	require.Nil(t, err)
+	assert.Equal(t, "Old", kv.Value)
+}
+
+func TestGetMulti(t *testing.T) {
+	db, err := memory.NewDB(memory.WithVersionedKVs([]*VersionedKV{
+		{Key: "A", Value: "Old", TxTimeStart: t1, TxTimeEnd: &t2, ValidTimeStart: t1},
+		{Key: "A", Value: "New", TxTimeStart: t2, ValidTimeStart: t1},
+		{Key: "B", Value: "Old", TxTimeStart: t1, ValidTimeStart: t1, ValidTimeEnd: &t2},
+	}))
+	require.Nil(t, err)
+
+	kvs, err := db.GetMulti([]string{"B", "C", "A"})
+	require.Nil(t, err)
+	require.Len(t, kvs, 3)
+	assert.Nil(t, kvs[0])
+	assert.Nil(t, kvs[1])
+	assert.Equal(t, "New", kvs[2].Value)
+	kvs, err = db.GetMulti([]string{"B", "C", "A"}, AsOfValidTime(t1), AsOfTransactionTime(t1))
+	require.Nil(t, err)
+	assert.Equal(t, "Old", kvs[0].Value)
+	assert.Nil(t, kvs[1])
+	assert.Equal(t, "Old", kvs[2].Value)
+
+	// DBs that are not MultiGetters are read with Get
+	fallback, err := GetMulti(struct{ DB }{db}, []string{"B", "C", "A"}, AsOfValidTime(t1), AsOfTransactionTime(t1))
+	require.Nil(t, err)
+	assert.Equal(t, kvs, fallback)
+}
+
+func TestChangedKeys(t *testing.T) {
+	db, err := memory.NewDB(memory.WithVersionedKVs([]*VersionedKV{
+		{Key: "A", Value: "Old", TxTimeStart: t1, TxTimeEnd: &t2, ValidTimeStart: t1},
+		{Key: "A", Value: "New", TxTimeStart: t2, ValidTimeStart: t1},
+		{Key: "B", Value: "Old", TxTimeStart: t1, ValidTimeStart: t1},
+		{Key: "C", Value: "Old", TxTimeStart: t1, TxTimeEnd: &t3, ValidTimeStart: t1},
+	}))
+	require.Nil(t, err)
+
+	for _, since := range []time.Time{t0, t1, t2, t3} {
+		keys, err := db.ChangedKeys(since)
+		require.Nil(t, err)
+		// DBs that are not ChangeListers are read through their histories
+		fallback, err := ChangedKeys(struct {
+			DB
+			KeyLister
+		}{db, db}, since)
+		require.Nil(t, err)
+		assert.Equal(t, keys, fallback)
+	}
+	keys, err := db.ChangedKeys(t1)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"A", "C"}, keys)
+	keys, err = db.ChangedKeys(t0)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"A", "B", "C"}, keys)
+}
+
+func TestSkipUnchanged(t *testing.T) {
+	c := clock.New(t3)
+	require.Nil(t, c.AutoAdvance(time.Minute))
+	db, err := memory.NewDB(memory.WithClock(c), memory.WithSkipUnchanged(nil), memory.WithVersionedKVs([]*VersionedKV{
+		{Key: "A", Value: "Old", TxTimeStart: t1, ValidTimeStart: t1, ValidTimeEnd: &t2},
+		{Key: "A", Value: "Old", TxTimeStart: t1, ValidTimeStart: t2},
+		{Key: "B", Value: "Old", TxTimeStart: t1, ValidTimeStart: t2},
+	}))
+	require.Nil(t, err)
+	expectVersions := func(key string, n int) {
+		t.Helper()
+		vs, err := db.History(key)
+		require.Nil(t, err)
+		assert.Len(t, vs, n)
+	}
+
+	// equal over the whole valid time range, across versions
+	require.Nil(t, db.Set("A", "Old", WithValidTime(t1)))
+	require.Nil(t, db.Set("A", "Old", WithValidTime(t1), WithEndValidTime(t3)))
+	require.Nil(t, db.Set("A", "Old"))
+	expectVersions("A", 2)
+	// not covered
+	require.Nil(t, db.Set("B", "Old", WithValidTime(t1)))
+	expectVersions("B", 2)
+	// not equal
+	require.Nil(t, db.Set("A", "New", WithValidTime(t2)))
+	expectVersions("A", 3)
+
+	// custom comparator
+	db, err = memory.NewDB(memory.WithClock(c), memory.WithSkipUnchanged(func(a, b Value) bool {
+		return fmt.Sprint(a) == fmt.Sprint(b)
+	}))
+	require.Nil(t, err)
+	require.Nil(t, db.Set("A", 1))
+	require.Nil(t, db.Set("A", "1"))
+	kv, err := db.Get("A")
+	require.Nil(t, err)
+	assert.Equal(t, 1, kv.Value)
+}
+
+func TestPreWriteHook(t *testing.T) {
+	var calls []string
+	nonNegative := func(key string, value Value, times memory.WriteTimes) error {
+		calls = append(calls, "nonNegative")
+		if n, ok := value.(int); ok && n < 0 {
+			return fmt.Errorf("balance of %v cannot be negative", key)
+		}
+		return nil
+	}
+	var seen []memory.WriteTimes
+	record := func(key string, value Value, times memory.WriteTimes) error {
+		calls = append(calls, "record")
+		seen = append(seen, times)
+		return nil
+	}
+	c := clock.New(t3)
+	db, err := memory.NewDB(memory.WithClock(c), memory.WithPreWriteHook(nonNegative), memory.WithPreWriteHook(record))
+	require.Nil(t, err)
+
+	require.Nil(t, db.Set("A", 10, WithValidTime(t1), WithEndValidTime(t2)))
+	assert.Equal(t, []string{"nonNegative", "record"}, calls)
+	require.Len(t, seen, 1)
+	assert.Equal(t, memory.WriteTimes{TxTime: t3, ValidTime: t1, EndValidTime: &t2}, seen[0])
+
+	// a rejected write has no effect and stops later hooks
+	calls = nil
+	require.NotNil(t, db.Set("A", -5, WithValidTime(t1)))
+	assert.Equal(t, []string{"nonNegative"}, calls)
+	vs, err := db.History("A")
+	require.Nil(t, err)
+	assert.Len(t, vs, 1)
+
+	// deleting a key that does not exist is a no-op
+	calls = nil
+	require.Nil(t, db.Delete("B"))
+	assert.Empty(t, calls)
+
+	require.Nil(t, db.Delete("A", WithAllValidTime()))
+	require.Len(t, seen, 2)
+	assert.Equal(t, memory.WriteTimes{TxTime: t3, AllValidTime: true, Delete: true}, seen[1])
+}
+
+func TestPostWriteHook(t *testing.T) {
+	t.Run("hooks receive write results", func(t *testing.T) {
+		var calls []string
+		var results []*WriteResult
+		var db *memory.DB
+		hook := func(key string, result *WriteResult) {
+			// hooks may read the DB
+			_, err := db.Get(key)
+			calls = append(calls, fmt.Sprintf("%v found=%v", key, err == nil))
+			results = append(results, result)
+		}
+		c := clock.New(t1)
+		var err error
+		db, err = memory.NewDB(memory.WithClock(c), memory.WithPostWriteHook(hook))
+		require.Nil(t, err)
+		feed := changefeed.NewDB(db)
+		feed.Subscribe(func(e changefeed.Event) {
+			calls = append(calls, "event "+e.Key)
+		})
+
+		require.Nil(t, feed.Set("A", "Old"))
+		require.Nil(t, c.SetNow(t2))
+		require.Nil(t, feed.Delete("A"))
+		require.Nil(t, feed.Delete("B")) // no-op
+		require.NotNil(t, feed.Set("", "Old"))
+		assert.Equal(t, []string{"A found=true", "event A", "A found=false", "event A"}, calls)
+		require.Len(t, results, 2)
+		assert.Equal(t, "Old", results[0].Created.Value)
+		assert.True(t, results[1].TxTime.Equal(t2))
+		assert.Len(t, results[1].Closed, 1)
+	})
+	t.Run("hooks are called in commit order", func(t *testing.T) {
+		var txTimes []time.Time
+		db, err := memory.NewDB(memory.WithPostWriteHook(func(key string, result *WriteResult) {
+			txTimes = append(txTimes, result.TxTime)
+		}))
+		require.Nil(t, err)
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				assert.Nil(t, db.Set(fmt.Sprint(i%3), i))
+			}(i)
+		}
+		wg.Wait()
+		require.Len(t, txTimes, 20)
+		for i := 1; i < len(txTimes); i++ {
+			assert.False(t, txTimes[i].Before(txTimes[i-1]))
+		}
+	})
+	t.Run("hooks may read the DB during concurrent writes", func(t *testing.T) {
+		var db *memory.DB
+		var reads int64
+		var wg sync.WaitGroup
+		var once sync.Once
+		db, err := memory.NewDB(memory.WithPostWriteHook(func(key string, result *WriteResult) {
+			once.Do(func() {
+				// let another write commit and wait for its hooks before this hook reads
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					assert.Nil(t, db.Set("B", 0))
+				}()
+				time.Sleep(10 * time.Millisecond)
+			})
+			_, err := db.Get(key)
+			assert.Nil(t, err)
+			atomic.AddInt64(&reads, 1)
+		}))
+		require.Nil(t, err)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			require.Nil(t, db.Set("A", 0))
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					for j := 0; j < 50; j++ {
+						if j%10 == 0 {
+							b := &WriteBatch{}
+							b.Set(fmt.Sprint(i), j)
+							b.Set("shared", j)
+							assert.Nil(t, db.WriteBatch(b))
+							continue
+						}
+						assert.Nil(t, db.Set(fmt.Sprint(i%3), j))
+					}
+				}(i)
+			}
+			wg.Wait()
+		}()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatal("writes with hooks that read the DB did not return")
+		}
+		assert.Equal(t, int64(2+8*(45+2*5)), atomic.LoadInt64(&reads))
+	})
+}
+
+func TestImport(t *testing.T) {
+	db, err := memory.NewDB(memory.WithClock(clock.New(t2)), memory.WithTxTimePolicy(TxTimeReject),
+		memory.WithVersionedKVs([]*VersionedKV{
+			{Key: "A", Value: "Old", TxTimeStart: t1, ValidTimeStart: t1},
+		}))
+	require.Nil(t, err)
+
+	// overlapping versions are rejected without importing any
+	err = db.Import([]*VersionedKV{
+		{Key: "B", Value: "Old", TxTimeStart: t1, ValidTimeStart: t1},
+		{Key: "A", Value: "New", TxTimeStart: t2, ValidTimeStart: t1},
+	})
+	require.NotNil(t, err)
+	_, err = db.History("B")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.Nil(t, db.Import([]*VersionedKV{
+		{Key: "B", Value: "Old", TxTimeStart: t1, TxTimeEnd: &t3, ValidTimeStart: t1},
+		{Key: "B", Value: "New", TxTimeStart: t3, ValidTimeStart: t1},
+	}))
+	kv, err := db.Get("B", AsOfTransactionTime(t3))
+	require.Nil(t, err)
+	assert.Equal(t, "New", kv.Value)
+	kv, err = db.Get("B", AsOfTransactionTime(t2))
+	require.Nil(t, err)
+	assert.Equal(t, "Old", kv.Value)
+	// imported transaction times are observed
+	require.ErrorIs(t, db.Set("C", "Old"), ErrTxTimeRegressed)
+}
+
+func TestBulkLoad(t *testing.T) {
+	db, err := memory.NewDB(memory.WithClock(clock.New(t2)), memory.WithTxTimePolicy(TxTimeReject),
+		memory.WithVersionedKVs([]*VersionedKV{
+			{Key: "A", Value: "Old", TxTimeStart: t1, ValidTimeStart: t1},
+		}))
+	require.Nil(t, err)
+
+	t.Run("overlap is checked on commit", func(t *testing.T) {
+		l := db.BulkLoad()
+		require.Nil(t, l.Add(&VersionedKV{Key: "B", Value: "Old", TxTimeStart: t1, ValidTimeStart: t1}))
+		// overlaps a version added much earlier in the load
+		var kvs []*VersionedKV
+		for i := 0; i < 100; i++ {
+			start, end := t1.Add(time.Duration(i)*time.Hour), t1.Add(time.Duration(i+1)*time.Hour)
+			kvs = append(kvs, &VersionedKV{Key: "C", Value: i, TxTimeStart: start, TxTimeEnd: &end, ValidTimeStart: t1})
+		}
+		require.Nil(t, l.Add(kvs...))
+		require.Nil(t, l.Add(&VersionedKV{Key: "B", Value: "New", TxTimeStart: t3, ValidTimeStart: t2}))
+		assert.Equal(t, 102, l.Len())
+		require.NotNil(t, l.Commit())
+		for _, key := range []string{"B", "C"} {
+			_, err = db.History(key)
+			require.ErrorIs(t, err, ErrNotFound)
+		}
+		require.NotNil(t, l.Add(&VersionedKV{Key: "D", Value: "Old", TxTimeStart: t1, ValidTimeStart: t1}))
+	})
+	t.Run("overlap with stored versions", func(t *testing.T) {
+		l := db.BulkLoad()
+		require.Nil(t, l.Add(&VersionedKV{Key: "A", Value: "New", TxTimeStart: t2, ValidTimeStart: t1}))
+		require.NotNil(t, l.Commit())
+	})
+	t.Run("invalid versions are not staged", func(t *testing.T) {
+		l := db.BulkLoad()
+		require.NotNil(t, l.Add(
+			&VersionedKV{Key: "B", Value: "Old", TxTimeStart: t1, ValidTimeStart: t1},
+			&VersionedKV{Key: "B", Value: "Old", TxTimeStart: t1},
+		))
+		assert.Equal(t, 0, l.Len())
+	})
+	t.Run("discard", func(t *testing.T) {
+		l := db.BulkLoad()
+		require.Nil(t, l.Add(&VersionedKV{Key: "B", Value: "Old", TxTimeStart: t1, ValidTimeStart: t1}))
+		l.Discard()
+		require.NotNil(t, l.Commit())
+		_, err = db.History("B")
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+	t.Run("commit", func(t *testing.T) {
+		l := db.BulkLoad()
+		// a long history of corrections
+		const n = 10000
+		for i := 0; i < n; i++ {
+			start := t1.Add(time.Duration(i) * time.Minute)
+			kv := &VersionedKV{Key: "B", Value: i, TxTimeStart: start, ValidTimeStart: t1}
+			if i < n-1 {
+				end := start.Add(time.Minute)
+				kv.TxTimeEnd = &end
+			}
+			require.Nil(t, l.Add(kv))
+		}
+		require.Nil(t, l.Add(&VersionedKV{Key: "A", Value: "Older", TxTimeStart: t0, TxTimeEnd: &t1, ValidTimeStart: t0}))
+		_, err = db.History("B")
+		require.ErrorIs(t, err, ErrNotFound, "staged versions are not visible")
+
+		require.Nil(t, l.Commit())
+		kv, err := db.Get("B", AsOfTransactionTime(t1.Add(n*time.Minute)))
+		require.Nil(t, err)
+		assert.Equal(t, n-1, kv.Value)
+		kv, err = db.Get("A", AsOfValidTime(t0), AsOfTransactionTime(t0))
+		require.Nil(t, err)
+		assert.Equal(t, "Older", kv.Value)
+		// invariant checks of "B" are quadratic
+		require.Nil(t, dbtest.CheckInvariants(db, []string{"A"}))
+		// committed transaction times are observed
+		require.ErrorIs(t, db.Set("D", "Old"), ErrTxTimeRegressed)
+	})
+}
+
+func TestWriteBatch(t *testing.T) {
+	var results []string
+	rejectNegative := func(key string, value Value, times memory.WriteTimes) error {
+		if n, ok := value.(int); ok && n < 0 {
+			return fmt.Errorf("balance of %v cannot be negative", key)
+		}
+		return nil
+	}
+	db, err := memory.NewDB(memory.WithClock(clock.New(t1)), memory.WithLockFreeReads(), memory.WithIdempotencyWindow(10),
+		memory.WithPreWriteHook(rejectNegative),
+		memory.WithPostWriteHook(func(key string, result *WriteResult) {
+			results = append(results, fmt.Sprintf("%v %v", key, result.Created != nil))
+		}))
+	require.Nil(t, err)
+	require.Nil(t, db.Set("A", 10))
+
+	t.Run("rejected write rolls back the batch", func(t *testing.T) {
+		results = nil
+		b := &WriteBatch{}
+		b.Set("A", 5)
+		b.Set("B", 5)
+		b.Set("C", -5)
+		err := db.WriteBatch(b)
+		require.NotNil(t, err)
+		assert.Contains(t, err.Error(), "cannot be negative")
+		assert.Empty(t, results)
+		kv, err := db.Get("A")
+		require.Nil(t, err)
+		assert.Equal(t, 10, kv.Value)
+		vs, err := db.History("A")
+		require.Nil(t, err)
+		assert.Len(t, vs, 1)
+		_, err = db.History("B")
+		require.ErrorIs(t, err, ErrNotFound)
+		_, err = db.History("C")
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+	t.Run("post-write hooks are called after the batch", func(t *testing.T) {
+		results = nil
+		b := &WriteBatch{}
+		b.Set("A", 5, WithIdempotencyKey("transfer"))
+		b.Set("C", 0, WithIdempotencyKey("transfer")) // skipped
+		b.Delete("Z")                                 // no-op
+		b.Set("B", 5)
+		require.Nil(t, db.WriteBatch(b))
+		assert.Equal(t, []string{"A true", "B true"}, results)
+		kv, err := db.Get("A")
+		require.Nil(t, err)
+		assert.Equal(t, 5, kv.Value)
+		_, err = db.Get("C")
+		require.ErrorIs(t, err, ErrNotFound)
+
+		// the idempotency key is remembered
+		require.Nil(t, db.Set("A", 0, WithIdempotencyKey("transfer")))
+		kv, err = db.Get("A")
+		require.Nil(t, err)
+		assert.Equal(t, 5, kv.Value)
+	})
+	violations, err := Check(db)
+	require.Nil(t, err)
+	assert.Empty(t, violations)
+}
+
+func TestWatch(t *testing.T) {
+	c := clock.New(t1)
+	db, err := memory.NewDB(memory.WithClock(c))
+	require.Nil(t, err)
+	a, cancelA := db.Watch("A")
+	defer cancelA()
+	all, cancelAll := db.Watch("", WatchPrefix())
+
+	require.Nil(t, db.Set("A", "Old"))
+	require.Nil(t, db.Set("B", "Old"))
+	require.Nil(t, c.SetNow(t2))
+	require.Nil(t, db.Delete("A", WithValidTime(t1), WithEndValidTime(t2)))
+	require.Nil(t, db.Delete("C")) // no-op
+	b := &WriteBatch{}
+	b.Set("A", "New")
+	b.Set("C", "New")
+	require.Nil(t, db.WriteBatch(b))
+
+	e := <-a
+	assert.Equal(t, "A", e.Key)
+	assert.Equal(t, ChangeOpSet, e.Op)
+	assert.True(t, e.TxTime.Equal(t1))
+	require.Len(t, e.Created, 1)
+	assert.Equal(t, "Old", e.Created[0].Value)
+	assert.Empty(t, e.Closed)
+	e = <-a
+	assert.Equal(t, ChangeOpDelete, e.Op)
+	assert.True(t, e.TxTime.Equal(t2))
+	require.Len(t, e.Closed, 1)
+	require.Len(t, e.Created, 1, "overhang")
+	assert.True(t, e.Created[0].ValidTimeStart.Equal(t2))
+	e = <-a
+	assert.Equal(t, ChangeOpSet, e.Op)
+	assert.Equal(t, "New", e.Created[0].Value)
+
+	var keys []string
+	for i := 0; i < 5; i++ {
+		keys = append(keys, (<-all).Key)
+	}
+	assert.Equal(t, []string{"A", "B", "A", "A", "C"}, keys)
+	cancelAll()
+	cancelAll()
+	_, ok := <-all
+	assert.False(t, ok, "channel is closed")
+
+	// writes do not wait on receivers
+	for i := 0; i < 100; i++ {
+		require.Nil(t, db.Set("A", i))
+	}
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, i, (<-a).Created[0].Value)
+	}
+}
+
+func TestWithFutureValidTimes(t *testing.T) {
+	c := clock.New(t2)
+	db, err := memory.NewDB(memory.WithClock(c), memory.WithFutureValidTimes())
+	require.Nil(t, err)
+
+	require.Nil(t, db.Set("A", "Old", WithValidTime(t1)))
+	require.Nil(t, db.Set("A", "New", WithValidTime(t3)))
+	kv, err := db.Get("A")
+	require.Nil(t, err)
+	assert.Equal(t, "Old", kv.Value)
+	kv, err = db.Get("A", AsOfValidTime(t3))
+	require.Nil(t, err)
+	assert.Equal(t, "New", kv.Value)
+
+	// branches inherit the option
+	branch := db.Branch("x")
+	require.Nil(t, branch.Set("B", "New", WithValidTime(t3)))
+	_, err = branch.Get("B")
+	assert.ErrorIs(t, err, ErrNotFound)
+	kv, err = branch.Get("B", AsOfValidTime(t3))
+	require.Nil(t, err)
+	assert.Equal(t, "New", kv.Value)
+
+	require.Nil(t, c.SetNow(t4))
+	kv, err = db.Get("A")
+	require.Nil(t, err)
+	assert.Equal(t, "New", kv.Value)
+	require.Nil(t, dbtest.CheckInvariants(db, []string{"A"}))
+}
+
+func TestReadTxConcurrentWrites(t *testing.T) {
+	c := clock.New(t2)
+	require.Nil(t, c.AutoAdvance(time.Nanosecond))
+	db, err := memory.NewDB(memory.WithClock(c))
+	require.Nil(t, err)
+	require.Nil(t, db.Set("A", 0, WithValidTime(t1)))
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer close(done)
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 1; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if err := db.Set("A", w*1000000+i, WithValidTime(t1)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(w)
+	}
+
+	// writes committed after a ReadTx is pinned are not visible to it
+	for i := 0; i < 2000; i++ {
+		tx := db.ReadTx(PinValidTime(t1))
+		first, err := tx.Get("A")
+		require.Nil(t, err)
+		for j := 0; j < 5; j++ {
+			kv, err := tx.Get("A")
+			require.Nil(t, err)
+			require.Equal(t, first.Value, kv.Value, "read %v of tx %v", j, i)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	bt "github.com/elh/bitempura"
+)
+
+// WriteTimes describes the times of a write passed to a PreWriteHook.
+type WriteTimes struct {
+	TxTime       time.Time
+	ValidTime    time.Time  // zero if AllValidTime is set
+	EndValidTime *time.Time // nil if the write's valid time range is open
+	AllValidTime bool       // the write is a Delete with bt.WithAllValidTime
+	Delete       bool       // the write is a Delete. its value is nil
+}
+
+// PreWriteHook is called before a write is applied. If it returns an error, the write fails with it and has no effect.
+// Hooks are called while the DB is locked for writing, so the checks they make are atomic with the write, and they must
+// not call the DB.
+type PreWriteHook func(key string, value bt.Value, times WriteTimes) error
+
+// WithPreWriteHook constructs database that calls hook before every write that is not a no-op, in the order hooks were
+// registered. Hooks enforce application rules, such as a balance never being negative, that a write must satisfy.
+func WithPreWriteHook(hook PreWriteHook) DBOpt {
+	return func(os *dbOptions) {
+		os.preWriteHooks = append(os.preWriteHooks, hook)
+	}
+}
+
+// preWrite calls the pre-write hooks for a write. db.m must be held for writing.
+func (db *DB) preWrite(key string, value bt.Value, isDelete bool, config *writeConfig, now time.Time) error {
+	if len(db.preWriteHooks) == 0 {
+		return nil
+	}
+	times := WriteTimes{
+		TxTime:       now,
+		AllValidTime: config.allValidTime,
+		Delete:       isDelete,
+	}
+	if !config.allValidTime {
+		times.ValidTime = fromNanos(config.validTime.Start)
+	}
+	if config.validTime.HasEnd {
+		end := fromNanos(config.validTime.End)
+		times.EndValidTime = &end
+	}
+	for _, hook := range db.preWriteHooks {
+		if err := hook(key, value, times); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PostWriteHook is called after a write is applied with the versions it affected. It cannot fail the write.
+type PostWriteHook func(key string, result *bt.WriteResult)
+
+// WithPostWriteHook constructs database that calls hook after every write that is not a no-op, in the order hooks were
+// registered, for triggers such as updating caches, enqueueing jobs, or writing audit records.
+//
+// Hooks are called synchronously before the write returns and in the order writes are applied, so a hook sees every
+// write exactly once and in transaction time order. Hooks may read the DB but must not write to it. Hooks are called
+// after the write lock is released, so their reads may see later writes. Because they are called before the write
+// returns, a write's hooks are called before a changefeed.DB wrapping the DB emits its event. Writes to branches do not
+// call hooks.
+func WithPostWriteHook(hook PostWriteHook) DBOpt {
+	return func(os *dbOptions) {
+		os.postWriteHooks = append(os.postWriteHooks, hook)
+	}
+}
+
+// write applies a write with update and then calls the post-write hooks and notifies watches.
+func (db *DB) write(key string, value bt.Value, isDelete bool, result *bt.WriteResult, opts ...bt.WriteOpt) error {
+	// decide once since watches may be canceled during the write
+	notify := db.notifiesWrites()
+	if result == nil && notify {
+		result = &bt.WriteResult{}
+	}
+	ticket, err := db.update(key, value, isDelete, result, notify, opts...)
+	if err != nil {
+		return err
+	}
+	if !notifies(notify, result) {
+		return nil
+	}
+	db.notifyQueue.wait(ticket)
+	defer db.notifyQueue.done()
+	for _, hook := range db.postWriteHooks {
+		hook(key, result)
+	}
+	db.watchers.notify(key, isDelete, result)
+	return nil
+}
+
+// notifyQueue orders the notification of writes by commit without holding the write lock, so post-write hooks may read
+// the DB. A write takes a ticket while holding db.m and, after releasing it, waits until every write with an earlier
+// ticket has been notified.
+type notifyQueue struct {
+	next uint64 // next ticket to take. guarded by db.m
+
+	m       sync.Mutex
+	turn    *sync.Cond // signaled when serving changes
+	serving uint64     // ticket being notified. guarded by m
+}
+
+// take returns the next ticket. db.m must be held for writing. The caller must wait for the ticket and call done.
+func (q *notifyQueue) take() uint64 {
+	ticket := q.next
+	q.next++
+	return ticket
+}
+
+// wait blocks until ticket is served.
+func (q *notifyQueue) wait(ticket uint64) {
+	q.m.Lock()
+	defer q.m.Unlock()
+	for q.serving != ticket {
+		q.cond().Wait()
+	}
+}
+
+// done serves the next ticket.
+func (q *notifyQueue) done() {
+	q.m.Lock()
+	defer q.m.Unlock()
+	q.serving++
+	q.cond().Broadcast()
+}
+
+// cond returns turn, initializing it if needed. q.m must be held.
+func (q *notifyQueue) cond() *sync.Cond {
+	if q.turn == nil {
+		q.turn = sync.NewCond(&q.m)
+	}
+	return q.turn
+}
+
+// notifiesWrites returns whether writes are passed to post-write hooks or watches, so their results are needed.
+func (db *DB) notifiesWrites() bool {
+	return len(db.postWriteHooks) > 0 || db.watchers.active()
+}
+
+// notifies returns whether a successful write with result calls the post-write hooks and notifies watches. No-op writes
+// are not notified.
+func notifies(notify bool, result *bt.WriteResult) bool {
+	return notify && !result.TxTime.IsZero()
+}
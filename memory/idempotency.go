@@ -0,0 +1,33 @@
+package memory
+
+// idempotencyKeys is a set of the most recently added idempotency keys, bounded by window.
+type idempotencyKeys struct {
+	window int
+	keys   map[string]struct{}
+	order  []string // ring buffer of keys in the order added
+	next   int      // index in order of the next key to evict
+}
+
+func newIdempotencyKeys(window int) idempotencyKeys {
+	return idempotencyKeys{window: window, keys: map[string]struct{}{}}
+}
+
+func (s *idempotencyKeys) contains(key string) bool {
+	_, ok := s.keys[key]
+	return ok
+}
+
+// add adds key, evicting the oldest key if the set is full.
+func (s *idempotencyKeys) add(key string) {
+	if s.window == 0 || s.contains(key) {
+		return
+	}
+	if len(s.order) < s.window {
+		s.order = append(s.order, key)
+	} else {
+		delete(s.keys, s.order[s.next])
+		s.order[s.next] = key
+		s.next = (s.next + 1) % s.window
+	}
+	s.keys[key] = struct{}{}
+}
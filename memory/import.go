@@ -0,0 +1,18 @@
+package memory
+
+import (
+	bt "github.com/elh/bitempura"
+)
+
+var _ bt.Importer = (*DB)(nil)
+
+// Import stores versioned key-values as is. It fails without storing any of them if they are invalid or overlap each
+// other or stored versions of the same key in both transaction time and valid time. Transaction times of imported
+// versions are observed like those seeded by WithVersionedKVs. It is a bulk load of kvs. See BulkLoader.
+func (db *DB) Import(kvs []*bt.VersionedKV) error {
+	l := db.BulkLoad()
+	if err := l.Add(kvs...); err != nil {
+		return err
+	}
+	return l.Commit()
+}
@@ -0,0 +1,18 @@
+package memory
+
+import (
+	bt "github.com/elh/bitempura"
+)
+
+// ReadTx returns a read-only view of the DB pinned to the clock's current time as transaction time. See bt.ReadTx.
+//
+// The time is read under the write lock, which writes also hold while reading the clock, so writes committed after the
+// pin have transaction times at or after it as long as the clock does not regress. The pin is observed as an issued
+// transaction time, so with TxTimeReject or TxTimeAdjust, writes are not made before it even if the clock regresses.
+func (db *DB) ReadTx(opts ...bt.ReadTxOpt) *bt.ReadTx {
+	db.m.Lock()
+	defer db.m.Unlock()
+	now := db.clock.Now()
+	db.observeTxTime(now)
+	return bt.NewReadTx(db, now, opts...)
+}
@@ -0,0 +1,141 @@
+package memory
+
+import (
+	"errors"
+	"time"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/interval"
+)
+
+// version is the internal representation of a bt.VersionedKV. Times are stored as unix nanoseconds instead of time.Time
+// and *time.Time so that stored versions hold no pointers other than their value and optional view. An end time is open
+// (nil in a bt.VersionedKV) if its has bit is false. The key is not stored since versions are indexed by key.
+type version struct {
+	value           bt.Value
+	view            *bt.VersionedKV // shared, immutable conversion of the version. only set by WithSharedViews
+	txTimeStart     int64
+	txTimeEnd       int64
+	validTimeStart  int64
+	validTimeEnd    int64
+	decisionTime    int64
+	hasTxTimeEnd    bool
+	hasValidTimeEnd bool
+	hasDecisionTime bool
+}
+
+// checkValidTimeStart returns an error if valid time start t cannot be stored. bt.BeginningOfTime is stored as
+// math.MinInt64, which read valid times before it are clamped to.
+func checkValidTimeStart(t time.Time) error {
+	if t.Equal(bt.BeginningOfTime) {
+		return nil
+	}
+	return interval.CheckTime(t)
+}
+
+func fromNanos(n int64) time.Time {
+	return time.Unix(0, n).UTC()
+}
+
+// newVersion converts a validated VersionedKV whose times are representable.
+func newVersion(kv *bt.VersionedKV) (version, error) {
+	v := version{
+		value:          kv.Value,
+		txTimeStart:    kv.TxTimeStart.UnixNano(),
+		validTimeStart: kv.ValidTimeStart.UnixNano(),
+	}
+	if err := checkValidTimeStart(kv.ValidTimeStart); err != nil {
+		return version{}, err
+	}
+	times := []time.Time{kv.TxTimeStart}
+	if kv.TxTimeEnd != nil {
+		v.txTimeEnd, v.hasTxTimeEnd = kv.TxTimeEnd.UnixNano(), true
+		times = append(times, *kv.TxTimeEnd)
+	}
+	if kv.ValidTimeEnd != nil {
+		v.validTimeEnd, v.hasValidTimeEnd = kv.ValidTimeEnd.UnixNano(), true
+		times = append(times, *kv.ValidTimeEnd)
+	}
+	if kv.DecisionTime != nil {
+		v.decisionTime, v.hasDecisionTime = kv.DecisionTime.UnixNano(), true
+		times = append(times, *kv.DecisionTime)
+	}
+	for _, t := range times {
+		if err := interval.CheckTime(t); err != nil {
+			return version{}, err
+		}
+	}
+	return v, nil
+}
+
+// exportedVersion is a bt.VersionedKV together with storage for its optional times so that converting a version is a single
+// allocation.
+type exportedVersion struct {
+	kv           bt.VersionedKV
+	txTimeEnd    time.Time
+	validTimeEnd time.Time
+	decisionTime time.Time
+}
+
+// toVersionedKV converts the version to a new VersionedKV with UTC times. Callers own the result, so mutating it does
+// not affect the DB.
+func (v *version) toVersionedKV(key string) *bt.VersionedKV {
+	e := &exportedVersion{
+		kv: bt.VersionedKV{
+			Key:            key,
+			Value:          v.value,
+			TxTimeStart:    fromNanos(v.txTimeStart),
+			ValidTimeStart: fromNanos(v.validTimeStart),
+		},
+	}
+	if v.hasTxTimeEnd {
+		e.txTimeEnd = fromNanos(v.txTimeEnd)
+		e.kv.TxTimeEnd = &e.txTimeEnd
+	}
+	if v.hasValidTimeEnd {
+		e.validTimeEnd = fromNanos(v.validTimeEnd)
+		e.kv.ValidTimeEnd = &e.validTimeEnd
+	}
+	if v.hasDecisionTime {
+		e.decisionTime = fromNanos(v.decisionTime)
+		e.kv.DecisionTime = &e.decisionTime
+	}
+	return &e.kv
+}
+
+func (v *version) validate() error {
+	if v.hasTxTimeEnd && v.txTimeStart >= v.txTimeEnd {
+		return errors.New("transaction time start must be before end")
+	}
+	if v.hasValidTimeEnd && v.validTimeStart >= v.validTimeEnd {
+		return errors.New("valid time start must be before end")
+	}
+	return nil
+}
+
+func (v *version) txTimeRange() interval.Interval {
+	return interval.Interval{Start: v.txTimeStart, End: v.txTimeEnd, HasEnd: v.hasTxTimeEnd}
+}
+
+func (v *version) validTimeRange() interval.Interval {
+	return interval.Interval{Start: v.validTimeStart, End: v.validTimeEnd, HasEnd: v.hasValidTimeEnd}
+}
+
+// knownAt returns whether the version is current as of transaction time tt. See bt.VersionedKV.KnownAt.
+func (v *version) knownAt(tt int64) bool {
+	return v.txTimeRange().Contains(tt)
+}
+
+// decidedAt returns whether the version was decided at or before decision time dt. See bt.VersionedKV.DecidedAt.
+func (v *version) decidedAt(dt int64) bool {
+	if v.hasDecisionTime {
+		return v.decisionTime <= dt
+	}
+	return v.txTimeStart <= dt
+}
+
+// visibleAt returns whether the version is read as of valid time vt and transaction time tt. See
+// bt.VersionedKV.VisibleAt.
+func (v *version) visibleAt(vt, tt int64) bool {
+	return v.validTimeRange().Contains(vt) && v.knownAt(tt)
+}
@@ -11,13 +11,14 @@ import (
 
 	"github.com/elh/bitempura"
 	bt "github.com/elh/bitempura"
-	"github.com/elh/bitempura/dbtest"
+	btclock "github.com/elh/bitempura/clock"
 	"github.com/elh/bitempura/memory"
 )
 
 var db bitempura.DB
-var clock *dbtest.TestClock
+var clock *btclock.Clock
 var onChangeFn *js.Value
+var cancelWatch bt.CancelFunc // set if onChangeFn is called by watching the DB
 
 // Init initializes the global Wasm DB. bt_Init must be called before usage.
 // arguments = [withClock: bool]
@@ -41,11 +42,8 @@ func initDB(inputs []js.Value) error {
 
 	var opts []memory.DBOpt
 	if withClock {
-		clock = &dbtest.TestClock{}
 		// initialize now for manually controlled clock
-		if err := clock.SetNow(time.Now().UTC()); err != nil {
-			return err
-		}
+		clock = btclock.New(time.Now().UTC())
 		opts = append(opts, memory.WithClock(clock))
 	}
 
@@ -54,9 +52,18 @@ func initDB(inputs []js.Value) error {
 	if err != nil {
 		return err
 	}
+	watchChanges()
 	return nil
 }
 
+// UseDB sets the global Wasm DB to an already constructed DB. This allows other backends (e.g. sql/wasm) to reuse the
+// adapters in this package. The clock is cleared so bt_SetNow cannot be used.
+func UseDB(d bt.DB) {
+	db = d
+	clock = nil
+	watchChanges()
+}
+
 // Get is the wasm adapter for DB.Get.
 // arguments = key: string, [as_of_valid_time: string (RFC 3339 datetime), as_of_transaction_time: string (RFC 3339 datetime)]
 func Get(this js.Value, inputs []js.Value) interface{} {
@@ -192,9 +199,7 @@ func Set(this js.Value, inputs []js.Value) interface{} {
 		return nil
 	}
 
-	if onChangeFn != nil {
-		onChangeFn.Invoke(key)
-	}
+	notifyChange(key)
 	return nil
 }
 
@@ -267,9 +272,7 @@ func Delete(this js.Value, inputs []js.Value) interface{} {
 		return nil
 	}
 
-	if onChangeFn != nil {
-		onChangeFn.Invoke(key)
-	}
+	notifyChange(key)
 	return nil
 }
 
@@ -358,7 +361,8 @@ func history(inputs []js.Value) (interface{}, error) {
 }
 
 // OnChange allows the user to register a callback function to be invoked when the database changes. The callback
-// function is invoked with the key that was just updated.
+// function is invoked with the key that was just updated. If the DB can be watched, as a memory.DB can, the callback is
+// invoked for every write, including writes made through Query, shortly after the write returns.
 // arguments = fn: unary function (arguments = key: string)
 func OnChange(this js.Value, inputs []js.Value) interface{} {
 	err := onChange(inputs)
@@ -380,10 +384,32 @@ func onChange(inputs []js.Value) error {
 		onChangeFn = &inputs[0]
 	}
 
+	watchChanges()
 	return nil
 }
 
-// SetNow is the wasm adapter for dbtest.TestClock.SetNow. SetNow can only be called if DB was Init-ed with a clock.
+// watchChanges invokes onChangeFn with the key of every change to the DB if the DB is a bt.Watcher, so writes made by
+// any means are observed. Otherwise, the adapters call notifyChange after their own writes.
+func watchChanges() {
+	if cancelWatch != nil {
+		cancelWatch()
+		cancelWatch = nil
+	}
+	w, ok := db.(bt.Watcher)
+	if !ok || onChangeFn == nil {
+		return
+	}
+	events, cancel := w.Watch("", bt.WatchPrefix())
+	cancelWatch = cancel
+	fn := *onChangeFn
+	go func() {
+		for e := range events {
+			fn.Invoke(e.Key)
+		}
+	}()
+}
+
+// SetNow is the wasm adapter for clock.Clock.SetNow. SetNow can only be called if DB was Init-ed with a clock.
 // arguments = now: string (RFC 3339 datetime)
 func SetNow(this js.Value, inputs []js.Value) interface{} {
 	if clock == nil {
@@ -0,0 +1,139 @@
+//go:build js && wasm
+// +build js,wasm
+
+package wasm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"syscall/js"
+	"time"
+
+	bt "github.com/elh/bitempura"
+)
+
+// Diff returns the changes for a key (or all keys) between two (valid time, transaction time) coordinates. Each change
+// is an object with Key, Op ("added", "removed", or "modified"), Before, and After versioned key-values. Keys whose
+// values are equal at both coordinates are omitted.
+// arguments = key: string (or null for all keys), [from_valid_time: string (RFC 3339 datetime), from_transaction_time: string (RFC 3339 datetime), to_valid_time: string (RFC 3339 datetime), to_transaction_time: string (RFC 3339 datetime)]
+func Diff(this js.Value, inputs []js.Value) interface{} {
+	if db == nil {
+		fmt.Println("ERROR: db is not initialized. call bt_Init")
+		return nil
+	}
+	res, err := diff(inputs)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return nil
+	}
+	return res
+}
+
+func diff(inputs []js.Value) (interface{}, error) {
+	var key *string
+	if len(inputs) > 0 && inputs[0].Type() != js.TypeNull && inputs[0].Type() != js.TypeUndefined {
+		if inputs[0].Type() != js.TypeString {
+			return nil, fmt.Errorf("key must be type string (or null or undefined)")
+		}
+		k := inputs[0].String()
+		key = &k
+	}
+	names := []string{"from_valid_time", "from_transaction_time", "to_valid_time", "to_transaction_time"}
+	times := make([]*time.Time, len(names))
+	for i, name := range names {
+		idx := i + 1
+		if len(inputs) <= idx || inputs[idx].Type() == js.TypeNull || inputs[idx].Type() == js.TypeUndefined {
+			continue
+		}
+		if inputs[idx].Type() != js.TypeString {
+			return nil, fmt.Errorf("%v must be type string (or null or undefined)", name)
+		}
+		t, err := time.Parse(time.RFC3339, inputs[idx].String())
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %v: %v\n", name, err)
+		}
+		times[i] = &t
+	}
+
+	before, err := readAt(key, times[0], times[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from coordinate: %v\n", err)
+	}
+	after, err := readAt(key, times[2], times[3])
+	if err != nil {
+		return nil, fmt.Errorf("failed to read to coordinate: %v\n", err)
+	}
+
+	var keys []string
+	for k := range before {
+		keys = append(keys, k)
+	}
+	for k := range after {
+		if _, ok := before[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	res := []interface{}{}
+	for _, k := range keys {
+		b, a := before[k], after[k]
+		var op string
+		switch {
+		case b == nil:
+			op = "added"
+		case a == nil:
+			op = "removed"
+		case !reflect.DeepEqual(b.Value, a.Value):
+			op = "modified"
+		default:
+			continue
+		}
+		change := map[string]interface{}{"Key": k, "Op": op, "Before": nil, "After": nil}
+		if b != nil {
+			if change["Before"], err = kvToMap(b); err != nil {
+				return nil, fmt.Errorf("failed to convert kv: %v\n", err)
+			}
+		}
+		if a != nil {
+			if change["After"], err = kvToMap(a); err != nil {
+				return nil, fmt.Errorf("failed to convert kv: %v\n", err)
+			}
+		}
+		res = append(res, change)
+	}
+	return res, nil
+}
+
+// readAt returns the versioned key-values visible at a coordinate by key. If key is nil, all keys are read.
+func readAt(key *string, validTime, txTime *time.Time) (map[string]*bt.VersionedKV, error) {
+	var opts []bt.ReadOpt
+	if validTime != nil {
+		opts = append(opts, bt.AsOfValidTime(*validTime))
+	}
+	if txTime != nil {
+		opts = append(opts, bt.AsOfTransactionTime(*txTime))
+	}
+
+	out := map[string]*bt.VersionedKV{}
+	if key != nil {
+		kv, err := db.Get(*key, opts...)
+		if errors.Is(err, bt.ErrNotFound) {
+			return out, nil
+		} else if err != nil {
+			return nil, err
+		}
+		out[kv.Key] = kv
+		return out, nil
+	}
+	kvs, err := db.List(opts...)
+	if err != nil {
+		return nil, err
+	}
+	for _, kv := range kvs {
+		out[kv.Key] = kv
+	}
+	return out, nil
+}
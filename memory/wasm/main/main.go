@@ -21,8 +21,12 @@ func main() {
 	js.Global().Set("bt_Set", js.FuncOf(wasm.Set))
 	js.Global().Set("bt_Delete", js.FuncOf(wasm.Delete))
 	js.Global().Set("bt_History", js.FuncOf(wasm.History))
+	js.Global().Set("bt_Diff", js.FuncOf(wasm.Diff))
+	js.Global().Set("bt_Query", js.FuncOf(wasm.Query))
 	// helpers
 	js.Global().Set("bt_OnChange", js.FuncOf(wasm.OnChange))
 	js.Global().Set("bt_SetNow", js.FuncOf(wasm.SetNow))
+	// web worker message protocol
+	js.Global().Set("bt_HandleMessage", js.FuncOf(wasm.HandleMessage))
 	<-c
 }
@@ -0,0 +1,109 @@
+//go:build js && wasm
+// +build js,wasm
+
+package wasm
+
+import (
+	"fmt"
+	"syscall/js"
+)
+
+// HandleMessage is the message protocol entrypoint used when running the Wasm DB inside a Web Worker. The worker
+// forwards each postMessage request here and posts the returned response back to the page. Unlike the direct adapters,
+// errors are returned in the response instead of being printed.
+// arguments = message: object ({id: any, fn: string, args: array})
+// returns = object ({id: any, result: any, error: string | null})
+func HandleMessage(this js.Value, inputs []js.Value) interface{} {
+	return HandleMessageWithInit(initDB, inputs)
+}
+
+// HandleMessageWithInit is HandleMessage with Init messages handled by initFn, which is called with the message args
+// and must initialize the global Wasm DB (e.g. with UseDB). This allows other backends (e.g. sql/wasm) to reuse the
+// message protocol with their own Init.
+func HandleMessageWithInit(initFn func(args []js.Value) error, inputs []js.Value) interface{} {
+	var id interface{} = js.Null()
+	if len(inputs) > 0 && inputs[0].Type() == js.TypeObject {
+		id = inputs[0].Get("id")
+	}
+	res, err := handleMessage(initFn, inputs)
+	if err != nil {
+		return map[string]interface{}{"id": id, "result": js.Null(), "error": err.Error()}
+	}
+	return map[string]interface{}{"id": id, "result": res, "error": js.Null()}
+}
+
+func handleMessage(initFn func(args []js.Value) error, inputs []js.Value) (interface{}, error) {
+	var fn string
+	var args []js.Value
+	{
+		if len(inputs) < 1 {
+			return nil, fmt.Errorf("message is required")
+		}
+		if inputs[0].Type() != js.TypeObject {
+			return nil, fmt.Errorf("message must be type object")
+		}
+		msg := inputs[0]
+		if msg.Get("fn").Type() != js.TypeString {
+			return nil, fmt.Errorf("message fn must be type string")
+		}
+		fn = msg.Get("fn").String()
+		if jsArgs := msg.Get("args"); jsArgs.Type() != js.TypeNull && jsArgs.Type() != js.TypeUndefined {
+			if !js.Global().Get("Array").Call("isArray", jsArgs).Bool() {
+				return nil, fmt.Errorf("message args must be type array (or null or undefined)")
+			}
+			args = make([]js.Value, jsArgs.Length())
+			for i := range args {
+				args[i] = jsArgs.Index(i)
+			}
+		}
+	}
+
+	switch fn {
+	case "Init":
+		return nil, initFn(args)
+	case "SetNow":
+		if clock == nil {
+			return nil, fmt.Errorf("clock is not initialized. Init must be called with withClock=true")
+		}
+		return nil, setNow(args)
+	}
+
+	if db == nil {
+		return nil, fmt.Errorf("db is not initialized. call Init")
+	}
+	switch fn {
+	case "Get":
+		return get(args)
+	case "List":
+		return list(args)
+	case "Set":
+		key, err := set(args)
+		if err != nil {
+			return nil, err
+		}
+		notifyChange(key)
+		return nil, nil
+	case "Delete":
+		key, err := delete(args)
+		if err != nil {
+			return nil, err
+		}
+		notifyChange(key)
+		return nil, nil
+	case "History":
+		return history(args)
+	case "Diff":
+		return diff(args)
+	case "Query":
+		return runQuery(args)
+	default:
+		return nil, fmt.Errorf("unknown fn: %v", fn)
+	}
+}
+
+// notifyChange invokes onChangeFn after a write by an adapter if the DB is not watched.
+func notifyChange(key string) {
+	if onChangeFn != nil && cancelWatch == nil {
+		onChangeFn.Invoke(key)
+	}
+}
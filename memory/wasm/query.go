@@ -0,0 +1,57 @@
+//go:build js && wasm
+// +build js,wasm
+
+package wasm
+
+import (
+	"fmt"
+	"syscall/js"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/query"
+)
+
+// Query evaluates a statement in the query language (see package query). e.g.
+// "GET Bob/balance AS OF VALID 2022-01-01 TX 2022-01-08" or "LIST WHERE key LIKE 'Bob/%'".
+// arguments = query: string
+func Query(this js.Value, inputs []js.Value) interface{} {
+	if db == nil {
+		fmt.Println("ERROR: db is not initialized. call bt_Init")
+		return nil
+	}
+	res, err := runQuery(inputs)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return nil
+	}
+	return res
+}
+
+func runQuery(inputs []js.Value) (interface{}, error) {
+	if len(inputs) < 1 {
+		return nil, fmt.Errorf("query is required")
+	}
+	if inputs[0].Type() != js.TypeString {
+		return nil, fmt.Errorf("query must be type string")
+	}
+	s, err := query.Parse(inputs[0].String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query: %v", err)
+	}
+	res, err := s.Exec(db)
+	if err != nil {
+		return nil, err
+	}
+	switch s.Op {
+	case query.OpSet, query.OpDelete:
+		notifyChange(s.Key)
+	}
+	switch v := res.(type) {
+	case *bt.VersionedKV:
+		return kvToMap(v)
+	case []*bt.VersionedKV:
+		return kvsToSlice(v)
+	default:
+		return nil, nil
+	}
+}
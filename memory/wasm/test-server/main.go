@@ -12,6 +12,7 @@ const (
 func main() {
 	http.Handle("/", http.FileServer(http.Dir("./memory/wasm/test-server")))
 	http.Handle("/assets/", http.StripPrefix("/assets/", http.FileServer(http.Dir("./memory/wasm/assets"))))
+	http.Handle("/worker/", http.StripPrefix("/worker/", http.FileServer(http.Dir("./memory/wasm/worker"))))
 
 	if err := http.ListenAndServe(":"+appPort, nil); err != nil {
 		panic(err)
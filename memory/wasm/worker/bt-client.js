@@ -0,0 +1,48 @@
+// bt-client.js is the page side of the Web Worker message protocol. Each DB function returns a Promise. If wasmURL is
+// set, the worker loads the Wasm module from it instead of /assets/main.wasm.
+//
+//   const db = new BitempuraWorker("/worker/bt-worker.js");
+//   db.onChange = (key) => console.log("changed", key);
+//   await db.call("Init", [true]);
+//   await db.call("Set", ["a", "1"]);
+//   const kvs = await db.call("History", ["a"]);
+class BitempuraWorker {
+  constructor(url, wasmURL) {
+    if (wasmURL) {
+      const u = new URL(url, location.href);
+      u.searchParams.set("wasm", wasmURL);
+      url = u.toString();
+    }
+    this.nextID = 0;
+    this.pending = new Map();
+    this.onChange = null;
+    this.worker = new Worker(url);
+    this.worker.onmessage = (e) => {
+      const msg = e.data;
+      if (msg.type === "change") {
+        if (this.onChange) {
+          this.onChange(msg.key);
+        }
+        return;
+      }
+      const p = this.pending.get(msg.id);
+      if (!p) {
+        return;
+      }
+      this.pending.delete(msg.id);
+      if (msg.error) {
+        p.reject(new Error(msg.error));
+      } else {
+        p.resolve(msg.result);
+      }
+    };
+  }
+
+  call(fn, args) {
+    const id = this.nextID++;
+    return new Promise((resolve, reject) => {
+      this.pending.set(id, { resolve, reject });
+      this.worker.postMessage({ id: id, fn: fn, args: args || [] });
+    });
+  }
+}
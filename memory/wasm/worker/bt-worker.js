@@ -0,0 +1,20 @@
+// bt-worker.js runs the bitempura Wasm DB inside a Web Worker so that heavy calls do not block the page.
+//
+// Requests are posted as {id, fn, args} and answered with {id, result, error}. DB changes are posted as
+// {type: "change", key}.
+//
+// The Wasm module is fetched from the worker URL's "wasm" query parameter, which defaults to /assets/main.wasm, e.g.
+// new Worker("/worker/bt-worker.js?wasm=/assets/sql.wasm") for the sql.js build.
+importScripts("/assets/wasm_exec.js");
+
+const wasmURL = new URL(self.location.href).searchParams.get("wasm") || "/assets/main.wasm";
+const go = new Go();
+const ready = WebAssembly.instantiateStreaming(fetch(wasmURL), go.importObject).then((result) => {
+  go.run(result.instance);
+  bt_OnChange((key) => postMessage({ type: "change", key: key }));
+});
+
+onmessage = async (e) => {
+  await ready;
+  postMessage(bt_HandleMessage(e.data));
+};
@@ -0,0 +1,134 @@
+package memory
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	bt "github.com/elh/bitempura"
+)
+
+// Watch returns a channel of the ChangeEvents of writes to key. Events are sent after the write's post-write hooks are
+// called, in the order writes are applied. Events are shared by watches, so their versions must not be modified. Writes
+// to branches are not watched. See bt.Watcher.
+func (db *DB) Watch(key string, opts ...bt.WatchOpt) (<-chan bt.ChangeEvent, bt.CancelFunc) {
+	return db.watchers.add(key, bt.ApplyWatchOpts(opts).Prefix)
+}
+
+// watchers is the registry of a DB's watches.
+type watchers struct {
+	m    sync.Mutex
+	n    int32      // number of watches. read atomically so writes can skip building events if there are none
+	list []*watcher // in watch order
+}
+
+// watcher is a watch of a key or key prefix. Events are queued so that writes never wait on the receiver.
+type watcher struct {
+	key    string
+	prefix bool
+
+	out   chan bt.ChangeEvent
+	m     sync.Mutex
+	queue []bt.ChangeEvent
+	ready chan struct{} // signaled when queue is non-empty
+	done  chan struct{} // closed by cancel
+}
+
+func (ws *watchers) add(key string, prefix bool) (<-chan bt.ChangeEvent, bt.CancelFunc) {
+	w := &watcher{
+		key:    key,
+		prefix: prefix,
+		out:    make(chan bt.ChangeEvent),
+		ready:  make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	ws.m.Lock()
+	ws.list = append(ws.list, w)
+	atomic.AddInt32(&ws.n, 1)
+	ws.m.Unlock()
+	go w.run()
+
+	var once sync.Once
+	return w.out, func() {
+		once.Do(func() {
+			ws.m.Lock()
+			for i := range ws.list {
+				if ws.list[i] == w {
+					ws.list = append(ws.list[:i:i], ws.list[i+1:]...)
+					break
+				}
+			}
+			atomic.AddInt32(&ws.n, -1)
+			ws.m.Unlock()
+			close(w.done)
+		})
+	}
+}
+
+// active returns whether there are any watches.
+func (ws *watchers) active() bool {
+	return atomic.LoadInt32(&ws.n) > 0
+}
+
+// notify queues the event of a write for every watch of its key.
+func (ws *watchers) notify(key string, isDelete bool, result *bt.WriteResult) {
+	if !ws.active() {
+		return
+	}
+	e := bt.ChangeEvent{Key: key, Op: bt.ChangeOpSet, TxTime: result.TxTime, Closed: result.Closed}
+	if isDelete {
+		e.Op = bt.ChangeOpDelete
+	}
+	if result.Created != nil {
+		e.Created = append(e.Created, result.Created)
+	}
+	e.Created = append(e.Created, result.Overhangs...)
+
+	ws.m.Lock()
+	defer ws.m.Unlock()
+	for _, w := range ws.list {
+		if w.matches(key) {
+			w.push(e)
+		}
+	}
+}
+
+func (w *watcher) matches(key string) bool {
+	if w.prefix {
+		return strings.HasPrefix(key, w.key)
+	}
+	return key == w.key
+}
+
+func (w *watcher) push(e bt.ChangeEvent) {
+	w.m.Lock()
+	w.queue = append(w.queue, e)
+	w.m.Unlock()
+	select {
+	case w.ready <- struct{}{}:
+	default:
+	}
+}
+
+// run sends queued events to out until the watch is canceled.
+func (w *watcher) run() {
+	defer close(w.out)
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.ready:
+		}
+		w.m.Lock()
+		queue := w.queue
+		w.queue = nil
+		w.m.Unlock()
+		for _, e := range queue {
+			select {
+			case w.out <- e:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"errors"
+	"time"
+
+	bt "github.com/elh/bitempura"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var _ bt.DB = (*InstrumentedDB)(nil)
+
+// Outcome label values.
+const (
+	OutcomeHit      = "hit"       // successful read
+	OutcomeOK       = "ok"        // successful write
+	OutcomeNotFound = "not_found" // read returned bt.ErrNotFound
+	OutcomeError    = "error"     // any other error
+)
+
+// NewInstrumentedDB wraps a DB and registers per operation and per outcome counters and latency histograms with the
+// registry.
+func NewInstrumentedDB(db bt.DB, registry prometheus.Registerer) (*InstrumentedDB, error) {
+	calls := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "bitempura",
+		Name:      "operations_total",
+		Help:      "Number of DB operations by operation and outcome.",
+	}, []string{"operation", "outcome"})
+	durations := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "bitempura",
+		Name:      "operation_duration_seconds",
+		Help:      "Latency of DB operations by operation and outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "outcome"})
+	if err := registry.Register(calls); err != nil {
+		return nil, err
+	}
+	if err := registry.Register(durations); err != nil {
+		registry.Unregister(calls)
+		return nil, err
+	}
+	return &InstrumentedDB{db: db, calls: calls, durations: durations}, nil
+}
+
+// InstrumentedDB is a DB that publishes Prometheus metrics for every call to the underlying DB.
+type InstrumentedDB struct {
+	db        bt.DB
+	calls     *prometheus.CounterVec
+	durations *prometheus.HistogramVec
+}
+
+// Get data by key (as of optional valid and transaction times).
+func (db *InstrumentedDB) Get(key string, opts ...bt.ReadOpt) (*bt.VersionedKV, error) {
+	start := time.Now()
+	kv, err := db.db.Get(key, opts...)
+	db.observe("get", readOutcome(err), start)
+	return kv, err
+}
+
+// List all data (as of optional valid and transaction times).
+func (db *InstrumentedDB) List(opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	start := time.Now()
+	kvs, err := db.db.List(opts...)
+	db.observe("list", readOutcome(err), start)
+	return kvs, err
+}
+
+// Set stores value (with optional start and end valid time).
+func (db *InstrumentedDB) Set(key string, value bt.Value, opts ...bt.WriteOpt) error {
+	start := time.Now()
+	err := db.db.Set(key, value, opts...)
+	db.observe("set", writeOutcome(err), start)
+	return err
+}
+
+// Delete removes value (with optional start and end valid time).
+func (db *InstrumentedDB) Delete(key string, opts ...bt.WriteOpt) error {
+	start := time.Now()
+	err := db.db.Delete(key, opts...)
+	db.observe("delete", writeOutcome(err), start)
+	return err
+}
+
+// History returns versions by descending end transaction time, descending end valid time
+func (db *InstrumentedDB) History(key string, opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	start := time.Now()
+	kvs, err := db.db.History(key, opts...)
+	db.observe("history", readOutcome(err), start)
+	return kvs, err
+}
+
+func (db *InstrumentedDB) observe(operation, outcome string, start time.Time) {
+	db.calls.WithLabelValues(operation, outcome).Inc()
+	db.durations.WithLabelValues(operation, outcome).Observe(time.Since(start).Seconds())
+}
+
+func readOutcome(err error) string {
+	if err == nil {
+		return OutcomeHit
+	}
+	if errors.Is(err, bt.ErrNotFound) {
+		return OutcomeNotFound
+	}
+	return OutcomeError
+}
+
+func writeOutcome(err error) string {
+	if err == nil {
+		return OutcomeOK
+	}
+	return OutcomeError
+}
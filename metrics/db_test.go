@@ -0,0 +1,36 @@
+package metrics_test
+
+import (
+	"testing"
+
+	"github.com/elh/bitempura/memory"
+	"github.com/elh/bitempura/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstrumentedDB(t *testing.T) {
+	mdb, err := memory.NewDB()
+	require.Nil(t, err)
+	registry := prometheus.NewRegistry()
+	db, err := metrics.NewInstrumentedDB(mdb, registry)
+	require.Nil(t, err)
+
+	require.Nil(t, db.Set("A", "Old"))
+	_, err = db.Get("A")
+	require.Nil(t, err)
+	_, err = db.Get("B")
+	require.NotNil(t, err)
+	_, err = db.History("B")
+	require.NotNil(t, err)
+	require.NotNil(t, db.Set("", "Old"))
+
+	count, err := testutil.GatherAndCount(registry, "bitempura_operations_total")
+	require.Nil(t, err)
+	assert.Equal(t, 5, count) // distinct operation, outcome label pairs
+
+	_, err = metrics.NewInstrumentedDB(mdb, registry)
+	assert.NotNil(t, err, "metrics already registered")
+}
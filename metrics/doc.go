@@ -0,0 +1,2 @@
+// Package metrics provides a DB decorator publishing Prometheus metrics. It is usable with any bitempura.DB.
+package metrics
@@ -0,0 +1,158 @@
+package migrate
+
+import (
+	"fmt"
+
+	bt "github.com/elh/bitempura"
+)
+
+var _ bt.DB = (*DB)(nil)
+
+// Migration upgrades a value from one schema version to the next.
+type Migration func(old bt.Value) (bt.Value, error)
+
+// Schema is a sequence of migrations. Values start at version 1 and migrations[i] upgrades version i+1 to i+2, so the
+// current version is len(migrations)+1. Migrations may only be appended as the schema evolves.
+type Schema struct {
+	migrations []Migration
+}
+
+// NewSchema constructs a schema from its migrations in order.
+func NewSchema(migrations ...Migration) *Schema {
+	return &Schema{migrations: migrations}
+}
+
+// Version returns the current schema version.
+func (s *Schema) Version() int {
+	return len(s.migrations) + 1
+}
+
+// Envelope is a stored value tagged with its schema version. Stored values that are not Envelopes, such as those
+// written before the DB was wrapped, are version 1.
+type Envelope struct {
+	Version int
+	Value   bt.Value
+}
+
+// Upgrade migrates a stored value to the current version. It returns the value and the version it was stored at.
+func (s *Schema) Upgrade(stored bt.Value) (value bt.Value, version int, err error) {
+	value, version = stored, 1
+	switch e := stored.(type) {
+	case Envelope:
+		value, version = e.Value, e.Version
+	case *Envelope:
+		value, version = e.Value, e.Version
+	}
+	if version < 1 || version > s.Version() {
+		return nil, version, fmt.Errorf("unknown schema version %v", version)
+	}
+	for v := version; v < s.Version(); v++ {
+		if value, err = s.migrations[v-1](value); err != nil {
+			return nil, version, fmt.Errorf("failed to migrate from version %v: %w", v, err)
+		}
+	}
+	return value, version, nil
+}
+
+// Wrap returns a DB that stores values in Envelopes of the schema's current version and returns values upgraded to it.
+func Wrap(db bt.DB, schema *Schema, opts ...Opt) *DB {
+	options := &options{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return &DB{db: db, schema: schema, rewrite: options.rewrite}
+}
+
+// DB is a DB that migrates values on read. Returned VersionedKVs are copies with upgraded values.
+type DB struct {
+	db      bt.DB
+	schema  *Schema
+	rewrite bool
+}
+
+// options is a struct for processing Opt's to be used by DB
+type options struct {
+	rewrite bool
+}
+
+// Opt is an option for wrapping databases
+type Opt func(*options)
+
+// WithRewrite wraps the database so that Get and List also write upgraded values back. Only versions that are current
+// in transaction time are rewritten, as new versions over the same valid time range, so the stored history still has
+// the original values as of earlier transaction times. History never rewrites.
+func WithRewrite() Opt {
+	return func(os *options) {
+		os.rewrite = true
+	}
+}
+
+// Get data by key (as of optional valid and transaction times).
+func (db *DB) Get(key string, opts ...bt.ReadOpt) (*bt.VersionedKV, error) {
+	kv, err := db.db.Get(key, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return db.upgrade(kv, db.rewrite)
+}
+
+// List all data (as of optional valid and transaction times).
+func (db *DB) List(opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	kvs, err := db.db.List(opts...)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*bt.VersionedKV, len(kvs))
+	for i, kv := range kvs {
+		if out[i], err = db.upgrade(kv, db.rewrite); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// Set stores value at the current schema version (with optional start and end valid time).
+func (db *DB) Set(key string, value bt.Value, opts ...bt.WriteOpt) error {
+	return db.db.Set(key, Envelope{Version: db.schema.Version(), Value: value}, opts...)
+}
+
+// Delete removes value (with optional start and end valid time).
+func (db *DB) Delete(key string, opts ...bt.WriteOpt) error {
+	return db.db.Delete(key, opts...)
+}
+
+// History returns versions by descending end transaction time, descending end valid time
+func (db *DB) History(key string, opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	kvs, err := db.db.History(key, opts...)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*bt.VersionedKV, len(kvs))
+	for i, kv := range kvs {
+		if out[i], err = db.upgrade(kv, false); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// upgrade returns a copy of kv with its value upgraded, writing it back if rewrite is set and kv is an old version that
+// is current in transaction time.
+func (db *DB) upgrade(kv *bt.VersionedKV, rewrite bool) (*bt.VersionedKV, error) {
+	value, version, err := db.schema.Upgrade(kv.Value)
+	if err != nil {
+		return nil, fmt.Errorf("key=%v: %w", kv.Key, err)
+	}
+	if rewrite && version < db.schema.Version() && kv.TxTimeEnd == nil {
+		opts := []bt.WriteOpt{bt.WithValidTime(kv.ValidTimeStart)}
+		if kv.ValidTimeEnd != nil {
+			opts = append(opts, bt.WithEndValidTime(*kv.ValidTimeEnd))
+		}
+		if err := db.Set(kv.Key, value, opts...); err != nil {
+			return nil, fmt.Errorf("failed to rewrite key=%v: %w", kv.Key, err)
+		}
+	}
+	out := *kv
+	out.Value = value
+	return &out, nil
+}
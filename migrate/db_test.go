@@ -0,0 +1,99 @@
+package migrate_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/elh/bitempura/dbtest/tt"
+	"github.com/elh/bitempura/memory"
+	"github.com/elh/bitempura/migrate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// version 1 values are names. version 2 splits them into first and last names. version 3 adds a display name.
+var schema = migrate.NewSchema(
+	func(old bt.Value) (bt.Value, error) {
+		name, ok := old.(string)
+		if !ok {
+			return nil, errors.New("not a string")
+		}
+		return map[string]string{"first": name, "last": ""}, nil
+	},
+	func(old bt.Value) (bt.Value, error) {
+		m := old.(map[string]string)
+		return map[string]string{"first": m["first"], "last": m["last"], "display": m["first"]}, nil
+	},
+)
+
+func TestDB(t *testing.T) {
+	newDB := func(opts ...migrate.Opt) (bt.DB, *migrate.DB) {
+		c := clock.New(tt.Day(2))
+		require.Nil(t, c.AutoAdvance(time.Minute))
+		inner, err := memory.NewDB(memory.WithClock(c), memory.WithVersionedKVs([]*bt.VersionedKV{
+			{Key: "A", Value: "Alice", TxTimeStart: tt.Day(1), ValidTimeStart: tt.Day(1)},
+			{Key: "B", Value: migrate.Envelope{Version: 2, Value: map[string]string{"first": "Bob", "last": "B"}}, TxTimeStart: tt.Day(1), ValidTimeStart: tt.Day(1)},
+		}))
+		require.Nil(t, err)
+		return inner, migrate.Wrap(inner, schema, opts...)
+	}
+	alice := map[string]string{"first": "Alice", "last": "", "display": "Alice"}
+	bob := map[string]string{"first": "Bob", "last": "B", "display": "Bob"}
+
+	t.Run("upgrades on read", func(t *testing.T) {
+		inner, db := newDB()
+		kv, err := db.Get("A")
+		require.Nil(t, err)
+		assert.Equal(t, alice, kv.Value)
+		kvs, err := db.List()
+		require.Nil(t, err)
+		assert.ElementsMatch(t, []bt.Value{alice, bob}, []bt.Value{kvs[0].Value, kvs[1].Value})
+
+		// stored values are unchanged
+		kv, err = inner.Get("A")
+		require.Nil(t, err)
+		assert.Equal(t, "Alice", kv.Value)
+	})
+	t.Run("writes current version", func(t *testing.T) {
+		inner, db := newDB()
+		require.Nil(t, db.Set("C", alice))
+		kv, err := inner.Get("C")
+		require.Nil(t, err)
+		assert.Equal(t, migrate.Envelope{Version: 3, Value: alice}, kv.Value)
+		kv, err = db.Get("C")
+		require.Nil(t, err)
+		assert.Equal(t, alice, kv.Value)
+	})
+	t.Run("rewrite", func(t *testing.T) {
+		inner, db := newDB(migrate.WithRewrite())
+		_, err := db.Get("A")
+		require.Nil(t, err)
+		kv, err := inner.Get("A")
+		require.Nil(t, err)
+		assert.Equal(t, migrate.Envelope{Version: 3, Value: alice}, kv.Value)
+		assert.Equal(t, tt.Day(1), kv.ValidTimeStart)
+		// history keeps the original value
+		vs, err := db.History("A")
+		require.Nil(t, err)
+		require.Len(t, vs, 2)
+		vs, err = inner.History("A")
+		require.Nil(t, err)
+		assert.Equal(t, "Alice", vs[1].Value)
+
+		// current values are not rewritten again
+		_, err = db.List()
+		require.Nil(t, err)
+		vs, err = inner.History("A")
+		require.Nil(t, err)
+		assert.Len(t, vs, 2)
+	})
+	t.Run("errors", func(t *testing.T) {
+		_, _, err := schema.Upgrade(migrate.Envelope{Version: 4})
+		assert.NotNil(t, err)
+		_, _, err = schema.Upgrade(1)
+		assert.NotNil(t, err)
+	})
+}
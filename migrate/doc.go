@@ -0,0 +1,4 @@
+// Package migrate provides a DB decorator that versions stored values so applications can evolve the shape of their
+// values without rewriting bitemporal history. Values are stored with their schema version and upgraded by registered
+// migrations when they are read. It is usable with any bitempura.DB.
+package migrate
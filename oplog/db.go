@@ -0,0 +1,116 @@
+package oplog
+
+import (
+	"fmt"
+	"sync"
+
+	bt "github.com/elh/bitempura"
+)
+
+var _ bt.DB = (*DB)(nil)
+var _ bt.ResultWriter = (*DB)(nil)
+
+// Wrap wraps a DB so every applied write through it is appended to log. Writes that fail or are no-ops are not logged.
+// Writes made to the underlying DB directly are not observed.
+func Wrap(db bt.DB, log Log, opts ...Opt) *DB {
+	options := &options{nextSeq: 1}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return &DB{DB: db, log: log, nextSeq: options.nextSeq}
+}
+
+// DB is a DB that logs writes. Reads are passed through to the underlying DB.
+type DB struct {
+	bt.DB
+	log     Log
+	m       sync.Mutex // serialize writes so the log is in the order writes are applied
+	nextSeq uint64
+}
+
+// options is a struct for processing Opt's to be used by DB
+type options struct {
+	nextSeq uint64
+}
+
+// Opt is an option for constructing oplog DBs
+type Opt func(*options)
+
+// WithNextSeq configures the sequence number of the first logged entry, such as the last Seq of an existing log plus one
+// to continue appending to it. The default is 1.
+func WithNextSeq(seq uint64) Opt {
+	return func(os *options) {
+		os.nextSeq = seq
+	}
+}
+
+// Set stores value (with optional start and end valid time).
+func (db *DB) Set(key string, value bt.Value, opts ...bt.WriteOpt) error {
+	_, err := db.SetWithResult(key, value, opts...)
+	return err
+}
+
+// Delete removes value (with optional start and end valid time).
+func (db *DB) Delete(key string, opts ...bt.WriteOpt) error {
+	_, err := db.DeleteWithResult(key, opts...)
+	return err
+}
+
+// SetWithResult stores value (with optional start and end valid time) and returns the affected versions.
+func (db *DB) SetWithResult(key string, value bt.Value, opts ...bt.WriteOpt) (*bt.WriteResult, error) {
+	return db.write(OperationSet, key, value, opts, func() (*bt.WriteResult, error) {
+		return bt.SetWithResult(db.DB, key, value, opts...)
+	})
+}
+
+// DeleteWithResult removes value (with optional start and end valid time) and returns the affected versions.
+func (db *DB) DeleteWithResult(key string, opts ...bt.WriteOpt) (*bt.WriteResult, error) {
+	return db.write(OperationDelete, key, nil, opts, func() (*bt.WriteResult, error) {
+		return bt.DeleteWithResult(db.DB, key, opts...)
+	})
+}
+
+// write applies fn and logs it if it changed any versions. If the log fails, the write has been applied and the error
+// is returned.
+func (db *DB) write(op Operation, key string, value bt.Value, opts []bt.WriteOpt,
+	fn func() (*bt.WriteResult, error)) (*bt.WriteResult, error) {
+	db.m.Lock()
+	defer db.m.Unlock()
+
+	result, err := fn()
+	if err != nil {
+		return nil, err
+	}
+	if result.TxTime.IsZero() {
+		return result, nil
+	}
+
+	options := bt.ApplyWriteOpts(opts)
+	e := &Entry{
+		Seq:            db.nextSeq,
+		Operation:      op,
+		Key:            key,
+		Value:          value,
+		TxTime:         result.TxTime,
+		ValidTime:      options.ValidTime,
+		EndValidTime:   options.EndValidTime,
+		AllValidTime:   options.AllValidTime,
+		OverlapPolicy:  options.OverlapPolicy,
+		OverhangPolicy: options.OverhangPolicy,
+		DecisionTime:   options.DecisionTime,
+		IdempotencyKey: options.IdempotencyKey,
+	}
+	if e.ValidTime == nil && !e.AllValidTime {
+		// valid time defaults to the transaction time
+		e.ValidTime = &result.TxTime
+	}
+	// the DB may allow future valid times without the write option
+	e.FutureValidTime = options.FutureValidTime ||
+		(e.ValidTime != nil && e.ValidTime.After(e.TxTime)) ||
+		(e.EndValidTime != nil && e.EndValidTime.After(e.TxTime))
+	if err := db.log.Append(e); err != nil {
+		return result, fmt.Errorf("write was applied but not logged: %w", err)
+	}
+	db.nextSeq++
+	return result, nil
+}
@@ -0,0 +1,92 @@
+package oplog_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/elh/bitempura/dbtest/tt"
+	"github.com/elh/bitempura/memory"
+	"github.com/elh/bitempura/oplog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	t1 = tt.Day(1)
+	t2 = tt.Day(2)
+	t3 = tt.Day(3)
+	t4 = tt.Day(4)
+)
+
+func TestReplay(t *testing.T) {
+	c := clock.New(t2)
+	mdb, err := memory.NewDB(memory.WithClock(c))
+	require.Nil(t, err)
+	var buf bytes.Buffer
+	db := oplog.Wrap(mdb, oplog.NewWriter(&buf))
+
+	require.Nil(t, db.Set("A", "Old", bt.WithValidTime(t1)))
+	require.Nil(t, db.Set("B", map[string]interface{}{"n": 1.0}))
+	require.Nil(t, c.SetNow(t3))
+	require.Nil(t, db.Set("A", "New", bt.WithValidTime(t1), bt.WithEndValidTime(t2),
+		bt.WithOverhangPolicy(bt.OverhangTruncate)))
+	require.Nil(t, db.Delete("C"))       // no-op
+	require.NotNil(t, db.Set("", "Old")) // failed
+	require.Nil(t, db.Set("D", "New", bt.WithValidTime(t4), bt.WithFutureValidTime()))
+	require.Nil(t, c.SetNow(t4))
+	require.Nil(t, db.Delete("B", bt.WithAllValidTime()))
+
+	r := oplog.NewReader(bytes.NewReader(buf.Bytes()))
+	var entries []*oplog.Entry
+	for {
+		e, err := r.Read()
+		if err != nil {
+			break
+		}
+		entries = append(entries, e)
+	}
+	require.Len(t, entries, 5)
+	for i, e := range entries {
+		assert.Equal(t, uint64(i+1), e.Seq)
+	}
+	assert.Equal(t, oplog.OperationSet, entries[1].Operation)
+	assert.True(t, entries[1].ValidTime.Equal(t2)) // resolved default valid time
+	assert.True(t, entries[2].TxTime.Equal(t3))
+	assert.Equal(t, bt.OverhangTruncate, *entries[2].OverhangPolicy)
+	assert.True(t, entries[3].FutureValidTime)
+	assert.False(t, entries[2].FutureValidTime)
+	assert.Equal(t, oplog.OperationDelete, entries[4].Operation)
+	assert.True(t, entries[4].AllValidTime)
+	assert.Nil(t, entries[4].ValidTime)
+
+	replayClock := clock.New(t1)
+	replica, err := memory.NewDB(memory.WithClock(replayClock))
+	require.Nil(t, err)
+	n, err := oplog.Replay(oplog.NewReader(bytes.NewReader(buf.Bytes())), replica, replayClock)
+	require.Nil(t, err)
+	assert.Equal(t, 5, n)
+	for _, key := range []string{"A", "B", "D"} {
+		expected, err := mdb.History(key)
+		require.Nil(t, err)
+		actual, err := replica.History(key)
+		require.Nil(t, err)
+		assert.Equal(t, expected, actual, key)
+	}
+}
+
+type failingLog struct{}
+
+func (failingLog) Append(*oplog.Entry) error { return errors.New("disk full") }
+
+func TestLogFailure(t *testing.T) {
+	mdb, err := memory.NewDB()
+	require.Nil(t, err)
+	db := oplog.Wrap(mdb, failingLog{})
+	require.NotNil(t, db.Set("A", "Old"))
+	// the write was applied
+	_, err = db.Get("A")
+	require.Nil(t, err)
+}
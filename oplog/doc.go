@@ -0,0 +1,7 @@
+// Package oplog provides a DB decorator that appends every applied write, with its resolved options and transaction
+// time, to a serializable operation log, and functions to apply logged operations to another DB. Replaying a log into an
+// empty DB with a settable clock reproduces the histories of the logged DB, which is the basis for replication and for
+// reproducing bugs.
+//
+// Format: one JSON Entry per line.
+package oplog
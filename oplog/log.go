@@ -0,0 +1,154 @@
+package oplog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+)
+
+// Operation is the type of write of an Entry.
+type Operation string
+
+// Operations
+const (
+	OperationSet    Operation = "set"
+	OperationDelete Operation = "delete"
+)
+
+// Entry is a single applied write. Times are resolved, so applying an Entry does not depend on the clock except for the
+// transaction time.
+type Entry struct {
+	Seq       uint64 // position in the log, starting at 1
+	Operation Operation
+	Key       string
+	Value     bt.Value `json:",omitempty"` // unset for Delete
+	TxTime    time.Time
+	// ValidTime is the resolved valid time start. It is nil if AllValidTime is set.
+	ValidTime      *time.Time         `json:",omitempty"`
+	EndValidTime   *time.Time         `json:",omitempty"`
+	AllValidTime   bool               `json:",omitempty"`
+	OverlapPolicy  *bt.OverlapPolicy  `json:",omitempty"`
+	OverhangPolicy *bt.OverhangPolicy `json:",omitempty"`
+	DecisionTime   *time.Time         `json:",omitempty"`
+	IdempotencyKey string             `json:",omitempty"`
+	// FutureValidTime is set if the write's valid times may be after its transaction time.
+	FutureValidTime bool `json:",omitempty"`
+}
+
+// WriteOpts returns the WriteOpt's that reproduce the entry's write.
+func (e *Entry) WriteOpts() []bt.WriteOpt {
+	var opts []bt.WriteOpt
+	if e.ValidTime != nil {
+		opts = append(opts, bt.WithValidTime(*e.ValidTime))
+	}
+	if e.EndValidTime != nil {
+		opts = append(opts, bt.WithEndValidTime(*e.EndValidTime))
+	}
+	if e.AllValidTime {
+		opts = append(opts, bt.WithAllValidTime())
+	}
+	if e.OverlapPolicy != nil {
+		opts = append(opts, bt.WithOverlapPolicy(*e.OverlapPolicy))
+	}
+	if e.OverhangPolicy != nil {
+		opts = append(opts, bt.WithOverhangPolicy(*e.OverhangPolicy))
+	}
+	if e.DecisionTime != nil {
+		opts = append(opts, bt.WithDecisionTime(*e.DecisionTime))
+	}
+	if e.IdempotencyKey != "" {
+		opts = append(opts, bt.WithIdempotencyKey(e.IdempotencyKey))
+	}
+	if e.FutureValidTime {
+		opts = append(opts, bt.WithFutureValidTime())
+	}
+	return opts
+}
+
+// Log is a destination for entries. Append must not return until the entry is as durable as the log promises.
+type Log interface {
+	Append(e *Entry) error
+}
+
+// NewWriter constructs a Writer that appends entries to w. If w has a Sync method, such as an *os.File, it is called
+// after each entry is written.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, enc: json.NewEncoder(w)}
+}
+
+// Writer is a Log that writes entries as JSON lines.
+type Writer struct {
+	w   io.Writer
+	enc *json.Encoder
+}
+
+// Append writes the entry.
+func (w *Writer) Append(e *Entry) error {
+	if err := w.enc.Encode(e); err != nil {
+		return err
+	}
+	if s, ok := w.w.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// NewReader constructs a Reader of entries written by a Writer. Decoded values have the types of encoding/json.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{dec: json.NewDecoder(r)}
+}
+
+// Reader reads entries written by a Writer.
+type Reader struct {
+	dec *json.Decoder
+}
+
+// Read returns the next entry or io.EOF if there are none.
+func (r *Reader) Read() (*Entry, error) {
+	var e Entry
+	if err := r.dec.Decode(&e); err != nil {
+		return nil, err
+	}
+	if e.Operation != OperationSet && e.Operation != OperationDelete {
+		return nil, fmt.Errorf("entry %v has unknown operation %q", e.Seq, e.Operation)
+	}
+	return &e, nil
+}
+
+// Apply applies the entry's write to db. Its transaction time is the time of db's clock.
+func Apply(db bt.DB, e *Entry) error {
+	switch e.Operation {
+	case OperationSet:
+		return db.Set(e.Key, e.Value, e.WriteOpts()...)
+	case OperationDelete:
+		return db.Delete(e.Key, e.WriteOpts()...)
+	default:
+		return fmt.Errorf("unknown operation %q", e.Operation)
+	}
+}
+
+// Replay applies every entry read from r to db, setting c, which must be db's clock, to each entry's transaction time
+// first so the transaction times of the log are reproduced. It returns the number of entries applied.
+func Replay(r *Reader, db bt.DB, c clock.Settable) (int, error) {
+	var n int
+	for {
+		e, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+		if err := c.SetNow(e.TxTime); err != nil {
+			return n, fmt.Errorf("entry %v: %w", e.Seq, err)
+		}
+		if err := Apply(db, e); err != nil {
+			return n, fmt.Errorf("entry %v: %w", e.Seq, err)
+		}
+		n++
+	}
+}
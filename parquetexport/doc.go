@@ -0,0 +1,2 @@
+// Package parquetexport exports bitempura versioned key-values to Parquet with typed temporal columns for analytics.
+package parquetexport
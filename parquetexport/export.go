@@ -0,0 +1,136 @@
+package parquetexport
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	bt "github.com/elh/bitempura"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Row is the Parquet schema for a versioned key-value. Values are JSON encoded. Times are microsecond timestamps and
+// open ends are null.
+type Row struct {
+	Key            string `parquet:"name=key, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Value          string `parquet:"name=value, type=BYTE_ARRAY, convertedtype=UTF8"`
+	TxTimeStart    int64  `parquet:"name=tx_time_start, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+	TxTimeEnd      *int64 `parquet:"name=tx_time_end, type=INT64, convertedtype=TIMESTAMP_MICROS, repetitiontype=OPTIONAL"`
+	ValidTimeStart int64  `parquet:"name=valid_time_start, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+	ValidTimeEnd   *int64 `parquet:"name=valid_time_end, type=INT64, convertedtype=TIMESTAMP_MICROS, repetitiontype=OPTIONAL"`
+}
+
+// ToRow converts a versioned key-value to a Row.
+func ToRow(kv *bt.VersionedKV) (*Row, error) {
+	value, err := json.Marshal(kv.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &Row{
+		Key:            kv.Key,
+		Value:          string(value),
+		TxTimeStart:    kv.TxTimeStart.UnixMicro(),
+		TxTimeEnd:      toMicros(kv.TxTimeEnd),
+		ValidTimeStart: kv.ValidTimeStart.UnixMicro(),
+		ValidTimeEnd:   toMicros(kv.ValidTimeEnd),
+	}, nil
+}
+
+func toMicros(t *time.Time) *int64 {
+	if t == nil {
+		return nil
+	}
+	us := t.UnixMicro()
+	return &us
+}
+
+// Export writes every version of every key in db to w as Parquet. Keys are enumerated with bt.KeyLister unless
+// provided with WithKeys. It returns the number of rows written.
+func Export(w io.Writer, db bt.DB, opts ...Opt) (int, error) {
+	options := &exportOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	keys := options.keys
+	if keys == nil {
+		kl, ok := db.(bt.KeyLister)
+		if !ok {
+			return 0, errors.New("db does not implement bt.KeyLister. keys must be provided with WithKeys")
+		}
+		var err error
+		if keys, err = kl.Keys(); err != nil {
+			return 0, err
+		}
+	}
+
+	pw, err := writer.NewParquetWriterFromWriter(w, new(Row), 1)
+	if err != nil {
+		return 0, err
+	}
+	pw.CompressionType = parquet.CompressionCodec_SNAPPY
+
+	var n int
+	for _, key := range keys {
+		vs, err := db.History(key)
+		if errors.Is(err, bt.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return n, err
+		}
+		for _, v := range vs {
+			if !options.inWindow(v) {
+				continue
+			}
+			row, err := ToRow(v)
+			if err != nil {
+				return n, err
+			}
+			if err := pw.Write(row); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	if err := pw.WriteStop(); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// exportOptions is a struct for processing Opt's to be used by Export
+type exportOptions struct {
+	keys           []string
+	txStart, txEnd *time.Time
+}
+
+// Opt is an option for Export
+type Opt func(*exportOptions)
+
+// WithKeys configures the keys to export. This is required for DBs that do not implement bt.KeyLister.
+func WithKeys(keys []string) Opt {
+	return func(os *exportOptions) {
+		os.keys = keys
+	}
+}
+
+// WithTxTimeWindow limits the export to versions whose transaction time range overlaps [start, end). Either bound may
+// be nil.
+func WithTxTimeWindow(start, end *time.Time) Opt {
+	return func(os *exportOptions) {
+		os.txStart = start
+		os.txEnd = end
+	}
+}
+
+func (os *exportOptions) inWindow(v *bt.VersionedKV) bool {
+	if os.txEnd != nil && !v.TxTimeStart.Before(*os.txEnd) {
+		return false
+	}
+	if os.txStart != nil && v.TxTimeEnd != nil && !v.TxTimeEnd.After(*os.txStart) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package parquetexport_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/elh/bitempura/clock"
+	"github.com/elh/bitempura/dbtest/tt"
+	"github.com/elh/bitempura/memory"
+	"github.com/elh/bitempura/parquetexport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+)
+
+var (
+	t1 = tt.Day(1)
+	t2 = tt.Day(2)
+	t3 = tt.Day(3)
+)
+
+func TestExport(t *testing.T) {
+	clock := &clock.Clock{}
+	db, err := memory.NewDB(memory.WithClock(clock))
+	require.Nil(t, err)
+	require.Nil(t, clock.SetNow(t1))
+	require.Nil(t, db.Set("A", map[string]interface{}{"balance": 100}))
+	require.Nil(t, clock.SetNow(t3))
+	require.Nil(t, db.Set("A", map[string]interface{}{"balance": 90}))
+
+	readRows := func(b []byte) []parquetexport.Row {
+		pf, err := buffer.NewBufferFile(b)
+		require.Nil(t, err)
+		pr, err := reader.NewParquetReader(pf, new(parquetexport.Row), 1)
+		require.Nil(t, err)
+		defer pr.ReadStop()
+		rows := make([]parquetexport.Row, pr.GetNumRows())
+		require.Nil(t, pr.Read(&rows))
+		return rows
+	}
+
+	var buf bytes.Buffer
+	n, err := parquetexport.Export(&buf, db)
+	require.Nil(t, err)
+	assert.Equal(t, 3, n)
+	rows := readRows(buf.Bytes())
+	require.Len(t, rows, 3)
+	for _, row := range rows {
+		assert.Equal(t, "A", row.Key)
+		if row.TxTimeEnd != nil { // the closed original version
+			assert.Equal(t, t3.UnixMicro(), *row.TxTimeEnd)
+			assert.Equal(t, `{"balance":100}`, row.Value)
+		}
+	}
+
+	buf.Reset()
+	n, err = parquetexport.Export(&buf, db, parquetexport.WithTxTimeWindow(&t2, nil))
+	require.Nil(t, err)
+	assert.Equal(t, 3, n, "closed version overlaps window")
+	buf.Reset()
+	n, err = parquetexport.Export(&buf, db, parquetexport.WithTxTimeWindow(nil, &t2))
+	require.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Len(t, readRows(buf.Bytes()), 1)
+}
@@ -0,0 +1,18 @@
+// Package query implements a small textual temporal query language for bitempura DBs. It is used by the CLI, HTTP
+// server, and wasm console.
+//
+// Statements (keywords are case insensitive, keys may be single quoted, times are RFC 3339 datetimes or dates):
+//
+//	GET <key> [AS OF [VALID <time>] [TX <time>]]
+//	LIST [WHERE key LIKE '<pattern>'] [AS OF [VALID <time>] [TX <time>]]
+//	HISTORY <key>
+//	SET <key> = <JSON value> [VALID FROM <time> [TO <time>]]
+//	DELETE <key> [VALID FROM <time> [TO <time>]]
+//
+// LIKE patterns match "%" to any sequence of characters and "_" to any single character.
+//
+// Examples:
+//
+//	GET Bob/balance AS OF VALID 2022-01-01 TX 2022-01-08
+//	LIST WHERE key LIKE 'Bob/%'
+package query
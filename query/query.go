@@ -0,0 +1,323 @@
+package query
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	bt "github.com/elh/bitempura"
+)
+
+// Op is a statement type.
+type Op string
+
+// Ops
+const (
+	OpGet     Op = "GET"
+	OpList    Op = "LIST"
+	OpHistory Op = "HISTORY"
+	OpSet     Op = "SET"
+	OpDelete  Op = "DELETE"
+)
+
+// Statement is a parsed query.
+type Statement struct {
+	Op          Op
+	Key         string   // GET, HISTORY, SET, DELETE
+	KeyPattern  string   // optional LIKE pattern for LIST
+	Value       bt.Value // SET
+	ReadOptions bt.ReadOptions
+	// WriteOptions for SET and DELETE
+	WriteOptions bt.WriteOptions
+}
+
+// ReadOpts returns the statement's read options.
+func (s *Statement) ReadOpts() []bt.ReadOpt {
+	var opts []bt.ReadOpt
+	if s.ReadOptions.ValidTime != nil {
+		opts = append(opts, bt.AsOfValidTime(*s.ReadOptions.ValidTime))
+	}
+	if s.ReadOptions.TxTime != nil {
+		opts = append(opts, bt.AsOfTransactionTime(*s.ReadOptions.TxTime))
+	}
+	return opts
+}
+
+// WriteOpts returns the statement's write options.
+func (s *Statement) WriteOpts() []bt.WriteOpt {
+	var opts []bt.WriteOpt
+	if s.WriteOptions.ValidTime != nil {
+		opts = append(opts, bt.WithValidTime(*s.WriteOptions.ValidTime))
+	}
+	if s.WriteOptions.EndValidTime != nil {
+		opts = append(opts, bt.WithEndValidTime(*s.WriteOptions.EndValidTime))
+	}
+	return opts
+}
+
+// Exec executes the statement. The result is a *bt.VersionedKV for GET, []*bt.VersionedKV for LIST and HISTORY, and
+// nil for SET and DELETE.
+func (s *Statement) Exec(db bt.DB) (interface{}, error) {
+	switch s.Op {
+	case OpGet:
+		kv, err := db.Get(s.Key, s.ReadOpts()...)
+		if err != nil {
+			return nil, err
+		}
+		return kv, nil
+	case OpList:
+		kvs, err := db.List(s.ReadOpts()...)
+		if err != nil {
+			return nil, err
+		}
+		if s.KeyPattern == "" {
+			return kvs, nil
+		}
+		re := likeRegexp(s.KeyPattern)
+		out := []*bt.VersionedKV{}
+		for _, kv := range kvs {
+			if re.MatchString(kv.Key) {
+				out = append(out, kv)
+			}
+		}
+		return out, nil
+	case OpHistory:
+		kvs, err := db.History(s.Key)
+		if err != nil {
+			return nil, err
+		}
+		return kvs, nil
+	case OpSet:
+		return nil, db.Set(s.Key, s.Value, s.WriteOpts()...)
+	case OpDelete:
+		return nil, db.Delete(s.Key, s.WriteOpts()...)
+	default:
+		return nil, fmt.Errorf("unknown op: %v", s.Op)
+	}
+}
+
+// Eval parses and executes a query.
+func Eval(db bt.DB, q string) (interface{}, error) {
+	s, err := Parse(q)
+	if err != nil {
+		return nil, err
+	}
+	return s.Exec(db)
+}
+
+// likeRegexp converts a LIKE pattern to an anchored regular expression.
+func likeRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// Parse parses a query into a Statement.
+func Parse(q string) (*Statement, error) {
+	p := &parser{s: strings.TrimSpace(q)}
+	op, err := p.keyword()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Statement{Op: Op(op)}
+	switch s.Op {
+	case OpGet:
+		if s.Key, err = p.word("key"); err != nil {
+			return nil, err
+		}
+		if err := p.asOf(s); err != nil {
+			return nil, err
+		}
+	case OpList:
+		if p.accept("WHERE") {
+			if err := p.expect("KEY", "LIKE"); err != nil {
+				return nil, err
+			}
+			if s.KeyPattern, err = p.word("pattern"); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.asOf(s); err != nil {
+			return nil, err
+		}
+	case OpHistory:
+		if s.Key, err = p.word("key"); err != nil {
+			return nil, err
+		}
+	case OpSet:
+		if s.Key, err = p.word("key"); err != nil {
+			return nil, err
+		}
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		if s.Value, err = p.json(); err != nil {
+			return nil, err
+		}
+		if err := p.validRange(s); err != nil {
+			return nil, err
+		}
+	case OpDelete:
+		if s.Key, err = p.word("key"); err != nil {
+			return nil, err
+		}
+		if err := p.validRange(s); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown statement: %v", op)
+	}
+
+	if rest := strings.TrimSpace(p.s); rest != "" {
+		return nil, fmt.Errorf("unexpected input: %v", rest)
+	}
+	return s, nil
+}
+
+type parser struct {
+	s string // remaining input
+}
+
+// next returns the next whitespace delimited or single quoted token without consuming it.
+func (p *parser) next() (tok string, n int, err error) {
+	s := strings.TrimLeftFunc(p.s, unicode.IsSpace)
+	skipped := len(p.s) - len(s)
+	if s == "" {
+		return "", 0, nil
+	}
+	if s[0] == '\'' {
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", 0, errors.New("unterminated quote")
+		}
+		return s[1 : end+1], skipped + end + 2, nil
+	}
+	end := strings.IndexFunc(s, unicode.IsSpace)
+	if end < 0 {
+		end = len(s)
+	}
+	return s[:end], skipped + end, nil
+}
+
+func (p *parser) word(name string) (string, error) {
+	tok, n, err := p.next()
+	if err != nil {
+		return "", err
+	}
+	if tok == "" {
+		return "", fmt.Errorf("%v is required", name)
+	}
+	p.s = p.s[n:]
+	return tok, nil
+}
+
+func (p *parser) keyword() (string, error) {
+	tok, err := p.word("keyword")
+	return strings.ToUpper(tok), err
+}
+
+// accept consumes the next token if it is the keyword.
+func (p *parser) accept(keyword string) bool {
+	tok, n, err := p.next()
+	if err != nil || !strings.EqualFold(tok, keyword) {
+		return false
+	}
+	p.s = p.s[n:]
+	return true
+}
+
+func (p *parser) expect(keywords ...string) error {
+	for _, keyword := range keywords {
+		if !p.accept(keyword) {
+			return fmt.Errorf("expected %v", keyword)
+		}
+	}
+	return nil
+}
+
+func (p *parser) time(name string) (*time.Time, error) {
+	tok, err := p.word(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, tok); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to parse %v: %v", name, tok)
+}
+
+func (p *parser) json() (bt.Value, error) {
+	d := json.NewDecoder(strings.NewReader(p.s))
+	var v bt.Value
+	if err := d.Decode(&v); err != nil {
+		return nil, fmt.Errorf("failed to parse value: %v", err)
+	}
+	p.s = p.s[d.InputOffset():]
+	return v, nil
+}
+
+// asOf parses an optional AS OF [VALID <time>] [TX <time>] clause.
+func (p *parser) asOf(s *Statement) error {
+	if !p.accept("AS") {
+		return nil
+	}
+	if err := p.expect("OF"); err != nil {
+		return err
+	}
+	var err error
+	for {
+		switch {
+		case p.accept("VALID"):
+			if s.ReadOptions.ValidTime, err = p.time("valid time"); err != nil {
+				return err
+			}
+		case p.accept("TX"):
+			if s.ReadOptions.TxTime, err = p.time("tx time"); err != nil {
+				return err
+			}
+		default:
+			if s.ReadOptions.ValidTime == nil && s.ReadOptions.TxTime == nil {
+				return errors.New("AS OF requires VALID or TX")
+			}
+			return nil
+		}
+	}
+}
+
+// validRange parses an optional VALID FROM <time> [TO <time>] clause.
+func (p *parser) validRange(s *Statement) error {
+	if !p.accept("VALID") {
+		return nil
+	}
+	if err := p.expect("FROM"); err != nil {
+		return err
+	}
+	var err error
+	if s.WriteOptions.ValidTime, err = p.time("valid time"); err != nil {
+		return err
+	}
+	if p.accept("TO") {
+		if s.WriteOptions.EndValidTime, err = p.time("end valid time"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
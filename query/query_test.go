@@ -0,0 +1,133 @@
+package query_test
+
+import (
+	"testing"
+	"time"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/elh/bitempura/memory"
+	"github.com/elh/bitempura/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	t1 = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 = time.Date(2022, 1, 8, 0, 0, 0, 0, time.UTC)
+	t3 = time.Date(2022, 1, 15, 12, 30, 0, 0, time.UTC)
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		query       string
+		expected    *query.Statement
+		expectedErr bool
+	}{
+		{
+			desc:     "get",
+			query:    "GET Bob/balance",
+			expected: &query.Statement{Op: query.OpGet, Key: "Bob/balance"},
+		},
+		{
+			desc:  "get as of valid and tx time",
+			query: "get Bob/balance as of valid 2022-01-01 tx 2022-01-08",
+			expected: &query.Statement{Op: query.OpGet, Key: "Bob/balance",
+				ReadOptions: bt.ReadOptions{ValidTime: &t1, TxTime: &t2}},
+		},
+		{
+			desc:  "get quoted key as of RFC 3339 tx time",
+			query: "GET 'Bob balance' AS OF TX 2022-01-15T12:30:00Z",
+			expected: &query.Statement{Op: query.OpGet, Key: "Bob balance",
+				ReadOptions: bt.ReadOptions{TxTime: &t3}},
+		},
+		{
+			desc:     "list where key like",
+			query:    "LIST WHERE key LIKE 'Bob/%'",
+			expected: &query.Statement{Op: query.OpList, KeyPattern: "Bob/%"},
+		},
+		{
+			desc:     "history",
+			query:    "HISTORY Bob/balance",
+			expected: &query.Statement{Op: query.OpHistory, Key: "Bob/balance"},
+		},
+		{
+			desc:  "set with valid range",
+			query: `SET Bob/profile = {"name": "Bob Smith"} VALID FROM 2022-01-01 TO 2022-01-08`,
+			expected: &query.Statement{Op: query.OpSet, Key: "Bob/profile", Value: map[string]interface{}{"name": "Bob Smith"},
+				WriteOptions: bt.WriteOptions{ValidTime: &t1, EndValidTime: &t2}},
+		},
+		{
+			desc:     "delete",
+			query:    "DELETE Bob/balance",
+			expected: &query.Statement{Op: query.OpDelete, Key: "Bob/balance"},
+		},
+		{desc: "empty", query: "", expectedErr: true},
+		{desc: "unknown statement", query: "SELECT *", expectedErr: true},
+		{desc: "missing key", query: "GET", expectedErr: true},
+		{desc: "bad time", query: "GET Bob/balance AS OF VALID yesterday", expectedErr: true},
+		{desc: "empty as of", query: "GET Bob/balance AS OF", expectedErr: true},
+		{desc: "unterminated quote", query: "LIST WHERE key LIKE 'Bob/%", expectedErr: true},
+		{desc: "trailing input", query: "HISTORY Bob/balance now", expectedErr: true},
+		{desc: "bad value", query: "SET Bob/balance = {", expectedErr: true},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			s, err := query.Parse(tC.query)
+			if tC.expectedErr {
+				require.NotNil(t, err)
+				return
+			}
+			require.Nil(t, err)
+			assert.Equal(t, tC.expected, s)
+		})
+	}
+}
+
+func TestEval(t *testing.T) {
+	clock := &clock.Clock{}
+	db, err := memory.NewDB(memory.WithClock(clock))
+	require.Nil(t, err)
+
+	require.Nil(t, clock.SetNow(t1))
+	_, err = query.Eval(db, "SET Bob/balance = 100")
+	require.Nil(t, err)
+	_, err = query.Eval(db, "SET Alice/balance = 200")
+	require.Nil(t, err)
+	require.Nil(t, clock.SetNow(t3))
+	_, err = query.Eval(db, "SET Bob/balance = 90 VALID FROM 2022-01-08")
+	require.Nil(t, err)
+
+	res, err := query.Eval(db, "GET Bob/balance")
+	require.Nil(t, err)
+	assert.Equal(t, 90.0, res.(*bt.VersionedKV).Value)
+
+	res, err = query.Eval(db, "GET Bob/balance AS OF VALID 2022-01-08 TX 2022-01-08")
+	require.Nil(t, err)
+	assert.Equal(t, 100.0, res.(*bt.VersionedKV).Value)
+
+	res, err = query.Eval(db, "LIST WHERE key LIKE 'Bob/%'")
+	require.Nil(t, err)
+	kvs := res.([]*bt.VersionedKV)
+	require.Len(t, kvs, 1)
+	assert.Equal(t, "Bob/balance", kvs[0].Key)
+
+	res, err = query.Eval(db, "LIST WHERE key LIKE '_lice/balance'")
+	require.Nil(t, err)
+	require.Len(t, res.([]*bt.VersionedKV), 1)
+
+	res, err = query.Eval(db, "HISTORY Bob/balance")
+	require.Nil(t, err)
+	assert.Len(t, res.([]*bt.VersionedKV), 3)
+
+	_, err = query.Eval(db, "DELETE Bob/balance")
+	require.Nil(t, err)
+	res, err = query.Eval(db, "GET Bob/balance")
+	assert.ErrorIs(t, err, bt.ErrNotFound)
+	assert.True(t, res == nil, "result %#v", res)
+
+	res, err = query.Eval(db, "HISTORY Carol/balance")
+	assert.ErrorIs(t, err, bt.ErrNotFound)
+	assert.True(t, res == nil, "result %#v", res)
+}
@@ -0,0 +1,82 @@
+package bitempura
+
+import (
+	"time"
+)
+
+// ReadTx is a read-only view of a DB pinned to a transaction time, and optionally a valid time, so that a series of
+// reads, such as the queries of a multi-step report, sees a consistent "as of" view while writers keep committing.
+// DBs issue transaction times in order with the pin, so writes committed after it end or add versions at transaction
+// times at or after it, and reads as of it do not change. The view is inconsistent only if a write is made at or before
+// the pinned time, e.g. with a clock that does not advance between them, or with TxTimeAllow and a regressing clock.
+type ReadTx struct {
+	db        DB
+	txTime    time.Time
+	validTime *time.Time
+}
+
+// ReadTxOpt is an option for ReadTx.
+type ReadTxOpt func(*ReadTx)
+
+// PinValidTime pins the valid time of reads. Reads can override it with AsOfValidTime.
+func PinValidTime(t time.Time) ReadTxOpt {
+	return func(tx *ReadTx) {
+		tx.validTime = &t
+	}
+}
+
+// NewReadTx returns a ReadTx reading db as of transaction time txTime. DBs provide a ReadTx method that pins the
+// transaction time to their clock's time.
+func NewReadTx(db DB, txTime time.Time, opts ...ReadTxOpt) *ReadTx {
+	tx := &ReadTx{db: db, txTime: txTime}
+	for _, opt := range opts {
+		opt(tx)
+	}
+	return tx
+}
+
+// TxTime returns the pinned transaction time.
+func (tx *ReadTx) TxTime() time.Time {
+	return tx.txTime
+}
+
+// ValidTime returns the pinned valid time. It is nil if the valid time is not pinned.
+func (tx *ReadTx) ValidTime() *time.Time {
+	return tx.validTime
+}
+
+// readOpts returns opts as of the pinned times. The pinned valid time precedes opts and the pinned transaction time
+// follows them, so only the valid time can be overridden.
+func (tx *ReadTx) readOpts(opts []ReadOpt) []ReadOpt {
+	out := make([]ReadOpt, 0, len(opts)+2)
+	if tx.validTime != nil {
+		out = append(out, AsOfValidTime(*tx.validTime))
+	}
+	out = append(out, opts...)
+	return append(out, AsOfTransactionTime(tx.txTime))
+}
+
+// Get data by key as of the pinned times (and optional valid time).
+func (tx *ReadTx) Get(key string, opts ...ReadOpt) (*VersionedKV, error) {
+	return tx.db.Get(key, tx.readOpts(opts)...)
+}
+
+// List all data as of the pinned times (and optional valid time).
+func (tx *ReadTx) List(opts ...ReadOpt) ([]*VersionedKV, error) {
+	return tx.db.List(tx.readOpts(opts)...)
+}
+
+// GetMulti returns the data of each key as of the pinned times (and optional valid time). See GetMulti.
+func (tx *ReadTx) GetMulti(keys []string, opts ...ReadOpt) ([]*VersionedKV, error) {
+	return GetMulti(tx.db, keys, tx.readOpts(opts)...)
+}
+
+// History returns the versioned key-values for key as they were known at the pinned transaction time (filtered by
+// optional valid time), ordered as DB.History. Versions written after it are omitted and versions ended after it are
+// current. The pinned valid time does not filter History.
+func (tx *ReadTx) History(key string, opts ...ReadOpt) ([]*VersionedKV, error) {
+	// copy so the caller's opts are not appended to
+	out := make([]ReadOpt, 0, len(opts)+1)
+	out = append(out, opts...)
+	return tx.db.History(key, append(out, AsOfTransactionTime(tx.txTime))...)
+}
@@ -0,0 +1,93 @@
+package bitempura_test
+
+import (
+	"testing"
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/elh/bitempura/dbtest/tt"
+	"github.com/elh/bitempura/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadTx(t *testing.T) {
+	c := clock.New(tt.Day(1))
+	db, err := memory.NewDB(memory.WithClock(c))
+	require.Nil(t, err)
+	require.Nil(t, db.Set("A", "Old"))
+	require.Nil(t, db.Set("B", "Old"))
+	require.Nil(t, c.SetNow(tt.Day(2)))
+	require.Nil(t, db.Set("A", "New", WithValidTime(tt.Day(2))))
+
+	tx := db.ReadTx()
+	assert.True(t, tx.TxTime().Equal(tt.Day(2)))
+	assert.Nil(t, tx.ValidTime())
+	pinned := db.ReadTx(PinValidTime(tt.Day(1)))
+	assert.True(t, pinned.ValidTime().Equal(tt.Day(1)))
+
+	// writers keep committing
+	require.Nil(t, c.SetNow(tt.Day(3)))
+	require.Nil(t, db.Set("A", "Newer", WithValidTime(tt.Day(1))))
+	require.Nil(t, db.Delete("B"))
+	require.Nil(t, db.Set("C", "New"))
+
+	kv, err := tx.Get("A")
+	require.Nil(t, err)
+	assert.Equal(t, "New", kv.Value)
+	kv, err = tx.Get("A", AsOfValidTime(tt.Day(1)))
+	require.Nil(t, err)
+	assert.Equal(t, "Old", kv.Value)
+	kv, err = pinned.Get("A")
+	require.Nil(t, err)
+	assert.Equal(t, "Old", kv.Value)
+	kv, err = pinned.Get("A", AsOfValidTime(tt.Day(2)))
+	require.Nil(t, err)
+	assert.Equal(t, "New", kv.Value, "the pinned valid time can be overridden")
+	kv, err = tx.Get("A", AsOfTransactionTime(tt.Day(3)))
+	require.Nil(t, err)
+	assert.Equal(t, "New", kv.Value, "the pinned transaction time cannot be overridden")
+
+	kvs, err := tx.List()
+	require.Nil(t, err)
+	assert.Len(t, kvs, 2)
+	kvs, err = tx.GetMulti([]string{"B", "C"})
+	require.Nil(t, err)
+	require.NotNil(t, kvs[0])
+	assert.Equal(t, "Old", kvs[0].Value)
+	assert.Nil(t, kvs[1])
+
+	// history as it was at the pinned transaction time
+	_, err = tx.History("C")
+	assert.ErrorIs(t, err, ErrNotFound)
+	vs, err := tx.History("B")
+	require.Nil(t, err)
+	require.Len(t, vs, 1)
+	assert.Nil(t, vs[0].TxTimeEnd)
+	vs, err = tx.History("A")
+	require.Nil(t, err)
+	require.Len(t, vs, 3)
+	for _, v := range vs[:2] {
+		assert.Nil(t, v.TxTimeEnd)
+		assert.True(t, v.TxTimeStart.Equal(tt.Day(2)))
+	}
+	assert.Nil(t, vs[0].ValidTimeEnd, "descending end valid time")
+	assert.True(t, vs[2].TxTimeEnd.Equal(tt.Day(2)))
+	// the caller's opts are not appended to
+	opts := make([]ReadOpt, 1, 2)
+	opts[0] = AsOfValidTime(tt.Day(1))
+	_, err = tx.History("A", opts...)
+	require.Nil(t, err)
+	_, err = tx.History("A", opts[:1]...)
+	require.Nil(t, err)
+	assert.Nil(t, opts[:2][1])
+
+	full, err := db.History("A")
+	require.Nil(t, err)
+	assert.Len(t, full, 4)
+	for _, v := range full {
+		if v.TxTimeStart.Equal(tt.Day(2)) {
+			assert.NotNil(t, v.TxTimeEnd, "the DB's history is not modified")
+		}
+	}
+}
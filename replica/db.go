@@ -0,0 +1,196 @@
+package replica
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/elh/bitempura/oplog"
+)
+
+var _ bt.DB = (*DB)(nil)
+var _ oplog.Log = (*DB)(nil)
+
+// New constructs a DB that reads from follower and writes to primary. followerClock must be the clock of follower. It
+// is set to the transaction time of each applied entry so the follower reproduces the primary's transaction times.
+func New(primary, follower bt.DB, followerClock clock.Settable, opts ...Opt) *DB {
+	options := &options{
+		clock: &bt.DefaultClock{},
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return &DB{
+		primary:       primary,
+		follower:      follower,
+		followerClock: followerClock,
+		clock:         options.clock,
+		maxLag:        options.maxLag,
+	}
+}
+
+// DB is a DB that serves reads from a follower of a primary.
+type DB struct {
+	primary       bt.DB
+	follower      bt.DB
+	followerClock clock.Settable
+	clock         bt.Clock      // clock resolves "now" for staleness. it should match the primary's clock
+	maxLag        time.Duration // reads as of now fall back to the primary if the follower lags more. unbounded if 0
+
+	applyM    sync.Mutex // serialize applying entries
+	m         sync.RWMutex
+	highWater time.Time // guarded by m
+	lastSeq   uint64    // guarded by m
+	lastWrite time.Time // transaction time of the latest write through the DB. guarded by m
+}
+
+// options is a struct for processing Opt's to be used by DB
+type options struct {
+	clock  bt.Clock
+	maxLag time.Duration
+}
+
+// Opt is an option for constructing replica DBs
+type Opt func(*options)
+
+// WithClock configures the clock used to measure the follower's lag. It should match the clock of the primary.
+func WithClock(clock bt.Clock) Opt {
+	return func(os *options) {
+		os.clock = clock
+	}
+}
+
+// WithMaxLag configures reads as of now to be served by the primary if the follower's high-water transaction time is
+// more than d before now.
+func WithMaxLag(d time.Duration) Opt {
+	return func(os *options) {
+		os.maxLag = d
+	}
+}
+
+// Append applies the entry to the follower. It makes DB an oplog.Log, so it can be fed directly by oplog.Wrap.
+func (db *DB) Append(e *oplog.Entry) error {
+	return db.Apply(e)
+}
+
+// Apply applies an entry of the primary's oplog to the follower and advances the high-water transaction time. Entries
+// must be applied in order. Entries that have already been applied are ignored so delivery can be at least once, and a
+// gap in sequence numbers is an error.
+func (db *DB) Apply(e *oplog.Entry) error {
+	db.applyM.Lock()
+	defer db.applyM.Unlock()
+
+	db.m.RLock()
+	lastSeq := db.lastSeq
+	db.m.RUnlock()
+	if lastSeq != 0 && e.Seq <= lastSeq {
+		return nil
+	}
+	if lastSeq != 0 && e.Seq != lastSeq+1 {
+		return fmt.Errorf("entry %v applied after entry %v: entries are missing", e.Seq, lastSeq)
+	}
+	if err := db.followerClock.SetNow(e.TxTime); err != nil {
+		return fmt.Errorf("entry %v: %w", e.Seq, err)
+	}
+	if err := oplog.Apply(db.follower, e); err != nil {
+		return fmt.Errorf("entry %v: %w", e.Seq, err)
+	}
+
+	db.m.Lock()
+	defer db.m.Unlock()
+	db.lastSeq = e.Seq
+	if e.TxTime.After(db.highWater) {
+		db.highWater = e.TxTime
+	}
+	return nil
+}
+
+// Advance advances the high-water transaction time to t without applying an entry. The primary's log shipper should
+// call it periodically, e.g. with the primary's clock time, when there are no writes, so that an idle follower is not
+// considered stale. All entries with transaction times at or before t must already be applied.
+func (db *DB) Advance(t time.Time) {
+	db.m.Lock()
+	defer db.m.Unlock()
+	if t.After(db.highWater) {
+		db.highWater = t
+	}
+}
+
+// HighWater returns the follower's high-water transaction time. The follower reflects every write to the primary at or
+// before it.
+func (db *DB) HighWater() time.Time {
+	db.m.RLock()
+	defer db.m.RUnlock()
+	return db.highWater
+}
+
+// Lag returns how far the follower's high-water transaction time is behind now.
+func (db *DB) Lag() time.Duration {
+	return db.clock.Now().Sub(db.HighWater())
+}
+
+// Get data by key (as of optional valid and transaction times).
+func (db *DB) Get(key string, opts ...bt.ReadOpt) (*bt.VersionedKV, error) {
+	return db.reader(opts).Get(key, opts...)
+}
+
+// List all data (as of optional valid and transaction times).
+func (db *DB) List(opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	return db.reader(opts).List(opts...)
+}
+
+// Set stores value (with optional start and end valid time) in the primary. Later reads through the DB are served by
+// the primary until the follower has applied the write.
+func (db *DB) Set(key string, value bt.Value, opts ...bt.WriteOpt) error {
+	result, err := bt.SetWithResult(db.primary, key, value, opts...)
+	if err != nil {
+		return err
+	}
+	db.observeWrite(result)
+	return nil
+}
+
+// Delete removes value (with optional start and end valid time) in the primary. See Set.
+func (db *DB) Delete(key string, opts ...bt.WriteOpt) error {
+	result, err := bt.DeleteWithResult(db.primary, key, opts...)
+	if err != nil {
+		return err
+	}
+	db.observeWrite(result)
+	return nil
+}
+
+// History returns versions by descending end transaction time, descending end valid time
+func (db *DB) History(key string, opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	return db.reader(opts).History(key, opts...)
+}
+
+func (db *DB) observeWrite(result *bt.WriteResult) {
+	db.m.Lock()
+	defer db.m.Unlock()
+	if result.TxTime.After(db.lastWrite) {
+		db.lastWrite = result.TxTime
+	}
+}
+
+// reader returns the DB that serves a read. Reads as of a transaction time at or before the high-water mark are served
+// by the follower. Reads as of now are served by the primary if the follower has not applied the latest write through
+// the DB or lags more than maxLag.
+func (db *DB) reader(opts []bt.ReadOpt) bt.DB {
+	db.m.RLock()
+	highWater, lastWrite := db.highWater, db.lastWrite
+	db.m.RUnlock()
+
+	now := db.clock.Now()
+	options := bt.ApplyReadOpts(opts)
+	options.ResolveAgo(now)
+	if options.TxTime != nil && !options.TxTime.After(highWater) {
+		return db.follower
+	}
+	if lastWrite.After(highWater) || (db.maxLag > 0 && now.Sub(highWater) > db.maxLag) {
+		return db.primary
+	}
+	return db.follower
+}
@@ -0,0 +1,95 @@
+package replica_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/elh/bitempura/dbtest/tt"
+	"github.com/elh/bitempura/memory"
+	"github.com/elh/bitempura/oplog"
+	"github.com/elh/bitempura/replica"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	t1 = tt.Day(1)
+	t2 = tt.Day(2)
+)
+
+func TestDB(t *testing.T) {
+	c := clock.New(t1)
+	primary, err := memory.NewDB(memory.WithClock(c))
+	require.Nil(t, err)
+	var log bytes.Buffer
+	logged := oplog.Wrap(primary, oplog.NewWriter(&log))
+	followerClock := &clock.Clock{}
+	follower, err := memory.NewDB(memory.WithClock(followerClock))
+	require.Nil(t, err)
+	db := replica.New(logged, follower, followerClock, replica.WithClock(c), replica.WithMaxLag(time.Hour))
+
+	ship := func() {
+		r := oplog.NewReader(&log)
+		for {
+			e, err := r.Read()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			require.Nil(t, err)
+			require.Nil(t, db.Apply(e))
+		}
+	}
+
+	// reads after a write through the DB are served by the primary until the follower applies it
+	require.Nil(t, db.Set("A", "Old"))
+	_, err = follower.Get("A")
+	require.ErrorIs(t, err, bt.ErrNotFound)
+	kv, err := db.Get("A")
+	require.Nil(t, err)
+	assert.Equal(t, "Old", kv.Value)
+
+	ship()
+	assert.Equal(t, t1, db.HighWater())
+	assert.Equal(t, time.Duration(0), db.Lag())
+	kv, err = follower.Get("A")
+	require.Nil(t, err)
+	assert.Equal(t, "Old", kv.Value)
+
+	// a follower lagging more than the max lag is not read as of now
+	require.Nil(t, c.SetNow(t2))
+	require.Nil(t, logged.Set("A", "New"))
+	assert.Equal(t, 24*time.Hour, db.Lag())
+	kv, err = db.Get("A")
+	require.Nil(t, err)
+	assert.Equal(t, "New", kv.Value)
+	// but can be read as of transaction times it has applied
+	kv, err = db.Get("A", bt.AsOfTransactionTime(t1))
+	require.Nil(t, err)
+	assert.Equal(t, "Old", kv.Value)
+
+	ship()
+	assert.Equal(t, t2, db.HighWater())
+	vs, err := follower.History("A")
+	require.Nil(t, err)
+	expected, err := primary.History("A")
+	require.Nil(t, err)
+	assert.Equal(t, expected, vs)
+
+	// entries are applied at least once and in order
+	require.Nil(t, db.Apply(&oplog.Entry{Seq: 1, Operation: oplog.OperationSet, Key: "A", Value: "Old", TxTime: t1}))
+	require.NotNil(t, db.Apply(&oplog.Entry{Seq: 4, Operation: oplog.OperationSet, Key: "A", Value: "Old", TxTime: t2}))
+
+	// scheduled writes are applied with their future valid times
+	require.Nil(t, logged.Set("B", "New", bt.WithValidTime(t2.Add(time.Hour)), bt.WithFutureValidTime()))
+	ship()
+	vs, err = follower.History("B")
+	require.Nil(t, err)
+	expected, err = primary.History("B")
+	require.Nil(t, err)
+	assert.Equal(t, expected, vs)
+}
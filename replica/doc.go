@@ -0,0 +1,4 @@
+// Package replica provides a DB that serves reads from a follower DB kept up to date by applying the oplog of a
+// primary, and writes to the primary. The follower's high-water transaction time bounds its staleness: reads that the
+// follower may not reflect, such as reads after a write through the DB, fall back to the primary.
+package replica
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrUnauthenticated is returned when a request's principal could not be authenticated.
+	ErrUnauthenticated = errors.New("unauthenticated")
+	// ErrForbidden is returned when a principal is not authorized for an operation.
+	ErrForbidden = errors.New("forbidden")
+)
+
+// Permission is a class of operation on a key.
+type Permission string
+
+// Permissions
+const (
+	PermissionRead  Permission = "read"  // Get, List, History
+	PermissionWrite Permission = "write" // Set, Delete
+	PermissionPurge Permission = "purge" // permanently removing history
+)
+
+// Principal is an authenticated identity.
+type Principal struct {
+	ID    string
+	Roles []string
+}
+
+// Authenticator authenticates the principal of a request. It returns an error wrapping ErrUnauthenticated if the
+// request has missing or invalid credentials.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// AuthenticatorFunc is a function Authenticator.
+type AuthenticatorFunc func(r *http.Request) (*Principal, error)
+
+// Authenticate calls fn.
+func (fn AuthenticatorFunc) Authenticate(r *http.Request) (*Principal, error) {
+	return fn(r)
+}
+
+// BearerTokens returns an Authenticator of static "Authorization: Bearer <token>" tokens.
+func BearerTokens(tokens map[string]*Principal) Authenticator {
+	return AuthenticatorFunc(func(r *http.Request) (*Principal, error) {
+		h := r.Header.Get("Authorization")
+		if !strings.HasPrefix(h, "Bearer ") {
+			return nil, fmt.Errorf("%w: bearer token is required", ErrUnauthenticated)
+		}
+		token := strings.TrimPrefix(h, "Bearer ")
+		for t, p := range tokens {
+			if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+				return p, nil
+			}
+		}
+		return nil, fmt.Errorf("%w: invalid bearer token", ErrUnauthenticated)
+	})
+}
+
+// Authorizer authorizes a principal's operations on keys. It returns an error wrapping ErrForbidden if the operation
+// is not allowed.
+type Authorizer interface {
+	Authorize(p *Principal, perm Permission, key string) error
+}
+
+// AuthorizerFunc is a function Authorizer.
+type AuthorizerFunc func(p *Principal, perm Permission, key string) error
+
+// Authorize calls fn.
+func (fn AuthorizerFunc) Authorize(p *Principal, perm Permission, key string) error {
+	return fn(p, perm, key)
+}
+
+// Rule grants Permissions on keys with KeyPrefix to principals with an ID or role in Principals. "*" matches all
+// principals.
+type Rule struct {
+	Principals  []string
+	KeyPrefix   string
+	Permissions []Permission
+}
+
+func (r *Rule) allows(p *Principal, perm Permission, key string) bool {
+	if !strings.HasPrefix(key, r.KeyPrefix) || !containsPermission(r.Permissions, perm) {
+		return false
+	}
+	for _, name := range r.Principals {
+		if name == "*" || name == p.ID {
+			return true
+		}
+		for _, role := range p.Roles {
+			if name == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Rules is an Authorizer that allows an operation if any rule allows it.
+type Rules []Rule
+
+// Authorize implements Authorizer.
+func (rs Rules) Authorize(p *Principal, perm Permission, key string) error {
+	for i := range rs {
+		if rs[i].allows(p, perm, key) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %v may not %v %v", ErrForbidden, p.ID, perm, key)
+}
+
+func containsPermission(perms []Permission, perm Permission) bool {
+	for _, p := range perms {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal set by the auth handler, if any.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
@@ -0,0 +1,199 @@
+package auth_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/memory"
+	"github.com/elh/bitempura/server/auth"
+	bthttp "github.com/elh/bitempura/server/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	alice   = &auth.Principal{ID: "alice", Roles: []string{"finance"}}
+	bob     = &auth.Principal{ID: "bob"}
+	auditor = &auth.Principal{ID: "carol", Roles: []string{"auditor"}}
+
+	rules = auth.Rules{
+		{Principals: []string{"finance"}, KeyPrefix: "ledger/", Permissions: []auth.Permission{auth.PermissionRead, auth.PermissionWrite}},
+		{Principals: []string{"auditor"}, KeyPrefix: "", Permissions: []auth.Permission{auth.PermissionRead}},
+		{Principals: []string{"*"}, KeyPrefix: "public/", Permissions: []auth.Permission{auth.PermissionRead}},
+		{Principals: []string{"bob"}, KeyPrefix: "bob/", Permissions: []auth.Permission{auth.PermissionRead, auth.PermissionWrite, auth.PermissionPurge}},
+	}
+)
+
+func TestRules(t *testing.T) {
+	testCases := []struct {
+		p       *auth.Principal
+		perm    auth.Permission
+		key     string
+		allowed bool
+	}{
+		{alice, auth.PermissionRead, "ledger/1", true},
+		{alice, auth.PermissionWrite, "ledger/1", true},
+		{alice, auth.PermissionPurge, "ledger/1", false},
+		{alice, auth.PermissionRead, "bob/1", false},
+		{alice, auth.PermissionRead, "public/1", true},
+		{auditor, auth.PermissionRead, "bob/1", true},
+		{auditor, auth.PermissionWrite, "ledger/1", false},
+		{bob, auth.PermissionPurge, "bob/1", true},
+		{bob, auth.PermissionWrite, "public/1", false},
+	}
+	for _, tC := range testCases {
+		err := rules.Authorize(tC.p, tC.perm, tC.key)
+		if tC.allowed {
+			assert.Nil(t, err, "%v %v %v", tC.p.ID, tC.perm, tC.key)
+		} else {
+			assert.ErrorIs(t, err, auth.ErrForbidden, "%v %v %v", tC.p.ID, tC.perm, tC.key)
+		}
+	}
+}
+
+func TestDB(t *testing.T) {
+	mdb, err := memory.NewDB()
+	require.Nil(t, err)
+	require.Nil(t, mdb.Set("ledger/1", 100))
+	require.Nil(t, mdb.Set("bob/1", "secret"))
+	require.Nil(t, mdb.Set("public/1", "hello"))
+
+	db := auth.NewDB(mdb, alice, rules)
+	_, err = db.Get("ledger/1")
+	assert.Nil(t, err)
+	_, err = db.Get("bob/1")
+	assert.ErrorIs(t, err, auth.ErrForbidden)
+	_, err = db.History("bob/1")
+	assert.ErrorIs(t, err, auth.ErrForbidden)
+	assert.Nil(t, db.Set("ledger/2", 200))
+	assert.ErrorIs(t, db.Delete("public/1"), auth.ErrForbidden)
+
+	kvs, err := db.List()
+	require.Nil(t, err)
+	var keys []string
+	for _, kv := range kvs {
+		keys = append(keys, kv.Key)
+	}
+	assert.ElementsMatch(t, []string{"ledger/1", "ledger/2", "public/1"}, keys)
+
+	keys, err = db.(bt.KeyLister).Keys()
+	require.Nil(t, err)
+	assert.Equal(t, []string{"ledger/1", "ledger/2", "public/1"}, keys)
+
+	assert.ErrorIs(t, db.(*auth.DB).Authorize(auth.PermissionPurge, "ledger/1"), auth.ErrForbidden)
+}
+
+func TestHandler(t *testing.T) {
+	mdb, err := memory.NewDB()
+	require.Nil(t, err)
+	require.Nil(t, mdb.Set("ledger/1", 100))
+	authn := auth.BearerTokens(map[string]*auth.Principal{"alice-token": alice, "bob-token": bob})
+	server := httptest.NewServer(auth.NewHandler(mdb, bthttp.NewHandler, authn, rules))
+	defer server.Close()
+
+	do := func(method, path, token string) int {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader("1"))
+		require.Nil(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/kv/ledger/1", ""))
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/kv/ledger/1", "wrong"))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/kv/ledger/1", "alice-token"))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/kv/ledger/1", "bob-token"))
+	assert.Equal(t, http.StatusNoContent, do(http.MethodPut, "/kv/bob/1", "bob-token"))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPut, "/kv/ledger/1", "bob-token"))
+
+	client := bthttp.NewClient(server.URL, &http.Client{Transport: bearer("bob-token")})
+	_, err = client.Get("ledger/1")
+	assert.ErrorIs(t, err, auth.ErrForbidden)
+
+	erroring := auth.AuthenticatorFunc(func(r *http.Request) (*auth.Principal, error) { return nil, errors.New("boom") })
+	w := httptest.NewRecorder()
+	auth.NewHandler(mdb, bthttp.NewHandler, erroring, rules).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/kv", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestHookDB(t *testing.T) {
+	mdb, err := memory.NewDB()
+	require.Nil(t, err)
+	require.Nil(t, mdb.Set("ledger/1", 100))
+	require.Nil(t, mdb.Set("archive/1", "old"))
+
+	// ledger keys are writable, archive keys are read-only and cannot be purged
+	var calls []string
+	hook := func(op auth.Op, key string) error {
+		calls = append(calls, string(op)+" "+key)
+		if strings.HasPrefix(key, "archive/") && op.Permission() != auth.PermissionRead {
+			return fmt.Errorf("%w: %v %v", auth.ErrForbidden, op, key)
+		}
+		return nil
+	}
+	db := auth.NewHookDB(mdb, hook)
+	assert.Nil(t, db.Set("ledger/2", 200))
+	assert.ErrorIs(t, db.Delete("archive/1"), auth.ErrForbidden)
+	_, err = db.Get("archive/1")
+	assert.Nil(t, err)
+	_, err = db.History("archive/1")
+	assert.Nil(t, err)
+	assert.ErrorIs(t, db.(*auth.HookDB).Check(auth.OpPurge, "archive/1"), auth.ErrForbidden)
+	assert.Equal(t, []string{"set ledger/2", "delete archive/1", "get archive/1", "history archive/1", "purge archive/1"}, calls)
+
+	// results are filtered
+	db = auth.NewHookDB(mdb, func(op auth.Op, key string) error {
+		if key == "archive/1" {
+			return auth.ErrForbidden
+		}
+		return nil
+	})
+	kvs, err := db.List()
+	require.Nil(t, err)
+	require.Len(t, kvs, 2)
+	keys, err := db.(bt.KeyLister).Keys()
+	require.Nil(t, err)
+	assert.Equal(t, []string{"ledger/1", "ledger/2"}, keys)
+
+	// per request hooks in servers
+	server := httptest.NewServer(auth.NewHookHandler(mdb, bthttp.NewHandler, func(r *http.Request) auth.Hook {
+		readOnly := r.Header.Get("X-Read-Only") != ""
+		return func(op auth.Op, key string) error {
+			if readOnly && op.Permission() != auth.PermissionRead {
+				return auth.ErrForbidden
+			}
+			return nil
+		}
+	}))
+	defer server.Close()
+	put := func(readOnly bool) int {
+		req, err := http.NewRequest(http.MethodPut, server.URL+"/kv/ledger/3", strings.NewReader("1"))
+		require.Nil(t, err)
+		if readOnly {
+			req.Header.Set("X-Read-Only", "1")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusForbidden, put(true))
+	assert.Equal(t, http.StatusNoContent, put(false))
+}
+
+type bearer string
+
+func (b bearer) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+string(b))
+	return http.DefaultTransport.RoundTrip(r)
+}
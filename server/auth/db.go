@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"errors"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/changefeed"
+)
+
+var _ bt.DB = (*DB)(nil)
+var _ bt.KeyLister = (*DB)(nil)
+
+// NewDB constructs a DB that authorizes every operation of principal p against db. List and Keys omit keys the
+// principal may not read instead of failing. If db emits change events (see changefeed.DB), the returned DB does as
+// well for keys the principal may read.
+func NewDB(db bt.DB, p *Principal, authz Authorizer) bt.DB {
+	adb := &DB{db: db, p: p, authz: authz}
+	if s, ok := db.(subscriber); ok {
+		return &subscriberDB{DB: adb, s: s}
+	}
+	return adb
+}
+
+// DB is a DB scoped to the permissions of a principal.
+type DB struct {
+	db    bt.DB
+	p     *Principal
+	authz Authorizer
+}
+
+// Authorize returns an error if the principal does not have perm on key. It is exported so operations outside of the
+// DB interface (e.g. purges) can be checked.
+func (db *DB) Authorize(perm Permission, key string) error {
+	return db.authz.Authorize(db.p, perm, key)
+}
+
+// Get data by key (as of optional valid and transaction times).
+func (db *DB) Get(key string, opts ...bt.ReadOpt) (*bt.VersionedKV, error) {
+	if err := db.Authorize(PermissionRead, key); err != nil {
+		return nil, err
+	}
+	return db.db.Get(key, opts...)
+}
+
+// List all data (as of optional valid and transaction times).
+func (db *DB) List(opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	kvs, err := db.db.List(opts...)
+	if err != nil {
+		return nil, err
+	}
+	out := []*bt.VersionedKV{}
+	for _, kv := range kvs {
+		if db.Authorize(PermissionRead, kv.Key) == nil {
+			out = append(out, kv)
+		}
+	}
+	return out, nil
+}
+
+// Set stores value (with optional start and end valid time).
+func (db *DB) Set(key string, value bt.Value, opts ...bt.WriteOpt) error {
+	if err := db.Authorize(PermissionWrite, key); err != nil {
+		return err
+	}
+	return db.db.Set(key, value, opts...)
+}
+
+// Delete removes value (with optional start and end valid time).
+func (db *DB) Delete(key string, opts ...bt.WriteOpt) error {
+	if err := db.Authorize(PermissionWrite, key); err != nil {
+		return err
+	}
+	return db.db.Delete(key, opts...)
+}
+
+// History returns versions by descending end transaction time, descending end valid time
+func (db *DB) History(key string, opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	if err := db.Authorize(PermissionRead, key); err != nil {
+		return nil, err
+	}
+	return db.db.History(key, opts...)
+}
+
+// Keys returns all keys the principal may read. The underlying DB must be a bt.KeyLister.
+func (db *DB) Keys() ([]string, error) {
+	kl, ok := db.db.(bt.KeyLister)
+	if !ok {
+		return nil, errors.New("underlying DB does not list keys")
+	}
+	keys, err := kl.Keys()
+	if err != nil {
+		return nil, err
+	}
+	out := []string{}
+	for _, k := range keys {
+		if db.Authorize(PermissionRead, k) == nil {
+			out = append(out, k)
+		}
+	}
+	return out, nil
+}
+
+// subscriber is a DB that emits change events, e.g. changefeed.DB.
+type subscriber interface {
+	Subscribe(fn func(changefeed.Event)) (cancel func())
+}
+
+// subscriberDB is a DB over a DB that emits change events.
+type subscriberDB struct {
+	*DB
+	s subscriber
+}
+
+// Subscribe registers fn to be called with every Event for keys the principal may read.
+func (db *subscriberDB) Subscribe(fn func(changefeed.Event)) (cancel func()) {
+	return db.s.Subscribe(func(e changefeed.Event) {
+		if db.Authorize(PermissionRead, e.Key) == nil {
+			fn(e)
+		}
+	})
+}
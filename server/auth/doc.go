@@ -0,0 +1,4 @@
+// Package auth provides pluggable authentication and per-key-prefix authorization for the server packages, and Hooks for
+// applications that authorize operations with their own notion of identity. Temporal history often contains sensitive
+// audit data, so reads, writes, and purges are authorized separately.
+package auth
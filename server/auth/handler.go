@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	bt "github.com/elh/bitempura"
+)
+
+// NewHandler constructs a http.Handler that authenticates each request and serves it with newHandler over db scoped
+// to the request's principal (see NewDB), e.g. with server/http.NewHandler or server/ws.NewHandler. Requests that fail
+// authentication receive 401s. The principal is available to inner handlers via PrincipalFromContext.
+func NewHandler(db bt.DB, newHandler func(bt.DB) http.Handler, authn Authenticator, authz Authorizer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := authn.Authenticate(r)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrUnauthenticated) {
+				status = http.StatusUnauthorized
+			}
+			writeError(w, status, err)
+			return
+		}
+		newHandler(NewDB(db, p, authz)).ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	})
+}
+
+// NewHookHandler constructs a http.Handler that serves each request with newHandler over db checked by the Hook hookFn
+// returns for the request (see NewHookDB), e.g. one built from the embedding application's own session.
+func NewHookHandler(db bt.DB, newHandler func(bt.DB) http.Handler, hookFn func(r *http.Request) Hook) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		newHandler(NewHookDB(db, hookFn(r))).ServeHTTP(w, r)
+	})
+}
+
+// errorResponse matches the error body of server/http.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(errorResponse{Error: err.Error()})
+}
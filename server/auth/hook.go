@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"errors"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/changefeed"
+)
+
+var _ bt.DB = (*HookDB)(nil)
+var _ bt.KeyLister = (*HookDB)(nil)
+
+// Op is an operation checked by a Hook.
+type Op string
+
+// Ops
+const (
+	OpGet     Op = "get"
+	OpList    Op = "list"
+	OpSet     Op = "set"
+	OpDelete  Op = "delete"
+	OpHistory Op = "history"
+	OpKeys    Op = "keys"
+	OpPurge   Op = "purge" // not a DB operation. checked by applications with HookDB.Check
+)
+
+// Permission returns the class of the operation.
+func (op Op) Permission() Permission {
+	switch op {
+	case OpSet, OpDelete:
+		return PermissionWrite
+	case OpPurge:
+		return PermissionPurge
+	default:
+		return PermissionRead
+	}
+}
+
+// Hook is an authorization callback invoked before every operation on a key. It returns an error, which should wrap
+// ErrForbidden, if the operation is not allowed. Hooks let embedding applications enforce permissions with their own
+// notion of identity, e.g. from a request's context, instead of a Principal and Authorizer.
+type Hook func(op Op, key string) error
+
+// NewHookDB constructs a DB that calls hook before every operation of db. List and Keys call hook with an empty key
+// before the operation, then with each result's key, omitting results it rejects instead of failing. If db emits change
+// events (see changefeed.DB), the returned DB does as well for keys that hook allows with OpGet.
+func NewHookDB(db bt.DB, hook Hook) bt.DB {
+	hdb := &HookDB{db: db, hook: hook}
+	if s, ok := db.(subscriber); ok {
+		return &hookSubscriberDB{HookDB: hdb, s: s}
+	}
+	return hdb
+}
+
+// HookDB is a DB that authorizes operations with a Hook.
+type HookDB struct {
+	db   bt.DB
+	hook Hook
+}
+
+// Check returns the hook's error for op on key. It is exported so operations outside of the DB interface (e.g. purges)
+// can be checked.
+func (db *HookDB) Check(op Op, key string) error {
+	return db.hook(op, key)
+}
+
+// Get data by key (as of optional valid and transaction times).
+func (db *HookDB) Get(key string, opts ...bt.ReadOpt) (*bt.VersionedKV, error) {
+	if err := db.Check(OpGet, key); err != nil {
+		return nil, err
+	}
+	return db.db.Get(key, opts...)
+}
+
+// List all data (as of optional valid and transaction times).
+func (db *HookDB) List(opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	if err := db.Check(OpList, ""); err != nil {
+		return nil, err
+	}
+	kvs, err := db.db.List(opts...)
+	if err != nil {
+		return nil, err
+	}
+	out := []*bt.VersionedKV{}
+	for _, kv := range kvs {
+		if db.Check(OpList, kv.Key) == nil {
+			out = append(out, kv)
+		}
+	}
+	return out, nil
+}
+
+// Set stores value (with optional start and end valid time).
+func (db *HookDB) Set(key string, value bt.Value, opts ...bt.WriteOpt) error {
+	if err := db.Check(OpSet, key); err != nil {
+		return err
+	}
+	return db.db.Set(key, value, opts...)
+}
+
+// Delete removes value (with optional start and end valid time).
+func (db *HookDB) Delete(key string, opts ...bt.WriteOpt) error {
+	if err := db.Check(OpDelete, key); err != nil {
+		return err
+	}
+	return db.db.Delete(key, opts...)
+}
+
+// History returns versions by descending end transaction time, descending end valid time
+func (db *HookDB) History(key string, opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	if err := db.Check(OpHistory, key); err != nil {
+		return nil, err
+	}
+	return db.db.History(key, opts...)
+}
+
+// Keys returns all keys that hook allows. The underlying DB must be a bt.KeyLister.
+func (db *HookDB) Keys() ([]string, error) {
+	if err := db.Check(OpKeys, ""); err != nil {
+		return nil, err
+	}
+	kl, ok := db.db.(bt.KeyLister)
+	if !ok {
+		return nil, errors.New("underlying DB does not list keys")
+	}
+	keys, err := kl.Keys()
+	if err != nil {
+		return nil, err
+	}
+	out := []string{}
+	for _, k := range keys {
+		if db.Check(OpKeys, k) == nil {
+			out = append(out, k)
+		}
+	}
+	return out, nil
+}
+
+// hookSubscriberDB is a HookDB over a DB that emits change events.
+type hookSubscriberDB struct {
+	*HookDB
+	s subscriber
+}
+
+// Subscribe registers fn to be called with every Event for keys that hook allows with OpGet.
+func (db *hookSubscriberDB) Subscribe(fn func(changefeed.Event)) (cancel func()) {
+	return db.s.Subscribe(func(e changefeed.Event) {
+		if db.Check(OpGet, e.Key) == nil {
+			fn(e)
+		}
+	})
+}
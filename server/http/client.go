@@ -0,0 +1,199 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/server/auth"
+)
+
+var _ bt.DB = (*Client)(nil)
+
+// NewClient constructs a DB that is a client of a server serving NewHandler at baseURL. If httpClient is nil,
+// http.DefaultClient is used.
+func NewClient(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), httpClient: httpClient}
+}
+
+// Client is a DB backed by a remote server serving NewHandler.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// Get data by key (as of optional valid and transaction times).
+func (c *Client) Get(key string, opts ...bt.ReadOpt) (*bt.VersionedKV, error) {
+	var kv *bt.VersionedKV
+	if err := c.do(http.MethodGet, kvPath+"/"+escapeKey(key), readQuery(opts), nil, &kv); err != nil {
+		return nil, err
+	}
+	return kv, nil
+}
+
+// List all data (as of optional valid and transaction times).
+func (c *Client) List(opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	var kvs []*bt.VersionedKV
+	if err := c.do(http.MethodGet, kvPath, readQuery(opts), nil, &kvs); err != nil {
+		return nil, err
+	}
+	return kvs, nil
+}
+
+// Set stores value (with optional start and end valid time).
+func (c *Client) Set(key string, value bt.Value, opts ...bt.WriteOpt) error {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return c.do(http.MethodPut, kvPath+"/"+escapeKey(key), writeQuery(opts), body, nil)
+}
+
+// Delete removes value (with optional start and end valid time).
+func (c *Client) Delete(key string, opts ...bt.WriteOpt) error {
+	return c.do(http.MethodDelete, kvPath+"/"+escapeKey(key), writeQuery(opts), nil, nil)
+}
+
+// History returns versions by descending end transaction time, descending end valid time (filtered by optional valid
+// and transaction times).
+func (c *Client) History(key string, opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	var kvs []*bt.VersionedKV
+	if err := c.do(http.MethodGet, historyPath+escapeKey(key), readQuery(opts), nil, &kvs); err != nil {
+		return nil, err
+	}
+	return kvs, nil
+}
+
+// do executes a request and decodes the response into out if non-nil. 404, 403, and 409 responses are returned as
+// bt.ErrNotFound, auth.ErrForbidden, and bt.ErrOverlap. 409 responses for bt.ErrOverhang, bt.ErrHistoryLimit, and
+// bt.ErrTxTimeRegressed and 400 responses for bt.ErrInvalidWrite, bt.ErrNilValue, and path.ErrBadPattern are returned as
+// those errors.
+func (c *Client) do(method, route string, q url.Values, body []byte, out interface{}) error {
+	u := c.baseURL + route
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var errResp ErrorResponse
+		_ = json.Unmarshal(b, &errResp)
+		if resp.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("%w: %v", bt.ErrNotFound, errResp.Error)
+		}
+		if resp.StatusCode == http.StatusForbidden {
+			return fmt.Errorf("%w: %v", auth.ErrForbidden, errResp.Error)
+		}
+		if resp.StatusCode == http.StatusConflict {
+			err := sentinelOf(errResp.Error, bt.ErrOverlap, bt.ErrOverhang, bt.ErrHistoryLimit, bt.ErrTxTimeRegressed)
+			return fmt.Errorf("%w: %v", err, errResp.Error)
+		}
+		if resp.StatusCode == http.StatusBadRequest {
+			if err := sentinelOf(errResp.Error, nil, bt.ErrInvalidWrite, bt.ErrNilValue, path.ErrBadPattern); err != nil {
+				return fmt.Errorf("%w: %v", err, errResp.Error)
+			}
+		}
+		return fmt.Errorf("server returned %v: %v", resp.StatusCode, errResp.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(b, out)
+}
+
+// sentinelOf returns the error of errs whose message prefixes msg, which the server wrapped, or def if there is none.
+func sentinelOf(msg string, def error, errs ...error) error {
+	for _, err := range errs {
+		if strings.HasPrefix(msg, err.Error()) {
+			return err
+		}
+	}
+	return def
+}
+
+// escapeKey escapes each segment of the key so keys containing "/" map onto the server's routes.
+func escapeKey(key string) string {
+	parts := strings.Split(key, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
+}
+
+func readQuery(opts []bt.ReadOpt) url.Values {
+	options := bt.ApplyReadOpts(opts)
+	q := url.Values{}
+	setQueryTime(q, "valid_time", options.ValidTime)
+	setQueryTime(q, "tx_time", options.TxTime)
+	setQueryDuration(q, "valid_time_ago", options.ValidTimeAgo)
+	setQueryDuration(q, "tx_time_ago", options.TxTimeAgo)
+	if w := options.ValidTimeWindow; w != nil {
+		setQueryTime(q, "valid_window_start", &w.Start)
+		setQueryTime(q, "valid_window_end", &w.End)
+	}
+	if options.KeyFilter.Prefix != "" {
+		q.Set("key_prefix", options.KeyFilter.Prefix)
+	}
+	if options.KeyFilter.Glob != "" {
+		q.Set("key_glob", options.KeyFilter.Glob)
+	}
+	return q
+}
+
+func writeQuery(opts []bt.WriteOpt) url.Values {
+	options := bt.ApplyWriteOpts(opts)
+	q := url.Values{}
+	setQueryTime(q, "valid_time", options.ValidTime)
+	setQueryTime(q, "end_valid_time", options.EndValidTime)
+	setQueryDuration(q, "valid_duration", options.ValidDuration)
+	if options.AllValidTime {
+		q.Set("all_valid_time", "true")
+	}
+	if options.FutureValidTime {
+		q.Set("future_valid_time", "true")
+	}
+	if options.OverlapPolicy != nil {
+		q.Set("overlap_policy", options.OverlapPolicy.String())
+	}
+	if options.OverhangPolicy != nil {
+		q.Set("overhang_policy", options.OverhangPolicy.String())
+	}
+	if options.IdempotencyKey != "" {
+		q.Set("idempotency_key", options.IdempotencyKey)
+	}
+	return q
+}
+
+func setQueryDuration(q url.Values, name string, d *time.Duration) {
+	if d != nil {
+		q.Set(name, d.String())
+	}
+}
+
+func setQueryTime(q url.Values, name string, t *time.Time) {
+	if t != nil {
+		q.Set(name, t.Format(time.RFC3339Nano))
+	}
+}
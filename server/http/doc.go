@@ -0,0 +1,2 @@
+// Package http exposes a bitempura.DB over JSON REST so it can be used from non-Go services and curl.
+package http
@@ -0,0 +1,395 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/query"
+	"github.com/elh/bitempura/server/auth"
+)
+
+// Routes. Keys are the remainder of the path after the route prefix and may contain "/".
+//
+//	GET    /kv?<read params>               List
+//	GET    /kv/<key>?<read params>         Get
+//	PUT    /kv/<key>?<write params>        Set. body is the JSON value
+//	DELETE /kv/<key>?<write params>        Delete
+//	GET    /history/<key>?<read params>    History
+//	POST   /query                          Query. body is {"query": "<statement>"} (see package query)
+//
+// Read params:
+//
+//	valid_time, tx_time                    read as of the times
+//	valid_time_ago, tx_time_ago            read as of the durations before now, e.g. "24h"
+//	valid_window_start, valid_window_end   History of the valid time window. set together
+//	key_prefix, key_glob                   List keys with the prefix or matching the glob
+//
+// Write params:
+//
+//	valid_time, end_valid_time             valid time range of the write
+//	valid_duration                         valid time range of the duration from valid_time, e.g. "720h"
+//	all_valid_time=true                    Delete over all valid time
+//	future_valid_time=true                 allow valid times after the transaction time
+//	overlap_policy                         "clip" or "reject"
+//	overhang_policy                        "reassert", "truncate", or "reject"
+//	idempotency_key                        key under which retries of the write are no-ops
+//
+// All times are RFC 3339 datetimes and durations are Go durations. Invalid params and writes respond 400 Bad Request.
+// Rejected writes (overlap, overhang, history limit, or regressed transaction time) respond 409 Conflict.
+const (
+	kvPath      = "/kv"
+	historyPath = "/history/"
+	queryPath   = "/query"
+)
+
+// NewHandler constructs a http.Handler exposing a DB over JSON REST.
+func NewHandler(db bt.DB) http.Handler {
+	h := &handler{db: db}
+	mux := http.NewServeMux()
+	mux.HandleFunc(kvPath, h.handleKVs)
+	mux.HandleFunc(kvPath+"/", h.handleKV)
+	mux.HandleFunc(historyPath, h.handleHistory)
+	mux.HandleFunc(queryPath, h.handleQuery)
+	return mux
+}
+
+type handler struct {
+	db bt.DB
+}
+
+// ErrorResponse is the body of all non-2xx responses.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func (h *handler) handleKVs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+	opts, err := readOpts(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	// stream the JSON array so large DBs are served with bounded memory. errors after the first result can no longer
+	// change the status so the response is truncated
+	started := false
+	start := func() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, "[")
+		started = true
+	}
+	enc := json.NewEncoder(w)
+	err = bt.ListFunc(h.db, func(kv *bt.VersionedKV) bool {
+		if !started {
+			start()
+		} else if _, err := io.WriteString(w, ","); err != nil {
+			return false
+		}
+		return enc.Encode(kv) == nil
+	}, opts...)
+	if err != nil {
+		if !started {
+			writeDBError(w, err)
+		}
+		return
+	}
+	if !started {
+		start()
+	}
+	_, _ = io.WriteString(w, "]\n")
+}
+
+func (h *handler) handleKV(w http.ResponseWriter, r *http.Request) {
+	key, err := pathKey(r.URL, kvPath+"/")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		opts, err := readOpts(r.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		kv, err := h.db.Get(key, opts...)
+		if err != nil {
+			writeDBError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, kv)
+	case http.MethodPut:
+		opts, err := writeOpts(r.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		var value bt.Value
+		if err := json.NewDecoder(r.Body).Decode(&value); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("failed to decode value: %v", err))
+			return
+		}
+		if err := h.db.Set(key, value, opts...); err != nil {
+			writeDBError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		opts, err := writeOpts(r.URL.Query())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := h.db.Delete(key, opts...); err != nil {
+			writeDBError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+	}
+}
+
+func (h *handler) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+	key, err := pathKey(r.URL, historyPath)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	opts, err := readOpts(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	kvs, err := h.db.History(key, opts...)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, kvs)
+}
+
+// QueryRequest is the body of a query request.
+type QueryRequest struct {
+	Query string `json:"query"`
+}
+
+// QueryResponse is the body of a successful query response. Result is a versioned key-value for GET, a list of
+// versioned key-values for LIST and HISTORY, and null for SET and DELETE.
+type QueryResponse struct {
+	Result interface{} `json:"result"`
+}
+
+func (h *handler) handleQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %v not allowed", r.Method))
+		return
+	}
+	var req QueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("failed to decode request: %v", err))
+		return
+	}
+	s, err := query.Parse(req.Query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("failed to parse query: %v", err))
+		return
+	}
+	res, err := s.Exec(h.db)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, QueryResponse{Result: res})
+}
+
+// pathKey returns the unescaped key following the route prefix.
+func pathKey(u *url.URL, prefix string) (string, error) {
+	key := strings.TrimPrefix(u.EscapedPath(), prefix)
+	key, err := url.PathUnescape(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse key: %v", err)
+	}
+	if key == "" {
+		return "", errors.New("key is required")
+	}
+	return key, nil
+}
+
+func readOpts(q url.Values) ([]bt.ReadOpt, error) {
+	var opts []bt.ReadOpt
+	validTime, err := queryTime(q, "valid_time")
+	if err != nil {
+		return nil, err
+	}
+	if validTime != nil {
+		opts = append(opts, bt.AsOfValidTime(*validTime))
+	}
+	txTime, err := queryTime(q, "tx_time")
+	if err != nil {
+		return nil, err
+	}
+	if txTime != nil {
+		opts = append(opts, bt.AsOfTransactionTime(*txTime))
+	}
+	validTimeAgo, err := queryDuration(q, "valid_time_ago")
+	if err != nil {
+		return nil, err
+	}
+	if validTimeAgo != nil {
+		opts = append(opts, bt.AsOfValidAgo(*validTimeAgo))
+	}
+	txTimeAgo, err := queryDuration(q, "tx_time_ago")
+	if err != nil {
+		return nil, err
+	}
+	if txTimeAgo != nil {
+		opts = append(opts, bt.AsOfTransactionAgo(*txTimeAgo))
+	}
+	windowStart, err := queryTime(q, "valid_window_start")
+	if err != nil {
+		return nil, err
+	}
+	windowEnd, err := queryTime(q, "valid_window_end")
+	if err != nil {
+		return nil, err
+	}
+	if (windowStart == nil) != (windowEnd == nil) {
+		return nil, errors.New("valid_window_start and valid_window_end must be set together")
+	}
+	if windowStart != nil {
+		opts = append(opts, bt.WithValidTimeWindow(*windowStart, *windowEnd))
+	}
+	filter := bt.KeyFilter{Prefix: q.Get("key_prefix"), Glob: q.Get("key_glob")}
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	if filter.Prefix != "" {
+		opts = append(opts, bt.WithKeyPrefix(filter.Prefix))
+	}
+	if filter.Glob != "" {
+		opts = append(opts, bt.WithKeyGlob(filter.Glob))
+	}
+	return opts, nil
+}
+
+func writeOpts(q url.Values) ([]bt.WriteOpt, error) {
+	var opts []bt.WriteOpt
+	validTime, err := queryTime(q, "valid_time")
+	if err != nil {
+		return nil, err
+	}
+	if validTime != nil {
+		opts = append(opts, bt.WithValidTime(*validTime))
+	}
+	endValidTime, err := queryTime(q, "end_valid_time")
+	if err != nil {
+		return nil, err
+	}
+	if endValidTime != nil {
+		opts = append(opts, bt.WithEndValidTime(*endValidTime))
+	}
+	validDuration, err := queryDuration(q, "valid_duration")
+	if err != nil {
+		return nil, err
+	}
+	if validDuration != nil {
+		opts = append(opts, bt.WithValidDuration(*validDuration))
+	}
+	if q.Get("all_valid_time") == "true" {
+		opts = append(opts, bt.WithAllValidTime())
+	}
+	if q.Get("future_valid_time") == "true" {
+		opts = append(opts, bt.WithFutureValidTime())
+	}
+	switch p := q.Get("overlap_policy"); p {
+	case "":
+	case bt.OverlapClip.String():
+		opts = append(opts, bt.WithOverlapPolicy(bt.OverlapClip))
+	case bt.OverlapReject.String():
+		opts = append(opts, bt.WithOverlapPolicy(bt.OverlapReject))
+	default:
+		return nil, fmt.Errorf("unknown overlap_policy %v", p)
+	}
+	switch p := q.Get("overhang_policy"); p {
+	case "":
+	case bt.OverhangReassert.String():
+		opts = append(opts, bt.WithOverhangPolicy(bt.OverhangReassert))
+	case bt.OverhangTruncate.String():
+		opts = append(opts, bt.WithOverhangPolicy(bt.OverhangTruncate))
+	case bt.OverhangReject.String():
+		opts = append(opts, bt.WithOverhangPolicy(bt.OverhangReject))
+	default:
+		return nil, fmt.Errorf("unknown overhang_policy %v", p)
+	}
+	if k := q.Get("idempotency_key"); k != "" {
+		opts = append(opts, bt.WithIdempotencyKey(k))
+	}
+	return opts, nil
+}
+
+func queryDuration(q url.Values, name string) (*time.Duration, error) {
+	s := q.Get(name)
+	if s == "" {
+		return nil, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %v: %v", name, err)
+	}
+	return &d, nil
+}
+
+func queryTime(q url.Values, name string) (*time.Time, error) {
+	s := q.Get(name)
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %v: %v", name, err)
+	}
+	return &t, nil
+}
+
+func writeDBError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, bt.ErrNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, auth.ErrForbidden):
+		writeError(w, http.StatusForbidden, err)
+	case errors.Is(err, bt.ErrOverlap), errors.Is(err, bt.ErrOverhang), errors.Is(err, bt.ErrHistoryLimit),
+		errors.Is(err, bt.ErrTxTimeRegressed):
+		writeError(w, http.StatusConflict, err)
+	case errors.Is(err, bt.ErrInvalidWrite), errors.Is(err, bt.ErrNilValue), errors.Is(err, path.ErrBadPattern):
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, ErrorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,320 @@
+package http_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/elh/bitempura/dbtest"
+	"github.com/elh/bitempura/dbtest/tt"
+	"github.com/elh/bitempura/memory"
+	bthttp "github.com/elh/bitempura/server/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	t1 = tt.Day(1)
+	t2 = tt.Day(2)
+	t3 = tt.Day(3)
+)
+
+func TestHandler(t *testing.T) {
+	clock := &clock.Clock{}
+	db, err := memory.NewDB(memory.WithClock(clock))
+	require.Nil(t, err)
+	server := httptest.NewServer(bthttp.NewHandler(db))
+	defer server.Close()
+
+	do := func(method, path, body string) (int, string) {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		require.Nil(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		require.Nil(t, err)
+		return resp.StatusCode, string(b)
+	}
+	decodeKV := func(s string) *bt.VersionedKV {
+		var kv bt.VersionedKV
+		require.Nil(t, json.Unmarshal([]byte(s), &kv))
+		return &kv
+	}
+
+	require.Nil(t, clock.SetNow(t1))
+	status, _ := do(http.MethodPut, "/kv/Bob/balance", `100`)
+	require.Equal(t, http.StatusNoContent, status)
+	require.Nil(t, clock.SetNow(t3))
+	status, _ = do(http.MethodPut, "/kv/Bob/balance?valid_time="+t2.Format(time.RFC3339), `90`)
+	require.Equal(t, http.StatusNoContent, status)
+
+	t.Run("get", func(t *testing.T) {
+		status, body := do(http.MethodGet, "/kv/Bob/balance", "")
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, 90.0, decodeKV(body).Value)
+	})
+	t.Run("get as of times", func(t *testing.T) {
+		status, body := do(http.MethodGet, "/kv/Bob/balance?valid_time="+t1.Format(time.RFC3339)+"&tx_time="+t1.Format(time.RFC3339), "")
+		require.Equal(t, http.StatusOK, status)
+		assert.Equal(t, 100.0, decodeKV(body).Value)
+	})
+	t.Run("get not found", func(t *testing.T) {
+		status, _ := do(http.MethodGet, "/kv/Alice/balance", "")
+		require.Equal(t, http.StatusNotFound, status)
+	})
+	t.Run("get bad time", func(t *testing.T) {
+		status, _ := do(http.MethodGet, "/kv/Bob/balance?valid_time=yesterday", "")
+		require.Equal(t, http.StatusBadRequest, status)
+	})
+	t.Run("list", func(t *testing.T) {
+		status, body := do(http.MethodGet, "/kv", "")
+		require.Equal(t, http.StatusOK, status)
+		var kvs []*bt.VersionedKV
+		require.Nil(t, json.Unmarshal([]byte(body), &kvs))
+		require.Len(t, kvs, 1)
+		assert.Equal(t, "Bob/balance", kvs[0].Key)
+	})
+	t.Run("history", func(t *testing.T) {
+		status, body := do(http.MethodGet, "/history/Bob/balance", "")
+		require.Equal(t, http.StatusOK, status)
+		var kvs []*bt.VersionedKV
+		require.Nil(t, json.Unmarshal([]byte(body), &kvs))
+		assert.Len(t, kvs, 3)
+	})
+	t.Run("query", func(t *testing.T) {
+		status, body := do(http.MethodPost, "/query", `{"query": "GET Bob/balance AS OF VALID 2022-01-01 TX 2022-01-01"}`)
+		require.Equal(t, http.StatusOK, status)
+		var resp struct{ Result *bt.VersionedKV }
+		require.Nil(t, json.Unmarshal([]byte(body), &resp))
+		assert.Equal(t, 100.0, resp.Result.Value)
+
+		status, _ = do(http.MethodPost, "/query", `{"query": "GET"}`)
+		require.Equal(t, http.StatusBadRequest, status)
+		status, _ = do(http.MethodPost, "/query", `{"query": "GET Alice/balance"}`)
+		require.Equal(t, http.StatusNotFound, status)
+	})
+	t.Run("delete", func(t *testing.T) {
+		status, _ := do(http.MethodDelete, "/kv/Bob/balance", "")
+		require.Equal(t, http.StatusNoContent, status)
+		status, _ = do(http.MethodGet, "/kv/Bob/balance", "")
+		require.Equal(t, http.StatusNotFound, status)
+	})
+}
+
+func TestHandlerErrorStatus(t *testing.T) {
+	c := clock.New(t2)
+	db, err := memory.NewDB(memory.WithClock(c), memory.WithStrictTxTime(),
+		memory.WithNilValuePolicy(bt.NilValueReject), memory.WithHistoryLimit(1, bt.HistoryLimitReject))
+	require.Nil(t, err)
+	server := httptest.NewServer(bthttp.NewHandler(db))
+	defer server.Close()
+	client := bthttp.NewClient(server.URL, nil)
+
+	do := func(method, path, body string) int {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		require.Nil(t, err)
+		resp, err := http.DefaultClient.Do(req)
+		require.Nil(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	require.Equal(t, http.StatusNoContent, do(http.MethodPut, "/kv/A", `1`))
+	require.Equal(t, http.StatusNoContent, do(http.MethodPut, "/kv/C?valid_time="+t1.Format(time.RFC3339), `1`))
+	overhang := "/kv/C?overhang_policy=reject&valid_time=" + t1.Format(time.RFC3339) + "&end_valid_time=" +
+		t1.Add(time.Hour).Format(time.RFC3339)
+	for _, tC := range []struct {
+		desc     string
+		method   string
+		path     string
+		body     string
+		expected int
+	}{
+		{"future valid time", http.MethodPut, "/kv/B?valid_time=" + t3.Format(time.RFC3339), `1`, http.StatusBadRequest},
+		{"end before start", http.MethodPut, "/kv/B?valid_time=" + t1.Format(time.RFC3339) + "&end_valid_time=" +
+			t1.Format(time.RFC3339), `1`, http.StatusBadRequest},
+		{"nil value", http.MethodPut, "/kv/B", `null`, http.StatusBadRequest},
+		{"bad glob", http.MethodGet, "/kv?key_glob=%5B", "", http.StatusBadRequest},
+		{"history limit", http.MethodPut, "/kv/A?valid_time=" + t1.Format(time.RFC3339), `2`, http.StatusConflict},
+		{"overhang", http.MethodPut, overhang, `2`, http.StatusConflict},
+	} {
+		t.Run(tC.desc, func(t *testing.T) {
+			assert.Equal(t, tC.expected, do(tC.method, tC.path, tC.body))
+		})
+	}
+
+	// the client returns the errors
+	assert.ErrorIs(t, client.Set("B", 1.0, bt.WithValidTime(t3)), bt.ErrInvalidWrite)
+	assert.ErrorIs(t, client.Set("B", nil), bt.ErrNilValue)
+	assert.ErrorIs(t, client.Set("A", 2.0, bt.WithValidTime(t1)), bt.ErrHistoryLimit)
+	assert.ErrorIs(t, client.Set("C", 2.0, bt.WithValidTime(t1), bt.WithEndValidTime(t1.Add(time.Hour)),
+		bt.WithOverhangPolicy(bt.OverhangReject)), bt.ErrOverhang)
+	_, err = client.List(bt.WithKeyGlob("["))
+	assert.ErrorIs(t, err, path.ErrBadPattern)
+
+	c2 := clock.New(t2)
+	regressed, err := memory.NewDB(memory.WithClock(c2), memory.WithStrictTxTime(), memory.WithLastTxTime(t3))
+	require.Nil(t, err)
+	regressedServer := httptest.NewServer(bthttp.NewHandler(regressed))
+	defer regressedServer.Close()
+	assert.ErrorIs(t, bthttp.NewClient(regressedServer.URL, nil).Set("A", 1.0), bt.ErrTxTimeRegressed)
+}
+
+func TestClient(t *testing.T) {
+	clock := &clock.Clock{}
+	db, err := memory.NewDB(memory.WithClock(clock))
+	require.Nil(t, err)
+	server := httptest.NewServer(bthttp.NewHandler(db))
+	defer server.Close()
+	client := bthttp.NewClient(server.URL, nil)
+
+	require.Nil(t, clock.SetNow(t1))
+	require.Nil(t, client.Set("Bob/balance", 100.0, bt.WithIdempotencyKey("bob-1")))
+	require.Nil(t, clock.SetNow(t3))
+	require.Nil(t, client.Set("Bob/balance", 100.0, bt.WithIdempotencyKey("bob-1"))) // retry is a no-op
+	require.Nil(t, client.Set("Bob/balance", 90.0, bt.WithValidTime(t2)))
+	require.NotNil(t, client.Set("Bob/balance", 80.0, bt.WithValidTime(t3.Add(time.Hour)))) // in the future
+
+	kv, err := client.Get("Bob/balance")
+	require.Nil(t, err)
+	assert.Equal(t, 90.0, kv.Value)
+	kv, err = client.Get("Bob/balance", bt.AsOfValidTime(t1))
+	require.Nil(t, err)
+	assert.Equal(t, 100.0, kv.Value)
+	kv, err = client.Get("Bob/balance", bt.AsOfValidAgo(t3.Sub(t1)))
+	require.Nil(t, err)
+	assert.Equal(t, 100.0, kv.Value)
+	_, err = client.Get("Alice/balance")
+	require.ErrorIs(t, err, bt.ErrNotFound)
+
+	kvs, err := client.List()
+	require.Nil(t, err)
+	assert.Len(t, kvs, 1)
+	kvs, err = client.History("Bob/balance")
+	require.Nil(t, err)
+	assert.Len(t, kvs, 3)
+
+	require.Nil(t, client.Delete("Bob/balance"))
+	_, err = client.Get("Bob/balance")
+	require.ErrorIs(t, err, bt.ErrNotFound)
+}
+
+func TestOverlapPolicy(t *testing.T) {
+	dbtest.TestOverlapPolicy(t, "Old", "New", func(clock bt.Clock) (bt.DB, error) {
+		db, err := memory.NewDB(memory.WithClock(clock))
+		if err != nil {
+			return nil, err
+		}
+		server := httptest.NewServer(bthttp.NewHandler(db))
+		t.Cleanup(server.Close)
+		return bthttp.NewClient(server.URL, nil), nil
+	})
+}
+
+func TestAllValidTime(t *testing.T) {
+	dbtest.TestAllValidTime(t, "Old", "New", func(clock bt.Clock) (bt.DB, error) {
+		db, err := memory.NewDB(memory.WithClock(clock))
+		if err != nil {
+			return nil, err
+		}
+		server := httptest.NewServer(bthttp.NewHandler(db))
+		t.Cleanup(server.Close)
+		return bthttp.NewClient(server.URL, nil), nil
+	})
+}
+
+func TestKeyFilter(t *testing.T) {
+	dbtest.TestKeyFilter(t, "Old", "New", func(clock bt.Clock) (bt.DB, error) {
+		db, err := memory.NewDB(memory.WithClock(clock))
+		if err != nil {
+			return nil, err
+		}
+		server := httptest.NewServer(bthttp.NewHandler(db))
+		t.Cleanup(server.Close)
+		return bthttp.NewClient(server.URL, nil), nil
+	})
+}
+
+func TestValidDuration(t *testing.T) {
+	dbtest.TestValidDuration(t, "Old", "New", func(clock bt.Clock) (bt.DB, error) {
+		db, err := memory.NewDB(memory.WithClock(clock))
+		if err != nil {
+			return nil, err
+		}
+		server := httptest.NewServer(bthttp.NewHandler(db))
+		t.Cleanup(server.Close)
+		return bthttp.NewClient(server.URL, nil), nil
+	})
+}
+
+func TestFutureValidTime(t *testing.T) {
+	dbtest.TestFutureValidTime(t, "Old", "New", func(clock bt.Clock) (bt.DB, error) {
+		db, err := memory.NewDB(memory.WithClock(clock))
+		if err != nil {
+			return nil, err
+		}
+		server := httptest.NewServer(bthttp.NewHandler(db))
+		t.Cleanup(server.Close)
+		return bthttp.NewClient(server.URL, nil), nil
+	})
+}
+
+func TestBeginningOfTime(t *testing.T) {
+	dbtest.TestBeginningOfTime(t, "Old", "New", func(clock bt.Clock) (bt.DB, error) {
+		db, err := memory.NewDB(memory.WithClock(clock))
+		if err != nil {
+			return nil, err
+		}
+		server := httptest.NewServer(bthttp.NewHandler(db))
+		t.Cleanup(server.Close)
+		return bthttp.NewClient(server.URL, nil), nil
+	})
+}
+
+func TestOverhangPolicy(t *testing.T) {
+	dbtest.TestOverhangPolicy(t, "Old", "New", func(clock bt.Clock) (bt.DB, error) {
+		db, err := memory.NewDB(memory.WithClock(clock))
+		if err != nil {
+			return nil, err
+		}
+		server := httptest.NewServer(bthttp.NewHandler(db))
+		t.Cleanup(server.Close)
+		return bthttp.NewClient(server.URL, nil), nil
+	})
+}
+
+func init() {
+	dbtest.RegisterBackend("memory", dbtest.Backend{
+		Capabilities: []dbtest.Capability{dbtest.CapabilityWrite, dbtest.CapabilityClock},
+		NewDB: func(_ []*bt.VersionedKV, clock bt.Clock) (bt.DB, func(), error) {
+			db, err := memory.NewDB(memory.WithClock(clock))
+			return db, func() {}, err
+		},
+	})
+	dbtest.RegisterBackend("http", dbtest.Backend{
+		Capabilities: []dbtest.Capability{dbtest.CapabilityWrite, dbtest.CapabilityClock},
+		NewDB: func(_ []*bt.VersionedKV, clock bt.Clock) (bt.DB, func(), error) {
+			db, err := memory.NewDB(memory.WithClock(clock))
+			if err != nil {
+				return nil, nil, err
+			}
+			server := httptest.NewServer(bthttp.NewHandler(db))
+			return bthttp.NewClient(server.URL, nil), server.Close, nil
+		},
+	})
+}
+
+// TestEquivalence checks the client over the handler behaves identically to the DB it serves.
+func TestEquivalence(t *testing.T) {
+	for seed := int64(1); seed <= 10; seed++ {
+		dbtest.TestRegisteredEquivalence(t, dbtest.RandomScript(seed, 60))
+	}
+}
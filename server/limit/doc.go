@@ -0,0 +1,3 @@
+// Package limit provides server middleware for per-client rate limits and maximum request sizes so one misbehaving
+// client can not monopolize a shared DB.
+package limit
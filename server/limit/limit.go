@@ -0,0 +1,163 @@
+package limit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Opt is an option for constructing a limiting handler.
+type Opt func(*options)
+
+type options struct {
+	limit        rate.Limit
+	burst        int
+	clientKey    func(r *http.Request) string
+	cost         func(r *http.Request) int
+	maxBodyBytes int64
+	idleTimeout  time.Duration
+}
+
+// WithRateLimit limits each client to rps request cost per second with bursts of up to burst. By default, requests are
+// not rate limited.
+func WithRateLimit(rps float64, burst int) Opt {
+	return func(o *options) {
+		o.limit = rate.Limit(rps)
+		o.burst = burst
+	}
+}
+
+// WithClientKey sets the function identifying the client of a request, e.g. an API key header or authenticated
+// principal. Defaults to RemoteIP.
+func WithClientKey(fn func(r *http.Request) string) Opt {
+	return func(o *options) {
+		o.clientKey = fn
+	}
+}
+
+// WithCost sets the function returning the rate limit cost of a request so expensive requests like full-history reads
+// and lists consume more of a client's budget. Defaults to 1 for all requests. Costs greater than the burst are always
+// rejected.
+func WithCost(fn func(r *http.Request) int) Opt {
+	return func(o *options) {
+		o.cost = fn
+	}
+}
+
+// WithMaxBodyBytes rejects request bodies larger than n bytes with a 413. By default, bodies are not limited.
+func WithMaxBodyBytes(n int64) Opt {
+	return func(o *options) {
+		o.maxBodyBytes = n
+	}
+}
+
+// WithIdleTimeout sets how long a client's rate limit state is kept after its last request. Defaults to 10 minutes.
+func WithIdleTimeout(d time.Duration) Opt {
+	return func(o *options) {
+		o.idleTimeout = d
+	}
+}
+
+// RemoteIP returns the IP address of the request's remote address.
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// NewHandler wraps h with rate limiting and request size limits. Rate limited requests receive 429s with a
+// Retry-After header.
+func NewHandler(h http.Handler, opts ...Opt) http.Handler {
+	options := &options{
+		limit:       rate.Inf,
+		clientKey:   RemoteIP,
+		cost:        func(*http.Request) int { return 1 },
+		idleTimeout: 10 * time.Minute,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return &handler{h: h, options: options, clients: map[string]*client{}}
+}
+
+type handler struct {
+	h       http.Handler
+	options *options
+
+	m         sync.Mutex
+	clients   map[string]*client
+	lastSweep time.Time
+}
+
+type client struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if max := h.options.maxBodyBytes; max > 0 {
+		if r.ContentLength > max {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("request body exceeds %v bytes", max))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, max)
+	}
+
+	if h.options.limit != rate.Inf {
+		now := time.Now()
+		res := h.limiter(h.options.clientKey(r), now).ReserveN(now, h.options.cost(r))
+		if !res.OK() {
+			writeError(w, http.StatusTooManyRequests, fmt.Errorf("request cost exceeds rate limit burst"))
+			return
+		}
+		if delay := res.DelayFrom(now); delay > 0 {
+			res.CancelAt(now)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, fmt.Errorf("rate limit exceeded"))
+			return
+		}
+	}
+
+	h.h.ServeHTTP(w, r)
+}
+
+// limiter returns the client's limiter, sweeping idle clients at most once per idle timeout.
+func (h *handler) limiter(key string, now time.Time) *rate.Limiter {
+	h.m.Lock()
+	defer h.m.Unlock()
+	if now.Sub(h.lastSweep) > h.options.idleTimeout {
+		for k, c := range h.clients {
+			if now.Sub(c.lastSeen) > h.options.idleTimeout {
+				delete(h.clients, k)
+			}
+		}
+		h.lastSweep = now
+	}
+	c, ok := h.clients[key]
+	if !ok {
+		c = &client{limiter: rate.NewLimiter(h.options.limit, h.options.burst)}
+		h.clients[key] = c
+	}
+	c.lastSeen = now
+	return c.limiter
+}
+
+// errorResponse matches the error body of server/http.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,68 @@
+package limit_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/elh/bitempura/server/limit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	do := func(h http.Handler, method, path, remoteAddr, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("rate limit per client", func(t *testing.T) {
+		h := limit.NewHandler(ok, limit.WithRateLimit(0.001, 2))
+		assert.Equal(t, http.StatusOK, do(h, http.MethodGet, "/kv", "10.0.0.1:1234", "").Code)
+		assert.Equal(t, http.StatusOK, do(h, http.MethodGet, "/kv", "10.0.0.1:1235", "").Code)
+		w := do(h, http.MethodGet, "/kv", "10.0.0.1:1236", "")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+		// other clients have their own budget
+		assert.Equal(t, http.StatusOK, do(h, http.MethodGet, "/kv", "10.0.0.2:1234", "").Code)
+	})
+	t.Run("cost", func(t *testing.T) {
+		cost := func(r *http.Request) int {
+			if strings.HasPrefix(r.URL.Path, "/history/") {
+				return 5
+			}
+			return 1
+		}
+		h := limit.NewHandler(ok, limit.WithRateLimit(0.001, 5), limit.WithCost(cost),
+			limit.WithClientKey(func(r *http.Request) string { return r.Header.Get("X-API-Key") }))
+		assert.Equal(t, http.StatusOK, do(h, http.MethodGet, "/history/a", "", "").Code)
+		assert.Equal(t, http.StatusTooManyRequests, do(h, http.MethodGet, "/kv/a", "", "").Code)
+
+		h = limit.NewHandler(ok, limit.WithRateLimit(0.001, 2), limit.WithCost(cost))
+		assert.Equal(t, http.StatusTooManyRequests, do(h, http.MethodGet, "/history/a", "10.0.0.1:1234", "").Code)
+	})
+	t.Run("max body bytes", func(t *testing.T) {
+		h := limit.NewHandler(ok, limit.WithMaxBodyBytes(4))
+		assert.Equal(t, http.StatusOK, do(h, http.MethodPut, "/kv/a", "10.0.0.1:1234", "1234").Code)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, do(h, http.MethodPut, "/kv/a", "10.0.0.1:1234", "12345").Code)
+
+		// bodies without a declared length are cut off while reading
+		req := httptest.NewRequest(http.MethodPut, "/kv/a", io.NopCloser(strings.NewReader("12345")))
+		req.ContentLength = -1
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		require.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,3 @@
+// Package tenant routes server requests to per-tenant DBs so one deployment can serve many teams. Tenants may be
+// backed by separate DBs or by key namespaces of a shared DB.
+package tenant
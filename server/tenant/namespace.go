@@ -0,0 +1,152 @@
+package tenant
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/changefeed"
+)
+
+var _ bt.DB = (*NamespaceDB)(nil)
+var _ bt.KeyLister = (*NamespaceDB)(nil)
+
+// NewNamespaceDB constructs a DB that stores all keys in db under the prefix "<namespace>/". Keys are returned without
+// the prefix and keys outside of the namespace are never visible. If db emits change events (see changefeed.DB), the
+// returned DB does as well for keys in the namespace.
+func NewNamespaceDB(db bt.DB, namespace string) (bt.DB, error) {
+	if err := ValidateName(namespace); err != nil {
+		return nil, err
+	}
+	ndb := &NamespaceDB{db: db, prefix: namespace + "/"}
+	if s, ok := db.(subscriber); ok {
+		return &subscriberNamespaceDB{NamespaceDB: ndb, s: s}, nil
+	}
+	return ndb, nil
+}
+
+// ValidateName returns an error if name is not a valid tenant or namespace name. Names are non-empty and only contain
+// ASCII letters, digits, "-", and "_" so they can not overlap when used as key prefixes or path segments.
+func ValidateName(name string) error {
+	if name == "" {
+		return errors.New("name is required")
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return errors.New("name may only contain letters, digits, '-', and '_'")
+		}
+	}
+	return nil
+}
+
+// NamespaceDB is a DB scoped to a key namespace of an underlying DB.
+type NamespaceDB struct {
+	db     bt.DB
+	prefix string
+}
+
+// Get data by key (as of optional valid and transaction times).
+func (db *NamespaceDB) Get(key string, opts ...bt.ReadOpt) (*bt.VersionedKV, error) {
+	kv, err := db.db.Get(db.prefix+key, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return db.strip(kv), nil
+}
+
+// List all data (as of optional valid and transaction times).
+func (db *NamespaceDB) List(opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	kvs, err := db.db.List(opts...)
+	if err != nil {
+		return nil, err
+	}
+	out := []*bt.VersionedKV{}
+	for _, kv := range kvs {
+		if strings.HasPrefix(kv.Key, db.prefix) {
+			out = append(out, db.strip(kv))
+		}
+	}
+	return out, nil
+}
+
+// Set stores value (with optional start and end valid time).
+func (db *NamespaceDB) Set(key string, value bt.Value, opts ...bt.WriteOpt) error {
+	return db.db.Set(db.prefix+key, value, opts...)
+}
+
+// Delete removes value (with optional start and end valid time).
+func (db *NamespaceDB) Delete(key string, opts ...bt.WriteOpt) error {
+	return db.db.Delete(db.prefix+key, opts...)
+}
+
+// History returns versions by descending end transaction time, descending end valid time
+func (db *NamespaceDB) History(key string, opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	kvs, err := db.db.History(db.prefix+key, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return db.stripAll(kvs), nil
+}
+
+// Keys returns all keys in the namespace. The underlying DB must be a bt.KeyLister.
+func (db *NamespaceDB) Keys() ([]string, error) {
+	kl, ok := db.db.(bt.KeyLister)
+	if !ok {
+		return nil, errors.New("underlying DB does not list keys")
+	}
+	keys, err := kl.Keys()
+	if err != nil {
+		return nil, err
+	}
+	out := []string{}
+	for _, k := range keys {
+		if strings.HasPrefix(k, db.prefix) {
+			out = append(out, strings.TrimPrefix(k, db.prefix))
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// strip returns a copy of kv without the namespace prefix. Versions are copied since DBs may return internal state.
+func (db *NamespaceDB) strip(kv *bt.VersionedKV) *bt.VersionedKV {
+	out := *kv
+	out.Key = strings.TrimPrefix(kv.Key, db.prefix)
+	return &out
+}
+
+func (db *NamespaceDB) stripAll(kvs []*bt.VersionedKV) []*bt.VersionedKV {
+	if kvs == nil {
+		return nil
+	}
+	out := make([]*bt.VersionedKV, len(kvs))
+	for i, kv := range kvs {
+		out[i] = db.strip(kv)
+	}
+	return out
+}
+
+// subscriber is a DB that emits change events, e.g. changefeed.DB.
+type subscriber interface {
+	Subscribe(fn func(changefeed.Event)) (cancel func())
+}
+
+// subscriberNamespaceDB is a NamespaceDB over a DB that emits change events.
+type subscriberNamespaceDB struct {
+	*NamespaceDB
+	s subscriber
+}
+
+// Subscribe registers fn to be called with every Event for keys in the namespace.
+func (db *subscriberNamespaceDB) Subscribe(fn func(changefeed.Event)) (cancel func()) {
+	return db.s.Subscribe(func(e changefeed.Event) {
+		if !strings.HasPrefix(e.Key, db.prefix) {
+			return
+		}
+		e.Key = strings.TrimPrefix(e.Key, db.prefix)
+		e.Created = db.stripAll(e.Created)
+		e.Closed = db.stripAll(e.Closed)
+		fn(e)
+	})
+}
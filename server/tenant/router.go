@@ -0,0 +1,154 @@
+package tenant
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	bt "github.com/elh/bitempura"
+)
+
+// DefaultPathPrefix is the default path prefix of tenant routes. Requests to /tenants/<tenant>/<route> are served by
+// the tenant's handler at /<route>.
+const DefaultPathPrefix = "/tenants/"
+
+// DBFunc returns the DB for a tenant. It is called at most once per tenant by a Router.
+type DBFunc func(tenant string) (bt.DB, error)
+
+// Namespaced returns a DBFunc that isolates each tenant in its own key namespace of a shared DB.
+func Namespaced(db bt.DB) DBFunc {
+	return func(tenant string) (bt.DB, error) {
+		return NewNamespaceDB(db, tenant)
+	}
+}
+
+// RouterOpt is an option for constructing a Router.
+type RouterOpt func(*routerOptions)
+
+type routerOptions struct {
+	pathPrefix string
+	header     string
+	allow      func(tenant string) bool
+}
+
+// WithPathPrefix sets the path prefix that the tenant name follows. Defaults to DefaultPathPrefix.
+func WithPathPrefix(prefix string) RouterOpt {
+	return func(o *routerOptions) {
+		o.pathPrefix = "/" + strings.Trim(prefix, "/") + "/"
+	}
+}
+
+// WithHeader reads the tenant name from a request header instead of the path. Paths are passed through unchanged.
+func WithHeader(header string) RouterOpt {
+	return func(o *routerOptions) {
+		o.header = header
+	}
+}
+
+// WithAllow restricts the tenants served. Requests for other tenants receive 404s. By default, all validly named
+// tenants are served.
+func WithAllow(fn func(tenant string) bool) RouterOpt {
+	return func(o *routerOptions) {
+		o.allow = fn
+	}
+}
+
+// NewRouter constructs a http.Handler that routes each request to the handler of its tenant. Each tenant's handler is
+// constructed once with newHandler over the DB returned by dbFn, e.g. with server/http.NewHandler or
+// server/ws.NewHandler.
+func NewRouter(dbFn DBFunc, newHandler func(bt.DB) http.Handler, opts ...RouterOpt) *Router {
+	options := &routerOptions{pathPrefix: DefaultPathPrefix}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return &Router{dbFn: dbFn, newHandler: newHandler, options: options, handlers: map[string]http.Handler{}}
+}
+
+// Router is a http.Handler routing requests to per-tenant handlers.
+type Router struct {
+	dbFn       DBFunc
+	newHandler func(bt.DB) http.Handler
+	options    *routerOptions
+
+	m        sync.Mutex
+	handlers map[string]http.Handler
+}
+
+// ServeHTTP implements http.Handler.
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tenant, r, err := rt.route(r)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err := ValidateName(tenant); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid tenant: %v", err))
+		return
+	}
+	if rt.options.allow != nil && !rt.options.allow(tenant) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown tenant: %v", tenant))
+		return
+	}
+	h, err := rt.handler(tenant)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	h.ServeHTTP(w, r)
+}
+
+// route returns the tenant of a request and the request to pass to the tenant's handler.
+func (rt *Router) route(r *http.Request) (string, *http.Request, error) {
+	if rt.options.header != "" {
+		tenant := r.Header.Get(rt.options.header)
+		if tenant == "" {
+			return "", nil, fmt.Errorf("%v header is required", rt.options.header)
+		}
+		return tenant, r, nil
+	}
+
+	if !strings.HasPrefix(r.URL.Path, rt.options.pathPrefix) {
+		return "", nil, fmt.Errorf("path must start with %v<tenant>", rt.options.pathPrefix)
+	}
+	rest := strings.TrimPrefix(r.URL.Path, rt.options.pathPrefix)
+	tenant, path := rest, "/"
+	if i := strings.IndexByte(rest, '/'); i >= 0 {
+		tenant, path = rest[:i], rest[i:]
+	}
+
+	r2 := r.Clone(r.Context())
+	r2.URL.Path = path
+	r2.URL.RawPath = ""
+	if r.URL.RawPath != "" {
+		r2.URL.RawPath = strings.TrimPrefix(r.URL.RawPath, rt.options.pathPrefix+tenant)
+	}
+	return tenant, r2, nil
+}
+
+func (rt *Router) handler(tenant string) (http.Handler, error) {
+	rt.m.Lock()
+	defer rt.m.Unlock()
+	if h, ok := rt.handlers[tenant]; ok {
+		return h, nil
+	}
+	db, err := rt.dbFn(tenant)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open DB for tenant %v: %v", tenant, err)
+	}
+	h := rt.newHandler(db)
+	rt.handlers[tenant] = h
+	return h, nil
+}
+
+// errorResponse matches the error body of server/http.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(errorResponse{Error: err.Error()})
+}
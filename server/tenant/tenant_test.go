@@ -0,0 +1,126 @@
+package tenant_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/changefeed"
+	"github.com/elh/bitempura/memory"
+	bthttp "github.com/elh/bitempura/server/http"
+	"github.com/elh/bitempura/server/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespaceDB(t *testing.T) {
+	shared, err := memory.NewDB()
+	require.Nil(t, err)
+	require.Nil(t, shared.Set("other", "x"))
+	db, err := tenant.NewNamespaceDB(shared, "acme")
+	require.Nil(t, err)
+
+	require.Nil(t, db.Set("a", 1))
+	require.Nil(t, db.Set("b", 2))
+	require.Nil(t, db.Delete("b"))
+
+	kv, err := db.Get("a")
+	require.Nil(t, err)
+	assert.Equal(t, "a", kv.Key)
+	_, err = db.Get("other")
+	assert.ErrorIs(t, err, bt.ErrNotFound)
+
+	kvs, err := db.List()
+	require.Nil(t, err)
+	require.Len(t, kvs, 1)
+	assert.Equal(t, "a", kvs[0].Key)
+
+	kvs, err = db.History("b")
+	require.Nil(t, err)
+	for _, kv := range kvs {
+		assert.Equal(t, "b", kv.Key)
+	}
+
+	keys, err := db.(bt.KeyLister).Keys()
+	require.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, keys)
+
+	// underlying versions are not modified
+	kv, err = shared.Get("acme/a")
+	require.Nil(t, err)
+	assert.Equal(t, "acme/a", kv.Key)
+
+	_, err = tenant.NewNamespaceDB(shared, "acme/x")
+	assert.NotNil(t, err)
+}
+
+func TestNamespaceDBSubscribe(t *testing.T) {
+	mdb, err := memory.NewDB()
+	require.Nil(t, err)
+	shared := changefeed.NewDB(mdb)
+	db, err := tenant.NewNamespaceDB(shared, "acme")
+	require.Nil(t, err)
+	s, ok := db.(interface {
+		Subscribe(fn func(changefeed.Event)) (cancel func())
+	})
+	require.True(t, ok)
+
+	var events []changefeed.Event
+	cancel := s.Subscribe(func(e changefeed.Event) { events = append(events, e) })
+	defer cancel()
+	require.Nil(t, shared.Set("globex/a", 1))
+	require.Nil(t, db.Set("a", 1))
+	require.Len(t, events, 1)
+	assert.Equal(t, "a", events[0].Key)
+	require.Len(t, events[0].Created, 1)
+	assert.Equal(t, "a", events[0].Created[0].Key)
+}
+
+func TestRouter(t *testing.T) {
+	shared, err := memory.NewDB()
+	require.Nil(t, err)
+
+	do := func(h http.Handler, method, path, tenantHeader string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader("1"))
+		if tenantHeader != "" {
+			req.Header.Set("X-Tenant", tenantHeader)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	t.Run("path prefix with namespaces", func(t *testing.T) {
+		router := tenant.NewRouter(tenant.Namespaced(shared), bthttp.NewHandler)
+		require.Nil(t, shared.Set("acme/a%b", 1))
+
+		assert.Equal(t, http.StatusOK, do(router, http.MethodGet, "/tenants/acme/kv/a%25b", ""))
+		assert.Equal(t, http.StatusNotFound, do(router, http.MethodGet, "/tenants/globex/kv/a%25b", ""))
+		assert.Equal(t, http.StatusNotFound, do(router, http.MethodGet, "/kv/acme/a%25b", ""))
+		assert.Equal(t, http.StatusBadRequest, do(router, http.MethodGet, "/tenants/ac.me/kv/a", ""))
+	})
+	t.Run("header with separate DBs", func(t *testing.T) {
+		var opened []string
+		dbFn := func(name string) (bt.DB, error) {
+			opened = append(opened, name)
+			if name == "broken" {
+				return nil, errors.New("boom")
+			}
+			return memory.NewDB()
+		}
+		router := tenant.NewRouter(dbFn, bthttp.NewHandler, tenant.WithHeader("X-Tenant"),
+			tenant.WithAllow(func(name string) bool { return name != "banned" }))
+
+		// isolation: writes to one tenant are not visible to another
+		assert.Equal(t, http.StatusNoContent, do(router, http.MethodPut, "/kv/a", "acme"))
+		assert.Equal(t, http.StatusOK, do(router, http.MethodGet, "/kv/a", "acme"))
+		assert.Equal(t, http.StatusNotFound, do(router, http.MethodGet, "/kv/a", "globex"))
+		assert.Equal(t, http.StatusNotFound, do(router, http.MethodGet, "/kv/a", ""))
+		assert.Equal(t, http.StatusNotFound, do(router, http.MethodGet, "/kv", "banned"))
+		assert.Equal(t, http.StatusInternalServerError, do(router, http.MethodGet, "/kv", "broken"))
+		assert.Equal(t, []string{"acme", "globex", "broken"}, opened)
+	})
+}
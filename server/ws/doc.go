@@ -0,0 +1,3 @@
+// Package ws exposes a bitempura.DB over JSON-RPC 2.0 on WebSockets, including subscriptions to change events, so
+// browser clients can connect to a real backend instead of only the in-page Wasm DB.
+package ws
@@ -0,0 +1,436 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/changefeed"
+	"github.com/elh/bitempura/query"
+	"github.com/elh/bitempura/server/auth"
+	"github.com/gorilla/websocket"
+)
+
+// Methods. Params are JSON objects. All times are RFC 3339 datetimes.
+//
+//	get          {key, valid_time?, tx_time?}             -> versioned key-value
+//	list         {valid_time?, tx_time?}                  -> versioned key-values
+//	set          {key, value, valid_time?, end_valid_time?} -> null
+//	delete       {key, valid_time?, end_valid_time?}      -> null
+//	history      {key}                                    -> versioned key-values
+//	query        {query}                                  -> result of the statement (see package query)
+//	subscribe    {key_prefix?}                            -> subscription id
+//	unsubscribe  {subscription}                           -> null
+//
+// Change events for subscriptions are sent as "change" notifications with ChangeParams.
+const (
+	MethodGet         = "get"
+	MethodList        = "list"
+	MethodSet         = "set"
+	MethodDelete      = "delete"
+	MethodHistory     = "history"
+	MethodQuery       = "query"
+	MethodSubscribe   = "subscribe"
+	MethodUnsubscribe = "unsubscribe"
+	MethodChange      = "change"
+)
+
+// JSON-RPC error codes. CodeNotFound is returned for bt.ErrNotFound and CodeForbidden for auth.ErrForbidden.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+	CodeForbidden      = -32003
+	CodeNotFound       = -32004
+)
+
+// Subscriber is a DB that emits change events. changefeed.DB is a Subscriber.
+type Subscriber interface {
+	Subscribe(fn func(changefeed.Event)) (cancel func())
+}
+
+// Request is a JSON-RPC request. Requests without an ID are notifications and receive no response.
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// Response is a JSON-RPC response. It is encoded with exactly one of result and error.
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// MarshalJSON encodes the response with its error if set, and otherwise with its result, which may be null.
+func (r Response) MarshalJSON() ([]byte, error) {
+	if r.Error != nil {
+		return json.Marshal(struct {
+			JSONRPC string          `json:"jsonrpc"`
+			ID      json.RawMessage `json:"id"`
+			Error   *Error          `json:"error"`
+		}{r.JSONRPC, r.ID, r.Error})
+	}
+	return json.Marshal(struct {
+		JSONRPC string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+		Result  interface{}     `json:"result"`
+	}{r.JSONRPC, r.ID, r.Result})
+}
+
+// Error is a JSON-RPC error.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v (code %v)", e.Message, e.Code)
+}
+
+// Notification is a JSON-RPC notification sent by the server.
+type Notification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// ChangeParams are the params of a "change" notification.
+type ChangeParams struct {
+	Subscription int              `json:"subscription"`
+	Event        changefeed.Event `json:"event"`
+}
+
+// ReadParams are the params of get, list, and history.
+type ReadParams struct {
+	Key       string     `json:"key"`
+	ValidTime *time.Time `json:"valid_time"`
+	TxTime    *time.Time `json:"tx_time"`
+}
+
+// WriteParams are the params of set and delete.
+type WriteParams struct {
+	Key          string     `json:"key"`
+	Value        bt.Value   `json:"value"`
+	ValidTime    *time.Time `json:"valid_time"`
+	EndValidTime *time.Time `json:"end_valid_time"`
+}
+
+// QueryParams are the params of query.
+type QueryParams struct {
+	Query string `json:"query"`
+}
+
+// SubscribeParams are the params of subscribe. Only events for keys with KeyPrefix are sent.
+type SubscribeParams struct {
+	KeyPrefix string `json:"key_prefix"`
+}
+
+// UnsubscribeParams are the params of unsubscribe.
+type UnsubscribeParams struct {
+	Subscription int `json:"subscription"`
+}
+
+// HandlerOpt is an option for constructing a Handler.
+type HandlerOpt func(*handlerOptions)
+
+type handlerOptions struct {
+	upgrader        websocket.Upgrader
+	bufferSize      int
+	maxMessageBytes int64
+}
+
+// WithCheckOrigin sets the function used to validate the Origin header of upgrade requests. By default, cross-origin
+// requests are rejected.
+func WithCheckOrigin(fn func(r *http.Request) bool) HandlerOpt {
+	return func(o *handlerOptions) {
+		o.upgrader.CheckOrigin = fn
+	}
+}
+
+// WithBufferSize sets the number of outgoing messages buffered per connection. Connections that fall this far behind
+// are closed. Defaults to 256.
+func WithBufferSize(n int) HandlerOpt {
+	return func(o *handlerOptions) {
+		o.bufferSize = n
+	}
+}
+
+// WithMaxMessageBytes closes connections that send messages larger than n bytes. By default, messages are not
+// limited.
+func WithMaxMessageBytes(n int64) HandlerOpt {
+	return func(o *handlerOptions) {
+		o.maxMessageBytes = n
+	}
+}
+
+// NewHandler constructs a http.Handler that upgrades requests to WebSockets serving the DB over JSON-RPC. Subscriptions
+// are supported if db is a Subscriber.
+func NewHandler(db bt.DB, opts ...HandlerOpt) http.Handler {
+	options := &handlerOptions{bufferSize: 256}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return &handler{db: db, options: options}
+}
+
+type handler struct {
+	db      bt.DB
+	options *handlerOptions
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	wsConn, err := h.options.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already written an error response
+		return
+	}
+	if h.options.maxMessageBytes > 0 {
+		wsConn.SetReadLimit(h.options.maxMessageBytes)
+	}
+	c := &conn{
+		db:      h.db,
+		ws:      wsConn,
+		out:     make(chan interface{}, h.options.bufferSize),
+		done:    make(chan struct{}),
+		cancels: map[int]func(){},
+	}
+	c.serve()
+}
+
+// conn is a single WebSocket connection. Reads are handled in serve and all writes go through out so a single
+// goroutine writes to the WebSocket.
+type conn struct {
+	db  bt.DB
+	ws  *websocket.Conn
+	out chan interface{}
+
+	closeOnce sync.Once
+	done      chan struct{}
+
+	subM    sync.Mutex
+	cancels map[int]func()
+	nextSub int
+}
+
+func (c *conn) serve() {
+	go c.writeLoop()
+	defer c.close()
+	for {
+		_, b, err := c.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		if resp := c.handle(b); resp != nil {
+			select {
+			case c.out <- resp:
+			case <-c.done:
+				return
+			}
+		}
+	}
+}
+
+func (c *conn) writeLoop() {
+	defer c.close()
+	for {
+		select {
+		case msg := <-c.out:
+			if err := c.ws.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// close cancels all subscriptions and closes the WebSocket.
+func (c *conn) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.subM.Lock()
+		for _, cancel := range c.cancels {
+			cancel()
+		}
+		c.cancels = nil
+		c.subM.Unlock()
+		_ = c.ws.Close()
+	})
+}
+
+// handle handles a single request message and returns the response or nil for notifications.
+func (c *conn) handle(b []byte) *Response {
+	var req Request
+	if err := json.Unmarshal(b, &req); err != nil {
+		return &Response{JSONRPC: "2.0", ID: json.RawMessage("null"),
+			Error: &Error{Code: CodeParseError, Message: err.Error()}}
+	}
+	res, err := c.call(&req)
+	if req.ID == nil {
+		return nil
+	}
+	resp := &Response{JSONRPC: "2.0", ID: req.ID, Result: res}
+	if err != nil {
+		var rpcErr *Error
+		switch {
+		case errors.As(err, &rpcErr):
+		case errors.Is(err, bt.ErrNotFound):
+			rpcErr = &Error{Code: CodeNotFound, Message: err.Error()}
+		case errors.Is(err, auth.ErrForbidden):
+			rpcErr = &Error{Code: CodeForbidden, Message: err.Error()}
+		default:
+			rpcErr = &Error{Code: CodeInternalError, Message: err.Error()}
+		}
+		resp.Result, resp.Error = nil, rpcErr
+	}
+	return resp
+}
+
+func (c *conn) call(req *Request) (interface{}, error) {
+	if req.JSONRPC != "2.0" {
+		return nil, &Error{Code: CodeInvalidRequest, Message: `jsonrpc must be "2.0"`}
+	}
+	switch req.Method {
+	case MethodGet, MethodList, MethodHistory:
+		var p ReadParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		return c.read(req.Method, &p)
+	case MethodSet, MethodDelete:
+		var p WriteParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		return nil, c.write(req.Method, &p)
+	case MethodQuery:
+		var p QueryParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		s, err := query.Parse(p.Query)
+		if err != nil {
+			return nil, &Error{Code: CodeInvalidParams, Message: fmt.Sprintf("failed to parse query: %v", err)}
+		}
+		return s.Exec(c.db)
+	case MethodSubscribe:
+		var p SubscribeParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		return c.subscribe(p.KeyPrefix)
+	case MethodUnsubscribe:
+		var p UnsubscribeParams
+		if err := decodeParams(req.Params, &p); err != nil {
+			return nil, err
+		}
+		return nil, c.unsubscribe(p.Subscription)
+	default:
+		return nil, &Error{Code: CodeMethodNotFound, Message: fmt.Sprintf("unknown method: %v", req.Method)}
+	}
+}
+
+func (c *conn) read(method string, p *ReadParams) (interface{}, error) {
+	if method != MethodList && p.Key == "" {
+		return nil, &Error{Code: CodeInvalidParams, Message: "key is required"}
+	}
+	var opts []bt.ReadOpt
+	if p.ValidTime != nil {
+		opts = append(opts, bt.AsOfValidTime(*p.ValidTime))
+	}
+	if p.TxTime != nil {
+		opts = append(opts, bt.AsOfTransactionTime(*p.TxTime))
+	}
+	switch method {
+	case MethodGet:
+		return c.db.Get(p.Key, opts...)
+	case MethodList:
+		kvs, err := c.db.List(opts...)
+		if err != nil {
+			return nil, err
+		}
+		if kvs == nil {
+			kvs = []*bt.VersionedKV{}
+		}
+		return kvs, nil
+	default:
+		return c.db.History(p.Key)
+	}
+}
+
+func (c *conn) write(method string, p *WriteParams) error {
+	if p.Key == "" {
+		return &Error{Code: CodeInvalidParams, Message: "key is required"}
+	}
+	var opts []bt.WriteOpt
+	if p.ValidTime != nil {
+		opts = append(opts, bt.WithValidTime(*p.ValidTime))
+	}
+	if p.EndValidTime != nil {
+		opts = append(opts, bt.WithEndValidTime(*p.EndValidTime))
+	}
+	if method == MethodSet {
+		return c.db.Set(p.Key, p.Value, opts...)
+	}
+	return c.db.Delete(p.Key, opts...)
+}
+
+func (c *conn) subscribe(keyPrefix string) (int, error) {
+	s, ok := c.db.(Subscriber)
+	if !ok {
+		return 0, &Error{Code: CodeMethodNotFound, Message: "subscriptions are not supported by this DB"}
+	}
+
+	c.subM.Lock()
+	defer c.subM.Unlock()
+	if c.cancels == nil {
+		return 0, errors.New("connection is closed")
+	}
+	id := c.nextSub
+	c.nextSub++
+	c.cancels[id] = s.Subscribe(func(e changefeed.Event) {
+		if !strings.HasPrefix(e.Key, keyPrefix) {
+			return
+		}
+		// subscribers are called synchronously on the write path so never block. slow connections are dropped
+		select {
+		case c.out <- &Notification{JSONRPC: "2.0", Method: MethodChange, Params: ChangeParams{Subscription: id, Event: e}}:
+		default:
+			go c.close()
+		}
+	})
+	return id, nil
+}
+
+func (c *conn) unsubscribe(id int) error {
+	c.subM.Lock()
+	defer c.subM.Unlock()
+	cancel, ok := c.cancels[id]
+	if !ok {
+		return &Error{Code: CodeInvalidParams, Message: fmt.Sprintf("unknown subscription: %v", id)}
+	}
+	cancel()
+	delete(c.cancels, id)
+	return nil
+}
+
+func decodeParams(raw json.RawMessage, v interface{}) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return &Error{Code: CodeInvalidParams, Message: fmt.Sprintf("failed to decode params: %v", err)}
+	}
+	return nil
+}
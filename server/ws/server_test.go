@@ -0,0 +1,179 @@
+package ws_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/changefeed"
+	"github.com/elh/bitempura/clock"
+	"github.com/elh/bitempura/dbtest/tt"
+	"github.com/elh/bitempura/memory"
+	"github.com/elh/bitempura/server/ws"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	t1 = tt.Day(1)
+	t2 = tt.Day(2)
+	t3 = tt.Day(3)
+)
+
+// message is a response or notification received by the client.
+type message struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Result json.RawMessage `json:"result"`
+	Error  *ws.Error       `json:"error"`
+	Params json.RawMessage `json:"params"`
+}
+
+func TestHandler(t *testing.T) {
+	clock := &clock.Clock{}
+	mdb, err := memory.NewDB(memory.WithClock(clock))
+	require.Nil(t, err)
+	db := changefeed.NewDB(mdb)
+	server := httptest.NewServer(ws.NewHandler(db))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.Nil(t, err)
+	defer conn.Close()
+
+	nextID := 0
+	call := func(method string, params interface{}) *message {
+		nextID++
+		require.Nil(t, conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": nextID, "method": method, "params": params}))
+		var msg message
+		require.Nil(t, conn.ReadJSON(&msg))
+		return &msg
+	}
+
+	require.Nil(t, clock.SetNow(t1))
+	resp := call(ws.MethodSet, map[string]interface{}{"key": "Bob/balance", "value": 100})
+	require.Nil(t, resp.Error)
+	require.Nil(t, clock.SetNow(t3))
+	resp = call(ws.MethodSet, map[string]interface{}{"key": "Bob/balance", "value": 90, "valid_time": t2})
+	require.Nil(t, resp.Error)
+
+	t.Run("get", func(t *testing.T) {
+		resp := call(ws.MethodGet, map[string]interface{}{"key": "Bob/balance", "valid_time": t1, "tx_time": t1})
+		require.Nil(t, resp.Error)
+		var kv bt.VersionedKV
+		require.Nil(t, json.Unmarshal(resp.Result, &kv))
+		assert.Equal(t, 100.0, kv.Value)
+	})
+	t.Run("get not found", func(t *testing.T) {
+		resp := call(ws.MethodGet, map[string]interface{}{"key": "Alice/balance"})
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, ws.CodeNotFound, resp.Error.Code)
+	})
+	t.Run("list", func(t *testing.T) {
+		resp := call(ws.MethodList, nil)
+		require.Nil(t, resp.Error)
+		var kvs []*bt.VersionedKV
+		require.Nil(t, json.Unmarshal(resp.Result, &kvs))
+		assert.Len(t, kvs, 1)
+	})
+	t.Run("history", func(t *testing.T) {
+		resp := call(ws.MethodHistory, map[string]interface{}{"key": "Bob/balance"})
+		require.Nil(t, resp.Error)
+		var kvs []*bt.VersionedKV
+		require.Nil(t, json.Unmarshal(resp.Result, &kvs))
+		assert.Len(t, kvs, 3)
+	})
+	t.Run("query", func(t *testing.T) {
+		resp := call(ws.MethodQuery, map[string]interface{}{"query": "LIST WHERE key LIKE 'Bob/%'"})
+		require.Nil(t, resp.Error)
+		var kvs []*bt.VersionedKV
+		require.Nil(t, json.Unmarshal(resp.Result, &kvs))
+		assert.Len(t, kvs, 1)
+	})
+	t.Run("errors", func(t *testing.T) {
+		resp := call("purge", nil)
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, ws.CodeMethodNotFound, resp.Error.Code)
+		resp = call(ws.MethodGet, map[string]interface{}{})
+		require.NotNil(t, resp.Error)
+		assert.Equal(t, ws.CodeInvalidParams, resp.Error.Code)
+	})
+	t.Run("subscribe", func(t *testing.T) {
+		resp := call(ws.MethodSubscribe, map[string]interface{}{"key_prefix": "Alice/"})
+		require.Nil(t, resp.Error)
+		var sub int
+		require.Nil(t, json.Unmarshal(resp.Result, &sub))
+
+		// write outside of the connection. events for other key prefixes are filtered out
+		require.Nil(t, db.Set("Bob/balance", 80))
+		require.Nil(t, db.Set("Alice/balance", 200))
+		var msg message
+		require.Nil(t, conn.ReadJSON(&msg))
+		require.Equal(t, ws.MethodChange, msg.Method)
+		var params ws.ChangeParams
+		require.Nil(t, json.Unmarshal(msg.Params, &params))
+		assert.Equal(t, sub, params.Subscription)
+		assert.Equal(t, "Alice/balance", params.Event.Key)
+		assert.Equal(t, changefeed.OpSet, params.Event.Op)
+
+		resp = call(ws.MethodUnsubscribe, map[string]interface{}{"subscription": sub})
+		require.Nil(t, resp.Error)
+		require.Nil(t, db.Set("Alice/balance", 300))
+		resp = call(ws.MethodUnsubscribe, map[string]interface{}{"subscription": sub})
+		require.NotNil(t, resp.Error)
+	})
+}
+
+func TestResponse(t *testing.T) {
+	b, err := json.Marshal(&ws.Response{JSONRPC: "2.0", ID: json.RawMessage("1"), Error: &ws.Error{Code: ws.CodeNotFound,
+		Message: "not found"}})
+	require.Nil(t, err)
+	assert.JSONEq(t, `{"jsonrpc": "2.0", "id": 1, "error": {"code": -32004, "message": "not found"}}`, string(b))
+
+	b, err = json.Marshal(&ws.Response{JSONRPC: "2.0", ID: json.RawMessage("1")})
+	require.Nil(t, err)
+	assert.JSONEq(t, `{"jsonrpc": "2.0", "id": 1, "result": null}`, string(b))
+
+	var resp ws.Response
+	require.Nil(t, json.Unmarshal([]byte(`{"jsonrpc": "2.0", "id": 1, "result": 2}`), &resp))
+	assert.Equal(t, 2.0, resp.Result)
+}
+
+func TestHandlerWithoutSubscriber(t *testing.T) {
+	db, err := memory.NewDB()
+	require.Nil(t, err)
+	server := httptest.NewServer(ws.NewHandler(db))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.Nil(t, err)
+	defer conn.Close()
+
+	require.Nil(t, conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": ws.MethodSubscribe}))
+	var msg message
+	require.Nil(t, conn.ReadJSON(&msg))
+	require.NotNil(t, msg.Error)
+	assert.Equal(t, ws.CodeMethodNotFound, msg.Error.Code)
+}
+
+func TestHandlerMaxMessageBytes(t *testing.T) {
+	db, err := memory.NewDB()
+	require.Nil(t, err)
+	server := httptest.NewServer(ws.NewHandler(db, ws.WithMaxMessageBytes(128)))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.Nil(t, err)
+	defer conn.Close()
+
+	value := strings.Repeat("x", 256)
+	require.Nil(t, conn.WriteJSON(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": ws.MethodSet,
+		"params": map[string]interface{}{"key": "a", "value": value}}))
+	var msg message
+	assert.NotNil(t, conn.ReadJSON(&msg))
+	_, err = db.Get("a")
+	assert.ErrorIs(t, err, bt.ErrNotFound)
+}
@@ -0,0 +1,64 @@
+package sql
+
+import (
+	"errors"
+
+	bt "github.com/elh/bitempura"
+)
+
+// WriteBatch applies the writes of b in order with a single transaction time in one SQL transaction. It fails without
+// applying any of them if one fails. If the TableDB was constructed with a *sql.Tx, the writes are made in it and are
+// only atomic if the caller commits or rolls back the transaction as a whole.
+func (db *TableDB) WriteBatch(b *bt.WriteBatch) error {
+	db.m.Lock()
+	defer db.m.Unlock()
+	// issue the transaction time under the lock. see update
+	now := db.clock.Now()
+	values := make([]map[string]interface{}, len(b.Writes))
+	configs := make([]*writeConfig, len(b.Writes))
+	keys := make(map[string]bool, len(b.Writes))
+	// writes without options share a single resolution of the DB's defaults, so large batches resolve options once
+	var defaults *writeConfig
+	for i, w := range b.Writes {
+		if keys[w.Key] {
+			return &bt.BatchWriteError{Index: i, Key: w.Key,
+				Err: invalidWrite(errors.New("key is written more than once"))}
+		}
+		keys[w.Key] = true
+		if !w.Delete {
+			valueMap, ok := w.Value.(map[string]interface{})
+			if !ok {
+				return &bt.BatchWriteError{Index: i, Key: w.Key, Err: invalidWrite(errors.New("value must be of type map[string]interface{}"))}
+			}
+			values[i] = valueMap
+		}
+		if len(w.Opts) == 0 && defaults != nil {
+			// copy since write may adjust it
+			config := *defaults
+			configs[i] = &config
+			continue
+		}
+		config, err := db.prepareWrite(w.Delete, w.Opts, now)
+		if err != nil {
+			return &bt.BatchWriteError{Index: i, Key: w.Key, Err: err}
+		}
+		if len(w.Opts) == 0 {
+			defaults = config
+			copied := *config
+			config = &copied
+		}
+		configs[i] = config
+	}
+
+	eq, commit, rollback, err := db.begin()
+	if err != nil {
+		return err
+	}
+	defer rollback()
+	for i, w := range b.Writes {
+		if err := db.write(eq, w.Key, values[i], w.Delete, configs[i], now); err != nil {
+			return &bt.BatchWriteError{Index: i, Key: w.Key, Err: err}
+		}
+	}
+	return commit()
+}
@@ -4,13 +4,25 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/Masterminds/squirrel"
 	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/interval"
+	"github.com/google/uuid"
 )
 
 var _ DB = (*TableDB)(nil)
+var _ bt.KeyLister = (*TableDB)(nil)
+var _ bt.HistoriesReader = (*TableDB)(nil)
+var _ bt.ListStreamer = (*TableDB)(nil)
+var _ bt.MultiGetter = (*TableDB)(nil)
+var _ bt.ChangeLister = (*TableDB)(nil)
+var _ bt.Importer = (*TableDB)(nil)
+var _ bt.StatsReader = (*TableDB)(nil)
+var _ bt.BatchWriter = (*TableDB)(nil)
 
 // DB is a SQL-backed, SQL-queryable, bitemporal database.
 // WARNING: WIP. this implementation is experimental and abandoned.
@@ -18,6 +30,8 @@ type DB interface {
 	bt.DB
 	// Select executes a SQL query (as of optional valid and transaction times).
 	Select(query squirrel.SelectBuilder, opts ...bt.ReadOpt) (*sql.Rows, error)
+	// ReadTx returns a read-only view pinned to the current transaction time. See bt.ReadTx.
+	ReadTx(opts ...bt.ReadTxOpt) *bt.ReadTx
 }
 
 // StateTableName returns the default bitemporal state table name for a given table.
@@ -25,12 +39,27 @@ func StateTableName(tableName string) string {
 	return fmt.Sprintf("__bt_%v_states", tableName)
 }
 
+// StateTableIndexDDL returns the DDL for the index TableDB expects on a state table. Reads filter the key and order by
+// transaction time start and valid time start, so the index covers their lookups.
+func StateTableIndexDDL(tableName, pkColumnName string) string {
+	stateTable := StateTableName(tableName)
+	return fmt.Sprintf("CREATE INDEX IF NOT EXISTS %v_as_of ON %v (%v, __bt_tx_time_start, __bt_valid_time_start)",
+		stateTable, stateTable, pkColumnName)
+}
+
 // NewTableDB constructs a SQL-backed, SQL-queryable, bitemporal database connected to a specific underlying SQL table.
+// The state table should have the index of StateTableIndexDDL.
 // WARNING: WIP. this implementation is experimental and abandoned.
 func NewTableDB(eq ExecerQueryer, table string, pkColumnName string, updatedAtColName,
-	deletedAtColName *string) (DB, error) {
+	deletedAtColName *string, opts ...TableDBOpt) (DB, error) {
 	// TODO: convert UpdateAt and DeletedAt columns to options
 	// TODO: support composite PK through a pkFn(key string) Key struct
+	options := &tableDBOptions{
+		clock: &bt.DefaultClock{},
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
 	return &TableDB{
 		eq:               eq,
 		table:            table,
@@ -38,9 +67,55 @@ func NewTableDB(eq ExecerQueryer, table string, pkColumnName string, updatedAtCo
 		pkColumnName:     pkColumnName,
 		updatedAtColName: updatedAtColName,
 		deletedAtColName: deletedAtColName,
+		clock:            options.clock,
+		overlapPolicy:    options.overlapPolicy,
+		txTimePolicy:     options.txTimePolicy,
+		futureValidTimes: options.futureValidTimes,
 	}, nil
 }
 
+// tableDBOptions is a struct for processing TableDBOpt's to be used by TableDB
+type tableDBOptions struct {
+	clock            bt.Clock
+	overlapPolicy    bt.OverlapPolicy
+	txTimePolicy     bt.TxTimePolicy
+	futureValidTimes bool
+}
+
+// TableDBOpt is an option for constructing TableDBs
+type TableDBOpt func(*tableDBOptions)
+
+// WithClock constructs database with a clock in order to control transaction times. This is used for testing.
+func WithClock(clock bt.Clock) TableDBOpt {
+	return func(os *tableDBOptions) {
+		os.clock = clock
+	}
+}
+
+// WithOverlapPolicy constructs database with a default overlap policy for Set. Writes can override it with
+// bt.WithOverlapPolicy.
+func WithOverlapPolicy(p bt.OverlapPolicy) TableDBOpt {
+	return func(os *tableDBOptions) {
+		os.overlapPolicy = p
+	}
+}
+
+// WithTxTimePolicy constructs database with a policy for writes whose clock time precedes the latest transaction time
+// persisted in the state table, for example after a restart with a skewed system clock.
+func WithTxTimePolicy(p bt.TxTimePolicy) TableDBOpt {
+	return func(os *tableDBOptions) {
+		os.txTimePolicy = p
+	}
+}
+
+// WithFutureValidTimes constructs database that allows every write to have valid times after its transaction time, as
+// if it were made with bt.WithFutureValidTime.
+func WithFutureValidTimes() TableDBOpt {
+	return func(os *tableDBOptions) {
+		os.futureValidTimes = true
+	}
+}
+
 // TableDB is a SQL-backed, SQL-queryable, bitemporal database that is connected to a specific underlying SQL table.
 type TableDB struct {
 	eq               ExecerQueryer
@@ -49,6 +124,13 @@ type TableDB struct {
 	pkColumnName     string
 	updatedAtColName *string
 	deletedAtColName *string
+	clock            bt.Clock         // clock provides transaction times
+	overlapPolicy    bt.OverlapPolicy // default overlap policy for Set
+	txTimePolicy     bt.TxTimePolicy  // handling of writes with transaction times before the latest persisted
+	futureValidTimes bool             // if set, writes may have valid times after their transaction time
+
+	m            sync.Mutex // held from issuing a write's transaction time until it is committed. see ReadTx
+	latestPinned time.Time  // latest transaction time pinned by ReadTx. guarded by m
 }
 
 // Get data by key (as of optional valid and transaction times).
@@ -61,12 +143,17 @@ func (db *TableDB) Get(key string, opts ...bt.ReadOpt) (*bt.VersionedKV, error)
 	//		(__bt_tx_time_end IS NULL OR __bt_tx_time_end > <as_of_tx_time>) AND
 	//		__bt_valid_time_start <= <as_of_valid_time> AND
 	//		(__bt_valid_time_end IS NULL OR __bt_valid_time_end > <as_of_valid_time>)
-	// LIMIT 1
+	// ORDER BY __bt_tx_time_start DESC, __bt_valid_time_start DESC
+	// LIMIT 2
+	//
+	// at most 1 row can match in a consistent state table. a second row is selected to detect ambiguity.
 	b := squirrel.Select("*").
 		From(db.stateTable).
 		Where(squirrel.Eq{db.pkColumnName: key}).
-		Limit(1)
-	rows, err := db.Select(b, opts...)
+		OrderBy("__bt_tx_time_start DESC", "__bt_valid_time_start DESC").
+		Limit(2)
+	config := db.handleReadOpts(opts)
+	rows, err := db.selectAsOf(b, config)
 	if err != nil {
 		return nil, err
 	}
@@ -77,69 +164,189 @@ func (db *TableDB) Get(key string, opts ...bt.ReadOpt) (*bt.VersionedKV, error)
 		return nil, err
 	}
 	if len(kvs) == 0 {
-		return nil, bt.ErrNotFound
+		return nil, &bt.NotFoundError{Key: key, ValidTime: config.validTime, TxTime: config.txTime}
+	}
+	if len(kvs) > 1 {
+		return nil, fmt.Errorf("multiple versions matched find for validTime: %v, txTime: %v", config.validTime,
+			config.txTime)
 	}
 	return kvs[0], nil
 }
 
+// GetMulti returns the data of each key (as of optional valid and transaction times) in the order of keys. Results are
+// nil for keys that are not found. Keys are read in a single query.
+func (db *TableDB) GetMulti(keys []string, opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	// SELECT *
+	// FROM <table>
+	// WHERE
+	// 		<base table pk> IN (<keys>) AND
+	//		... as of conditions of Get
+	b := squirrel.Select("*").
+		From(db.stateTable).
+		Where(squirrel.Eq{db.pkColumnName: keys})
+	config := db.handleReadOpts(opts)
+	rows, err := db.selectAsOf(b, config)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	kvs, err := ScanToVersionedKVs(db.pkColumnName, rows)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]*bt.VersionedKV, len(kvs))
+	for _, kv := range kvs {
+		if _, ok := byKey[kv.Key]; ok {
+			return nil, fmt.Errorf("multiple versions matched find for key: %v, validTime: %v, txTime: %v", kv.Key,
+				config.validTime, config.txTime)
+		}
+		byKey[kv.Key] = kv
+	}
+	out := make([]*bt.VersionedKV, len(keys))
+	for i, key := range keys {
+		out[i] = byKey[key]
+	}
+	return out, nil
+}
+
 // List all data (as of optional valid and transaction times).
 func (db *TableDB) List(opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	var kvs []*bt.VersionedKV
+	if err := db.ListFunc(func(kv *bt.VersionedKV) bool {
+		kvs = append(kvs, kv)
+		return true
+	}, opts...); err != nil {
+		return nil, err
+	}
+	return kvs, nil
+}
+
+// ListFunc calls fn with each result of List (as of optional valid and transaction times) until fn returns false. Rows
+// are scanned one at a time. Key filters are narrowed with a LIKE prefix match in the query and then matched exactly.
+func (db *TableDB) ListFunc(fn func(*bt.VersionedKV) bool, opts ...bt.ReadOpt) error {
 	// SELECT *
 	// FROM <table>
 	// WHERE
-	// 		<base table pk> = <key> AND
+	// 		<base table pk> LIKE <key filter prefix>% AND
 	//		__bt_tx_time_start <= <as_of_tx_time> AND
 	//		(__bt_tx_time_end IS NULL OR __bt_tx_time_end > <as_of_tx_time>) AND
 	//		__bt_valid_time_start <= <as_of_valid_time> AND
 	//		(__bt_valid_time_end IS NULL OR __bt_valid_time_end > <as_of_valid_time>)
-	b := squirrel.Select("*").
-		From(db.stateTable)
+	filter := bt.ApplyReadOpts(opts).KeyFilter
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+	b := squirrel.Select("*")
+	if prefix := filter.LiteralPrefix(); prefix != "" {
+		b = b.Where(db.pkColumnName+` LIKE ? ESCAPE '\'`, escapeLike(prefix)+"%")
+	}
 	rows, err := db.Select(b, opts...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	kvs, err := ScanToVersionedKVs(db.pkColumnName, rows)
+	cols, err := rows.Columns()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return kvs, nil
+	for rows.Next() {
+		m, err := scanToMap(rows, cols)
+		if err != nil {
+			return err
+		}
+		kv, err := toVersionedKV(db.pkColumnName, m)
+		if err != nil {
+			return err
+		}
+		if !filter.Match(kv.Key) {
+			continue
+		}
+		if !fn(kv) {
+			return nil
+		}
+	}
+	return rows.Err()
 }
 
-// Set stores value (with optional start and end valid time).
-// WARNING: unimplemented
+// escapeLike escapes the LIKE wildcards of s with backslashes.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// Set stores value (with optional start and end valid time). value must be a map[string]interface{} of state table
+// column values. Writes are made directly to the state table; the base table is not modified.
 func (db *TableDB) Set(key string, value bt.Value, opts ...bt.WriteOpt) error {
-	// INSERT
-	// INTO <table>
-	// (<fields...>, __bt_tx_time_start, __bt_tx_time_end, __bt_valid_time_start, __bt_valid_time_end)
-	// VALUES
-	// (<values...>, <tx_time_start>, <tx_time_end>, <valid_time_start>, <valid_time_end>)
-	//
-	// select out the conflicting records based on the write opt times. update them and add new ones as needed
-	return errors.New("unimplemented")
+	valueMap, ok := value.(map[string]interface{})
+	if !ok {
+		return invalidWrite(errors.New("value must be of type map[string]interface{}"))
+	}
+	return db.update(key, valueMap, false, opts...)
 }
 
-// Delete removes value (with optional start and end valid time).
-// WARNING: unimplemented
+// Delete removes value (with optional start and end valid time). Writes are made directly to the state table; the base
+// table is not modified.
 func (db *TableDB) Delete(key string, opts ...bt.WriteOpt) error {
-	// select out the conflicting records based on the write opt times. update them and add new ones as needed
-	if db.deletedAtColName == nil {
-		return errors.New("Delete without configured DeleteAt column is unimplemented") // TODO: support this
+	return db.update(key, nil, true, opts...)
+}
+
+// Import inserts versioned key-values into the state table as is. Values must be of type map[string]interface{}. It
+// fails without inserting any of them if they are invalid or overlap each other or stored versions of the same key in
+// both transaction time and valid time. Writes are made directly to the state table; the base table is not modified.
+func (db *TableDB) Import(kvs []*bt.VersionedKV) error {
+	eq, commit, rollback, err := db.begin()
+	if err != nil {
+		return err
+	}
+	defer rollback()
+
+	byKey := map[string][]*bt.VersionedKV{}
+	var keys []string
+	for _, kv := range kvs {
+		if _, ok := byKey[kv.Key]; !ok {
+			keys = append(keys, kv.Key)
+		}
+		byKey[kv.Key] = append(byKey[kv.Key], kv)
+	}
+	existing, err := db.histories(eq, keys)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if violations := bt.CheckHistory(key, append(existing[key], byKey[key]...)); len(violations) > 0 {
+			return violations[0]
+		}
 	}
-	return errors.New("unimplemented")
+	for _, kv := range kvs {
+		if err := db.insertVersion(eq, kv); err != nil {
+			return err
+		}
+	}
+	return commit()
 }
 
-// History returns versions by descending end transaction time, descending end valid time
-func (db *TableDB) History(key string) ([]*bt.VersionedKV, error) {
+// History returns versions by descending end transaction time, descending end valid time (filtered by optional valid
+// and transaction times). See bt.FilterHistory.
+func (db *TableDB) History(key string, opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	options := bt.ApplyReadOpts(opts)
+	if len(opts) > 0 {
+		options.ResolveAgo(db.clock.Now())
+	}
+
 	// SELECT *
 	// FROM <table>
 	// WHERE
 	// 		<base table pk> = <key>
+	// 		[AND __bt_tx_time_start <= <tx time>]
 	// ORDER BY __bt_tx_time_end DESC, __bt_valid_time_end DESC
-	rows, err := squirrel.Select("*").
+	b := squirrel.Select("*").
 		From(db.stateTable).
-		Where(squirrel.Eq{db.pkColumnName: key}).
+		Where(squirrel.Eq{db.pkColumnName: key})
+	if options.TxTime != nil {
+		b = b.Where(squirrel.LtOrEq{"__bt_tx_time_start": *options.TxTime})
+	}
+	rows, err := b.
 		OrderBy("__bt_tx_time_end IS NULL DESC, __bt_tx_time_end DESC, __bt_valid_time_end IS NULL DESC, __bt_valid_time_end DESC").
 		RunWith(db.eq).
 		Query()
@@ -152,23 +359,156 @@ func (db *TableDB) History(key string) ([]*bt.VersionedKV, error) {
 	if err != nil {
 		return nil, err
 	}
-	if len(kvs) == 0 {
-		return nil, bt.ErrNotFound
+	if kvs = bt.FilterHistory(kvs, options); len(kvs) == 0 {
+		return nil, &bt.NotFoundError{Key: key}
 	}
 	return kvs, nil
 }
 
+// Histories returns the versions of each key, ordered as History, with a single query. Keys with no versions are
+// omitted.
+func (db *TableDB) Histories(keys []string) (map[string][]*bt.VersionedKV, error) {
+	return db.histories(db.eq, keys)
+}
+
+func (db *TableDB) histories(eq ExecerQueryer, keys []string) (map[string][]*bt.VersionedKV, error) {
+	// SELECT *
+	// FROM <table>
+	// WHERE
+	// 		<base table pk> IN (<keys>)
+	// ORDER BY __bt_tx_time_end DESC, __bt_valid_time_end DESC
+	rows, err := squirrel.Select("*").
+		From(db.stateTable).
+		Where(squirrel.Eq{db.pkColumnName: keys}).
+		OrderBy("__bt_tx_time_end IS NULL DESC, __bt_tx_time_end DESC, __bt_valid_time_end IS NULL DESC, __bt_valid_time_end DESC").
+		RunWith(eq).
+		Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	kvs, err := ScanToVersionedKVs(db.pkColumnName, rows)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string][]*bt.VersionedKV, len(keys))
+	for _, kv := range kvs {
+		out[kv.Key] = append(out[kv.Key], kv)
+	}
+	return out, nil
+}
+
+// Keys returns all keys in ascending order.
+func (db *TableDB) Keys() ([]string, error) {
+	// SELECT DISTINCT <base table pk>
+	// FROM <table>
+	// ORDER BY <base table pk> ASC
+	return db.selectKeys(squirrel.Select(db.pkColumnName).
+		Distinct().
+		From(db.stateTable).
+		OrderBy(db.pkColumnName + " ASC"))
+}
+
+// ChangedKeys returns the keys that gained or closed versions after transaction time since, in ascending order.
+func (db *TableDB) ChangedKeys(since time.Time) ([]string, error) {
+	// SELECT DISTINCT <base table pk>
+	// FROM <table>
+	// WHERE
+	//		__bt_tx_time_start > <since> OR
+	//		__bt_tx_time_end > <since>
+	// ORDER BY <base table pk> ASC
+	return db.selectKeys(squirrel.Select(db.pkColumnName).
+		Distinct().
+		From(db.stateTable).
+		Where(squirrel.Or{squirrel.Gt{"__bt_tx_time_start": since}, squirrel.Gt{"__bt_tx_time_end": since}}).
+		OrderBy(db.pkColumnName + " ASC"))
+}
+
+// Stats returns per-key and total statistics of all versions with a single scan of the state table. Approximate bytes
+// count the value columns of each row.
+func (db *TableDB) Stats() (*bt.Stats, error) {
+	// SELECT *
+	// FROM <table>
+	rows, err := squirrel.Select("*").
+		From(db.stateTable).
+		RunWith(db.eq).
+		Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	kvs, err := ScanToVersionedKVs(db.pkColumnName, rows)
+	if err != nil {
+		return nil, err
+	}
+	perKey := map[string]*bt.KeyStats{}
+	var keys []string
+	for _, kv := range kvs {
+		ks, ok := perKey[kv.Key]
+		if !ok {
+			ks = &bt.KeyStats{}
+			perKey[kv.Key] = ks
+			keys = append(keys, kv.Key)
+		}
+		ks.Add(kv)
+	}
+	stats := &bt.Stats{PerKey: make(map[string]*bt.KeyStats, len(keys))}
+	for _, key := range keys {
+		stats.AddKey(key, perKey[key])
+	}
+	return stats, nil
+}
+
+func (db *TableDB) selectKeys(b squirrel.SelectBuilder) ([]string, error) {
+	rows, err := b.RunWith(db.eq).Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// ReadTx returns a read-only view of the DB pinned to the clock's current time as transaction time. See bt.ReadTx.
+//
+// The time is read under the same lock as writes issue and commit their transaction times, so the view includes every
+// write committed before it and later writes of the TableDB are made at or after the pinned time, as with TxTimeAdjust
+// or TxTimeReject if the clock regresses. Writes made through other TableDBs or processes sharing the state table are
+// not ordered with the pin.
+func (db *TableDB) ReadTx(opts ...bt.ReadTxOpt) *bt.ReadTx {
+	db.m.Lock()
+	defer db.m.Unlock()
+	now := db.clock.Now()
+	if now.After(db.latestPinned) {
+		db.latestPinned = now
+	}
+	return bt.NewReadTx(db, now, opts...)
+}
+
 // Select executes a SQL query (as of optional valid and transaction times).
 func (db *TableDB) Select(b squirrel.SelectBuilder, opts ...bt.ReadOpt) (*sql.Rows, error) {
-	options := db.handleReadOpts(opts)
+	return db.selectAsOf(b, db.handleReadOpts(opts))
+}
 
+func (db *TableDB) selectAsOf(b squirrel.SelectBuilder, options *readConfig) (*sql.Rows, error) {
 	// override FROM table
 	b = b.From(db.stateTable)
 	// add tx and valid time to query
 	b = b.Where(squirrel.LtOrEq{"__bt_tx_time_start": options.txTime})
 	b = b.Where(squirrel.Or{squirrel.Eq{"__bt_tx_time_end": nil}, squirrel.Gt{"__bt_tx_time_end": options.txTime}})
-	b = b.Where(squirrel.LtOrEq{"__bt_valid_time_start": options.validTime})
-	b = b.Where(squirrel.Or{squirrel.Eq{"__bt_valid_time_end": nil}, squirrel.Gt{"__bt_valid_time_end": options.validTime}})
+	validTime := bt.ClampValidTime(options.validTime)
+	b = b.Where(squirrel.LtOrEq{"__bt_valid_time_start": validTime})
+	b = b.Where(squirrel.Or{squirrel.Eq{"__bt_valid_time_end": nil}, squirrel.Gt{"__bt_valid_time_end": validTime}})
 
 	return b.RunWith(db.eq).Query()
 }
@@ -181,7 +521,8 @@ type readConfig struct {
 func (db *TableDB) handleReadOpts(opts []bt.ReadOpt) *readConfig {
 	options := bt.ApplyReadOpts(opts)
 
-	now := time.Now()
+	now := db.clock.Now()
+	options.ResolveAgo(now)
 	config := &readConfig{
 		validTime: now,
 		txTime:    now,
@@ -196,6 +537,325 @@ func (db *TableDB) handleReadOpts(opts []bt.ReadOpt) *readConfig {
 	return config
 }
 
+// Common logic of Set and Delete. Versions overlapping the write's valid time range are ended at the current transaction
+// time and their "overhangs" outside of the range are rewritten. If for Delete, do not insert a new version.
+func (db *TableDB) update(key string, value map[string]interface{}, isDelete bool, opts ...bt.WriteOpt) error {
+	db.m.Lock()
+	defer db.m.Unlock()
+	// issue the transaction time under the lock so writes are committed in transaction time order. see ReadTx
+	now := db.clock.Now()
+	config, err := db.prepareWrite(isDelete, opts, now)
+	if err != nil {
+		return err
+	}
+
+	eq, commit, rollback, err := db.begin()
+	if err != nil {
+		return err
+	}
+	defer rollback()
+
+	if err := db.write(eq, key, value, isDelete, config, now); err != nil {
+		return err
+	}
+	return commit()
+}
+
+// prepareWrite validates a write and resolves its options at transaction time now.
+func (db *TableDB) prepareWrite(isDelete bool, opts []bt.WriteOpt, now time.Time) (*writeConfig, error) {
+	config, err := db.handleWriteOpts(opts, now)
+	if err != nil {
+		return nil, invalidWrite(err)
+	}
+	if !isDelete && config.allValidTime {
+		return nil, invalidWrite(errors.New("all valid time is only supported for Delete"))
+	}
+	return config, nil
+}
+
+// invalidWrite wraps the reason a write is invalid with bt.ErrInvalidWrite.
+func invalidWrite(err error) error {
+	return fmt.Errorf("%w: %v", bt.ErrInvalidWrite, err)
+}
+
+// write applies a prepared write of key at transaction time now with eq. The caller commits. db.m must be held.
+func (db *TableDB) write(eq ExecerQueryer, key string, value map[string]interface{}, isDelete bool, config *writeConfig,
+	now time.Time) error {
+	if db.txTimePolicy != bt.TxTimeAllow {
+		latest, err := db.latestTxTime(eq)
+		if err != nil {
+			return err
+		}
+		if db.latestPinned.After(latest) {
+			latest = db.latestPinned
+		}
+		if now.Before(latest) {
+			if db.txTimePolicy == bt.TxTimeReject {
+				return fmt.Errorf("%w: %v is before %v", bt.ErrTxTimeRegressed, now, latest)
+			}
+			now = latest
+			if config.defaultValidTime {
+				config.validTime = now
+			}
+		}
+	}
+
+	// SELECT *
+	// FROM <table>
+	// WHERE
+	// 		<base table pk> = <key> AND
+	//		__bt_tx_time_start <= <now> AND
+	//		(__bt_tx_time_end IS NULL OR __bt_tx_time_end > <now>) AND
+	//		(<valid_time_end> IS NULL OR __bt_valid_time_start < <valid_time_end>) AND
+	//		(__bt_valid_time_end IS NULL OR __bt_valid_time_end > <valid_time_start>)
+	b := squirrel.Select("*").
+		From(db.stateTable).
+		Where(squirrel.Eq{db.pkColumnName: key}).
+		Where(squirrel.LtOrEq{"__bt_tx_time_start": now}).
+		Where(squirrel.Or{squirrel.Eq{"__bt_tx_time_end": nil}, squirrel.Gt{"__bt_tx_time_end": now}})
+	if !config.allValidTime {
+		b = b.Where(squirrel.Or{squirrel.Eq{"__bt_valid_time_end": nil}, squirrel.Gt{"__bt_valid_time_end": config.validTime}})
+	}
+	if config.endValidTime != nil {
+		b = b.Where(squirrel.Lt{"__bt_valid_time_start": *config.endValidTime})
+	}
+	rows, err := b.RunWith(eq).Query()
+	if err != nil {
+		return err
+	}
+	overlapping, err := ScanToMaps(rows)
+	_ = rows.Close()
+	if err != nil {
+		return err
+	}
+	if !isDelete && len(overlapping) > 0 && config.overlapPolicy == bt.OverlapReject {
+		return bt.ErrOverlap
+	}
+
+	for _, row := range overlapping {
+		if _, err := squirrel.Update(db.stateTable).
+			Set("__bt_tx_time_end", now).
+			Where(squirrel.Eq{"__bt_id": row["__bt_id"]}).
+			RunWith(eq).
+			Exec(); err != nil {
+			return err
+		}
+		if config.allValidTime {
+			continue
+		}
+
+		validTimeStart, err := getTime("__bt_valid_time_start", row)
+		if err != nil {
+			return err
+		}
+		validTimeEnd, err := getNullTime("__bt_valid_time_end", row)
+		if err != nil {
+			return err
+		}
+		write := interval.Of(config.validTime, config.endValidTime)
+		for _, overhang := range interval.Of(validTimeStart, validTimeEnd).Difference(write) {
+			start, end := overhang.Times()
+			// overhangs after the write start at its end valid time
+			if write.HasEnd && overhang.Start >= write.End {
+				switch config.overhangPolicy {
+				case bt.OverhangTruncate:
+					continue
+				case bt.OverhangReject:
+					return bt.ErrOverhang
+				}
+			}
+			if err := db.insert(eq, key, stateValue(db.pkColumnName, row), now, start, end); err != nil {
+				return err
+			}
+		}
+	}
+
+	// add value for Set, add nothing for Delete
+	if !isDelete {
+		if err := db.insert(eq, key, value, now, config.validTime, config.endValidTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insert inserts a new current version into the state table.
+func (db *TableDB) insert(eq ExecerQueryer, key string, value map[string]interface{}, txTimeStart,
+	validTimeStart time.Time, validTimeEnd *time.Time) error {
+	return db.insertVersion(eq, &bt.VersionedKV{
+		Key:            key,
+		Value:          value,
+		TxTimeStart:    txTimeStart,
+		ValidTimeStart: validTimeStart,
+		ValidTimeEnd:   validTimeEnd,
+	})
+}
+
+// insertVersion inserts a versioned key-value into the state table. Its value must be of type map[string]interface{}.
+func (db *TableDB) insertVersion(eq ExecerQueryer, kv *bt.VersionedKV) error {
+	if err := kv.Validate(); err != nil {
+		return err
+	}
+	value, ok := kv.Value.(map[string]interface{})
+	if !ok {
+		return errors.New("value must be of type map[string]interface{}")
+	}
+	cols := []string{db.pkColumnName, "__bt_id", "__bt_tx_time_start", "__bt_tx_time_end", "__bt_valid_time_start",
+		"__bt_valid_time_end"}
+	vals := []interface{}{kv.Key, uuid.New().String(), kv.TxTimeStart, kv.TxTimeEnd, kv.ValidTimeStart, kv.ValidTimeEnd}
+	for k, v := range value {
+		cols = append(cols, k)
+		vals = append(vals, v)
+	}
+	_, err := squirrel.Insert(db.stateTable).
+		Columns(cols...).
+		Values(vals...).
+		RunWith(eq).
+		Exec()
+	return err
+}
+
+// begin starts a transaction if the underlying ExecerQueryer supports it. Otherwise, writes are not atomic.
+func (db *TableDB) begin() (eq ExecerQueryer, commit func() error, rollback func(), err error) {
+	beginner, ok := db.eq.(interface{ Begin() (*sql.Tx, error) })
+	if !ok {
+		return db.eq, func() error { return nil }, func() {}, nil
+	}
+	tx, err := beginner.Begin()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return tx, tx.Commit, func() { _ = tx.Rollback() }, nil
+}
+
+// latestTxTime returns the latest transaction time start or end persisted in the state table. It is the zero time if
+// the state table is empty.
+func (db *TableDB) latestTxTime(eq ExecerQueryer) (time.Time, error) {
+	// SELECT <column>
+	// FROM <table>
+	// WHERE <column> IS NOT NULL
+	// ORDER BY <column> DESC
+	// LIMIT 1
+	var latest time.Time
+	for _, column := range []string{"__bt_tx_time_start", "__bt_tx_time_end"} {
+		rows, err := squirrel.Select(column).
+			From(db.stateTable).
+			Where(squirrel.NotEq{column: nil}).
+			OrderBy(column + " DESC").
+			Limit(1).
+			RunWith(eq).
+			Query()
+		if err != nil {
+			return time.Time{}, err
+		}
+		ms, err := ScanToMaps(rows)
+		_ = rows.Close()
+		if err != nil {
+			return time.Time{}, err
+		}
+		if len(ms) == 0 {
+			continue
+		}
+		t, err := getTime(column, ms[0])
+		if err != nil {
+			return time.Time{}, err
+		}
+		if t.After(latest) {
+			latest = t
+		}
+	}
+	return latest, nil
+}
+
+type writeConfig struct {
+	validTime      time.Time
+	endValidTime   *time.Time
+	overlapPolicy  bt.OverlapPolicy
+	overhangPolicy bt.OverhangPolicy
+	allValidTime   bool // validTime is unbounded. only valid for Delete
+
+	defaultValidTime bool // validTime was defaulted to the transaction time
+}
+
+func (db *TableDB) handleWriteOpts(opts []bt.WriteOpt, now time.Time) (config *writeConfig, err error) {
+	options := bt.ApplyWriteOpts(opts)
+
+	config = &writeConfig{
+		validTime:        now,
+		endValidTime:     nil,
+		overlapPolicy:    db.overlapPolicy,
+		defaultValidTime: true,
+	}
+	if options.ValidTime != nil {
+		config.validTime = *options.ValidTime
+		config.defaultValidTime = false
+	}
+	if options.EndValidTime != nil {
+		config.endValidTime = options.EndValidTime
+	}
+	if options.OverlapPolicy != nil {
+		config.overlapPolicy = *options.OverlapPolicy
+	}
+	if options.OverhangPolicy != nil {
+		config.overhangPolicy = *options.OverhangPolicy
+	}
+	if options.ValidDuration != nil {
+		return nil, errors.New("valid duration requires a valid time and cannot be combined with an end valid time")
+	}
+	if options.AllValidTime {
+		if options.ValidTime != nil || options.EndValidTime != nil {
+			return nil, errors.New("all valid time cannot be combined with a valid time")
+		}
+		config.allValidTime, config.defaultValidTime = true, false
+	}
+	if options.DecisionTime != nil {
+		return nil, errors.New("decision time is not supported")
+	}
+	if options.IdempotencyKey != "" {
+		return nil, errors.New("idempotency keys are not supported")
+	}
+
+	if config.endValidTime != nil && !config.endValidTime.After(config.validTime) {
+		return nil, errors.New("valid time start must be before end")
+	}
+	// overhangs are computed with package interval
+	if err := interval.CheckTime(config.validTime); err != nil && !config.validTime.Equal(bt.BeginningOfTime) {
+		return nil, err
+	}
+	if config.endValidTime != nil {
+		if err := interval.CheckTime(*config.endValidTime); err != nil {
+			return nil, err
+		}
+	}
+	// disallow valid times being set in the future unless scheduled
+	if !options.FutureValidTime && !db.futureValidTimes {
+		if config.validTime.After(now) {
+			return nil, errors.New("valid time start cannot be in the future")
+		}
+		if config.endValidTime != nil && config.endValidTime.After(now) {
+			return nil, errors.New("valid time end cannot be in the future")
+		}
+	}
+
+	return config, nil
+}
+
+// stateValue returns the value columns of a state table row.
+func stateValue(pkColumnName string, row map[string]interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	for k, v := range row {
+		if !isVersionColumn(pkColumnName, k) {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func isVersionColumn(pkColumnName, col string) bool {
+	return col == pkColumnName || col == "__bt_id" || col == "__bt_tx_time_start" || col == "__bt_tx_time_end" ||
+		col == "__bt_valid_time_start" || col == "__bt_valid_time_end"
+}
+
 // ExecerQueryer can Exec or Query. Both sql.DB and sql.Tx satisfy this interface.
 type ExecerQueryer interface {
 	Exec(query string, args ...interface{}) (sql.Result, error)
@@ -13,6 +13,8 @@ import (
 	"github.com/Masterminds/squirrel"
 	bt "github.com/elh/bitempura"
 	"github.com/elh/bitempura/dbtest"
+	"github.com/elh/bitempura/dbtest/tt"
+	"github.com/elh/bitempura/memory"
 	. "github.com/elh/bitempura/sql"
 	"github.com/google/uuid"
 	_ "github.com/mattn/go-sqlite3"
@@ -21,9 +23,10 @@ import (
 )
 
 var (
-	t1 = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
-	t2 = t1.AddDate(0, 0, 1)
-	t3 = t1.AddDate(0, 0, 2)
+	t1 = tt.Day(1)
+	t2 = tt.Day(2)
+	t3 = tt.Day(3)
+	t4 = tt.Day(4)
 
 	oldValue = map[string]interface{}{
 		"type":       "checking",
@@ -43,49 +46,226 @@ var (
 	verbose = false // if true, print from tests using println
 )
 
-func TestGet(t *testing.T) {
-	dbtest.TestGet(t, oldValue, newValue, func(kvs []*bt.VersionedKV) (bt.DB, func(), error) {
-		sqlDB := setupTestDB(t)
-		for _, kv := range kvs {
-			mustInsertKV(sqlDB, "balances", "id", kv)
-		}
-		db, err := NewTableDB(sqlDB, "balances", "id", toStringPtr("updated_at"), toStringPtr("deleted_at"))
-		return db, closeDBFn(sqlDB), err
-	})
+func TestGetMultipleMatches(t *testing.T) {
+	sqlDB := setupTestDB(t)
+	defer closeDB(sqlDB)
+	// corrupt state table with overlapping versions
+	mustInsertKV(sqlDB, "balances", "id", &bt.VersionedKV{Key: "A", Value: oldValue, TxTimeStart: t1, ValidTimeStart: t1})
+	mustInsertKV(sqlDB, "balances", "id", &bt.VersionedKV{Key: "A", Value: newValue, TxTimeStart: t2, ValidTimeStart: t2})
+	db, err := NewTableDB(sqlDB, "balances", "id", toStringPtr("updated_at"), toStringPtr("deleted_at"))
+	require.Nil(t, err)
+
+	kv, err := db.Get("A", bt.AsOfValidTime(t1), bt.AsOfTransactionTime(t3))
+	require.Nil(t, err)
+	assert.Equal(t, 0.0, kv.Value.(map[string]interface{})["balance"])
+	_, err = db.Get("A", bt.AsOfValidTime(t3), bt.AsOfTransactionTime(t3))
+	require.NotNil(t, err)
+	require.NotErrorIs(t, err, bt.ErrNotFound)
 }
 
-func TestList(t *testing.T) {
-	dbtest.TestList(t, oldValue, newValue, func(kvs []*bt.VersionedKV) (bt.DB, func(), error) {
-		sqlDB := setupTestDB(t)
-		for _, kv := range kvs {
-			mustInsertKV(sqlDB, "balances", "id", kv)
-		}
-		db, err := NewTableDB(sqlDB, "balances", "id", toStringPtr("updated_at"), toStringPtr("deleted_at"))
-		return db, closeDBFn(sqlDB), err
+// TestSuites runs the dbtest suites against a TableDB of the balances table. Values are strings stored in rows by
+// stringValueDB.
+func TestSuites(t *testing.T) {
+	dbtest.RunSuites(t, dbtest.Backend{
+		Capabilities: []dbtest.Capability{dbtest.CapabilitySeed, dbtest.CapabilityWrite, dbtest.CapabilityClock,
+			dbtest.CapabilityBatch},
+		NewDB: func(kvs []*bt.VersionedKV, clock bt.Clock) (bt.DB, func(), error) {
+			sqlDB := setupTestDB(t)
+			for _, kv := range kvs {
+				rowKV := *kv
+				rowKV.Value = toRow(kv.Value)
+				mustInsertKV(sqlDB, "balances", "id", &rowKV)
+			}
+			db, err := NewTableDB(sqlDB, "balances", "id", toStringPtr("updated_at"), toStringPtr("deleted_at"),
+				WithClock(clock))
+			return &stringValueDB{DB: db}, closeDBFn(sqlDB), err
+		},
+		OldValue: "Old",
+		NewValue: "New",
+		// times are compared as SQLite text, so times in different locations are misordered
+		Skip: []string{"ChaosClock"},
+	}, dbtest.WithInvariantChecks())
+}
+
+func TestOverlapPolicy(t *testing.T) {
+	sqlDB := setupTestDB(t)
+	defer closeDB(sqlDB)
+	mustInsertKV(sqlDB, "balances", "id", &bt.VersionedKV{Key: "A", Value: oldValue, TxTimeStart: t1, ValidTimeStart: t1})
+	db, err := NewTableDB(sqlDB, "balances", "id", toStringPtr("updated_at"), toStringPtr("deleted_at"),
+		WithOverlapPolicy(bt.OverlapReject))
+	require.Nil(t, err)
+	require.ErrorIs(t, db.Set("A", newValue), bt.ErrOverlap)
+	require.Nil(t, db.Set("A", newValue, bt.WithOverlapPolicy(bt.OverlapClip)))
+}
+
+func TestNotFoundError(t *testing.T) {
+	sqlDB := setupTestDB(t)
+	defer closeDB(sqlDB)
+	mustInsertKV(sqlDB, "balances", "id", &bt.VersionedKV{Key: "A", Value: oldValue, TxTimeStart: t2, ValidTimeStart: t2})
+	db, err := NewTableDB(sqlDB, "balances", "id", toStringPtr("updated_at"), toStringPtr("deleted_at"))
+	require.Nil(t, err)
+
+	_, err = db.Get("A", bt.AsOfValidTime(t1), bt.AsOfTransactionTime(t3))
+	require.ErrorIs(t, err, bt.ErrNotFound)
+	var notFound *bt.NotFoundError
+	require.ErrorAs(t, err, &notFound)
+	assert.Equal(t, &bt.NotFoundError{Key: "A", ValidTime: t1, TxTime: t3}, notFound)
+
+	_, err = db.History("B")
+	require.ErrorAs(t, err, &notFound)
+	assert.Equal(t, &bt.NotFoundError{Key: "B"}, notFound)
+}
+
+// settableClock is a clock that, unlike clock.Clock, can be set backwards.
+type settableClock struct {
+	now time.Time
+}
+
+func (c *settableClock) Now() time.Time {
+	return c.now
+}
+
+func TestTxTimePolicy(t *testing.T) {
+	sqlDB := setupTestDB(t)
+	defer closeDB(sqlDB)
+	mustInsertKV(sqlDB, "balances", "id", &bt.VersionedKV{
+		Key: "A", Value: oldValue, TxTimeStart: t1, TxTimeEnd: &t3, ValidTimeStart: t1,
 	})
+
+	// a restarted DB with a skewed clock
+	c := &settableClock{t2}
+	db, err := NewTableDB(sqlDB, "balances", "id", toStringPtr("updated_at"), toStringPtr("deleted_at"),
+		WithClock(c), WithTxTimePolicy(bt.TxTimeReject))
+	require.Nil(t, err)
+	require.ErrorIs(t, db.Set("B", newValue), bt.ErrTxTimeRegressed)
+	_, err = db.History("B")
+	require.ErrorIs(t, err, bt.ErrNotFound)
+
+	db, err = NewTableDB(sqlDB, "balances", "id", toStringPtr("updated_at"), toStringPtr("deleted_at"),
+		WithClock(c), WithTxTimePolicy(bt.TxTimeAdjust))
+	require.Nil(t, err)
+	require.Nil(t, db.Set("B", newValue))
+	kv, err := db.Get("B", bt.AsOfValidTime(t3), bt.AsOfTransactionTime(t3))
+	require.Nil(t, err)
+	assert.True(t, kv.TxTimeStart.Equal(t3))
+	assert.True(t, kv.ValidTimeStart.Equal(t3))
+}
+
+func TestListFunc(t *testing.T) {
+	sqlDB := setupTestDB(t)
+	defer closeDB(sqlDB)
+	for _, key := range []string{"a", "b", "c"} {
+		mustInsertKV(sqlDB, "balances", "id", &bt.VersionedKV{Key: key, Value: oldValue, TxTimeStart: t1, ValidTimeStart: t1})
+	}
+	db, err := NewTableDB(sqlDB, "balances", "id", toStringPtr("updated_at"), toStringPtr("deleted_at"))
+	require.Nil(t, err)
+
+	expected, err := db.List()
+	require.Nil(t, err)
+	var got []*bt.VersionedKV
+	require.Nil(t, db.(bt.ListStreamer).ListFunc(func(kv *bt.VersionedKV) bool {
+		got = append(got, kv)
+		return len(got) < 2
+	}))
+	assert.Equal(t, expected[:2], got)
+}
+
+func TestHistories(t *testing.T) {
+	sqlDB := setupTestDB(t)
+	defer closeDB(sqlDB)
+	for _, kv := range []*bt.VersionedKV{
+		{Key: "a", Value: oldValue, TxTimeStart: t1, TxTimeEnd: &t2, ValidTimeStart: t1},
+		{Key: "a", Value: newValue, TxTimeStart: t2, ValidTimeStart: t1},
+		{Key: "b", Value: oldValue, TxTimeStart: t1, ValidTimeStart: t1},
+		{Key: "c", Value: oldValue, TxTimeStart: t1, ValidTimeStart: t1},
+	} {
+		mustInsertKV(sqlDB, "balances", "id", kv)
+	}
+	db, err := NewTableDB(sqlDB, "balances", "id", toStringPtr("updated_at"), toStringPtr("deleted_at"))
+	require.Nil(t, err)
+
+	histories, err := db.(bt.HistoriesReader).Histories([]string{"a", "b", "missing"})
+	require.Nil(t, err)
+	require.Len(t, histories, 2)
+	for _, key := range []string{"a", "b"} {
+		vs, err := db.History(key)
+		require.Nil(t, err)
+		assert.Equal(t, vs, histories[key])
+	}
 }
 
-// func TestDelete(t *testing.T) {
-// 	dbtest.TestDelete(t, oldValue, newValue, func(kvs []*bt.VersionedKV, clock bt.Clock) (bt.DB, func(), error) {
-// 		sqlDB := setupTestDB(t)
-// 		for _, kv := range kvs {
-// 			mustInsertKV(sqlDB, "balances", "id", kv)
-// 		}
-// 		// TODO: control TX in clock...
-// 		db, err := NewTableDB(sqlDB, "balances", "id", toStringPtr("updated_at"), toStringPtr("deleted_at"))
-// 		return db, closeDBFn(sqlDB), err
-// 	})
-// }
-
-func TestHistory(t *testing.T) {
-	dbtest.TestHistory(t, oldValue, newValue, func(kvs []*bt.VersionedKV) (bt.DB, func(), error) {
-		sqlDB := setupTestDB(t)
-		for _, kv := range kvs {
-			mustInsertKV(sqlDB, "balances", "id", kv)
+func TestGetMulti(t *testing.T) {
+	sqlDB := setupTestDB(t)
+	defer closeDB(sqlDB)
+	for _, kv := range []*bt.VersionedKV{
+		{Key: "a", Value: oldValue, TxTimeStart: t1, TxTimeEnd: &t2, ValidTimeStart: t1},
+		{Key: "a", Value: newValue, TxTimeStart: t2, ValidTimeStart: t1},
+		{Key: "b", Value: oldValue, TxTimeStart: t1, ValidTimeStart: t1, ValidTimeEnd: &t2},
+	} {
+		mustInsertKV(sqlDB, "balances", "id", kv)
+	}
+	db, err := NewTableDB(sqlDB, "balances", "id", toStringPtr("updated_at"), toStringPtr("deleted_at"))
+	require.Nil(t, err)
+
+	for _, opts := range [][]bt.ReadOpt{nil, {bt.AsOfValidTime(t1), bt.AsOfTransactionTime(t1)}} {
+		keys := []string{"b", "missing", "a"}
+		kvs, err := db.(bt.MultiGetter).GetMulti(keys, opts...)
+		require.Nil(t, err)
+		require.Len(t, kvs, len(keys))
+		for i, key := range keys {
+			kv, err := db.Get(key, opts...)
+			if errors.Is(err, bt.ErrNotFound) {
+				assert.Nil(t, kvs[i])
+				continue
+			}
+			require.Nil(t, err)
+			assert.Equal(t, kv, kvs[i])
 		}
-		db, err := NewTableDB(sqlDB, "balances", "id", toStringPtr("updated_at"), toStringPtr("deleted_at"))
-		return db, closeDBFn(sqlDB), err
-	})
+	}
+}
+
+func TestChangedKeys(t *testing.T) {
+	sqlDB := setupTestDB(t)
+	defer closeDB(sqlDB)
+	for _, kv := range []*bt.VersionedKV{
+		{Key: "a", Value: oldValue, TxTimeStart: t1, TxTimeEnd: &t2, ValidTimeStart: t1},
+		{Key: "a", Value: newValue, TxTimeStart: t2, ValidTimeStart: t1},
+		{Key: "b", Value: oldValue, TxTimeStart: t1, ValidTimeStart: t1},
+		{Key: "c", Value: oldValue, TxTimeStart: t1, TxTimeEnd: &t3, ValidTimeStart: t1},
+	} {
+		mustInsertKV(sqlDB, "balances", "id", kv)
+	}
+	db, err := NewTableDB(sqlDB, "balances", "id", toStringPtr("updated_at"), toStringPtr("deleted_at"))
+	require.Nil(t, err)
+
+	keys, err := bt.ChangedKeys(db, t1)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"a", "c"}, keys)
+	keys, err = bt.ChangedKeys(db, t2)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"c"}, keys)
+	keys, err = bt.ChangedKeys(db, t3)
+	require.Nil(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestKeys(t *testing.T) {
+	sqlDB := setupTestDB(t)
+	defer closeDB(sqlDB)
+	for _, key := range []string{"b", "a", "b"} {
+		mustInsertKV(sqlDB, "balances", "id", &bt.VersionedKV{
+			Key:            key,
+			Value:          oldValue,
+			TxTimeStart:    t1,
+			ValidTimeStart: t1,
+		})
+	}
+	db, err := NewTableDB(sqlDB, "balances", "id", toStringPtr("updated_at"), toStringPtr("deleted_at"))
+	require.Nil(t, err)
+
+	keys, err := db.(bt.KeyLister).Keys()
+	require.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, keys)
 }
 
 func TestQuery(t *testing.T) {
@@ -130,7 +310,7 @@ func TestQuery(t *testing.T) {
 
 	db, err := NewTableDB(sqlDB, "balances", "id", toStringPtr("updated_at"), toStringPtr("deleted_at"))
 	require.Nil(t, err)
-	defer dbtest.WriteOutputHistory(t, db, []string{"alice/balance", "bob/balance", "carol/balance"}, t.Name(), "")
+	defer dbtest.WriteOutput(t, nil, db, []string{"alice/balance", "bob/balance", "carol/balance"}, "")
 
 	testCases := []struct {
 		desc    string
@@ -311,6 +491,8 @@ func setupTestDB(t *testing.T) *sql.DB {
 		);
 	`)
 	require.Nil(t, err)
+	_, err = sqlDB.Exec(StateTableIndexDDL("balances", "id"))
+	require.Nil(t, err)
 
 	return sqlDB
 }
@@ -360,6 +542,88 @@ func mustInsertKV(db *sql.DB, tableName, pkColumnName string, kv *bt.VersionedKV
 	}
 }
 
+// stringValueDB adapts the string and int values used by the dbtest suites to rows of the balances table. Strings are
+// stored in the type column and ints in the balance column. The type column is not nullable so nil is stored as "".
+type stringValueDB struct {
+	bt.DB
+}
+
+func (db *stringValueDB) Get(key string, opts ...bt.ReadOpt) (*bt.VersionedKV, error) {
+	kv, err := db.DB.Get(key, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return fromRowKVs([]*bt.VersionedKV{kv})[0], nil
+}
+
+func (db *stringValueDB) List(opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	kvs, err := db.DB.List(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return fromRowKVs(kvs), nil
+}
+
+func (db *stringValueDB) Set(key string, value bt.Value, opts ...bt.WriteOpt) error {
+	return db.DB.Set(key, toRow(value), opts...)
+}
+
+func (db *stringValueDB) History(key string, opts ...bt.ReadOpt) ([]*bt.VersionedKV, error) {
+	kvs, err := db.DB.History(key, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return fromRowKVs(kvs), nil
+}
+
+func (db *stringValueDB) WriteBatch(b *bt.WriteBatch) error {
+	rows := &bt.WriteBatch{}
+	for _, w := range b.Writes {
+		if w.Delete {
+			rows.Delete(w.Key, w.Opts...)
+		} else {
+			rows.Set(w.Key, toRow(w.Value), w.Opts...)
+		}
+	}
+	return bt.ApplyBatch(db.DB, rows)
+}
+
+// intValueType is the type column of rows storing int values in the balance column.
+const intValueType = "__int"
+
+func toRow(v bt.Value) bt.Value {
+	balance := 0.0
+	switch n := v.(type) {
+	case nil:
+		v = ""
+	case int:
+		v, balance = intValueType, float64(n)
+	}
+	return map[string]interface{}{
+		"type":       v,
+		"balance":    balance,
+		"is_active":  false,
+		"updated_at": t1,
+		"deleted_at": nil,
+	}
+}
+
+func fromRowKVs(kvs []*bt.VersionedKV) []*bt.VersionedKV {
+	out := make([]*bt.VersionedKV, len(kvs))
+	for i, kv := range kvs {
+		c := *kv
+		c.Value = kv.Value.(map[string]interface{})["type"]
+		if c.Value == "" {
+			c.Value = nil
+		}
+		if c.Value == intValueType {
+			c.Value = int(kv.Value.(map[string]interface{})["balance"].(float64))
+		}
+		out[i] = &c
+	}
+	return out
+}
+
 func toStringPtr(s string) *string {
 	return &s
 }
@@ -378,3 +642,166 @@ func println(v ...interface{}) {
 		fmt.Println(v...)
 	}
 }
+
+func TestCrashConsistency(t *testing.T) {
+	var sqlDB *sql.DB
+	dbtest.TestCrashConsistency(t, "Old", "New", dbtest.CrashBackend{
+		Open: func(clock bt.Clock) (bt.DB, error) {
+			if sqlDB == nil {
+				sqlDB = setupTestDB(t)
+			} else {
+				var err error
+				if sqlDB, err = sql.Open("sqlite3", "bitempura_test.db"); err != nil {
+					return nil, err
+				}
+			}
+			db, err := NewTableDB(sqlDB, "balances", "id", toStringPtr("updated_at"), toStringPtr("deleted_at"),
+				WithClock(clock))
+			return &stringValueDB{DB: db}, err
+		},
+		Kill: func() {
+			closeDB(sqlDB)
+		},
+	})
+}
+
+func TestImport(t *testing.T) {
+	sqlDB := setupTestDB(t)
+	defer closeDB(sqlDB)
+	sdb, err := NewTableDB(sqlDB, "balances", "id", toStringPtr("updated_at"), toStringPtr("deleted_at"))
+	require.Nil(t, err)
+	db := &stringValueDB{DB: sdb}
+	importer := sdb.(bt.Importer)
+
+	require.Nil(t, importer.Import([]*bt.VersionedKV{
+		{Key: "A", Value: toRow("Old"), TxTimeStart: t1, TxTimeEnd: &t3, ValidTimeStart: t1},
+		{Key: "A", Value: toRow("New"), TxTimeStart: t3, ValidTimeStart: t1},
+	}))
+	kv, err := db.Get("A", bt.AsOfTransactionTime(t2))
+	require.Nil(t, err)
+	assert.Equal(t, "Old", kv.Value)
+	kv, err = db.Get("A")
+	require.Nil(t, err)
+	assert.Equal(t, "New", kv.Value)
+
+	// overlapping versions are rejected without importing any
+	err = importer.Import([]*bt.VersionedKV{
+		{Key: "B", Value: toRow("Old"), TxTimeStart: t1, ValidTimeStart: t1},
+		{Key: "A", Value: toRow("Newest"), TxTimeStart: tt.Day(4), ValidTimeStart: t1},
+	})
+	require.NotNil(t, err)
+	_, err = db.History("B")
+	require.ErrorIs(t, err, bt.ErrNotFound)
+}
+
+func TestStats(t *testing.T) {
+	sqlDB := setupTestDB(t)
+	defer closeDB(sqlDB)
+	kvs := []*bt.VersionedKV{
+		{Key: "A", Value: toRow("Old"), TxTimeStart: t1, TxTimeEnd: &t2, ValidTimeStart: t1},
+		{Key: "A", Value: toRow("New"), TxTimeStart: t2, ValidTimeStart: t1},
+		{Key: "B", Value: toRow("Old"), TxTimeStart: t3, ValidTimeStart: t3},
+	}
+	for _, kv := range kvs {
+		mustInsertKV(sqlDB, "balances", "id", kv)
+	}
+	db, err := NewTableDB(sqlDB, "balances", "id", toStringPtr("updated_at"), toStringPtr("deleted_at"))
+	require.Nil(t, err)
+
+	stats, err := db.(bt.StatsReader).Stats()
+	require.Nil(t, err)
+	assert.Equal(t, 2, stats.Keys)
+	assert.Equal(t, 3, stats.Total.Versions)
+	assert.Equal(t, 2, stats.PerKey["A"].Versions)
+	assert.Equal(t, 1, stats.PerKey["A"].OpenVersions)
+	assert.Equal(t, []string{"A", "B"}, stats.LargestKeys(0))
+
+	// the same as reading every history
+	fallback, err := bt.ReadStats(struct {
+		bt.DB
+		bt.KeyLister
+	}{db, db.(bt.KeyLister)})
+	require.Nil(t, err)
+	assert.Equal(t, stats, fallback)
+}
+
+func TestReadTx(t *testing.T) {
+	sqlDB := setupTestDB(t)
+	defer closeDB(sqlDB)
+	c := &settableClock{now: t2}
+	db, err := NewTableDB(sqlDB, "balances", "id", toStringPtr("updated_at"), toStringPtr("deleted_at"),
+		WithClock(c))
+	require.Nil(t, err)
+	require.Nil(t, db.Set("A", toRow("Old")))
+
+	tx := db.ReadTx()
+	c.now = t3
+	require.Nil(t, db.Set("A", toRow("New")))
+
+	kv, err := tx.Get("A")
+	require.Nil(t, err)
+	assert.Equal(t, "Old", kv.Value.(map[string]interface{})["type"])
+	vs, err := tx.History("A")
+	require.Nil(t, err)
+	require.Len(t, vs, 1)
+	assert.Nil(t, vs[0].TxTimeEnd)
+
+	// writes are not made before a pinned transaction time even if the clock regresses
+	reject, err := NewTableDB(sqlDB, "balances", "id", toStringPtr("updated_at"), toStringPtr("deleted_at"),
+		WithClock(c), WithTxTimePolicy(bt.TxTimeReject))
+	require.Nil(t, err)
+	c.now = t4
+	tx = reject.ReadTx()
+	c.now = t3
+	assert.ErrorIs(t, reject.Set("A", toRow("Newer")), bt.ErrTxTimeRegressed)
+	kv, err = tx.Get("A")
+	require.Nil(t, err)
+	assert.Equal(t, "New", kv.Value.(map[string]interface{})["type"])
+}
+
+func TestExportSeed(t *testing.T) {
+	c := &settableClock{now: t1}
+	mdb, err := memory.NewDB(memory.WithClock(c))
+	require.Nil(t, err)
+	require.Nil(t, mdb.Set("A", toRow("Old")))
+	require.Nil(t, mdb.Set("B", toRow("it's")))
+	c.now = t2
+	require.Nil(t, mdb.Set("A", toRow("New"), bt.WithValidTime(t1), bt.WithEndValidTime(t2)))
+	c.now = t3
+	require.Nil(t, mdb.Delete("B"))
+
+	var seed strings.Builder
+	n, err := ExportSeed(&seed, mdb, "balances", "id")
+	require.Nil(t, err)
+	assert.Equal(t, 5, n)
+	var again strings.Builder
+	_, err = ExportSeed(&again, mdb, "balances", "id", WithSeedKeys([]string{"B", "A"}))
+	require.Nil(t, err)
+	assert.Equal(t, seed.String(), again.String(), "exports are deterministic")
+	assert.Contains(t, seed.String(), "'it''s'")
+
+	sqlDB := setupTestDB(t)
+	defer closeDB(sqlDB)
+	for _, stmt := range strings.SplitAfter(strings.TrimSpace(seed.String()), ";\n") {
+		_, err := sqlDB.Exec(stmt)
+		require.Nil(t, err, stmt)
+	}
+	db, err := NewTableDB(sqlDB, "balances", "id", toStringPtr("updated_at"), toStringPtr("deleted_at"))
+	require.Nil(t, err)
+	for _, key := range []string{"A", "B"} {
+		expected, err := mdb.History(key)
+		require.Nil(t, err)
+		actual, err := db.History(key)
+		require.Nil(t, err)
+		require.Len(t, actual, len(expected))
+		for i := range expected {
+			e, a := fromRowKVs(expected[i : i+1])[0], fromRowKVs(actual[i : i+1])[0]
+			assert.True(t, e.Equal(a), "expected %v, got %v", toJSON(e), toJSON(a))
+		}
+	}
+
+	_, err = ExportSeed(&seed, mdb, "balances", "id", WithSeedColumns(func(v bt.Value) (map[string]interface{}, error) {
+		return map[string]interface{}{"type": struct{}{}}, nil
+	}))
+	assert.NotNil(t, err)
+}
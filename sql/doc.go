@@ -1,4 +1,6 @@
 // Package sql implements a SQL-backed, SQL-queryable, bitemporal database.
 // This implements the key-value oriented interface of bitempura.DB and provides SQL querying.
+// Values are stored unencrypted and uncompressed as the columns of the table, so they can be queried with Select. Use
+// the database's own encryption at rest and compression for them.
 // WARNING: WIP. this implementation is experimental and abandoned.
 package sql
@@ -18,47 +18,47 @@ func ScanToVersionedKVs(pkColumnName string, rows *sql.Rows) ([]*bt.VersionedKV,
 
 	out := make([]*bt.VersionedKV, len(maps))
 	for i, m := range maps {
-		key, err := getString(pkColumnName, m)
+		kv, err := toVersionedKV(pkColumnName, m)
 		if err != nil {
 			return nil, err
 		}
-		txTimeStart, err := getTime("__bt_tx_time_start", m)
-		if err != nil {
-			return nil, err
-		}
-		txTimeEnd, err := getNullTime("__bt_tx_time_end", m)
-		if err != nil {
-			return nil, err
-		}
-		validTimeStart, err := getTime("__bt_valid_time_start", m)
-		if err != nil {
-			return nil, err
-		}
-		validTimeEnd, err := getNullTime("__bt_valid_time_end", m)
-		if err != nil {
-			return nil, err
-		}
-
-		val := map[string]interface{}{}
-		for k, v := range m {
-			if k != pkColumnName && k != "__bt_id" && k != "__bt_tx_time_start" && k != "__bt_tx_time_end" &&
-				k != "__bt_valid_time_start" && k != "__bt_valid_time_end" {
-				val[k] = v
-			}
-		}
-		kv := &bt.VersionedKV{
-			Key:            key,
-			Value:          val,
-			TxTimeStart:    txTimeStart,
-			TxTimeEnd:      txTimeEnd,
-			ValidTimeStart: validTimeStart,
-			ValidTimeEnd:   validTimeEnd,
-		}
 		out[i] = kv
 	}
 	return out, nil
 }
 
+// toVersionedKV converts a state table row scanned to a map into a VersionedKV.
+func toVersionedKV(pkColumnName string, m map[string]interface{}) (*bt.VersionedKV, error) {
+	key, err := getString(pkColumnName, m)
+	if err != nil {
+		return nil, err
+	}
+	txTimeStart, err := getTime("__bt_tx_time_start", m)
+	if err != nil {
+		return nil, err
+	}
+	txTimeEnd, err := getNullTime("__bt_tx_time_end", m)
+	if err != nil {
+		return nil, err
+	}
+	validTimeStart, err := getTime("__bt_valid_time_start", m)
+	if err != nil {
+		return nil, err
+	}
+	validTimeEnd, err := getNullTime("__bt_valid_time_end", m)
+	if err != nil {
+		return nil, err
+	}
+	return &bt.VersionedKV{
+		Key:            key,
+		Value:          stateValue(pkColumnName, m),
+		TxTimeStart:    txTimeStart,
+		TxTimeEnd:      txTimeEnd,
+		ValidTimeStart: validTimeStart,
+		ValidTimeEnd:   validTimeEnd,
+	}, nil
+}
+
 // ScanToMaps generically scans SQL rows into a slice of maps with columns as map keys. Caller should defer
 // rows.Close() but does not need to call rows.Err()
 func ScanToMaps(rows *sql.Rows) ([]map[string]interface{}, error) {
@@ -0,0 +1,186 @@
+package sql
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	bt "github.com/elh/bitempura"
+	"github.com/google/uuid"
+)
+
+// SeedTimeFormat is the format of time literals in seed statements. It is the first format of the sqlite3 driver and is
+// accepted by other SQL databases' timestamp columns. Times are written in UTC.
+const SeedTimeFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+// seedNamespace namespaces the deterministic __bt_id UUIDs of seeded versions.
+var seedNamespace = uuid.NewSHA1(uuid.NameSpaceOID, []byte("github.com/elh/bitempura/sql.seed"))
+
+// ExportSeed writes an INSERT statement into the state table of table for every version of every key in db to w, so
+// histories built in another DB, such as memory.DB in tests, can be loaded into a SQL deployment read by TableDB. Keys
+// are enumerated with bt.KeyLister unless provided with WithSeedKeys. Values are column maps like those of TableDB
+// unless converted with WithSeedColumns. Statements are ordered by key and then as History, and __bt_id is derived from
+// the version so exports of the same history are identical. It returns the number of statements written.
+func ExportSeed(w io.Writer, db bt.DB, table, pkColumnName string, opts ...SeedOpt) (int, error) {
+	options := &seedOptions{
+		columns: func(v bt.Value) (map[string]interface{}, error) {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, errors.New("value must be of type map[string]interface{}")
+			}
+			return m, nil
+		},
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	keys := options.keys
+	if keys == nil {
+		kl, ok := db.(bt.KeyLister)
+		if !ok {
+			return 0, errors.New("db does not implement bt.KeyLister. keys must be provided with WithSeedKeys")
+		}
+		var err error
+		if keys, err = kl.Keys(); err != nil {
+			return 0, err
+		}
+	} else {
+		keys = append([]string(nil), keys...)
+		sort.Strings(keys)
+	}
+	histories, err := bt.Histories(db, keys)
+	if err != nil {
+		return 0, err
+	}
+
+	stateTable := StateTableName(table)
+	var n int
+	for _, key := range keys {
+		for _, v := range histories[key] {
+			stmt, err := seedStatement(stateTable, pkColumnName, v, options.columns)
+			if err != nil {
+				return n, fmt.Errorf("key=%v: %w", key, err)
+			}
+			if _, err := io.WriteString(w, stmt); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+// seedOptions is a struct for processing SeedOpt's to be used by ExportSeed
+type seedOptions struct {
+	keys    []string
+	columns func(bt.Value) (map[string]interface{}, error)
+}
+
+// SeedOpt is an option for ExportSeed
+type SeedOpt func(*seedOptions)
+
+// WithSeedKeys configures the keys to export. This is required for DBs that do not implement bt.KeyLister.
+func WithSeedKeys(keys []string) SeedOpt {
+	return func(os *seedOptions) {
+		os.keys = keys
+	}
+}
+
+// WithSeedColumns configures the conversion of values to the state table's value columns, e.g. for DBs that do not
+// store column maps.
+func WithSeedColumns(fn func(bt.Value) (map[string]interface{}, error)) SeedOpt {
+	return func(os *seedOptions) {
+		os.columns = fn
+	}
+}
+
+func seedStatement(stateTable, pkColumnName string, v *bt.VersionedKV,
+	columnsFn func(bt.Value) (map[string]interface{}, error)) (string, error) {
+	if err := v.Validate(); err != nil {
+		return "", err
+	}
+	value, err := columnsFn(v.Value)
+	if err != nil {
+		return "", err
+	}
+	id := uuid.NewSHA1(seedNamespace, []byte(strings.Join([]string{
+		v.Key, v.TxTimeStart.UTC().Format(time.RFC3339Nano), v.ValidTimeStart.UTC().Format(time.RFC3339Nano),
+	}, "\x00")))
+	cols := []string{pkColumnName, "__bt_id", "__bt_tx_time_start", "__bt_tx_time_end", "__bt_valid_time_start",
+		"__bt_valid_time_end"}
+	vals := []interface{}{v.Key, id.String(), v.TxTimeStart, v.TxTimeEnd, v.ValidTimeStart, v.ValidTimeEnd}
+	valueCols := make([]string, 0, len(value))
+	for col := range value {
+		valueCols = append(valueCols, col)
+	}
+	sort.Strings(valueCols)
+	for _, col := range valueCols {
+		cols = append(cols, col)
+		vals = append(vals, value[col])
+	}
+
+	literals := make([]string, len(vals))
+	for i, val := range vals {
+		if literals[i], err = seedLiteral(val); err != nil {
+			return "", fmt.Errorf("column %v: %w", cols[i], err)
+		}
+	}
+	return fmt.Sprintf("INSERT INTO %v (%v) VALUES (%v);\n", stateTable, strings.Join(cols, ", "),
+		strings.Join(literals, ", ")), nil
+}
+
+// seedLiteral formats a column value as a SQL literal.
+func seedLiteral(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "NULL", nil
+	case *time.Time:
+		if v == nil {
+			return "NULL", nil
+		}
+		return seedLiteral(*v)
+	case time.Time:
+		return quote(v.UTC().Format(SeedTimeFormat)), nil
+	case string:
+		return quote(v), nil
+	case []byte:
+		return "X'" + hex.EncodeToString(v) + "'", nil
+	case bool:
+		if v {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case int:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float32:
+		return seedLiteral(float64(v))
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", fmt.Errorf("%v has no SQL literal", v)
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	default:
+		return "", fmt.Errorf("unsupported column value type %T", v)
+	}
+}
+
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,91 @@
+//go:build js && wasm
+// +build js,wasm
+
+package wasm
+
+import (
+	"database/sql"
+	"fmt"
+	"syscall/js"
+
+	mwasm "github.com/elh/bitempura/memory/wasm"
+	bsql "github.com/elh/bitempura/sql"
+)
+
+// Init initializes the global Wasm DB as a sql.TableDB backed by a sql.js Database. The bitemporal state table
+// (see sql.StateTableName) must already exist in the sql.js Database. bt_Init must be called before usage.
+// arguments = db: sql.js Database, table: string, pk_column_name: string, [updated_at_column_name: string, deleted_at_column_name: string]
+func Init(this js.Value, inputs []js.Value) interface{} {
+	err := initDB(inputs)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return nil
+	}
+	return nil
+}
+
+// HandleMessage is the Web Worker message protocol entrypoint of the sql.js build. It is memory/wasm's HandleMessage
+// with Init messages handled as by Init. A sql.js Database cannot be posted to a worker, so the worker must open it and
+// pass it as the first arg of the Init message.
+// arguments = message: object ({id: any, fn: string, args: array})
+// returns = object ({id: any, result: any, error: string | null})
+func HandleMessage(this js.Value, inputs []js.Value) interface{} {
+	return mwasm.HandleMessageWithInit(initDB, inputs)
+}
+
+func initDB(inputs []js.Value) error {
+	var jsDB js.Value
+	var table, pkColumnName string
+	var updatedAtColName, deletedAtColName *string
+	{
+		if len(inputs) < 1 {
+			return fmt.Errorf("db is required")
+		}
+		if inputs[0].Type() != js.TypeObject {
+			return fmt.Errorf("db must be a sql.js Database")
+		}
+		jsDB = inputs[0]
+	}
+	{
+		if len(inputs) < 2 {
+			return fmt.Errorf("table is required")
+		}
+		if inputs[1].Type() != js.TypeString {
+			return fmt.Errorf("table must be type string")
+		}
+		table = inputs[1].String()
+	}
+	{
+		if len(inputs) < 3 {
+			return fmt.Errorf("pk_column_name is required")
+		}
+		if inputs[2].Type() != js.TypeString {
+			return fmt.Errorf("pk_column_name must be type string")
+		}
+		pkColumnName = inputs[2].String()
+	}
+	if len(inputs) > 3 && inputs[3].Type() != js.TypeNull && inputs[3].Type() != js.TypeUndefined {
+		if inputs[3].Type() != js.TypeString {
+			return fmt.Errorf("updated_at_column_name must be type string (or null or undefined)")
+		}
+		s := inputs[3].String()
+		updatedAtColName = &s
+	}
+	if len(inputs) > 4 && inputs[4].Type() != js.TypeNull && inputs[4].Type() != js.TypeUndefined {
+		if inputs[4].Type() != js.TypeString {
+			return fmt.Errorf("deleted_at_column_name must be type string (or null or undefined)")
+		}
+		s := inputs[4].String()
+		deletedAtColName = &s
+	}
+
+	sqlDB := sql.OpenDB(&connector{db: jsDB})
+	// sql.js Databases are single connection
+	sqlDB.SetMaxOpenConns(1)
+	db, err := bsql.NewTableDB(sqlDB, table, pkColumnName, updatedAtColName, deletedAtColName)
+	if err != nil {
+		return err
+	}
+	mwasm.UseDB(db)
+	return nil
+}
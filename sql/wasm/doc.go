@@ -0,0 +1,4 @@
+// Package wasm provides compilation of sql.TableDB to WebAssembly using an in-browser SQLite via sql.js.
+// The working model for execution in Wasm is the same as memory/wasm: there is one global DB and the memory/wasm adapters
+// are reused for all DB functions.
+package wasm
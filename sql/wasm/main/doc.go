@@ -0,0 +1,2 @@
+// Package main is the main being built by sql/wasm
+package main
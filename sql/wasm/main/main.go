@@ -0,0 +1,33 @@
+//go:build js && wasm
+// +build js,wasm
+
+package main
+
+import (
+	"syscall/js"
+
+	mwasm "github.com/elh/bitempura/memory/wasm"
+	"github.com/elh/bitempura/sql/wasm"
+)
+
+// All functions are exported with the "bt_" prefix.
+// The working model for execution in Wasm is that there is one global sql.TableDB. bt_Init must be called with a sql.js
+// Database before usage.
+func main() {
+	c := make(chan struct{})
+	// init (and re-init)
+	js.Global().Set("bt_Init", js.FuncOf(wasm.Init))
+	// db functions
+	js.Global().Set("bt_Get", js.FuncOf(mwasm.Get))
+	js.Global().Set("bt_List", js.FuncOf(mwasm.List))
+	js.Global().Set("bt_Set", js.FuncOf(mwasm.Set))
+	js.Global().Set("bt_Delete", js.FuncOf(mwasm.Delete))
+	js.Global().Set("bt_History", js.FuncOf(mwasm.History))
+	js.Global().Set("bt_Diff", js.FuncOf(mwasm.Diff))
+	js.Global().Set("bt_Query", js.FuncOf(mwasm.Query))
+	// helpers
+	js.Global().Set("bt_OnChange", js.FuncOf(mwasm.OnChange))
+	// web worker message protocol
+	js.Global().Set("bt_HandleMessage", js.FuncOf(wasm.HandleMessage))
+	<-c
+}
@@ -0,0 +1,212 @@
+//go:build js && wasm
+// +build js,wasm
+
+package wasm
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"syscall/js"
+	"time"
+)
+
+// timeFormat is a fixed width format so that times stored as TEXT in sql.js compare correctly lexicographically.
+const timeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+var _ driver.Connector = (*connector)(nil)
+
+// connector is a database/sql connector for an in-browser sql.js Database object.
+// see https://sql.js.org/documentation/Database.html
+type connector struct {
+	db js.Value
+}
+
+func (c *connector) Connect(context.Context) (driver.Conn, error) {
+	return &conn{db: c.db}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return &sqljsDriver{}
+}
+
+// sqljsDriver exists only to satisfy driver.Connector. Connections can only be opened with an existing sql.js Database.
+type sqljsDriver struct{}
+
+func (d *sqljsDriver) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("sqljs: connections must be created with a sql.js Database object")
+}
+
+type conn struct {
+	db js.Value
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{c: c, query: query}, nil
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	if err := c.run("BEGIN", nil); err != nil {
+		return nil, err
+	}
+	return &tx{c: c}, nil
+}
+
+// run executes a statement without results. sql.js throws JS exceptions on errors which are recovered into errors.
+func (c *conn) run(query string, args []driver.Value) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("sqljs: %v", r)
+		}
+	}()
+	c.db.Call("run", query, toJSArgs(args))
+	return nil
+}
+
+type tx struct {
+	c *conn
+}
+
+func (t *tx) Commit() error {
+	return t.c.run("COMMIT", nil)
+}
+
+func (t *tx) Rollback() error {
+	return t.c.run("ROLLBACK", nil)
+}
+
+type stmt struct {
+	c     *conn
+	query string
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	if err := s.c.run(s.query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(s.c.db.Call("getRowsModified").Int()), nil
+}
+
+func (s *stmt) Query(args []driver.Value) (_ driver.Rows, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("sqljs: %v", r)
+		}
+	}()
+	jsStmt := s.c.db.Call("prepare", s.query)
+	// the statement is freed by rows.Close once returned. free it here if bind or getColumnNames throws so it does not
+	// leak in the Wasm heap
+	returned := false
+	defer func() {
+		if !returned {
+			jsStmt.Call("free")
+		}
+	}()
+	jsStmt.Call("bind", toJSArgs(args))
+
+	jsCols := jsStmt.Call("getColumnNames")
+	cols := make([]string, jsCols.Length())
+	for i := range cols {
+		cols[i] = jsCols.Index(i).String()
+	}
+	returned = true
+	return &rows{stmt: jsStmt, cols: cols}, nil
+}
+
+type rows struct {
+	stmt js.Value
+	cols []string
+}
+
+func (r *rows) Columns() []string {
+	return r.cols
+}
+
+func (r *rows) Close() error {
+	r.stmt.Call("free")
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("sqljs: %v", rec)
+		}
+	}()
+	if !r.stmt.Call("step").Bool() {
+		return io.EOF
+	}
+	vals := r.stmt.Call("get")
+	for i := range dest {
+		dest[i] = fromJSValue(vals.Index(i))
+	}
+	return nil
+}
+
+func toJSArgs(args []driver.Value) []interface{} {
+	out := make([]interface{}, len(args))
+	for i, arg := range args {
+		out[i] = toJSValue(arg)
+	}
+	return out
+}
+
+// toJSValue converts driver values into values sql.js can bind. Times are stored as fixed width UTC TEXT.
+func toJSValue(v driver.Value) interface{} {
+	switch v := v.(type) {
+	case nil:
+		return js.Null()
+	case int64:
+		return float64(v)
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case time.Time:
+		return v.UTC().Format(timeFormat)
+	case []byte:
+		arr := js.Global().Get("Uint8Array").New(len(v))
+		js.CopyBytesToJS(arr, v)
+		return arr
+	default:
+		return v
+	}
+}
+
+// fromJSValue converts sql.js results into driver values. Because sql.js does not expose declared column types, TEXT
+// values in the time format written by toJSValue are returned as time.Time.
+func fromJSValue(v js.Value) driver.Value {
+	switch v.Type() {
+	case js.TypeNull, js.TypeUndefined:
+		return nil
+	case js.TypeNumber:
+		return v.Float()
+	case js.TypeBoolean:
+		return v.Bool()
+	case js.TypeString:
+		s := v.String()
+		if t, err := time.Parse(timeFormat, s); err == nil {
+			return t
+		}
+		return s
+	default:
+		b := make([]byte, v.Length())
+		js.CopyBytesToGo(b, v)
+		return b
+	}
+}
@@ -0,0 +1,168 @@
+package bitempura
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+// KeyStats describes the versions of a key, or of all keys in Stats.Total.
+type KeyStats struct {
+	Versions     int // all versions
+	OpenVersions int // versions that are current in transaction time
+
+	// earliest and latest start or end of any version. zero if there are no versions
+	EarliestTxTime    time.Time
+	LatestTxTime      time.Time
+	EarliestValidTime time.Time
+	LatestValidTime   time.Time
+
+	ApproxBytes int64 // see ApproxVersionSize
+}
+
+// Stats describes the contents of a DB for capacity planning and monitoring.
+type Stats struct {
+	Keys   int
+	Total  KeyStats
+	PerKey map[string]*KeyStats
+}
+
+// StatsReader is implemented by DBs that can compute Stats without reading every history through the DB interface.
+type StatsReader interface {
+	// Stats returns per-key and total statistics of all versions.
+	Stats() (*Stats, error)
+}
+
+// ReadStats returns per-key and total statistics of all versions. If db is a StatsReader, its Stats are returned.
+// Otherwise, db must be a KeyLister and the histories of all keys are read.
+func ReadStats(db DB) (*Stats, error) {
+	if sr, ok := db.(StatsReader); ok {
+		return sr.Stats()
+	}
+	kl, ok := db.(KeyLister)
+	if !ok {
+		return nil, errors.New("DB must be a StatsReader or KeyLister")
+	}
+	keys, err := kl.Keys()
+	if err != nil {
+		return nil, err
+	}
+	histories, err := Histories(db, keys)
+	if err != nil {
+		return nil, err
+	}
+	stats := &Stats{PerKey: make(map[string]*KeyStats, len(histories))}
+	for key, vs := range histories {
+		ks := &KeyStats{}
+		for _, v := range vs {
+			ks.Add(v)
+		}
+		stats.AddKey(key, ks)
+	}
+	return stats, nil
+}
+
+// Add accumulates a version into the stats.
+func (s *KeyStats) Add(v *VersionedKV) {
+	s.Versions++
+	if v.TxTimeEnd == nil {
+		s.OpenVersions++
+	}
+	s.observeTxTime(v.TxTimeStart)
+	if v.TxTimeEnd != nil {
+		s.observeTxTime(*v.TxTimeEnd)
+	}
+	s.observeValidTime(v.ValidTimeStart)
+	if v.ValidTimeEnd != nil {
+		s.observeValidTime(*v.ValidTimeEnd)
+	}
+	s.ApproxBytes += ApproxVersionSize(v.Key, v.Value)
+}
+
+// Merge accumulates other into the stats.
+func (s *KeyStats) Merge(other *KeyStats) {
+	if other.Versions == 0 {
+		return
+	}
+	s.Versions += other.Versions
+	s.OpenVersions += other.OpenVersions
+	s.observeTxTime(other.EarliestTxTime)
+	s.observeTxTime(other.LatestTxTime)
+	s.observeValidTime(other.EarliestValidTime)
+	s.observeValidTime(other.LatestValidTime)
+	s.ApproxBytes += other.ApproxBytes
+}
+
+// AddKey adds the stats of a key and accumulates them into the total.
+func (s *Stats) AddKey(key string, ks *KeyStats) {
+	if s.PerKey == nil {
+		s.PerKey = map[string]*KeyStats{}
+	}
+	s.Keys++
+	s.PerKey[key] = ks
+	s.Total.Merge(ks)
+}
+
+// LargestKeys returns up to n keys with the most approximate bytes, largest first, to find the keys responsible for
+// store growth. Keys with equal sizes are ordered by key. All keys are returned if n is not positive.
+func (s *Stats) LargestKeys(n int) []string {
+	keys := make([]string, 0, len(s.PerKey))
+	for key := range s.PerKey {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := s.PerKey[keys[i]].ApproxBytes, s.PerKey[keys[j]].ApproxBytes
+		if a != b {
+			return a > b
+		}
+		return keys[i] < keys[j]
+	})
+	if n > 0 && n < len(keys) {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+func (s *KeyStats) observeTxTime(t time.Time) {
+	s.EarliestTxTime, s.LatestTxTime = widen(s.EarliestTxTime, s.LatestTxTime, t)
+}
+
+func (s *KeyStats) observeValidTime(t time.Time) {
+	s.EarliestValidTime, s.LatestValidTime = widen(s.EarliestValidTime, s.LatestValidTime, t)
+}
+
+// widen returns the range [earliest, latest] extended to include t. A zero range is empty.
+func widen(earliest, latest, t time.Time) (time.Time, time.Time) {
+	if earliest.IsZero() || t.Before(earliest) {
+		earliest = t
+	}
+	if latest.IsZero() || t.After(latest) {
+		latest = t
+	}
+	return earliest, latest
+}
+
+// versionOverhead approximates the bytes of a version other than its key and value: four times and their end pointers.
+const versionOverhead = 4*24 + 2*8
+
+// ApproxVersionSize approximates the bytes of a version with key and value. Strings and byte slices are counted by
+// length and other values by their JSON encoding. Values that cannot be encoded count as nothing.
+func ApproxVersionSize(key string, value Value) int64 {
+	return versionOverhead + int64(len(key)) + approxValueSize(value)
+}
+
+func approxValueSize(value Value) int64 {
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case string:
+		return int64(len(v))
+	case []byte:
+		return int64(len(v))
+	}
+	b, err := JSONCodec.Marshal(value)
+	if err != nil {
+		return 0
+	}
+	return int64(len(b))
+}
@@ -0,0 +1,57 @@
+package bitempura_test
+
+import (
+	"testing"
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/dbtest/tt"
+	"github.com/elh/bitempura/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadStats(t *testing.T) {
+	db, err := memory.NewDB(memory.WithVersionedKVs([]*VersionedKV{
+		{Key: "A", Value: "Old", TxTimeStart: tt.Day(1), TxTimeEnd: tt.DayPtr(2), ValidTimeStart: tt.Day(1)},
+		{Key: "A", Value: "Old", TxTimeStart: tt.Day(2), ValidTimeStart: tt.Day(1), ValidTimeEnd: tt.DayPtr(2)},
+		{Key: "A", Value: "New", TxTimeStart: tt.Day(2), ValidTimeStart: tt.Day(2)},
+		{Key: "B", Value: map[string]int{"n": 1}, TxTimeStart: tt.Day(3), ValidTimeStart: tt.Day(0)},
+	}))
+	require.Nil(t, err)
+
+	stats, err := ReadStats(db)
+	require.Nil(t, err)
+	assert.Equal(t, 2, stats.Keys)
+	assert.Equal(t, KeyStats{
+		Versions:          4,
+		OpenVersions:      3,
+		EarliestTxTime:    tt.Day(1),
+		LatestTxTime:      tt.Day(3),
+		EarliestValidTime: tt.Day(0),
+		LatestValidTime:   tt.Day(2),
+		ApproxBytes:       3*ApproxVersionSize("A", "Old") + ApproxVersionSize("B", `{"n":1}`),
+	}, stats.Total)
+	assert.Equal(t, 3, stats.PerKey["A"].Versions)
+	assert.Equal(t, 2, stats.PerKey["A"].OpenVersions)
+
+	// DBs that are not StatsReaders are read through their histories
+	fallback, err := ReadStats(struct {
+		DB
+		KeyLister
+	}{db, db})
+	require.Nil(t, err)
+	assert.Equal(t, stats, fallback)
+
+	_, err = ReadStats(&historyDB{})
+	assert.NotNil(t, err)
+}
+
+func TestLargestKeys(t *testing.T) {
+	stats := &Stats{}
+	stats.AddKey("A", &KeyStats{Versions: 1, ApproxBytes: 10})
+	stats.AddKey("B", &KeyStats{Versions: 5, ApproxBytes: 50})
+	stats.AddKey("C", &KeyStats{Versions: 1, ApproxBytes: 10})
+	assert.Equal(t, []string{"B", "A"}, stats.LargestKeys(2))
+	assert.Equal(t, []string{"B", "A", "C"}, stats.LargestKeys(0))
+	assert.Empty(t, (&Stats{}).LargestKeys(3))
+}
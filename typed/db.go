@@ -0,0 +1,176 @@
+package typed
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bt "github.com/elh/bitempura"
+)
+
+// VersionedKV is a bt.VersionedKV with a value of type V.
+type VersionedKV[V any] struct {
+	Key   string
+	Value V
+
+	TxTimeStart    time.Time  // inclusive
+	TxTimeEnd      *time.Time // exclusive
+	ValidTimeStart time.Time  // inclusive
+	ValidTimeEnd   *time.Time // exclusive
+
+	DecisionTime *time.Time `json:",omitempty"`
+}
+
+// Untyped returns the versioned key-value with its value as a bt.Value.
+func (kv *VersionedKV[V]) Untyped() *bt.VersionedKV {
+	return &bt.VersionedKV{
+		Key:            kv.Key,
+		Value:          kv.Value,
+		TxTimeStart:    kv.TxTimeStart,
+		TxTimeEnd:      kv.TxTimeEnd,
+		ValidTimeStart: kv.ValidTimeStart,
+		ValidTimeEnd:   kv.ValidTimeEnd,
+		DecisionTime:   kv.DecisionTime,
+	}
+}
+
+// DB is a DB with values of type V. Values are stored as is and read back with a type assertion. Values of other types,
+// such as the generic maps of a DB that decodes JSON, are converted to V through JSON. WithConversion overrides both.
+type DB[V any] struct {
+	db     bt.DB
+	encode func(V) (bt.Value, error)
+	decode func(bt.Value) (V, error)
+}
+
+// options is a struct for processing Opt's to be used by DB
+type options[V any] struct {
+	encode func(V) (bt.Value, error)
+	decode func(bt.Value) (V, error)
+}
+
+// Opt is an option for constructing a DB
+type Opt[V any] func(*options[V])
+
+// WithConversion configures how values are converted to the values stored in the underlying DB and back, e.g. to
+// store them in the map[string]interface{} rows of a sql.TableDB.
+func WithConversion[V any](encode func(V) (bt.Value, error), decode func(bt.Value) (V, error)) Opt[V] {
+	return func(os *options[V]) {
+		os.encode, os.decode = encode, decode
+	}
+}
+
+// Wrap returns a DB with values of type V over db.
+func Wrap[V any](db bt.DB, opts ...Opt[V]) *DB[V] {
+	options := &options[V]{
+		encode: func(v V) (bt.Value, error) { return v, nil },
+		decode: convert[V],
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return &DB[V]{db: db, encode: options.encode, decode: options.decode}
+}
+
+// Untyped returns the underlying DB.
+func (db *DB[V]) Untyped() bt.DB {
+	return db.db
+}
+
+// Get data by key (as of optional valid and transaction times).
+func (db *DB[V]) Get(key string, opts ...bt.ReadOpt) (*VersionedKV[V], error) {
+	kv, err := db.db.Get(key, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return db.typed(kv)
+}
+
+// GetValue returns the value of key (as of optional valid and transaction times).
+func (db *DB[V]) GetValue(key string, opts ...bt.ReadOpt) (V, error) {
+	kv, err := db.Get(key, opts...)
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	return kv.Value, nil
+}
+
+// List all data (as of optional valid and transaction times).
+func (db *DB[V]) List(opts ...bt.ReadOpt) ([]*VersionedKV[V], error) {
+	kvs, err := db.db.List(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return db.typedAll(kvs)
+}
+
+// Set stores value (with optional start and end valid time).
+func (db *DB[V]) Set(key string, value V, opts ...bt.WriteOpt) error {
+	stored, err := db.encode(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode value: %w", err)
+	}
+	return db.db.Set(key, stored, opts...)
+}
+
+// Delete removes value (with optional start and end valid time).
+func (db *DB[V]) Delete(key string, opts ...bt.WriteOpt) error {
+	return db.db.Delete(key, opts...)
+}
+
+// History returns versions by descending end transaction time, descending end valid time (filtered by optional valid
+// and transaction times).
+func (db *DB[V]) History(key string, opts ...bt.ReadOpt) ([]*VersionedKV[V], error) {
+	kvs, err := db.db.History(key, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return db.typedAll(kvs)
+}
+
+func (db *DB[V]) typed(kv *bt.VersionedKV) (*VersionedKV[V], error) {
+	value, err := db.decode(kv.Value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode value of key=%v: %w", kv.Key, err)
+	}
+	return &VersionedKV[V]{
+		Key:            kv.Key,
+		Value:          value,
+		TxTimeStart:    kv.TxTimeStart,
+		TxTimeEnd:      kv.TxTimeEnd,
+		ValidTimeStart: kv.ValidTimeStart,
+		ValidTimeEnd:   kv.ValidTimeEnd,
+		DecisionTime:   kv.DecisionTime,
+	}, nil
+}
+
+func (db *DB[V]) typedAll(kvs []*bt.VersionedKV) ([]*VersionedKV[V], error) {
+	out := make([]*VersionedKV[V], len(kvs))
+	for i, kv := range kvs {
+		typed, err := db.typed(kv)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = typed
+	}
+	return out, nil
+}
+
+// convert returns value as a V. A nil value is the zero V.
+func convert[V any](value bt.Value) (V, error) {
+	var v V
+	if value == nil {
+		return v, nil
+	}
+	if v, ok := value.(V); ok {
+		return v, nil
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return v, err
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return v, fmt.Errorf("%T is not convertible to %T: %w", value, v, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,94 @@
+package typed_test
+
+import (
+	"errors"
+	"testing"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/elh/bitempura/dbtest/tt"
+	"github.com/elh/bitempura/memory"
+	"github.com/elh/bitempura/typed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type balance struct {
+	Owner  string
+	Amount int
+}
+
+func TestDB(t *testing.T) {
+	c := clock.New(tt.Day(1))
+	mdb, err := memory.NewDB(memory.WithClock(c))
+	require.Nil(t, err)
+	db := typed.Wrap[balance](mdb)
+
+	require.Nil(t, db.Set("A", balance{Owner: "Alice", Amount: 10}))
+	require.Nil(t, c.SetNow(tt.Day(2)))
+	require.Nil(t, db.Set("A", balance{Owner: "Alice", Amount: 20}))
+	require.Nil(t, db.Set("B", balance{Owner: "Bob", Amount: 5}))
+
+	v, err := db.GetValue("A")
+	require.Nil(t, err)
+	assert.Equal(t, balance{Owner: "Alice", Amount: 20}, v)
+	kv, err := db.Get("A", bt.AsOfValidTime(tt.Day(1)))
+	require.Nil(t, err)
+	assert.Equal(t, 10, kv.Value.Amount)
+	assert.Equal(t, tt.Day(1), kv.ValidTimeStart)
+	assert.Equal(t, kv.Value, kv.Untyped().Value)
+
+	kvs, err := db.List()
+	require.Nil(t, err)
+	assert.Len(t, kvs, 2)
+	kvs, err = db.History("A")
+	require.Nil(t, err)
+	assert.Len(t, kvs, 3)
+
+	require.Nil(t, db.Delete("B"))
+	_, err = db.GetValue("B")
+	assert.ErrorIs(t, err, bt.ErrNotFound)
+	assert.Equal(t, mdb, db.Untyped())
+}
+
+func TestConversion(t *testing.T) {
+	t.Run("values of other types are converted through JSON", func(t *testing.T) {
+		mdb, err := memory.NewDB(memory.WithVersionedKVs([]*bt.VersionedKV{
+			{Key: "A", Value: map[string]interface{}{"Owner": "Alice", "Amount": 10.0}, TxTimeStart: tt.Day(1),
+				ValidTimeStart: tt.Day(1)},
+			{Key: "B", Value: "not a balance", TxTimeStart: tt.Day(1), ValidTimeStart: tt.Day(1)},
+		}))
+		require.Nil(t, err)
+		db := typed.Wrap[*balance](mdb)
+		v, err := db.GetValue("A")
+		require.Nil(t, err)
+		assert.Equal(t, &balance{Owner: "Alice", Amount: 10}, v)
+		_, err = db.GetValue("B")
+		assert.NotNil(t, err)
+		_, err = db.List()
+		assert.NotNil(t, err)
+	})
+	t.Run("custom conversion", func(t *testing.T) {
+		mdb, err := memory.NewDB()
+		require.Nil(t, err)
+		db := typed.Wrap(mdb, typed.WithConversion(
+			func(v int) (bt.Value, error) {
+				if v < 0 {
+					return nil, errors.New("negative")
+				}
+				return map[string]interface{}{"amount": v}, nil
+			},
+			func(stored bt.Value) (int, error) {
+				return stored.(map[string]interface{})["amount"].(int), nil
+			},
+		))
+		require.Nil(t, db.Set("A", 10))
+		assert.NotNil(t, db.Set("A", -1))
+		stored, err := mdb.Get("A")
+		require.Nil(t, err)
+		assert.Equal(t, map[string]interface{}{"amount": 10}, stored.Value)
+		v, err := db.GetValue("A")
+		require.Nil(t, err)
+		assert.Equal(t, 10, v)
+	})
+}
@@ -0,0 +1,3 @@
+// Package typed provides a DB wrapper whose values are statically typed, so reads return values of the wrapped type
+// instead of bitempura.Value. It is usable with any bitempura.DB.
+package typed
@@ -0,0 +1,3 @@
+// Package viz exports DB histories in the JSON format consumed by bitempura-viz
+// (https://github.com/elh/bitempura-viz) so any running application can be visualized.
+package viz
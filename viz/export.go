@@ -0,0 +1,188 @@
+package viz
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	bt "github.com/elh/bitempura"
+)
+
+// Output is the format consumed by bitempura-viz.
+type Output struct {
+	TestName    string
+	Passed      bool                         // true is test passed
+	Histories   map[string][]*bt.VersionedKV // key -> history
+	Description string                       // optional description. Markdown is supported.
+	Reads       []*Read                      `json:",omitempty"` // optional sequence of reads performed by the test
+}
+
+// Read is a read performed by a test and its result, so a visualization can show what was asked and why it held.
+type Read struct {
+	Op        string            // "Get" or "List"
+	Key       string            `json:",omitempty"` // empty for List
+	ValidTime *time.Time        // as of valid time. nil if "now"
+	TxTime    *time.Time        // as of transaction time. nil if "now"
+	Result    []*bt.VersionedKV // versions returned. empty if not found or on error
+	Err       string            `json:",omitempty"`
+}
+
+// Export reads the history of each key into an Output. Keys with no history have empty histories.
+func Export(db bt.DB, keys []string, description string, opts ...ExportOpt) (*Output, error) {
+	options := &exportOptions{
+		passed: true,
+	}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	histories, err := bt.Histories(db, keys)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if _, ok := histories[key]; !ok {
+			histories[key] = []*bt.VersionedKV{}
+		}
+	}
+	return &Output{
+		TestName:    options.name,
+		Passed:      options.passed,
+		Histories:   histories,
+		Description: description,
+		Reads:       options.reads,
+	}, nil
+}
+
+// ExportTo exports and writes the Output to a Sink.
+func ExportTo(sink Sink, db bt.DB, keys []string, description string, opts ...ExportOpt) error {
+	o, err := Export(db, keys, description, opts...)
+	if err != nil {
+		return err
+	}
+	return sink.Write(o)
+}
+
+// exportOptions is a struct for processing ExportOpt's to be used by Export
+type exportOptions struct {
+	name   string
+	passed bool
+	reads  []*Read
+}
+
+// ExportOpt is an option for Export
+type ExportOpt func(*exportOptions)
+
+// WithName sets the name of the Output. FileSink uses it as the file name.
+func WithName(name string) ExportOpt {
+	return func(os *exportOptions) {
+		os.name = name
+	}
+}
+
+// WithPassed sets whether the Output is marked as passed. The default is true.
+func WithPassed(passed bool) ExportOpt {
+	return func(os *exportOptions) {
+		os.passed = passed
+	}
+}
+
+// WithReads sets the reads included in the Output.
+func WithReads(reads []*Read) ExportOpt {
+	return func(os *exportOptions) {
+		os.reads = reads
+	}
+}
+
+// Sink writes Outputs somewhere.
+type Sink interface {
+	Write(o *Output) error
+}
+
+// SinkFunc is an adapter to allow the use of ordinary functions as Sinks.
+type SinkFunc func(o *Output) error
+
+// Write calls f(o).
+func (f SinkFunc) Write(o *Output) error {
+	return f(o)
+}
+
+var nonFileChars = regexp.MustCompile("[^a-zA-Z0-9]+")
+
+// FileSink writes each Output to <dir>/<name>.json with non-alphanumeric characters in the name replaced with "_".
+type FileSink struct {
+	Dir string
+}
+
+// Write writes the Output to a file. The directory is created if it does not exist.
+func (s *FileSink) Write(o *Output) error {
+	if o.TestName == "" {
+		return errors.New("output name is required for file sink")
+	}
+	b, err := json.MarshalIndent(o, "", "  ")
+	if err != nil {
+		return err
+	}
+	_ = os.Mkdir(s.Dir, 0777)
+	fileName := nonFileChars.ReplaceAllString(o.TestName, "_")
+	return os.WriteFile(filepath.Join(s.Dir, fileName+".json"), b, 0644)
+}
+
+// CombinedFileSink writes all Outputs written to it to a single file as a JSON array. The file is rewritten on every
+// write so it is always complete. Outputs are only combined within a CombinedFileSink, so concurrent processes must use
+// different paths.
+type CombinedFileSink struct {
+	Path string
+
+	m       sync.Mutex
+	outputs []*Output
+}
+
+// Write adds the Output to the file. The parent directory is created if it does not exist.
+func (s *CombinedFileSink) Write(o *Output) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.outputs = append(s.outputs, o)
+	b, err := json.MarshalIndent(s.outputs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0777); err != nil {
+		return err
+	}
+	return os.WriteFile(s.Path, b, 0644)
+}
+
+// HTTPSink POSTs each Output as JSON to a URL. If Client is nil, http.DefaultClient is used.
+type HTTPSink struct {
+	URL    string
+	Client *http.Client
+}
+
+// Write POSTs the Output.
+func (s *HTTPSink) Write(o *Output) error {
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	b, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(s.URL, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("sink returned status %v", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package viz_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/elh/bitempura/memory"
+	"github.com/elh/bitempura/viz"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport(t *testing.T) {
+	db, err := memory.NewDB()
+	require.Nil(t, err)
+	require.Nil(t, db.Set("A", "Old"))
+
+	o, err := viz.Export(db, []string{"A", "B"}, "desc", viz.WithName("my export"))
+	require.Nil(t, err)
+	assert.Equal(t, "my export", o.TestName)
+	assert.True(t, o.Passed)
+	assert.Equal(t, "desc", o.Description)
+	assert.Len(t, o.Histories["A"], 1)
+	assert.NotNil(t, o.Histories["B"])
+	assert.Len(t, o.Histories["B"], 0)
+	assert.Nil(t, o.Reads)
+
+	t.Run("reads", func(t *testing.T) {
+		reads := []*viz.Read{{Op: "Get", Key: "A"}}
+		o, err := viz.Export(db, []string{"A"}, "", viz.WithReads(reads))
+		require.Nil(t, err)
+		assert.Equal(t, reads, o.Reads)
+
+		// reads are omitted when not recorded so existing outputs do not change
+		b, err := json.Marshal(&viz.Output{})
+		require.Nil(t, err)
+		assert.NotContains(t, string(b), "Reads")
+	})
+
+	t.Run("file sink", func(t *testing.T) {
+		dir := t.TempDir()
+		require.Nil(t, viz.ExportTo(&viz.FileSink{Dir: dir}, db, []string{"A"}, "", viz.WithName("my export")))
+		b, err := os.ReadFile(filepath.Join(dir, "my_export.json"))
+		require.Nil(t, err)
+		var got viz.Output
+		require.Nil(t, json.Unmarshal(b, &got))
+		assert.Len(t, got.Histories["A"], 1)
+	})
+	t.Run("combined file sink", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "out", "all.json")
+		sink := &viz.CombinedFileSink{Path: path}
+		require.Nil(t, viz.ExportTo(sink, db, []string{"A"}, "", viz.WithName("first")))
+		require.Nil(t, viz.ExportTo(sink, db, []string{"A"}, "", viz.WithName("second")))
+		b, err := os.ReadFile(path)
+		require.Nil(t, err)
+		var got []*viz.Output
+		require.Nil(t, json.Unmarshal(b, &got))
+		require.Len(t, got, 2)
+		assert.Equal(t, "first", got[0].TestName)
+		assert.Equal(t, "second", got[1].TestName)
+	})
+	t.Run("http sink", func(t *testing.T) {
+		var got viz.Output
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Nil(t, json.NewDecoder(r.Body).Decode(&got))
+		}))
+		defer server.Close()
+		require.Nil(t, viz.ExportTo(&viz.HTTPSink{URL: server.URL}, db, []string{"A"}, "", viz.WithName("n")))
+		assert.Equal(t, "n", got.TestName)
+		assert.Len(t, got.Histories["A"], 1)
+	})
+}
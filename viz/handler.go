@@ -0,0 +1,60 @@
+package viz
+
+import (
+	_ "embed" // embed handler.html
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	bt "github.com/elh/bitempura"
+)
+
+//go:embed handler.html
+var handlerHTML []byte
+
+// Handler returns a http.Handler serving a page that renders key timelines live by polling the DB. Keys can be chosen
+// in the page. If none are chosen, all keys are rendered if the DB implements bt.KeyLister.
+//
+//	GET /               HTML page
+//	GET /output?key=    Output JSON for the keys
+func Handler(db bt.DB) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(handlerHTML)
+	})
+	mux.HandleFunc("/output", func(w http.ResponseWriter, r *http.Request) {
+		keys := r.URL.Query()["key"]
+		if len(keys) == 0 {
+			kl, ok := db.(bt.KeyLister)
+			if !ok {
+				writeError(w, http.StatusBadRequest, errors.New("key is required. db does not implement bt.KeyLister"))
+				return
+			}
+			var err error
+			if keys, err = kl.Keys(); err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+		}
+		o, err := Export(db, keys, "", WithName(strings.Join(keys, ", ")))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(o)
+	})
+	return mux
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,72 @@
+package viz_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elh/bitempura/memory"
+	"github.com/elh/bitempura/viz"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	db, err := memory.NewDB()
+	require.Nil(t, err)
+	require.Nil(t, db.Set("A", "Old"))
+	require.Nil(t, db.Set("B", "Old"))
+	server := httptest.NewServer(viz.Handler(db))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/")
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/html")
+
+	getOutput := func(query string) *viz.Output {
+		resp, err := http.Get(server.URL + "/output" + query)
+		require.Nil(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var o viz.Output
+		require.Nil(t, json.NewDecoder(resp.Body).Decode(&o))
+		return &o
+	}
+	assert.Len(t, getOutput("").Histories, 2)
+	o := getOutput("?key=B")
+	assert.Len(t, o.Histories, 1)
+	assert.Len(t, o.Histories["B"], 1)
+}
+
+func TestHandlerEscapesKeys(t *testing.T) {
+	key := `<img src=x onerror=alert(1)>`
+	db, err := memory.NewDB()
+	require.Nil(t, err)
+	require.Nil(t, db.Set(key, "Old"))
+	server := httptest.NewServer(viz.Handler(db))
+	defer server.Close()
+
+	// keys are only rendered as text by the page
+	resp, err := http.Get(server.URL + "/")
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	page, err := io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	assert.NotRegexp(t, `innerHTML\s*=\s*[^"\s]`, string(page))
+	assert.NotRegexp(t, `innerHTML\s*=\s*"[^"]`, string(page))
+	assert.Contains(t, string(page), "textContent = key")
+
+	resp, err = http.Get(server.URL + "/output")
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	assert.NotContains(t, string(body), "<img")
+	var o viz.Output
+	require.Nil(t, json.Unmarshal(body, &o))
+	assert.Len(t, o.Histories[key], 1)
+}
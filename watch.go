@@ -0,0 +1,57 @@
+package bitempura
+
+import "time"
+
+// ChangeOp is the type of write that produced a ChangeEvent.
+type ChangeOp string
+
+// Change ops
+const (
+	ChangeOpSet    ChangeOp = "set"
+	ChangeOpDelete ChangeOp = "delete"
+)
+
+// ChangeEvent describes the versions created and closed by a write to a key.
+type ChangeEvent struct {
+	Key     string
+	Op      ChangeOp
+	TxTime  time.Time      // transaction time of the write
+	Created []*VersionedKV // versions created by the write, including overhangs re-asserting old values
+	Closed  []*VersionedKV // versions whose transaction time was ended by the write
+}
+
+// CancelFunc stops a watch and closes its channel. Events that were not yet received are dropped.
+type CancelFunc func()
+
+// Watcher is implemented by DBs that can notify of writes to keys as they are made.
+type Watcher interface {
+	// Watch returns a channel of the ChangeEvents of writes to key that are not no-ops, in the order the writes are
+	// applied, and a function to stop watching. Events are queued for slow receivers, so writes do not wait on them
+	// and no events are dropped, but a receiver must keep up or cancel the watch.
+	Watch(key string, opts ...WatchOpt) (<-chan ChangeEvent, CancelFunc)
+}
+
+// WatchOptions is a struct for processing WatchOpt's specified by the watcher
+type WatchOptions struct {
+	Prefix bool // watch every key with key as a prefix. see WatchPrefix
+}
+
+// WatchOpt is an option for Watch
+type WatchOpt func(*WatchOptions)
+
+// WatchPrefix allows watcher to watch every key with the watched key as a prefix. Watch("", WatchPrefix()) watches
+// every key.
+func WatchPrefix() WatchOpt {
+	return func(os *WatchOptions) {
+		os.Prefix = true
+	}
+}
+
+// ApplyWatchOpts applies WatchOpt's to a WatchOptions struct for usage by the DB.
+func ApplyWatchOpts(opts []WatchOpt) *WatchOptions {
+	os := &WatchOptions{}
+	for _, opt := range opts {
+		opt(os)
+	}
+	return os
+}
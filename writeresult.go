@@ -0,0 +1,147 @@
+package bitempura
+
+import (
+	"errors"
+	"time"
+)
+
+// WriteResult describes the versions affected by a write.
+type WriteResult struct {
+	TxTime time.Time // transaction time of the write. zero if the write was a no-op
+	// Created is the version with the written value. It is nil for Delete and for writes that were no-ops.
+	Created *VersionedKV
+	// Closed are the versions whose transaction time was ended by the write.
+	Closed []*VersionedKV
+	// Overhangs are the versions re-asserting the values of closed versions outside of the write's valid time range.
+	Overhangs []*VersionedKV
+}
+
+// ResultWriter is implemented by DBs that can describe the versions affected by a write as it is made.
+type ResultWriter interface {
+	// SetWithResult stores value (with optional start and end valid time) and returns the affected versions.
+	SetWithResult(key string, value Value, opts ...WriteOpt) (*WriteResult, error)
+	// DeleteWithResult removes value (with optional start and end valid time) and returns the affected versions.
+	DeleteWithResult(key string, opts ...WriteOpt) (*WriteResult, error)
+}
+
+// SetWithResult stores value (with optional start and end valid time) and returns the affected versions. If db is a
+// ResultWriter, the result is returned by the write. Otherwise, it is found by comparing the key's history before and
+// after the write, which is not atomic with concurrent writes to key.
+func SetWithResult(db DB, key string, value Value, opts ...WriteOpt) (*WriteResult, error) {
+	if rw, ok := db.(ResultWriter); ok {
+		return rw.SetWithResult(key, value, opts...)
+	}
+	return writeWithResult(db, key, false, opts, func() error { return db.Set(key, value, opts...) })
+}
+
+// DeleteWithResult removes value (with optional start and end valid time) and returns the affected versions. See
+// SetWithResult.
+func DeleteWithResult(db DB, key string, opts ...WriteOpt) (*WriteResult, error) {
+	if rw, ok := db.(ResultWriter); ok {
+		return rw.DeleteWithResult(key, opts...)
+	}
+	return writeWithResult(db, key, true, opts, func() error { return db.Delete(key, opts...) })
+}
+
+func writeWithResult(db DB, key string, isDelete bool, opts []WriteOpt, write func() error) (*WriteResult, error) {
+	before, err := historyOrNone(db, key)
+	if err != nil {
+		return nil, err
+	}
+	// record state before the write since implementations may mutate versions in place
+	counts := countVersions(before)
+	if err := write(); err != nil {
+		return nil, err
+	}
+	after, err := historyOrNone(db, key)
+	if err != nil {
+		return nil, err
+	}
+
+	validTime := ApplyWriteOpts(opts).ValidTime
+	result := &WriteResult{}
+	created, closed := counts.diff(after)
+	for _, v := range closed {
+		result.TxTime = *v.TxTimeEnd
+		result.Closed = append(result.Closed, v)
+	}
+	for _, v := range created {
+		result.TxTime = v.TxTimeStart
+		// the written version starts at the write's valid time, which defaults to its transaction time
+		if !isDelete && result.Created == nil &&
+			((validTime != nil && v.ValidTimeStart.Equal(*validTime)) ||
+				(validTime == nil && v.ValidTimeStart.Equal(v.TxTimeStart))) {
+			result.Created = v
+		} else {
+			result.Overhangs = append(result.Overhangs, v)
+		}
+	}
+	return result, nil
+}
+
+// versionID identifies a version by its times. Versions written at the same transaction time as the versions they
+// close can share start times with them, so end times are included.
+type versionID struct {
+	txTimeStart, txTimeEnd, validTimeStart, validTimeEnd time.Time
+	txTimeEnded, validTimeEnded                          bool
+}
+
+func idOf(v *VersionedKV) versionID {
+	id := versionID{txTimeStart: v.TxTimeStart.UTC(), validTimeStart: v.ValidTimeStart.UTC()}
+	if v.TxTimeEnd != nil {
+		id.txTimeEnd, id.txTimeEnded = v.TxTimeEnd.UTC(), true
+	}
+	if v.ValidTimeEnd != nil {
+		id.validTimeEnd, id.validTimeEnded = v.ValidTimeEnd.UTC(), true
+	}
+	return id
+}
+
+// versionCounts counts a key's versions by id.
+type versionCounts map[versionID]int
+
+func countVersions(vs []*VersionedKV) versionCounts {
+	counts := versionCounts{}
+	for _, v := range vs {
+		counts[idOf(v)]++
+	}
+	return counts
+}
+
+// diff returns copies of the versions of after that were created or closed since the versions were counted.
+func (counts versionCounts) diff(after []*VersionedKV) (created, closed []*VersionedKV) {
+	// match versions with transaction time ends first so a version created with the start times of a version it closed
+	// is not mistaken for the closed one
+	for _, ended := range []bool{true, false} {
+		for _, v := range after {
+			if (v.TxTimeEnd != nil) != ended {
+				continue
+			}
+			id := idOf(v)
+			if counts[id] > 0 {
+				counts[id]--
+				continue
+			}
+			cp := *v
+			if ended {
+				openID := id
+				openID.txTimeEnd, openID.txTimeEnded = time.Time{}, false
+				if counts[openID] > 0 {
+					counts[openID]--
+					closed = append(closed, &cp)
+					continue
+				}
+			}
+			created = append(created, &cp)
+		}
+	}
+	return created, closed
+}
+
+func historyOrNone(db DB, key string) ([]*VersionedKV, error) {
+	vs, err := db.History(key)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	return vs, err
+}
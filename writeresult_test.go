@@ -0,0 +1,75 @@
+package bitempura_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/elh/bitempura/dbtest/tt"
+	"github.com/elh/bitempura/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteResult(t *testing.T) {
+	for _, tC := range []struct {
+		desc string
+		wrap func(db *memory.DB) DB
+	}{
+		{desc: "ResultWriter", wrap: func(db *memory.DB) DB { return db }},
+		{desc: "history fallback", wrap: func(db *memory.DB) DB { return struct{ DB }{db} }},
+	} {
+		t.Run(tC.desc, func(t *testing.T) {
+			c := clock.New(tt.Day(1))
+			mdb, err := memory.NewDB(memory.WithClock(c))
+			require.Nil(t, err)
+			db := tC.wrap(mdb)
+
+			res, err := SetWithResult(db, "A", "Old")
+			require.Nil(t, err)
+			assert.True(t, res.TxTime.Equal(tt.Day(1)))
+			require.NotNil(t, res.Created)
+			assert.Equal(t, "Old", res.Created.Value)
+			assert.Empty(t, res.Closed)
+			assert.Empty(t, res.Overhangs)
+
+			// a correction closes the old version and re-asserts it before and after
+			require.Nil(t, c.SetNow(tt.Day(4)))
+			res, err = SetWithResult(db, "A", "New", WithValidTime(tt.Day(2)), WithEndValidTime(tt.Day(3)))
+			require.Nil(t, err)
+			assert.True(t, res.TxTime.Equal(tt.Day(4)))
+			require.NotNil(t, res.Created)
+			assert.Equal(t, "New", res.Created.Value)
+			assert.True(t, res.Created.ValidTimeStart.Equal(tt.Day(2)))
+			require.Len(t, res.Closed, 1)
+			assert.True(t, res.Closed[0].TxTimeEnd.Equal(tt.Day(4)))
+			require.Len(t, res.Overhangs, 2)
+			for _, v := range res.Overhangs {
+				assert.Equal(t, "Old", v.Value)
+			}
+
+			require.Nil(t, c.SetNow(tt.Day(4).Add(time.Hour)))
+			res, err = DeleteWithResult(db, "A", WithValidTime(tt.Day(3)))
+			require.Nil(t, err)
+			assert.Nil(t, res.Created)
+			assert.Len(t, res.Closed, 1)
+			assert.Empty(t, res.Overhangs)
+
+			// no-op
+			res, err = DeleteWithResult(db, "B")
+			require.Nil(t, err)
+			assert.Equal(t, &WriteResult{}, res)
+
+			// a write at the transaction time of the version it closes
+			require.Nil(t, db.Set("C", "Old"))
+			res, err = SetWithResult(db, "C", "New")
+			require.Nil(t, err)
+			require.NotNil(t, res.Created)
+			assert.Equal(t, "New", res.Created.Value)
+			require.Len(t, res.Closed, 1)
+			assert.Equal(t, "Old", res.Closed[0].Value)
+			assert.Empty(t, res.Overhangs)
+		})
+	}
+}
@@ -0,0 +1,3 @@
+// Package xtdbimport replays an XTDB transaction log export into a bitempura.DB with faithful valid and transaction
+// times. See https://docs.xtdb.com/clients/http/ for the JSON tx-log format.
+package xtdbimport
@@ -0,0 +1,131 @@
+package xtdbimport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+)
+
+// Tx is a single transaction from an XTDB tx-log export (GET /_xtdb/tx-log?with-ops=true as JSON).
+type Tx struct {
+	TxID   int64             `json:"xtdb.api/tx-id"`
+	TxTime time.Time         `json:"xtdb.api/tx-time"`
+	TxOps  []json.RawMessage `json:"xtdb.api/tx-ops"`
+}
+
+// idAttr is the XTDB document id attribute.
+const idAttr = "xt/id"
+
+// ReadTxLog decodes a JSON array of transactions.
+func ReadTxLog(r io.Reader) ([]*Tx, error) {
+	var txs []*Tx
+	if err := json.NewDecoder(r).Decode(&txs); err != nil {
+		return nil, fmt.Errorf("failed to decode tx log: %v", err)
+	}
+	return txs, nil
+}
+
+// Import replays a transaction log into db. clock must be the clock of the DB. The clock is set to each transaction's
+// tx-time before its ops are applied so transaction times are preserved and valid times default to the tx-time as in
+// XTDB. put and delete ops are supported. Keys are document ids formatted as strings and values are documents without
+// the id. It returns the number of transactions applied.
+func Import(r io.Reader, db bt.DB, clock clock.Settable) (int, error) {
+	txs, err := ReadTxLog(r)
+	if err != nil {
+		return 0, err
+	}
+	for i, tx := range txs {
+		if err := Apply(db, clock, tx); err != nil {
+			return i, err
+		}
+	}
+	return len(txs), nil
+}
+
+// Apply applies a single transaction to db.
+func Apply(db bt.DB, clock clock.Settable, tx *Tx) error {
+	if err := clock.SetNow(tx.TxTime); err != nil {
+		return fmt.Errorf("tx %v: %v", tx.TxID, err)
+	}
+	for _, raw := range tx.TxOps {
+		if err := applyOp(db, raw); err != nil {
+			return fmt.Errorf("tx %v: %v", tx.TxID, err)
+		}
+	}
+	return nil
+}
+
+func applyOp(db bt.DB, raw json.RawMessage) error {
+	var op []json.RawMessage
+	if err := json.Unmarshal(raw, &op); err != nil {
+		return fmt.Errorf("failed to decode op: %v", err)
+	}
+	if len(op) < 2 {
+		return errors.New("op must have a type and argument")
+	}
+	var opType string
+	if err := json.Unmarshal(op[0], &opType); err != nil {
+		return fmt.Errorf("failed to decode op type: %v", err)
+	}
+	writeOpts, err := validTimes(op[2:])
+	if err != nil {
+		return err
+	}
+
+	switch opType {
+	case "put":
+		var doc map[string]interface{}
+		if err := json.Unmarshal(op[1], &doc); err != nil {
+			return fmt.Errorf("failed to decode put document: %v", err)
+		}
+		id, ok := doc[idAttr]
+		if !ok {
+			return fmt.Errorf("put document missing %v", idAttr)
+		}
+		delete(doc, idAttr)
+		return db.Set(idKey(id), doc, writeOpts...)
+	case "delete":
+		var id interface{}
+		if err := json.Unmarshal(op[1], &id); err != nil {
+			return fmt.Errorf("failed to decode delete id: %v", err)
+		}
+		return db.Delete(idKey(id), writeOpts...)
+	default:
+		return fmt.Errorf("unsupported op type: %v", opType)
+	}
+}
+
+// validTimes parses the optional valid time start and end of an op.
+func validTimes(raws []json.RawMessage) ([]bt.WriteOpt, error) {
+	var opts []bt.WriteOpt
+	for i, raw := range raws {
+		if i > 1 {
+			return nil, errors.New("op has too many arguments")
+		}
+		var t *time.Time
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return nil, fmt.Errorf("failed to decode valid time: %v", err)
+		}
+		if t == nil {
+			continue
+		}
+		if i == 0 {
+			opts = append(opts, bt.WithValidTime(*t))
+		} else {
+			opts = append(opts, bt.WithEndValidTime(*t))
+		}
+	}
+	return opts, nil
+}
+
+func idKey(id interface{}) string {
+	if s, ok := id.(string); ok {
+		return s
+	}
+	return fmt.Sprint(id)
+}
@@ -0,0 +1,76 @@
+package xtdbimport_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	bt "github.com/elh/bitempura"
+	"github.com/elh/bitempura/clock"
+	"github.com/elh/bitempura/memory"
+	"github.com/elh/bitempura/xtdbimport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// a subset of the XTDB crime investigation example. see memory.TestTXDBCrimeInvestigationExample
+const txLog = `[
+	{"xtdb.api/tx-id": 0, "xtdb.api/tx-time": "2018-12-31T00:00:00Z", "xtdb.api/tx-ops": [
+		["put", {"xt/id": "p2", "entry-pt": "SFO"}],
+		["put", {"xt/id": "p3", "entry-pt": "LA"}]
+	]},
+	{"xtdb.api/tx-id": 1, "xtdb.api/tx-time": "2019-01-03T00:00:00Z", "xtdb.api/tx-ops": [
+		["put", {"xt/id": "p4", "entry-pt": "NY"}, "2019-01-02T00:00:00Z"]
+	]},
+	{"xtdb.api/tx-id": 2, "xtdb.api/tx-time": "2019-01-04T00:00:00Z", "xtdb.api/tx-ops": [
+		["put", {"xt/id": "p2", "entry-pt": "SFO", "departure": true}, "2019-01-01T00:00:00Z", "2019-01-02T00:00:00Z"],
+		["delete", "p3"]
+	]}
+]`
+
+func day(s string) time.Time {
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestImport(t *testing.T) {
+	clock := &clock.Clock{}
+	db, err := memory.NewDB(memory.WithClock(clock))
+	require.Nil(t, err)
+
+	n, err := xtdbimport.Import(strings.NewReader(txLog), db, clock)
+	require.Nil(t, err)
+	assert.Equal(t, 3, n)
+
+	kv, err := db.Get("p4", bt.AsOfValidTime(day("2019-01-02")))
+	require.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"entry-pt": "NY"}, kv.Value)
+	assert.Equal(t, day("2019-01-03"), kv.TxTimeStart)
+
+	kv, err = db.Get("p2", bt.AsOfValidTime(day("2019-01-01")))
+	require.Nil(t, err)
+	assert.Equal(t, true, kv.Value.(map[string]interface{})["departure"])
+	kv, err = db.Get("p2", bt.AsOfValidTime(day("2019-01-01")), bt.AsOfTransactionTime(day("2019-01-03")))
+	require.Nil(t, err)
+	assert.Nil(t, kv.Value.(map[string]interface{})["departure"])
+
+	_, err = db.Get("p3")
+	require.ErrorIs(t, err, bt.ErrNotFound)
+	_, err = db.Get("p3", bt.AsOfTransactionTime(day("2019-01-03")))
+	require.Nil(t, err)
+}
+
+func TestImport_UnsupportedOp(t *testing.T) {
+	clock := &clock.Clock{}
+	db, err := memory.NewDB(memory.WithClock(clock))
+	require.Nil(t, err)
+
+	n, err := xtdbimport.Import(strings.NewReader(`[
+		{"xtdb.api/tx-id": 0, "xtdb.api/tx-time": "2018-12-31T00:00:00Z", "xtdb.api/tx-ops": [["evict", "p2"]]}
+	]`), db, clock)
+	require.NotNil(t, err)
+	assert.Equal(t, 0, n)
+}